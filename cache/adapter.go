@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// adminGroup forwards Admin operations to the caches of a wrapper
+//
+// found with AsAdmin, skipping caches without them, and sums their results
+type adminGroup []Cache
+
+// batchCacheAdapter wraps a Cache without native batching to satisfy
+//
+// BatchCache, looping over single key operations
+type batchCacheAdapter struct {
+	CacheV2
+}
+
+// cacheV2Adapter wraps a plain Cache to satisfy CacheV2
+type cacheV2Adapter struct {
+	Cache
+}
+
+// readOnlyCache restricts an ActiveCache to ReadOnlyCache
+type readOnlyCache struct {
+	cache *ActiveCache
+}
+
+var _ ReadOnlyCache = (*readOnlyCache)(nil)
+
+var _ BatchCache = (*batchCacheAdapter)(nil)
+
+// AsCacheV2 returns `c` as CacheV2.
+//
+// If `c` does not implement CacheV2, it is wrapped in an adapter
+// whose GetOK approximates ok from value != nil
+func AsCacheV2(c Cache) CacheV2 {
+	if v2, ok := c.(CacheV2); ok {
+		return v2
+	}
+
+	return &cacheV2Adapter{Cache: c}
+}
+
+// AsAdmin returns the Admin operations of `c` and whether they were found.
+//
+// If `c` does not implement Admin, the chain of wrappers is walked through
+// their `Unwrap() Cache` method until a Cache implementing Admin is found
+func AsAdmin(c Cache) (Admin, bool) {
+	for c != nil {
+		if admin, ok := c.(Admin); ok {
+			return admin, true
+		}
+
+		wrapper, ok := c.(interface{ Unwrap() Cache })
+		if !ok {
+			return nil, false
+		}
+		c = wrapper.Unwrap()
+	}
+
+	return nil, false
+}
+
+// AsBatchCache returns `c` as BatchCache.
+//
+// If `c` does not implement BatchCache, it is wrapped in an adapter looping
+// over single key operations, found through CacheV2 like AsCacheV2
+func AsBatchCache(c Cache) BatchCache {
+	if batch, ok := c.(BatchCache); ok {
+		return batch
+	}
+
+	return &batchCacheAdapter{CacheV2: AsCacheV2(c)}
+}
+
+// CleanNow runs a clean cycle of every cache
+func (g adminGroup) CleanNow() {
+	for _, c := range g {
+		if admin, ok := AsAdmin(c); ok {
+			admin.CleanNow()
+		}
+	}
+}
+
+// Close closes every cache and returns their errors joined
+func (g adminGroup) Close() error {
+	var errs []error
+	for _, c := range g {
+		if admin, ok := AsAdmin(c); ok {
+			errs = append(errs, admin.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Flush removes every entry of every cache
+func (g adminGroup) Flush() {
+	for _, c := range g {
+		if admin, ok := AsAdmin(c); ok {
+			admin.Flush()
+		}
+	}
+}
+
+// Len returns the sum of the amount of entries stored by every cache
+func (g adminGroup) Len() int {
+	var length int
+	for _, c := range g {
+		if admin, ok := AsAdmin(c); ok {
+			length += admin.Len()
+		}
+	}
+
+	return length
+}
+
+// Stats returns the sum of the metrics of every cache
+func (g adminGroup) Stats() Stats {
+	var stats Stats
+	for _, c := range g {
+		if admin, ok := AsAdmin(c); ok {
+			stats = stats.add(admin.Stats())
+		}
+	}
+
+	return stats
+}
+
+// DeleteMulti removes every key of `keys` with Delete,
+//
+// skipping nil keys, and returns the amount of keys found
+func (a *batchCacheAdapter) DeleteMulti(keys [][]byte) int {
+	deleted := 0
+	for _, key := range keys {
+		if key != nil && a.Delete(key) {
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// GetMulti reads every key of `keys` with GetOK, in order
+func (a *batchCacheAdapter) GetMulti(keys [][]byte) []BatchResult {
+	results := make([]BatchResult, len(keys))
+	for i, key := range keys {
+		if key == nil {
+			continue
+		}
+
+		if value, ttl, ok := a.GetOK(key); ok {
+			results[i] = BatchResult{Value: value, TTL: ttl, Found: true}
+		}
+	}
+
+	return results
+}
+
+// SetMulti writes every item of `items` with Set, in order.
+//
+// Set reports no errors, so only nil keys fail
+func (a *batchCacheAdapter) SetMulti(items []Item) []SetResult {
+	results := make([]SetResult, len(items))
+	for i, item := range items {
+		results[i].Key = item.Key
+		if item.Key == nil {
+			results[i].Err = ErrNilKey
+			continue
+		}
+
+		a.Set(item.Key, item.Value, item.TTL)
+	}
+
+	return results
+}
+
+// Unwrap returns the wrapped Cache
+func (a *batchCacheAdapter) Unwrap() Cache {
+	return a.CacheV2
+}
+
+// GetOK returns the value stored using `key` and reports ok when value is not nil.
+//
+// Empty values stored as nil cannot be told apart from a miss
+func (a *cacheV2Adapter) GetOK(key []byte) ([]byte, time.Duration, bool) {
+	value, ttl := a.Get(key)
+	return value, ttl, value != nil
+}
+
+// Unwrap returns the wrapped Cache
+func (a *cacheV2Adapter) Unwrap() Cache {
+	return a.Cache
+}
+
+// Get returns Value and TTL from specified key, see ActiveCache.Get
+func (r *readOnlyCache) Get(key []byte) ([]byte, time.Duration) {
+	return r.cache.Get(key)
+}
+
+// Has reports whether key is stored and not expired, see ActiveCache.Has
+func (r *readOnlyCache) Has(key []byte) bool {
+	return r.cache.Has(key)
+}
+
+// Keys returns copies of every live key, see ActiveCache.Keys
+func (r *readOnlyCache) Keys() [][]byte {
+	return r.cache.Keys()
+}
+
+// Len returns the amount of stored entries, see ActiveCache.Len
+func (r *readOnlyCache) Len() int {
+	return r.cache.Len()
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAsAdmin(t *testing.T) {
+	// Setup
+	activeCache := NewActiveCache()
+	defer activeCache.Close()
+	activeCache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// two layers of wrapping: CacheV2 adapter over a TieredCache over the ActiveCache
+	tiered := NewTieredCache(activeCache, newFakeStore(), time.Minute)
+	wrapped := AsCacheV2(tiered)
+	if _, ok := wrapped.(*cacheV2Adapter); !ok {
+		t.Fatalf("TieredCache should be wrapped by the CacheV2 adapter but got %T", wrapped)
+	}
+
+	// Test
+	admin, ok := AsAdmin(wrapped)
+	if !ok || admin != Admin(tiered) {
+		t.Fatalf("wrong value for AsAdmin() through the adapter. Expected %p but got %v", tiered, admin)
+	}
+
+	if admin.Len() != 1 {
+		t.Errorf("wrong value for Admin.Len(). Expected 1 but got %v", admin.Len())
+	}
+
+	admin.Flush()
+	if value, _ := wrapped.Get([]byte("missing")); value != nil || activeCache.Len() != 0 {
+		t.Errorf("Admin.Flush() should empty the unwrapped cache but got %v entries", activeCache.Len())
+	}
+
+	if admin, ok := AsAdmin(struct{ Cache }{activeCache}); ok || admin != nil {
+		t.Errorf("wrong value for AsAdmin() without Unwrap. Expected (nil, false) but got (%v, %v)", admin, ok)
+	}
+
+	if admin, ok := AsAdmin(nil); ok || admin != nil {
+		t.Errorf("wrong value for AsAdmin(nil). Expected (nil, false) but got (%v, %v)", admin, ok)
+	}
+}
+
+// testBatchCache runs the BatchCache suite against an empty `c`
+func testBatchCache(t *testing.T, c BatchCache) {
+	t.Helper()
+
+	// Test SetMulti
+	results := c.SetMulti([]Item{
+		{Key: []byte("lorem"), Value: []byte("ipsum")},
+		{Key: nil, Value: []byte("nil")},
+		{Key: []byte("john"), Value: []byte("doe"), TTL: time.Minute},
+	})
+	expectedErrs := []error{nil, ErrNilKey, nil}
+	for i, result := range results {
+		if result.Err != expectedErrs[i] {
+			t.Errorf("wrong value for SetMulti() result %v. Expected %v but got %v", i, expectedErrs[i], result.Err)
+		}
+	}
+
+	// Test GetMulti keeps key order and reports misses as not found
+	keys := [][]byte{[]byte("john"), nil, []byte("missing"), []byte("lorem")}
+	expected := []BatchResult{
+		{Value: []byte("doe"), TTL: time.Minute, Found: true},
+		{},
+		{},
+		{Value: []byte("ipsum"), TTL: NoExpiration, Found: true},
+	}
+	if got := c.GetMulti(keys); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong value for GetMulti(). Expected %v but got %v", expected, got)
+	}
+
+	// Test DeleteMulti counts each removed key once
+	if deleted := c.DeleteMulti([][]byte{[]byte("lorem"), nil, []byte("lorem"), []byte("missing")}); deleted != 1 {
+		t.Errorf("wrong value for DeleteMulti(). Expected 1 but got %v", deleted)
+	}
+
+	got := c.GetMulti([][]byte{[]byte("lorem"), []byte("john")})
+	if got[0].Found || !got[1].Found {
+		t.Errorf("wrong value for GetMulti() after DeleteMulti(). Expected [false true] but got [%v %v]", got[0].Found, got[1].Found)
+	}
+}
+
+func TestAsBatchCache(t *testing.T) {
+	// Setup
+	native := NewActiveCache()
+	native.StopCleaner()
+	plain := NewActiveCache()
+	plain.StopCleaner()
+
+	// Test
+	if batch := AsBatchCache(native); batch != BatchCache(native) {
+		t.Errorf("wrong value for AsBatchCache() of an ActiveCache. Expected the cache itself but got %T", batch)
+	}
+
+	fallback := AsBatchCache(struct{ Cache }{plain})
+	adapter, ok := fallback.(*batchCacheAdapter)
+	if !ok {
+		t.Fatalf("plain Cache should be wrapped by the BatchCache adapter but got %T", fallback)
+	}
+
+	if _, ok := adapter.Unwrap().(*cacheV2Adapter); !ok {
+		t.Errorf("wrong value for batchCacheAdapter.Unwrap(). Expected the CacheV2 adapter but got %T", adapter.Unwrap())
+	}
+
+	t.Run("native", func(t *testing.T) { testBatchCache(t, native) })
+	t.Run("fallback", func(t *testing.T) { testBatchCache(t, fallback) })
+}
+
+func TestAsCacheV2(t *testing.T) {
+	// Setup
+	activeCache := NewActiveCache()
+	activeCache.StopCleaner()
+	activeCache.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+	activeCache.Set([]byte("empty"), []byte{}, NoExpiration)
+
+	// Test
+	if v2 := AsCacheV2(activeCache); v2 != CacheV2(activeCache) {
+		t.Error("AsCacheV2() should return ActiveCache itself as it implements CacheV2")
+	}
+
+	plain := struct{ Cache }{activeCache} // hides GetOK
+	v2 := AsCacheV2(plain)
+	if _, ok := v2.(*cacheV2Adapter); !ok {
+		t.Fatalf("AsCacheV2() should wrap a plain Cache but got %T", v2)
+	}
+
+	type testCase struct {
+		key         []byte
+		expectedVal []byte
+		expectedOk  bool
+	}
+
+	testsCase := []testCase{
+		{key: []byte("lorem"), expectedVal: []byte("ipsum"), expectedOk: true},
+		{key: []byte("empty"), expectedVal: []byte{}, expectedOk: true},
+		{key: []byte("nonexistent key"), expectedVal: nil, expectedOk: false},
+		{key: nil, expectedVal: nil, expectedOk: false},
+	}
+
+	for _, tc := range testsCase {
+		val, ttl, ok := v2.GetOK(tc.key)
+		if ok != tc.expectedOk || !bytes.Equal(tc.expectedVal, val) || ttl != NoExpiration {
+			t.Errorf(
+				"wrong value for adapter GetOK(%s). Expected (%s, %v, %v) but got (%s, %v, %v)",
+				tc.key,
+				tc.expectedVal,
+				time.Duration(NoExpiration),
+				tc.expectedOk,
+				val,
+				ttl,
+				ok,
+			)
+		}
+	}
+}
+
+func TestCacheV2Adapter_Unwrap(t *testing.T) {
+	// Setup
+	plain := struct{ Cache }{NewActiveCache()}
+	defer plain.Cache.(*ActiveCache).Close()
+
+	// Test
+	if inner := AsCacheV2(plain).(*cacheV2Adapter).Unwrap(); inner != Cache(plain) {
+		t.Errorf("wrong value for Unwrap(). Expected %v but got %v", plain, inner)
+	}
+}
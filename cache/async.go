@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"bytes"
+	"time"
+)
+
+// An asyncOp represents a write queued by SetAsync, or a FlushWrites
+//
+// barrier closing `flushed` once every write queued before it is applied
+type asyncOp struct {
+	key     []byte
+	value   []byte
+	ttl     time.Duration
+	flushed chan struct{}
+
+	// Entry the write stored once applied, see writeThrough
+	entry *cacheEntry
+}
+
+// applyAsync applies `batch` under a single lock acquisition, in order,
+//
+// then propagates the applied writes to `Config.Backing`
+func (c *ActiveCache) applyAsync(batch []asyncOp) {
+	if len(batch) == 0 {
+		return
+	}
+
+	applied := 0
+	c.lock("set")
+	for _, op := range batch {
+		if c.setEntry(op.key, op.value, op.ttl, setOptions{}) == nil {
+			op.entry, _ = c.entries.Get(op.key)
+			batch[applied] = op
+			applied++
+		}
+	}
+	c.unlock()
+
+	// Backing is never called while holding the lock
+	for _, op := range batch[:applied] {
+		c.writeThrough(op.key, op.value, op.ttl, op.entry)
+	}
+}
+
+// collectAsync appends to `batch` the writes queued after `first` until
+//
+// the batch is full, `Config.AsyncFlushInterval` elapsed since `first`, a
+// FlushWrites barrier arrives or the queue is closed. Returns the batch, the
+// barrier if any and whether the queue was closed
+func (c *ActiveCache) collectAsync(queue <-chan asyncOp, first asyncOp, batch []asyncOp) ([]asyncOp, chan struct{}, bool) {
+	conf := c.config.Load()
+	batch = append(batch, first)
+
+	deadline := time.NewTimer(conf.AsyncFlushInterval)
+	defer deadline.Stop()
+
+	for len(batch) < conf.AsyncBatchSize {
+		select {
+		case op, ok := <-queue:
+			if !ok {
+				return batch, nil, true
+			}
+
+			if op.flushed != nil {
+				return batch, op.flushed, false
+			}
+			batch = append(batch, op)
+		case <-deadline.C:
+			return batch, nil, false
+		}
+	}
+
+	return batch, nil, false
+}
+
+// flushAsync closes the SetAsync queue and waits until every queued
+//
+// write was applied. Later SetAsync calls fall back to Set
+func (c *ActiveCache) flushAsync() {
+	c.asyncMtx.Lock()
+	if c.asyncClosed {
+		c.asyncMtx.Unlock()
+		return
+	}
+
+	c.asyncClosed = true
+	queue, done := c.asyncQueue, c.asyncDone
+	c.asyncMtx.Unlock()
+
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+}
+
+// FlushWrites blocks until every write queued by SetAsync before the call
+//
+// is applied, so the caller reads its own writes. Writes queued by other
+// goroutines meanwhile may be applied too. Returns at once if nothing was
+// ever queued or after Close
+func (c *ActiveCache) FlushWrites() {
+	c.asyncMtx.RLock()
+	if c.asyncClosed || c.asyncQueue == nil {
+		c.asyncMtx.RUnlock()
+		return
+	}
+
+	// The barrier waits for room even when full queues drop writes
+	flushed := make(chan struct{})
+	c.asyncQueue <- asyncOp{flushed: flushed}
+	c.asyncMtx.RUnlock()
+
+	<-flushed
+}
+
+// runAsync applies the writes of `queue` in batches until it is closed
+//
+// and drained, then closes `done`
+func (c *ActiveCache) runAsync(queue <-chan asyncOp, done chan<- struct{}) {
+	defer close(done)
+
+	var batch []asyncOp
+	for first := range queue {
+		if first.flushed != nil {
+			close(first.flushed)
+			continue
+		}
+
+		var flushed chan struct{}
+		var closed bool
+		batch, flushed, closed = c.collectAsync(queue, first, batch[:0])
+		c.applyAsync(batch)
+
+		if flushed != nil {
+			close(flushed)
+		}
+
+		if closed {
+			return
+		}
+	}
+}
+
+// SetAsync queues a write of Value for specified Key with TTL like Set
+//
+// and returns without waiting for the cache lock. A background worker applies
+// queued writes in order, in batches of up to `Config.AsyncBatchSize` under a
+// single lock acquisition, so writes of the same key keep their order.
+//
+// Writes become visible once their batch is applied, up to
+// `Config.AsyncFlushInterval` later or at once after FlushWrites. When
+// `Config.AsyncQueueSize` writes are pending SetAsync blocks, or drops the
+// write if `Config.AsyncDropWhenFull` is set, see Stats.AsyncDropped.
+//
+// Key and value are copied. Invalid writes are dropped like Set. Close applies
+// every queued write, later calls behave like Set
+func (c *ActiveCache) SetAsync(key, value []byte, ttl time.Duration) {
+	if c.validateEntry(key, value, ttl) != nil {
+		return
+	}
+
+	c.asyncStart.Do(c.startAsync)
+
+	c.asyncMtx.RLock()
+	if c.asyncClosed {
+		c.asyncMtx.RUnlock()
+		// Not Set, which queues here again with Config.AsyncWrites
+		_ = c.SetE(key, value, ttl)
+		return
+	}
+	defer c.asyncMtx.RUnlock()
+
+	op := asyncOp{key: bytes.Clone(key), value: bytes.Clone(value), ttl: ttl}
+	if !c.config.Load().AsyncDropWhenFull {
+		c.asyncQueue <- op
+		return
+	}
+
+	select {
+	case c.asyncQueue <- op:
+	default:
+		c.asyncDropped.Add(1)
+	}
+}
+
+// startAsync creates the SetAsync queue and its worker,
+//
+// unless Close already closed the queue
+func (c *ActiveCache) startAsync() {
+	c.asyncMtx.Lock()
+	defer c.asyncMtx.Unlock()
+
+	if c.asyncClosed {
+		return
+	}
+
+	c.asyncQueue = make(chan asyncOp, c.config.Load().AsyncQueueSize)
+	c.asyncDone = make(chan struct{})
+	go c.runAsync(c.asyncQueue, c.asyncDone)
+}
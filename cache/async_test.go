@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestActiveCache_FlushWrites(t *testing.T) {
+	// Setup: writes are only applied by full batches or barriers
+	cache := NewActiveCacheWithConfig(&Config{AsyncBatchSize: 1000, AsyncFlushInterval: time.Hour})
+	cache.StopCleaner()
+	defer cache.Close()
+
+	// Test
+	cache.FlushWrites()
+
+	cache.SetAsync([]byte("lorem"), []byte("ipsum"), NoExpiration)
+	if _, _, ok := cache.GetOK([]byte("lorem")); ok {
+		t.Errorf("SetAsync() write should not be visible before FlushWrites()")
+	}
+
+	cache.FlushWrites()
+	if value, _, ok := cache.GetOK([]byte("lorem")); !ok || string(value) != "ipsum" {
+		t.Errorf("wrong value for Get() after FlushWrites(). Expected ipsum but got (%s, %v)", value, ok)
+	}
+}
+
+func TestActiveCache_SetAsync(t *testing.T) {
+	// Setup
+	const writes = 1000
+	cache := NewActiveCacheWithConfig(&Config{AsyncBatchSize: 16})
+	cache.StopCleaner()
+	defer cache.Close()
+
+	// Test writes of the same key keep their order, reused buffers are copied
+	key, value := []byte("key"), make([]byte, 1)
+	for i := 0; i < writes; i++ {
+		copy(value, fmt.Sprint(i%10))
+		cache.SetAsync(key, value, NoExpiration)
+		cache.SetAsync([]byte(fmt.Sprintf("key%v", i%10)), []byte(fmt.Sprint(i)), NoExpiration)
+	}
+	copy(value, "x")
+	cache.SetAsync([]byte("expired"), []byte("value"), NoExpiration)
+	cache.SetAsync([]byte("expired"), nil, ExpireNow)
+	cache.SetAsync(nil, []byte("value"), NoExpiration)
+	cache.FlushWrites()
+
+	if got, _ := cache.Get(key); string(got) != "9" {
+		t.Errorf("wrong value for Get() after SetAsync(). Expected 9 but got %s", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		expected := fmt.Sprint(writes - 10 + i)
+		if got, _ := cache.Get([]byte(fmt.Sprintf("key%v", i))); string(got) != expected {
+			t.Errorf("wrong value for Get(key%v) after SetAsync(). Expected %v but got %s", i, expected, got)
+		}
+	}
+
+	if cache.Has([]byte("expired")) || cache.Len() != 11 {
+		t.Errorf("wrong value for Len() after SetAsync(). Expected 11 but got %v", cache.Len())
+	}
+}
+
+func TestActiveCache_SetAsync_dropWhenFull(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{AsyncQueueSize: 1, AsyncBatchSize: 1, AsyncDropWhenFull: true})
+	cache.StopCleaner()
+	defer cache.Close()
+
+	// Test the worker is stuck on the lock, so at most 2 writes fit
+	cache.mtx.Lock()
+	for i := 0; i < 10; i++ {
+		cache.SetAsync([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration)
+	}
+	cache.mtx.Unlock()
+	cache.FlushWrites()
+
+	dropped := cache.Stats().AsyncDropped
+	if dropped < 8 || int(dropped)+cache.Len() != 10 {
+		t.Errorf("wrong value for Stats().AsyncDropped. Expected at least 8 with %v entries but got %v", cache.Len(), dropped)
+	}
+}
+
+func TestActiveCache_SetAsync_close(t *testing.T) {
+	// Setup
+	const writes = 100
+	cache := NewActiveCacheWithConfig(&Config{AsyncBatchSize: 1000, AsyncFlushInterval: time.Hour})
+	cache.StopCleaner()
+	for i := 0; i < writes; i++ {
+		cache.SetAsync([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration)
+	}
+
+	// Test Close drains the queue
+	cache.Close()
+	if cache.Len() != writes {
+		t.Errorf("wrong value for Len() after Close(). Expected %v but got %v", writes, cache.Len())
+	}
+
+	cache.SetAsync([]byte("late"), []byte("value"), NoExpiration)
+	cache.FlushWrites()
+	if cache.Len() != writes {
+		t.Errorf("SetAsync() after Close() should be dropped like Set but got %v entries", cache.Len())
+	}
+}
+
+func TestActiveCache_Set_asyncWrites(t *testing.T) {
+	// Setup: writes are only applied by full batches, barriers or Close
+	const writes = 100
+	cache := NewActiveCacheWithConfig(&Config{AsyncWrites: true, AsyncBatchSize: 1000, AsyncFlushInterval: time.Hour})
+	cache.StopCleaner()
+
+	// Test writes are queued and keep their order
+	for i := 0; i < writes; i++ {
+		cache.Set([]byte("lorem"), []byte(fmt.Sprint(i)), NoExpiration)
+	}
+	if cache.Has([]byte("lorem")) {
+		t.Errorf("Set() with AsyncWrites should not be visible before FlushWrites()")
+	}
+
+	cache.FlushWrites()
+	if value, _ := cache.Get([]byte("lorem")); string(value) != fmt.Sprint(writes-1) {
+		t.Errorf("wrong value for Get() after FlushWrites(). Expected %v but got %s", writes-1, value)
+	}
+
+	// Test Close drains the queue, later writes are applied synchronously
+	for i := 0; i < writes; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+	cache.Close()
+	if cache.Len() != writes+1 {
+		t.Errorf("wrong value for Len() after Close(). Expected %v but got %v", writes+1, cache.Len())
+	}
+
+	cache.Set([]byte("late"), []byte("value"), NoExpiration)
+	if cache.Len() != writes+1 {
+		t.Errorf("Set() after Close() should be dropped but got %v entries", cache.Len())
+	}
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+)
+
+// An AuditOp identifies the operation of an AuditEvent
+type AuditOp int
+
+const (
+	// AuditSet records a write storing a key
+	AuditSet AuditOp = iota
+
+	// AuditDelete records the removal of a live key by a write, e.g. Delete or a negative TTL
+	AuditDelete
+
+	// AuditExpire records the removal of an expired key
+	AuditExpire
+
+	// AuditEvict records the removal of a live key to make room, see Config.MaxEntries
+	AuditEvict
+)
+
+// String returns the operation name
+func (o AuditOp) String() string {
+	switch o {
+	case AuditSet:
+		return "Set"
+	case AuditDelete:
+		return "Delete"
+	case AuditExpire:
+		return "Expire"
+	case AuditEvict:
+		return "Evict"
+	default:
+		return "AuditOp(" + strconv.Itoa(int(o)) + ")"
+	}
+}
+
+// An AuditEvent represents an operation recorded in the audit log, see Config.AuditLogSize
+type AuditEvent struct {
+	// Operation that happened to Key
+	Op AuditOp
+
+	// Key the operation happened to
+	Key []byte
+
+	// TTL stored by AuditSet events, zero otherwise
+	TTL time.Duration
+
+	// Time the operation happened
+	At time.Time
+}
+
+// audit records the event of `kind` in the audit log when `Config.AuditLogSize`
+//
+// is set, overwriting the oldest event once full. Reads are not recorded.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) audit(kind hookKind, key []byte, ttl time.Duration) {
+	var op AuditOp
+	switch kind {
+	case hookSet:
+		op = AuditSet
+	case hookDelete:
+		op = AuditDelete
+	case hookExpire:
+		op = AuditExpire
+	case hookEvict:
+		op = AuditEvict
+	default:
+		return
+	}
+
+	size := c.config.Load().AuditLogSize
+	if size <= 0 {
+		c.auditLog, c.auditNext = nil, 0
+		return
+	}
+
+	// The size was changed by Reconfigure
+	if c.auditNext > 0 && len(c.auditLog) != size {
+		c.auditLog, c.auditNext = c.auditEvents(), 0
+	}
+	if over := len(c.auditLog) - size; over > 0 {
+		c.auditLog = c.auditLog[over:]
+	}
+
+	if len(c.auditLog) < size {
+		c.auditLog = append(c.auditLog, AuditEvent{Op: op, Key: bytes.Clone(key), TTL: ttl, At: c.now()})
+		return
+	}
+
+	// Keys are copied by AuditLog, so the buffer of the overwritten event is reused
+	e := &c.auditLog[c.auditNext]
+	*e = AuditEvent{Op: op, Key: append(e.Key[:0], key...), TTL: ttl, At: c.now()}
+	c.auditNext = (c.auditNext + 1) % size
+}
+
+// auditEvents returns the events of the audit log from the oldest
+//
+// sharing their keys. Caller must hold the lock
+func (c *ActiveCache) auditEvents() []AuditEvent {
+	events := make([]AuditEvent, 0, len(c.auditLog))
+	events = append(events, c.auditLog[c.auditNext:]...)
+	return append(events, c.auditLog[:c.auditNext]...)
+}
+
+// AuditLog returns copies of the last `Config.AuditLogSize` sets, deletes,
+//
+// expirations and evictions, from the oldest. Events are recorded under the
+// write lock of the operation, in the order the operations happened.
+//
+// Returns nil if the audit log is disabled or nothing was recorded
+func (c *ActiveCache) AuditLog() []AuditEvent {
+	c.rlock()
+	defer c.runlock()
+
+	if len(c.auditLog) == 0 {
+		return nil
+	}
+
+	events := c.auditEvents()
+	for i := range events {
+		events[i].Key = bytes.Clone(events[i].Key)
+	}
+
+	return events
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+func TestActiveCache_AuditLog(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	const size = 4
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, AuditLogSize: size, MaxEntries: 3})
+	cache.StopCleaner()
+	start := clock.Now()
+
+	// Test
+	cache.Set([]byte("key0"), []byte("value"), time.Second)
+	cache.SetPermanent([]byte("key1"), []byte("value"))
+	cache.Get([]byte("key1"))
+	clock.Advance(2 * time.Second)
+	cache.Get([]byte("key0"))
+	cache.DeleteString("key1")
+	cache.DeleteString("nonexistent key")
+	for i := 2; i < 6; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), time.Minute)
+	}
+
+	// Only the last events remain, from the oldest: the expired key0 is removed
+	// to make room for key4, then key2 is the least recently used live key
+	log := cache.AuditLog()
+	var got []string
+	for _, e := range log {
+		got = append(got, fmt.Sprintf("%v %s %v", e.Op, e.Key, e.TTL))
+	}
+
+	expected := "Expire key0 0s, Set key4 1m0s, Evict key2 0s, Set key5 1m0s"
+	if strings.Join(got, ", ") != expected {
+		t.Errorf("wrong value for AuditLog(). Expected [%s] but got %v", expected, got)
+	}
+
+	if len(log) == size && (!log[0].At.Equal(start.Add(2*time.Second)) || log[0].At.After(log[size-1].At)) {
+		t.Errorf("wrong value for AuditEvent.At. Expected events recorded at %v but got %v", start.Add(2*time.Second), log[0].At)
+	}
+
+	// Keys are copies
+	log[0].Key[0] = 'x'
+	if key := cache.AuditLog()[0].Key; string(key) != "key0" {
+		t.Errorf("AuditLog() should return copies of the keys but got %s", key)
+	}
+
+	// Test a smaller log keeps the most recent events
+	cache.Reconfigure(&Config{AuditLogSize: 2, MaxEntries: 3})
+	cache.DeleteString("key5")
+
+	if log := cache.AuditLog(); len(log) != 2 || string(log[0].Key) != "key5" || log[1].Op != AuditDelete {
+		t.Errorf("wrong value for AuditLog() after Reconfigure. Expected [Set key5, Delete key5] but got %v", log)
+	}
+
+	// Test a disabled log
+	cache.Reconfigure(&Config{MaxEntries: 3})
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	if log := cache.AuditLog(); log != nil {
+		t.Errorf("wrong value for AuditLog() with a disabled log. Expected nil but got %v", log)
+	}
+}
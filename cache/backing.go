@@ -0,0 +1,349 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A Backing is a slower store the cache sits in front of, see Config.Backing
+type Backing interface {
+	// Load returns the value stored using `key` and its TTL.
+	//
+	// Returns ErrKeyNotFound if key is not stored
+	Load(key []byte) ([]byte, time.Duration, error)
+
+	// Store persists `value` using `key` with `ttl`
+	Store(key, value []byte, ttl time.Duration) error
+
+	// Delete removes `key`, if stored
+	Delete(key []byte) error
+}
+
+// A ContextBacking is a Backing honoring contexts. GetCtx and SetCtx
+//
+// pass their context to it instead of calling the Backing methods
+type ContextBacking interface {
+	Backing
+
+	// LoadContext behaves like Load, giving up when `ctx` is done
+	LoadContext(ctx context.Context, key []byte) ([]byte, time.Duration, error)
+
+	// StoreContext behaves like Store, giving up when `ctx` is done
+	StoreContext(ctx context.Context, key, value []byte, ttl time.Duration) error
+
+	// DeleteContext behaves like Delete, giving up when `ctx` is done
+	DeleteContext(ctx context.Context, key []byte) error
+}
+
+// A backingOp represents a write propagated to Backing, deleting `key` if `ttl` is negative
+type backingOp struct {
+	key   []byte
+	value []byte
+	ttl   time.Duration
+
+	// Entry the write stored in the cache, nil for deletes
+	entry *cacheEntry
+}
+
+// applyBacking propagates `op` to `Config.Backing`, passing `ctx` to
+//
+// a ContextBacking. A plain Backing is not called once `ctx` is done.
+//
+// On failure the error is reported and the entry the write stored is removed
+// from the cache, so it never serves a value the backing store did not accept
+func (c *ActiveCache) applyBacking(ctx context.Context, op backingOp) error {
+	backing := c.config.Load().Backing
+	if backing == nil {
+		return nil
+	}
+
+	var err error
+	ctxBacking, withCtx := backing.(ContextBacking)
+	switch {
+	case withCtx && op.ttl < NoExpiration:
+		err = ctxBacking.DeleteContext(ctx, op.key)
+	case withCtx:
+		err = ctxBacking.StoreContext(ctx, op.key, op.value, op.ttl)
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case op.ttl < NoExpiration:
+		err = backing.Delete(op.key)
+	default:
+		err = backing.Store(op.key, op.value, op.ttl)
+	}
+
+	if err != nil {
+		c.reportBackingError(op.key, err)
+		if op.ttl >= NoExpiration {
+			c.invalidate(op.key, op.entry)
+		}
+	}
+
+	return err
+}
+
+// enqueueWriteBehind queues `op` for the write-behind worker, starting it
+//
+// on first use. Reports false once the queue was closed by Close
+func (c *ActiveCache) enqueueWriteBehind(op backingOp) bool {
+	c.writeBehindStart.Do(c.startWriteBehind)
+
+	c.writeBehindMtx.RLock()
+	defer c.writeBehindMtx.RUnlock()
+
+	if c.writeBehindClosed {
+		return false
+	}
+
+	c.writeBehind <- op
+	return true
+}
+
+// flushWriteBehind closes the write-behind queue and waits until
+//
+// every queued write reached Backing. Later writes are synchronous
+func (c *ActiveCache) flushWriteBehind() {
+	c.writeBehindMtx.Lock()
+	if c.writeBehindClosed {
+		c.writeBehindMtx.Unlock()
+		return
+	}
+
+	c.writeBehindClosed = true
+	queue, done := c.writeBehind, c.writeBehindDone
+	c.writeBehindMtx.Unlock()
+
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+}
+
+// invalidate removes `key` from the cache only, reporting it to Hooks as deleted.
+//
+// Nothing is removed unless `entry` is still the one stored, a later write
+// of `key` is kept
+func (c *ActiveCache) invalidate(key []byte, entry *cacheEntry) {
+	c.lock("set")
+	defer c.unlock()
+
+	if current, ok := c.entries.Get(key); !ok || current != entry {
+		return
+	}
+
+	if c.delete(key) {
+		c.emit(hookDelete, key, 0)
+	}
+}
+
+// populate stores `value` loaded from Backing without writing it back,
+//
+// unless `key` was written while it was loaded: the newer entry is kept and
+// its value and TTL are returned instead. Reports false if that entry marks
+// the key absent, e.g. a tombstone or SetNotFound
+func (c *ActiveCache) populate(key, value []byte, ttl time.Duration) ([]byte, time.Duration, bool) {
+	if c.validateEntry(key, value, ttl) != nil {
+		return value, ttl, true
+	}
+
+	c.lock("set")
+	defer c.unlock()
+
+	now := c.now()
+	if current, ok := c.entries.Get(key); ok && !current.IsExpired(now) {
+		if current.NotFound {
+			return nil, 0, false
+		}
+
+		value, ttl := current.GetValueTTL(now)
+		return value, ttl, true
+	}
+
+	c.set(key, value, ttl)
+	return value, ttl, true
+}
+
+// readThrough loads `key` from `Config.Backing` after a cache miss with
+//
+// `missErr` and populates the cache with it. Returns `missErr` if there
+// is no Backing or the key is not stored there either
+func (c *ActiveCache) readThrough(key []byte, missErr error) ([]byte, time.Duration, error) {
+	return c.readThroughCtx(context.Background(), key, missErr)
+}
+
+// readThroughCtx behaves like readThrough, passing `ctx` to a ContextBacking.
+//
+// A plain Backing is not called once `ctx` is done, ctx.Err() is returned
+func (c *ActiveCache) readThroughCtx(ctx context.Context, key []byte, missErr error) ([]byte, time.Duration, error) {
+	backing := c.config.Load().Backing
+	if backing == nil {
+		return nil, 0, missErr
+	}
+
+	var value []byte
+	var ttl time.Duration
+	var err error
+	if ctxBacking, ok := backing.(ContextBacking); ok {
+		value, ttl, err = ctxBacking.LoadContext(ctx, key)
+	} else if err = ctx.Err(); err == nil {
+		value, ttl, err = backing.Load(key)
+	}
+	if errors.Is(err, ErrKeyNotFound) || (err == nil && ttl < NoExpiration) {
+		return nil, 0, missErr
+	}
+
+	if err != nil {
+		c.reportBackingError(key, err)
+		return nil, 0, err
+	}
+
+	value, ttl, ok := c.populate(key, value, ttl)
+	if !ok {
+		return nil, 0, missErr
+	}
+
+	return value, ttl, nil
+}
+
+// reportBackingError calls `Config.OnBackingError` if set
+func (c *ActiveCache) reportBackingError(key []byte, err error) {
+	if onError := c.config.Load().OnBackingError; onError != nil {
+		onError(key, err)
+	}
+}
+
+// startWriteBehind creates the write-behind queue and its worker,
+//
+// unless Close already closed the queue
+func (c *ActiveCache) startWriteBehind() {
+	c.writeBehindMtx.Lock()
+	defer c.writeBehindMtx.Unlock()
+
+	if c.writeBehindClosed {
+		return
+	}
+
+	c.writeBehind = make(chan backingOp, c.config.Load().WriteBehindQueueSize)
+	c.writeBehindDone = make(chan struct{})
+	go func(queue <-chan backingOp, done chan<- struct{}) {
+		defer close(done)
+		for op := range queue {
+			c.applyBacking(context.Background(), op)
+		}
+	}(c.writeBehind, c.writeBehindDone)
+}
+
+// writeThrough propagates a successful cache write of `entry` to `Config.Backing`,
+//
+// a delete if `ttl` is negative. With `Config.WriteBehind` the write is
+// queued and errors are only reported to `Config.OnBackingError`
+func (c *ActiveCache) writeThrough(key, value []byte, ttl time.Duration, entry *cacheEntry) error {
+	return c.writeThroughCtx(context.Background(), key, value, ttl, entry)
+}
+
+// writeThroughCtx behaves like writeThrough, passing `ctx` to a ContextBacking
+//
+// for writes that are not queued, see applyBacking
+func (c *ActiveCache) writeThroughCtx(ctx context.Context, key, value []byte, ttl time.Duration, entry *cacheEntry) error {
+	conf := c.config.Load()
+	if conf.Backing == nil {
+		return nil
+	}
+
+	op := backingOp{key: key, value: value, ttl: ttl, entry: entry}
+	if conf.WriteBehind {
+		queued := backingOp{key: bytes.Clone(key), value: bytes.Clone(value), ttl: ttl, entry: entry}
+		if c.enqueueWriteBehind(queued) {
+			return nil
+		}
+	}
+
+	return c.applyBacking(ctx, op)
+}
+
+// A MemoryBacking is a Backing keeping values in memory,
+//
+// useful for tests and examples. It is safe for concurrent use
+type MemoryBacking struct {
+	// Mutex for read and write lock
+	mtx sync.RWMutex
+
+	// Stored values by key
+	data map[string]Item
+
+	// Error returned by every operation when not nil, see SetErr
+	err error
+}
+
+var _ Backing = (*MemoryBacking)(nil)
+
+// NewMemoryBacking returns an empty MemoryBacking pointer instance
+func NewMemoryBacking() *MemoryBacking {
+	return &MemoryBacking{data: map[string]Item{}}
+}
+
+// Delete removes `key`, if stored
+func (m *MemoryBacking) Delete(key []byte) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	delete(m.data, string(key))
+	return nil
+}
+
+// Len returns the amount of stored values
+func (m *MemoryBacking) Len() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return len(m.data)
+}
+
+// Load returns the value stored using `key` and the TTL it was stored with.
+//
+// TTLs are not enforced. Returns ErrKeyNotFound if key is not stored
+func (m *MemoryBacking) Load(key []byte) ([]byte, time.Duration, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if m.err != nil {
+		return nil, 0, m.err
+	}
+
+	item, ok := m.data[string(key)]
+	if !ok {
+		return nil, 0, ErrKeyNotFound
+	}
+
+	return bytes.Clone(item.Value), item.TTL, nil
+}
+
+// SetErr makes every following operation fail with `err`,
+//
+// simulating an unavailable store. A nil `err` restores it
+func (m *MemoryBacking) SetErr(err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.err = err
+}
+
+// Store persists a copy of `value` using `key` with `ttl`
+func (m *MemoryBacking) Store(key, value []byte, ttl time.Duration) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	m.data[string(key)] = Item{Key: bytes.Clone(key), Value: bytes.Clone(value), TTL: ttl}
+	return nil
+}
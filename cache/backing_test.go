@@ -0,0 +1,382 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+// slowBacking is a ContextBacking over a MemoryBacking recording the context
+//
+// of every call. With `block` set calls wait until their context is done,
+// with `delay` set they take that long and then check their context
+type slowBacking struct {
+	*MemoryBacking
+	block bool
+	delay time.Duration
+	ctxs  []context.Context
+}
+
+func (s *slowBacking) wait(ctx context.Context) error {
+	s.ctxs = append(s.ctxs, ctx)
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+		return ctx.Err()
+	}
+
+	if !s.block {
+		return nil
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *slowBacking) LoadContext(ctx context.Context, key []byte) ([]byte, time.Duration, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, 0, err
+	}
+	return s.Load(key)
+}
+
+func (s *slowBacking) StoreContext(ctx context.Context, key, value []byte, ttl time.Duration) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.Store(key, value, ttl)
+}
+
+func (s *slowBacking) DeleteContext(ctx context.Context, key []byte) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.Delete(key)
+}
+
+func TestActiveCache_applyBacking(t *testing.T) {
+	// Setup
+	type ctxKey struct{}
+	backing := &slowBacking{MemoryBacking: NewMemoryBacking()}
+	backing.Store([]byte("stored"), []byte("value"), time.Minute)
+	cache := NewActiveCacheWithConfig(&Config{Backing: backing})
+	cache.StopCleaner()
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+
+	// Test contexts reach a ContextBacking
+	if value, _, err := cache.GetCtx(ctx, []byte("stored")); err != nil || string(value) != "value" {
+		t.Errorf("wrong value for GetCtx() on backing hit. Expected (value, nil) but got (%s, %v)", value, err)
+	}
+	cache.SetCtx(ctx, []byte("lorem"), []byte("ipsum"), NoExpiration)
+	cache.SetCtx(ctx, []byte("lorem"), nil, ExpireNow)
+
+	if len(backing.ctxs) != 3 {
+		t.Fatalf("wrong amount of ContextBacking calls. Expected 3 but got %v", len(backing.ctxs))
+	}
+	for i, got := range backing.ctxs {
+		if got.Value(ctxKey{}) != "request" {
+			t.Errorf("ContextBacking call %v should receive the caller context", i)
+		}
+	}
+
+	// Test a slow backing store gives up with the context
+	backing.block = true
+	timeout, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if _, _, err := cache.GetCtx(timeout, []byte("missing")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error for GetCtx() on slow backing. Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	// Test a write applied before the context is done is not undone by the backing store
+	backing.block = false
+	backing.delay = time.Millisecond * 40
+	slow, cancelSlow := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancelSlow()
+	if err := cache.SetCtx(slow, []byte("john"), []byte("doe"), NoExpiration); err != nil {
+		t.Errorf("wrong error for SetCtx() on slow backing. Expected nil but got %v", err)
+	}
+
+	if _, _, err := backing.Load([]byte("john")); !cache.Has([]byte("john")) || err != nil {
+		t.Errorf("SetCtx() on slow backing should keep the write but got cached=%v and backing error %v", cache.Has([]byte("john")), err)
+	}
+
+	// Test a done context writes nothing
+	backing.delay = 0
+	calls := len(backing.ctxs)
+	if err := cache.SetCtx(timeout, []byte("jane"), []byte("doe"), NoExpiration); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error for SetCtx() with done context. Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	if cache.Has([]byte("jane")) || len(backing.ctxs) != calls {
+		t.Errorf("SetCtx() with done context should write nothing but got cached=%v and %v backing calls", cache.Has([]byte("jane")), len(backing.ctxs)-calls)
+	}
+
+	// Test writes without context pass a background context
+	calls = len(backing.ctxs)
+	cache.Set([]byte("jane"), []byte("foster"), NoExpiration)
+	if len(backing.ctxs) != calls+1 || backing.ctxs[calls].Err() != nil {
+		t.Errorf("Set() should call the ContextBacking with a background context")
+	}
+}
+
+func TestActiveCache_flushWriteBehind(t *testing.T) {
+	// Setup
+	backing := NewMemoryBacking()
+	cache := NewActiveCacheWithConfig(&Config{
+		Backing:              backing,
+		WriteBehind:          true,
+		WriteBehindQueueSize: 4,
+	})
+
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%d", i)), []byte("value"), time.Minute)
+	}
+	cache.Set([]byte("key0"), nil, ExpireNow)
+
+	// Test
+	if err := cache.Close(); err != nil {
+		t.Errorf("wrong value for Close(). Expected nil but got %v", err)
+	}
+
+	if backing.Len() != 99 {
+		t.Errorf("wrong value for MemoryBacking.Len() after Close(). Expected 99 but got %d", backing.Len())
+	}
+
+	// Writes after Close are dropped
+	cache.Set([]byte("late"), []byte("value"), NoExpiration)
+	if _, _, err := backing.Load([]byte("late")); err != ErrKeyNotFound {
+		t.Errorf("wrong value for MemoryBacking.Load() after Close(). Expected %v but got %v", ErrKeyNotFound, err)
+	}
+
+	// Closing twice is harmless
+	cache.Close()
+}
+
+func TestActiveCache_readThrough(t *testing.T) {
+	// Setup
+	backing := NewMemoryBacking()
+	backing.Store([]byte("stored"), []byte("value"), time.Minute)
+
+	var reported []error
+	cache := NewActiveCacheWithConfig(&Config{
+		Backing:        backing,
+		OnBackingError: func(key []byte, err error) { reported = append(reported, err) },
+	})
+	cache.StopCleaner()
+
+	// Test miss populates the cache
+	value, ttl := cache.Get([]byte("stored"))
+	if !bytes.Equal(value, []byte("value")) || ttl != time.Minute {
+		t.Errorf("wrong value for Get() on backing hit. Expected (value, 1m) but got (%q, %v)", value, ttl)
+	}
+
+	backing.Delete([]byte("stored"))
+	if _, _, ok := cache.GetOK([]byte("stored")); !ok {
+		t.Errorf("wrong value for GetOK() after read-through. Expected true but got false")
+	}
+
+	backing.Store([]byte("string"), []byte("value"), time.Minute)
+	if value, _ := cache.GetString("string"); !bytes.Equal(value, []byte("value")) || !cache.Has([]byte("string")) {
+		t.Errorf("wrong value for GetString() on backing hit. Expected value but got %q", value)
+	}
+	backing.Delete([]byte("string"))
+
+	// Test miss in both
+	if _, _, err := cache.GetE([]byte("missing")); err != ErrKeyNotFound {
+		t.Errorf("wrong value for GetE() on backing miss. Expected %v but got %v", ErrKeyNotFound, err)
+	}
+
+	// Test backing errors surface without touching the cache
+	unavailable := errors.New("unavailable")
+	backing.SetErr(unavailable)
+	if _, _, err := cache.GetE([]byte("missing")); err != unavailable {
+		t.Errorf("wrong value for GetE() on backing error. Expected %v but got %v", unavailable, err)
+	}
+
+	if len(reported) != 1 || reported[0] != unavailable {
+		t.Errorf("wrong value for OnBackingError calls. Expected [%v] but got %v", unavailable, reported)
+	}
+
+	if cache.Len() != 2 {
+		t.Errorf("wrong value for Len() after backing error. Expected 2 but got %d", cache.Len())
+	}
+}
+
+// blockingBacking is a Backing over a MemoryBacking whose loads read the
+//
+// stored value, then signal `entered` and wait until `release` is closed
+type blockingBacking struct {
+	*MemoryBacking
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBacking) Load(key []byte) ([]byte, time.Duration, error) {
+	value, ttl, err := b.MemoryBacking.Load(key)
+	close(b.entered)
+	<-b.release
+	return value, ttl, err
+}
+
+func TestActiveCache_readThrough_concurrentWrite(t *testing.T) {
+	// Setup
+	backing := &blockingBacking{
+		MemoryBacking: NewMemoryBacking(),
+		entered:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	backing.Store([]byte("lorem"), []byte("old"), NoExpiration)
+	cache := NewActiveCacheWithConfig(&Config{Backing: backing})
+	cache.StopCleaner()
+
+	loaded := make(chan []byte)
+	go func() {
+		value, _ := cache.Get([]byte("lorem"))
+		loaded <- value
+	}()
+	<-backing.entered
+
+	// Test a write while the backing loads the key is not overwritten by the older loaded value
+	cache.Set([]byte("lorem"), []byte("new"), NoExpiration)
+	close(backing.release)
+
+	if value := <-loaded; string(value) != "new" {
+		t.Errorf("wrong value for Get(lorem) loading while it was written. Expected new but got %s", value)
+	}
+
+	if entry, ok := cache.GetEntry([]byte("lorem")); !ok || string(entry.Value) != "new" {
+		t.Errorf("wrong value for GetEntry(lorem) after read-through. Expected (new, true) but got (%s, %v)", entry.Value, ok)
+	}
+}
+
+func TestActiveCache_writeThrough(t *testing.T) {
+	// Setup
+	backing := NewMemoryBacking()
+	cache := NewActiveCacheWithConfig(&Config{Backing: backing})
+	cache.StopCleaner()
+
+	// Test writes and deletes go through
+	if err := cache.SetE([]byte("a"), []byte("1"), time.Minute); err != nil {
+		t.Errorf("wrong value for SetE(). Expected nil but got %v", err)
+	}
+	cache.SetMany([]Item{{Key: []byte("b"), Value: []byte("2")}, {Key: []byte("c"), Value: []byte("3")}})
+
+	if value, ttl, _ := backing.Load([]byte("a")); !bytes.Equal(value, []byte("1")) || ttl != time.Minute {
+		t.Errorf("wrong value for MemoryBacking.Load(). Expected (1, 1m) but got (%q, %v)", value, ttl)
+	}
+
+	if backing.Len() != 3 {
+		t.Errorf("wrong value for MemoryBacking.Len() after writes. Expected 3 but got %d", backing.Len())
+	}
+
+	cache.Set([]byte("a"), nil, ExpireNow)
+	cache.DeleteByPrefix([]byte("b"))
+	cache.DeleteString("c")
+	if backing.Len() != 0 {
+		t.Errorf("wrong value for MemoryBacking.Len() after deletes. Expected 0 but got %d", backing.Len())
+	}
+	cache.Set([]byte("c"), []byte("3"), NoExpiration)
+
+	// Test failed writes are not cached
+	unavailable := errors.New("unavailable")
+	backing.SetErr(unavailable)
+	if err := cache.SetE([]byte("c"), []byte("4"), NoExpiration); err != unavailable {
+		t.Errorf("wrong value for SetE() on backing error. Expected %v but got %v", unavailable, err)
+	}
+
+	backing.SetErr(nil)
+	if value, _, err := cache.GetE([]byte("c")); err != nil || !bytes.Equal(value, []byte("3")) {
+		t.Errorf("wrong value for GetE() after failed write. Expected (3, nil) but got (%q, %v)", value, err)
+	}
+}
+
+func TestActiveCache_writeThrough_deleteNotStored(t *testing.T) {
+	// Setup
+	backing := NewMemoryBacking()
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Backing: backing, MaxEntries: 1})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("evicted"), []byte("1"))
+	cache.Set([]byte("expired"), []byte("2"), time.Minute)
+	clock.Advance(time.Hour)
+
+	// Test deletes reach the backing for evicted and expired keys, so read-through does not load them back
+	for _, key := range []string{"evicted", "expired"} {
+		if _, _, err := backing.Load([]byte(key)); err != nil {
+			t.Fatalf("wrong value for MemoryBacking.Load(%s) before Delete(). Expected nil but got %v", key, err)
+		}
+
+		if cache.Delete([]byte(key)) {
+			t.Errorf("wrong value for Delete(%s) of a key not live in memory. Expected false but got true", key)
+		}
+
+		if value, _ := cache.Get([]byte(key)); value != nil {
+			t.Errorf("deleted key %s came back from backing: %q", key, value)
+		}
+	}
+
+	if backing.Len() != 0 {
+		t.Errorf("wrong value for MemoryBacking.Len() after deletes. Expected 0 but got %d", backing.Len())
+	}
+}
+
+// gateBacking is a Backing over a MemoryBacking failing stores of `value`
+//
+// once `release` is closed, signaling `entered` when such a store starts
+type gateBacking struct {
+	*MemoryBacking
+	value   []byte
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *gateBacking) Store(key, value []byte, ttl time.Duration) error {
+	if !bytes.Equal(value, g.value) {
+		return g.MemoryBacking.Store(key, value, ttl)
+	}
+
+	close(g.entered)
+	<-g.release
+	return errors.New("unavailable")
+}
+
+func TestActiveCache_writeThrough_concurrentWrite(t *testing.T) {
+	for _, writeBehind := range []bool{false, true} {
+		// Setup
+		backing := &gateBacking{
+			MemoryBacking: NewMemoryBacking(),
+			value:         []byte("ipsum"),
+			entered:       make(chan struct{}),
+			release:       make(chan struct{}),
+		}
+		cache := NewActiveCacheWithConfig(&Config{Backing: backing, WriteBehind: writeBehind})
+		cache.StopCleaner()
+
+		failed := make(chan error)
+		go func() {
+			failed <- cache.SetE([]byte("lorem"), []byte("ipsum"), NoExpiration)
+		}()
+		<-backing.entered
+
+		// Test a failed write does not remove a newer write of the same key
+		if err := cache.SetE([]byte("lorem"), []byte("dolor"), NoExpiration); err != nil {
+			t.Errorf("wrong value for SetE(lorem, dolor) with WriteBehind=%v. Expected nil but got %v", writeBehind, err)
+		}
+
+		close(backing.release)
+		if err := <-failed; (err == nil) != writeBehind {
+			t.Errorf("wrong value for SetE(lorem, ipsum) on backing error with WriteBehind=%v. Got %v", writeBehind, err)
+		}
+		cache.Close()
+
+		// Read-through would hide a removed entry
+		if entry, ok := cache.GetEntry([]byte("lorem")); !ok || string(entry.Value) != "dolor" {
+			t.Errorf("wrong value for GetEntry(lorem) after a failed older write with WriteBehind=%v. Expected (dolor, true) but got (%s, %v)",
+				writeBehind, entry.Value, ok)
+		}
+	}
+}
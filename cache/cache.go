@@ -1,7 +1,16 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"math"
 	"math/rand"
+	"runtime/debug"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,6 +23,22 @@ const (
 	DefaultCleanerInterval   = 200
 	DefaultKeysAmountByCycle = 20
 
+	DefaultCleanerBackoffCycles = 3
+	DefaultCleanerBackoffFactor = 2
+
+	DefaultMaxCleanDuration = 5 * time.Millisecond
+
+	// Compression
+	DefaultCompressMinBytes = 256
+
+	// Backing
+	DefaultWriteBehindQueueSize = 1024
+
+	// Async writes
+	DefaultAsyncQueueSize     = 4096
+	DefaultAsyncBatchSize     = 256
+	DefaultAsyncFlushInterval = time.Millisecond
+
 	ExpiredKeysPercentageTolerance = 25
 
 	MinCleanerInterval   = 50
@@ -21,28 +46,231 @@ const (
 
 	// Expiration
 	NoExpiration = 0
+	ExpireNow    = -1
+	MinMaxTTL    = MinCleanerInterval * time.Millisecond
+
+	// Longest TTL stored, longer ones are capped to it. Expiration times are
+	// kept in unix nanoseconds, which overflow in year 2262
+	MaxSupportedTTL = 100 * 365 * 24 * time.Hour
+
+	// Buffered keys of ExpiringSoon, further warnings are dropped
+	ExpiryWarningBufferSize = 256
+
+	// Memory
+	EntryOverheadBytes = 96
+
+	// Eviction, entries offered to Config.Eviction per evicted entry,
+	// sampled among at most EvictionSampleWindow consecutive entries
+	EvictionSampleSize   = 16
+	EvictionSampleWindow = EvictionSampleSize * 8
+
+	// Collisions
+	MaxRecordedCollisions = 16
+
+	// Waiting
+	WaitEmptyPollInterval = 10 * time.Millisecond
+
+	// Statistics
+	TTLHistogramSampleSize = 1000
+
+	// Health
+	HealthStallCycles = 5
 )
 
+// A CleanFunc inspects views of all stored entries, expired or not,
+//
+// and returns the keys to remove. It runs under the cache write lock
+// and must not call the cache
+type CleanFunc func(entries []EntryView) [][]byte
+
 type ActiveCache struct {
+	// Incremented on every entry access, orders entries for LRU eviction
+	accessTick atomic.Uint64
+
+	// Reports whether Close closed the SetAsync queue
+	asyncClosed bool
+
+	// Closed once the SetAsync worker applied every queued write
+	asyncDone chan struct{}
+
+	// Amount of SetAsync writes dropped on a full queue, see Stats
+	asyncDropped atomic.Int64
+
+	// Mutex guarding the SetAsync queue
+	asyncMtx sync.RWMutex
+
+	// Queue of writes made by SetAsync
+	asyncQueue chan asyncOp
+
+	// Starts the SetAsync worker on the first queued write
+	asyncStart sync.Once
+
+	// Ring of the last Config.AuditLogSize operations, see AuditLog
+	auditLog []AuditEvent
+
+	// Index in auditLog of the oldest event once the ring is full
+	auditNext int
+
+	// Amount of clean cycles stopped by `Config.MaxCleanDuration`
+	cleanBudgetExhausted atomic.Int64
+
+	// Start time of the current clean cycle, including recursive re-cleans
+	cleanCycleStart time.Time
+
+	// Closed once the cleaner started with stopChan exits
+	cleanerDone chan struct{}
+
+	// Reports whether the cleaner skips its cycles, see PauseCleaner
+	cleanerPaused atomic.Bool
+
 	// Function to perform clean on expired keys
-	cleanFunc func(entries *hashmap.HashMap[*cacheEntry], conf *Config)
+	cleanFunc func(c *ActiveCache)
+
+	// Reports whether the last clean cycle ran out of time with a high expired ratio
+	cleanHurry atomic.Bool
+
+	// Current interval between clean cycles, grows while cycles are idle
+	cleanInterval time.Duration
+
+	// Consecutive clean cycles that removed nothing
+	cleanIdleCycles int
+
+	// Signals the cleaner to run a cycle promptly, see Config.CleanHighWater
+	cleanSignal chan struct{}
 
-	// Holds all caching configuration
-	config *Config
+	// Start of the current clean budget window in unix seconds
+	cleanWindow int64
 
-	// Cache entries
-	entries hashmap.HashMap[*cacheEntry]
+	// Amount of keys inspected by the cleaner within cleanWindow
+	cleanWindowInspected int
 
-	// Reports whether the cleaner is running
+	// Tells the time entries expire by, `Config.Clock` at creation
+	clock Clock
+
+	// Holds all caching configuration, replaced as a whole by Reconfigure
+	config atomic.Pointer[Config]
+
+	// Colliding keys recorded while `Config.DetectCollisions` is set
+	collisions []Collision
+
+	// Amount of writes refused by `Config.DetectCollisions`
+	collisionsCount atomic.Int64
+
+	// Amount of entries removed by `Config.VerifyChecksums`, see Stats
+	corruptions atomic.Int64
+
+	// Sum of the costs charged by stored entries, see Config.MaxCostBytes
+	cost atomic.Int64
+
+	// Amount of writes refused by Config.MaxCostBytes, see Stats
+	costRejections atomic.Int64
+
+	// Hook events queued on unlock, dispatched in order by dispatchQueued
+	dispatchQueue []hookEvent
+
+	// Mutex guarding dispatchQueue and dispatching, never held while calling hooks
+	dispatchMtx sync.Mutex
+
+	// Reports whether a goroutine is dispatching the queued events
+	dispatching bool
+
+	// Hook events recorded under the lock, queued on unlock
+	events []hookEvent
+
+	// Mutex guarding events, the audit log, collisions and `Config.Eviction`
+	// notifications while Get and Set hold different stripes, see lockKey
+	eventsMtx sync.Mutex
+
+	// Cache entries, one stripe per lock of stripes
+	entries hashmap.StripedHashMap[*cacheEntry]
+
+	// Estimated amount of expired entries not removed yet
+	expiredEstimate atomic.Int64
+
+	// Amount of entries with TTL, expired or not
+	expiring atomic.Int64
+
+	// Keys of entries about to expire, see Config.ExpiryWarning
+	expiryWarnings chan []byte
+
+	// Amount of warnings dropped on a full ExpiringSoon buffer, see Stats
+	expiryWarningsDropped atomic.Int64
+
+	// Amount of Get calls that found a live value, see Stats
+	hits atomic.Int64
+
+	// Reports whether the cleaner is running, changed under lifecycleMtx
 	isCleanerRunning atomic.Bool
 
+	// Time the last clean cycle completed in unix nanoseconds, or the
+	// cleaner started if none did since, see Health
+	lastCleanAt atomic.Int64
+
+	// Last panic recovered from a clean cycle
+	lastCleanPanic atomic.Pointer[CleanPanicError]
+
+	// Amount of stored entries, expired or not
+	length atomic.Int64
+
+	// Mutex serializing lifecycle transitions, see State
+	lifecycleMtx sync.Mutex
+
+	// Approximate memory used by entries in bytes
+	memoryUsage atomic.Int64
+
+	// Amount of Get calls that found no live value, see Stats
+	misses atomic.Int64
+
 	// Mutex for read and write lock
 	mtx *sync.RWMutex
 
+	// Entries of each stripe by last access, see evictLRU
+	recency []recencyList
+
+	// Channel signaling the cleaner to pick up a new config
+	reconfigChan chan struct{}
+
+	// Amount of writes skipped by WithSkipIfEqual, see Stats
+	skippedWrites atomic.Int64
+
+	// Reports whether eviction must keep a key while a write makes room for
+	// itself, see isSpared. Nil otherwise, guarded by the write lock
+	spared func(key []byte) bool
+
+	// Lifecycle state, changed by setState under lifecycleMtx
+	state atomic.Int32
+
 	// Channel for stopping cleaner
 	stopChan chan interface{}
+
+	// Locks of the entries stripes with `Config.LockStripes`. Get, Set and
+	// single key reads take the one of their key, everything else takes them
+	// all after mtx, see lockKey. Nil with a single lock
+	stripes []sync.RWMutex
+
+	// Amount of stored tombstones, included in length, see Config.TombstoneTTL
+	tombstones atomic.Int64
+
+	// Queue of writes to `Config.Backing` while `Config.WriteBehind` is set
+	writeBehind chan backingOp
+
+	// Reports whether Close closed the write-behind queue
+	writeBehindClosed bool
+
+	// Closed once the write-behind worker applied every queued write
+	writeBehindDone chan struct{}
+
+	// Mutex guarding the write-behind queue
+	writeBehindMtx sync.RWMutex
+
+	// Starts the write-behind worker on the first queued write
+	writeBehindStart sync.Once
 }
 
+var _ Admin = (*ActiveCache)(nil)
+
+var _ BatchCache = (*ActiveCache)(nil)
+
 // NewActiveCache returns an ActiveCache pointer instance with default config values
 //
 // Cleaner is started in a go routine just before return
@@ -62,16 +290,260 @@ func NewActiveCacheWithConfig(conf *Config) *ActiveCache {
 		validateAndAdjustConfig(conf)
 	}
 
+	var clock Clock = systemClock{}
+	if conf.Clock != nil {
+		clock = conf.Clock
+	}
+
 	cache := &ActiveCache{
-		config:    conf,
-		mtx:       &sync.RWMutex{},
-		cleanFunc: defaultClean,
+		clock:          clock,
+		mtx:            &sync.RWMutex{},
+		cleanFunc:      defaultClean,
+		reconfigChan:   make(chan struct{}, 1),
+		cleanSignal:    make(chan struct{}, 1),
+		expiryWarnings: make(chan []byte, ExpiryWarningBufferSize),
 	}
 
+	if conf.LockStripes > 1 {
+		cache.entries = *hashmap.NewStripedHashMap[*cacheEntry](conf.LockStripes)
+		cache.stripes = make([]sync.RWMutex, conf.LockStripes)
+	}
+
+	cache.recency = make([]recencyList, cache.entries.Stripes())
+	cache.config.Store(conf)
+	cache.state.Store(int32(CleanerStopped))
+
 	cache.StartCleaner()
 	return cache
 }
 
+// ActiveCount returns the estimated amount of stored entries not expired.
+//
+// It is exact for entries without TTL, see ExpiredCount for accuracy
+func (c *ActiveCache) ActiveCount() int {
+	return c.Len() - c.ExpiredCount()
+}
+
+// admitCost checks that an entry charged `charge` can be stored under
+//
+// `Config.MaxCostBytes` without evicting anything. The cost of the entry `key`
+// replaces is freed.
+//
+// Returns ErrCostTooHigh if `charge` alone exceeds the budget, or ErrCacheFull
+// if FullBehavior is RejectWrites and the budget is exhausted, counting the
+// rejection in Stats.CostRejections. Caller must hold the write lock
+func (c *ActiveCache) admitCost(key []byte, charge int64) error {
+	conf := c.config.Load()
+	if conf.MaxCostBytes <= 0 {
+		return nil
+	}
+
+	if charge > conf.MaxCostBytes {
+		c.costRejections.Add(1)
+		return ErrCostTooHigh
+	}
+
+	if conf.FullBehavior != RejectWrites {
+		return nil
+	}
+
+	var freed int64
+	if old, ok := c.entries.Get(key); ok {
+		freed = old.Charge(key)
+	}
+
+	if c.cost.Load()-freed+charge > conf.MaxCostBytes {
+		c.costRejections.Add(1)
+		return ErrCacheFull
+	}
+
+	return nil
+}
+
+// Age returns how long ago the live entry of `key` was written, independent of its TTL,
+//
+// and whether it was found. Every write of the key, including overwrites and
+// SetKeepTTL, resets its age. Keys cached by SetNotFound are not found.
+//
+// No access is recorded
+func (c *ActiveCache) Age(key []byte) (time.Duration, bool) {
+	if key == nil {
+		return 0, false
+	}
+
+	stripe := c.lockKey("get", c.entries.Stripe(key))
+	defer c.unlockKey(stripe)
+
+	entry, ok := c.entries.Get(key)
+	if !ok || entry.IsExpired(c.now()) || entry.NotFound {
+		return 0, false
+	}
+
+	return c.now().Sub(time.Unix(0, entry.CreatedAt)), true
+}
+
+// ApproxLen returns the amount of stored entries without locking,
+//
+// read from the counter updated on every insert and removal. It is approximate
+// as expired entries are counted until the cleaner or a delete removes them,
+// see ActiveCount. Tombstones are not counted. Cheap enough for frequent monitoring polls
+func (c *ActiveCache) ApproxLen() int64 {
+	return c.length.Load() - c.tombstones.Load()
+}
+
+// BucketHistogram returns how many storage buckets have each bucket length
+func (c *ActiveCache) BucketHistogram() map[int]int {
+	c.rlock()
+	defer c.runlock()
+
+	return c.entries.BucketHistogram()
+}
+
+// CheckInvariants verifies the internal structures of the cache agree, for
+//
+// tests of the cache and of code built on it: Len, MemoryUsage, ExpiringCount
+// and the tombstone count match a recount of the stored entries, every entry
+// is linked once in the recency list of its stripe, see evictLRU, and every
+// entry is stored under the hash of its key, see HashMap.CheckInvariants.
+//
+// Returns every violation wrapping ErrInvariantViolated, joined, or nil.
+// The write lock is held for a full pass over the entries, which are all rehashed
+func (c *ActiveCache) CheckInvariants() error {
+	c.lock("check")
+	defer c.unlock()
+
+	var length, memoryUsage, cost, expiring, tombstones int64
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		length++
+		memoryUsage += entry.Size(key)
+		cost += entry.Charge(key)
+		if entry.HasTTL() {
+			expiring++
+		}
+		if entry.Tombstone {
+			tombstones++
+		}
+		return true
+	})
+
+	var errs []error
+	var linked int64
+	for i := range c.recency {
+		for entry := c.recency[i].oldest; entry != nil && linked <= length; entry = entry.Newer {
+			linked++
+			if stored, ok := c.entries.Get(entry.Key); !ok || stored != entry || c.entries.Stripe(entry.Key) != i {
+				errs = append(errs, fmt.Errorf("%w: recency list of stripe %d links key %q not stored with it", ErrInvariantViolated, i, entry.Key))
+			}
+		}
+	}
+
+	counters := []struct {
+		name          string
+		counted, kept int64
+	}{
+		{name: "entries", counted: length, kept: c.length.Load()},
+		{name: "memory usage", counted: memoryUsage, kept: c.memoryUsage.Load()},
+		{name: "cost", counted: cost, kept: c.cost.Load()},
+		{name: "entries with TTL", counted: expiring, kept: c.expiring.Load()},
+		{name: "tombstones", counted: tombstones, kept: c.tombstones.Load()},
+		{name: "recency list entries", counted: linked, kept: length},
+	}
+	for _, counter := range counters {
+		if counter.counted != counter.kept {
+			errs = append(errs, fmt.Errorf("%w: %s kept as %d but %d found", ErrInvariantViolated, counter.name, counter.kept, counter.counted))
+		}
+	}
+
+	if err := c.entries.CheckInvariants(); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvariantViolated, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// clampTTL caps a non negative `ttl` at `Config.MaxTTL` when set,
+//
+// so NoExpiration becomes MaxTTL too, and at MaxSupportedTTL
+func (c *ActiveCache) clampTTL(ttl time.Duration) time.Duration {
+	ttl = min(ttl, MaxSupportedTTL)
+	maxTTL := c.config.Load().MaxTTL
+	if maxTTL <= 0 || (ttl > NoExpiration && ttl <= maxTTL) {
+		return ttl
+	}
+
+	return maxTTL
+}
+
+// cleanBudget limits `sampleSize` to the keys left in the current
+//
+// second according to `Config.MaxCleanPerSecond` and consumes them.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) cleanBudget(sampleSize int) int {
+	maxPerSecond := c.config.Load().MaxCleanPerSecond
+	if maxPerSecond <= 0 {
+		return sampleSize
+	}
+
+	if second := c.now().Unix(); second != c.cleanWindow {
+		c.cleanWindow = second
+		c.cleanWindowInspected = 0
+	}
+
+	sampleSize = max(0, min(sampleSize, maxPerSecond-c.cleanWindowInspected))
+	c.cleanWindowInspected += sampleSize
+	return sampleSize
+}
+
+// CleanNow runs a clean cycle synchronously, regardless of the cleaner state
+func (c *ActiveCache) CleanNow() {
+	c.performClean()
+}
+
+// Close applies writes queued by SetAsync, stops the cleaner and flushes
+//
+// writes queued by `Config.WriteBehind`, implementing Admin. The cache moves to the Closed state: Get misses every key
+// and writes are dropped, SetE returns ErrClosed.
+//
+// It always returns nil
+func (c *ActiveCache) Close() error {
+	// Queued async writes are applied before writes are refused
+	c.flushAsync()
+
+	c.lifecycleMtx.Lock()
+	c.stopCleaner()
+
+	// Writes check the state under the lock, so none lands once it is set
+	c.lock("close")
+	from, ok := c.setState(Closed)
+	c.unlock()
+	c.lifecycleMtx.Unlock()
+
+	c.flushWriteBehind()
+	if ok {
+		c.notifyState(from, Closed)
+	}
+	return nil
+}
+
+// Compact shrinks the cache storage to fit the current amount of entries.
+//
+// Useful after the cleaner or deletes removed a large fraction of keys
+func (c *ActiveCache) Compact() {
+	c.lock("set")
+	defer c.unlock()
+
+	c.entries.Compact()
+}
+
+// Cost returns the sum of the costs charged by stored entries
+//
+// against `Config.MaxCostBytes`, see SetWithCost. Entries written without a
+// cost are charged their MemoryUsage share
+func (c *ActiveCache) Cost() int64 {
+	return c.cost.Load()
+}
+
 // defaultClean is the default function to perform clean algorithm that iterates through
 //
 // entries with TTL randomly `X` times and clean expired keys.
@@ -80,128 +552,2290 @@ func NewActiveCacheWithConfig(conf *Config) *ActiveCache {
 //
 // the function will call itself again
 //
-// `X` can be defined on `Config.KeysAmountByCycle`
-func defaultClean(entriesMap *hashmap.HashMap[*cacheEntry], conf *Config) {
-	var deleted int
-	entries := entriesMap.GetAll()
-	sampleSize := min(conf.KeysAmountByCycle, len(entries))
+// `X` can be defined on `Config.KeysAmountByCycle`.
+//
+// With `Config.SequentialScan` entries are picked in storage order instead.
+//
+// The cycle returns once it runs longer than `Config.MaxCleanDuration`. If the
+// expired ratio was above tolerance the next cycle starts sooner
+func defaultClean(c *ActiveCache) {
+	var deleted, inspectedWithTTL int
+	conf := c.config.Load()
+	sample := c.entries.Sample
+	if conf.SequentialScan {
+		sample = c.entries.Scan
+	}
+
+	entries := sample(conf.KeysAmountByCycle, nil)
+	sampleSize := c.cleanBudget(len(entries))
 
 	if sampleSize == 0 {
+		if len(entries) == 0 {
+			c.expiredEstimate.Store(0)
+		}
 		return
 	}
 
-	indexesToCheck := rand.Perm(len(entries))[:sampleSize]
-	for _, i := range indexesToCheck {
-		if entries[i].Value.IsExpired() {
-			entriesMap.Delete(entries[i].Key)
+	for i, e := range entries[:sampleSize] {
+		if conf.MaxCleanDuration > 0 && c.now().Sub(c.cleanCycleStart) >= conf.MaxCleanDuration {
+			c.cleanBudgetExhausted.Add(1)
+			c.cleanHurry.Store(i == 0 || deleted*100/i > ExpiredKeysPercentageTolerance)
+			c.estimateExpired(inspectedWithTTL, deleted)
+			return
+		}
+
+		if e.Value.HasTTL() {
+			inspectedWithTTL++
+		}
+
+		if e.Value.IsExpired(c.now()) {
+			c.delete(e.Key)
+			if !e.Value.Tombstone {
+				c.emit(hookExpire, e.Key, 0)
+			}
 			deleted++
+		} else if !e.Value.Checksummed || c.verifyChecksum(e.Key, e.Value) {
+			c.warnExpiry(e.Key, e.Value, conf.ExpiryWarning)
 		}
 	}
 
-	if (deleted * 100 / len(indexesToCheck)) > ExpiredKeysPercentageTolerance {
-		defaultClean(entriesMap, conf)
+	if (deleted * 100 / sampleSize) > ExpiredKeysPercentageTolerance {
+		defaultClean(c)
+		return
 	}
+
+	c.estimateExpired(inspectedWithTTL, deleted)
 }
 
-// Get returns Value and TTL from specified key if it exists.
+// delete removes `key` from entries keeping counters in sync
 //
-// If key is nil OR does not exist returns (nil, 0)
-func (c *ActiveCache) Get(key []byte) ([]byte, time.Duration) {
-	if key == nil {
-		return emptyValueTTL()
+// and reports whether it existed. Caller must hold the write lock
+func (c *ActiveCache) delete(key []byte) bool {
+	old, ok := c.entries.DeleteOK(key)
+	if ok {
+		c.unlinkRecency(old)
+		c.track(key, old, -1)
 	}
 
-	//Lock cache while reading
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+	return ok
+}
 
-	if entry, ok := c.entries.Get(key); ok {
-		return entry.GetValueTTL()
+// Delete removes the live entry stored for `key` and reports whether it existed.
+//
+// An expired entry is removed too, like the cleaner does, but reported as not
+// existing. Nil keys are ignored.
+//
+// The key is also deleted from `Config.Backing` like DeleteMany, stored in
+// memory or not
+func (c *ActiveCache) Delete(key []byte) bool {
+	if key == nil {
+		return false
 	}
 
-	return emptyValueTTL()
+	return c.DeleteMany([][]byte{key}) == 1
 }
 
-// IsCleanerRunning reports whether the cleaner is running
-func (c *ActiveCache) IsCleanerRunning() bool {
-	return c.isCleanerRunning.Load()
+// DeleteByPrefix removes every live entry whose key starts with `prefix`
+//
+// and returns the amount of removed entries
+func (c *ActiveCache) DeleteByPrefix(prefix []byte) int {
+	return c.DeleteFunc(func(key, _ []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
 }
 
-// performClean locks cache entries and perform clean function
-func (c *ActiveCache) performClean() {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
+// DeleteFunc removes every live entry for which `pred` returns true
+//
+// and returns the amount of removed entries.
+//
+// `pred` is called while holding the write lock and must not call the cache.
+//
+// Removed keys are also deleted from `Config.Backing`, errors are only
+// reported to `Config.OnBackingError`
+func (c *ActiveCache) DeleteFunc(pred func(key, value []byte) bool) int {
+	victims := c.deleteFunc(pred)
+	for _, key := range victims {
+		c.writeThrough(key, nil, ExpireNow, nil)
+	}
 
-	c.cleanFunc(&c.entries, c.config)
+	return len(victims)
 }
 
-// Set sets Value for specified Key with TTL.
+// deleteFunc removes every live entry for which `pred` returns true
 //
-// If TTL is equal to NoExpiration (zero), then it will never expires.
+// and returns their keys
+func (c *ActiveCache) deleteFunc(pred func(key, value []byte) bool) [][]byte {
+	c.lock("set")
+	defer c.unlock()
+
+	now := c.now()
+
+	// Collect victims first, the hashmap must not change while ranging
+	var victims [][]byte
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !entry.IsExpired(now) && !entry.Tombstone && pred(key, entry.Bytes()) {
+			victims = append(victims, key)
+		}
+		return true
+	})
+
+	for _, key := range victims {
+		c.deleteOrBury(key, now)
+		c.emit(hookDelete, key, 0)
+	}
+
+	return victims
+}
+
+// DeleteMany removes the live entries of `keys` under a single lock
 //
-// If TTL is negative the key expires instantly
-func (c *ActiveCache) Set(key, value []byte, ttl time.Duration) {
-	if key != nil {
-		// Lock cache while writing
-		c.mtx.Lock()
-		defer c.mtx.Unlock()
+// and returns the amount of removed entries. Nil keys are skipped.
+//
+// Every other key is also deleted from `Config.Backing`, stored in memory or
+// not, like a Set with a negative TTL, so evicted or expired keys are not
+// loaded back by read-through
+func (c *ActiveCache) DeleteMany(keys [][]byte) int {
+	deleted, victims := c.deleteMany(keys, c.config.Load().Backing != nil)
+	for _, key := range victims {
+		c.writeThrough(key, nil, ExpireNow, nil)
+	}
 
-		// delete key if ttl is negative
-		if ttl < NoExpiration {
-			c.entries.Delete(key)
-			return
+	return deleted
+}
+
+// deleteMany removes the live entries of `keys` and returns their amount,
+//
+// along with every non nil key when `collect` is set, whether it was stored
+// or not. Expired entries found are removed too like the cleaner does, but
+// are not counted
+func (c *ActiveCache) deleteMany(keys [][]byte, collect bool) (int, [][]byte) {
+	c.lock("set")
+	defer c.unlock()
+
+	deleted := 0
+	var victims [][]byte
+	for _, key := range keys {
+		if key == nil {
+			continue
 		}
 
-		var expiresAt int64
-		if ttl > NoExpiration {
-			expiresAt = time.Now().Add(ttl).UnixNano()
+		if collect {
+			victims = append(victims, key)
 		}
 
-		c.entries.Put(key, &cacheEntry{
-			Value:     value,
-			Ttl:       ttl,
-			ExpiresAt: expiresAt,
-		})
+		old, ok := c.entries.Get(key)
+		if !ok || old.Tombstone {
+			continue
+		}
+
+		if old.IsExpired(c.now()) {
+			c.delete(key)
+			c.emit(hookExpire, key, 0)
+			continue
+		}
+
+		c.deleteOrBury(key, c.now())
+		c.emit(hookDelete, key, 0)
+		deleted++
 	}
+
+	return deleted, victims
 }
 
-// StartCleaner starts active cache cleaning
-func (c *ActiveCache) StartCleaner() {
-	go func() {
-		if !c.isCleanerRunning.Load() {
-			c.stopChan = make(chan interface{})
-			c.isCleanerRunning.Store(true)
-
-			timer := time.NewTimer(time.Millisecond * time.Duration(c.config.CleanerInterval))
-			for {
-				select {
-				case <-c.stopChan:
-					c.isCleanerRunning.Store(false)
-					return
-				case <-timer.C:
-					c.performClean()
-				}
-			}
-		}
-	}()
+// DeleteMulti removes the live entries of `keys` under a single lock,
+//
+// implementing BatchCache, see DeleteMany
+func (c *ActiveCache) DeleteMulti(keys [][]byte) int {
+	return c.DeleteMany(keys)
 }
 
-// StopCleaner stops active cache cleaning
-func (c *ActiveCache) StopCleaner() {
-	if c.isCleanerRunning.Load() {
-		close(c.stopChan)
+// deleteOrBury deletes `key` on behalf of a caller, replacing a live entry with
+//
+// a tombstone written at `deletedAt` when `Config.TombstoneTTL` is set, see
+// delete. Reports whether a non tombstone entry existed. Caller must hold the write lock
+func (c *ActiveCache) deleteOrBury(key []byte, deletedAt time.Time) bool {
+	old, ok := c.entries.Get(key)
+	if !ok || old.Tombstone {
+		return false
 	}
+
+	ttl := c.config.Load().TombstoneTTL
+	if ttl <= 0 || old.IsExpired(c.now()) {
+		return c.delete(key)
+	}
+
+	tombstone := &cacheEntry{
+		Ttl:       ttl,
+		ExpiresAt: c.now().Add(ttl).UnixNano(),
+		CreatedAt: deletedAt.UnixNano(),
+		NotFound:  true,
+		Tombstone: true,
+	}
+
+	c.entries.Put(key, tombstone)
+	c.linkRecency(key, old, tombstone)
+	c.track(key, old, -1)
+	c.track(key, tombstone, 1)
+	return true
 }
 
-// validateAndAdjustConfig validate if parameters
+// DeleteString removes the live entry stored for string key `key` and
 //
-// has valid values and if not change them to default values
-func validateAndAdjustConfig(conf *Config) {
-	if conf.CleanerInterval < MinCleanerInterval {
-		conf.CleanerInterval = DefaultCleanerInterval
+// reports whether it existed. The key is only copied to []byte when found.
+//
+// The removed key is also deleted from `Config.Backing` like DeleteFunc
+func (c *ActiveCache) DeleteString(key string) bool {
+	c.lock("set")
+	entry, ok := c.entries.GetString(key)
+	if !ok || entry.IsExpired(c.now()) || entry.Tombstone {
+		c.unlock()
+		return false
 	}
 
-	if conf.KeysAmountByCycle < MinKeysAmountByCycle {
-		conf.KeysAmountByCycle = DefaultKeysAmountByCycle
+	k := []byte(key)
+	c.deleteOrBury(k, c.now())
+	c.emit(hookDelete, k, 0)
+	c.unlock()
+
+	c.writeThrough(k, nil, ExpireNow, nil)
+	return true
+}
+
+// detectCollision returns ErrHashCollision and records the collision if
+//
+// `Config.DetectCollisions` is set and `key` hashes like a different stored key.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) detectCollision(key []byte) error {
+	if !c.config.Load().DetectCollisions {
+		return nil
+	}
+
+	stored, _, ok := c.entries.Lookup(key)
+	if !ok || bytes.Equal(stored, key) {
+		return nil
+	}
+
+	c.collisionsCount.Add(1)
+	c.lockEvents()
+	defer c.unlockEvents()
+
+	if len(c.collisions) < MaxRecordedCollisions {
+		c.collisions = append(c.collisions, Collision{Stored: bytes.Clone(stored), Key: bytes.Clone(key)})
+	}
+
+	return ErrHashCollision
+}
+
+// Drain removes every entry and returns copies of the live ones, in one step
+//
+// under the write lock, so an entry written concurrently is either returned or
+// kept for the next Drain, never both. Unlike Snapshot the cache is left empty,
+// unlike Flush the entries are returned. Removed entries are reported to Hooks
+// as deleted.
+//
+// Expired entries and keys cached by SetNotFound are removed but not returned
+func (c *ActiveCache) Drain() []Item {
+	c.lock("set")
+	defer c.unlock()
+
+	now := c.now()
+	items := make([]Item, 0, c.Len())
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !entry.IsExpired(now) && !entry.NotFound {
+			items = append(items, Item{
+				Key:   bytes.Clone(key),
+				Value: bytes.Clone(entry.Bytes()),
+				TTL:   entry.RemainingTTL(now),
+			})
+		}
+		return true
+	})
+
+	c.removeAll()
+	return items
+}
+
+// ensureCapacity makes room for writing the new key `key` once
+//
+// `Config.MaxEntries` is reached. Entries with TTL are evicted first when
+// `Config.EvictVolatileRandom` is set, then `Config.FullBehavior` applies.
+// Overwrites of existing keys never need room.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) ensureCapacity(key []byte) error {
+	conf := c.config.Load()
+	if conf.MaxEntries <= 0 || c.length.Load() < int64(conf.MaxEntries) {
+		return nil
+	}
+
+	if _, ok := c.entries.Get(key); ok {
+		return nil
+	}
+
+	if conf.EvictVolatileRandom {
+		c.evictVolatileRandom(int(c.length.Load()) - conf.MaxEntries + 1)
+		if c.length.Load() < int64(conf.MaxEntries) {
+			return nil
+		}
+	}
+
+	if conf.FullBehavior == RejectWrites {
+		return ErrCacheFull
+	}
+
+	for c.length.Load() >= int64(conf.MaxEntries) && c.evictByPolicy() {
+	}
+
+	// Every remaining entry is pinned
+	if c.length.Load() >= int64(conf.MaxEntries) {
+		return ErrCacheFull
+	}
+
+	return nil
+}
+
+// ensureCost makes room for an entry charged `charge` under `Config.MaxCostBytes`
+//
+// before `key` is written, evicting entries following `Config.Eviction` like
+// ensureCapacity. The cost of the entry `key` replaces is freed.
+//
+// Expects the write to be admitted by admitCost first. Returns ErrCacheFull if
+// no evictable entry is left, counting the rejection in Stats.CostRejections.
+// Caller must hold the write lock
+func (c *ActiveCache) ensureCost(key []byte, charge int64) error {
+	conf := c.config.Load()
+	if conf.MaxCostBytes <= 0 {
+		return nil
+	}
+
+	for {
+		var freed int64
+		if old, ok := c.entries.Get(key); ok {
+			freed = old.Charge(key)
+		}
+
+		if c.cost.Load()-freed+charge <= conf.MaxCostBytes {
+			return nil
+		}
+
+		if conf.FullBehavior == RejectWrites || !c.evictByPolicy() {
+			c.costRejections.Add(1)
+			return ErrCacheFull
+		}
+	}
+}
+
+// Entries returns a consistent copy of all non-expired entries
+//
+// with their remaining TTL, intended for export tooling.
+//
+// Keys and values are copied into new slices while holding the read lock once,
+//
+// so the returned items are safe to use after the lock is released.
+//
+// Item.TTL holds the remaining TTL at call time.
+//
+// Memory cost: every live key and value is duplicated, so while the items
+//
+// are held the memory used by stored data roughly doubles on large caches.
+// Snapshot avoids the copies
+func (c *ActiveCache) Entries() []Item {
+	c.rlock()
+	defer c.runlock()
+
+	now := c.now()
+	entries := c.entries.GetAll()
+	items := make([]Item, 0, len(entries))
+	for _, e := range entries {
+		if e.Value.IsExpired(now) || e.Value.NotFound {
+			continue
+		}
+
+		items = append(items, Item{
+			Key:   bytes.Clone(e.Key),
+			Value: bytes.Clone(e.Value.Bytes()),
+			TTL:   e.Value.RemainingTTL(now),
+		})
+	}
+
+	return items
+}
+
+// EntriesSorted returns copies of every live entry like Entries,
+//
+// ordered by key bytes, e.g. for stable exports and golden tests
+func (c *ActiveCache) EntriesSorted() []Item {
+	items := c.Entries()
+	sortByKey(items, func(item Item) []byte { return item.Key })
+	return items
+}
+
+// estimateExpired extrapolates the expired ratio observed by the last
+//
+// clean sample to the entries with TTL that were not inspected.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) estimateExpired(inspectedWithTTL, expired int) {
+	if inspectedWithTTL == 0 {
+		c.expiredEstimate.Store(0)
+		return
+	}
+
+	notInspected := c.expiring.Load() - int64(inspectedWithTTL-expired)
+	c.expiredEstimate.Store(max(0, notInspected*int64(expired)/int64(inspectedWithTTL)))
+}
+
+// evict removes `entry` stored with `key` to free room,
+//
+// reporting it to Hooks as expired or deleted. Reports whether it was removed.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) evict(key []byte, entry *cacheEntry) bool {
+	if !c.delete(key) {
+		return false
+	}
+
+	switch {
+	case entry.Tombstone:
+	case entry.IsExpired(c.now()):
+		c.emit(hookExpire, key, 0)
+	default:
+		c.emit(hookEvict, key, 0)
+	}
+	return true
+}
+
+// evictLRU removes the least recently accessed evictable entry, the oldest
+//
+// one of the recency lists of every stripe. Pinned and spared entries at the
+// oldest ends are skipped, so the cost grows with the amount of stripes and of pinned
+// entries, not with the amount of entries.
+//
+// Reports whether an entry was removed, false if every entry is pinned.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) evictLRU() bool {
+	now := c.now()
+	var victim *cacheEntry
+	for i := range c.recency {
+		entry := c.recency[i].oldest
+		for entry != nil && (!entry.IsEvictable(now) || c.isSpared(entry.Key)) {
+			entry = entry.Newer
+		}
+
+		if entry != nil && (victim == nil || entry.LastAccess < victim.LastAccess) {
+			victim = entry
+		}
+	}
+
+	return victim != nil && c.evict(victim.Key, victim)
+}
+
+// evictVolatileRandom removes up to `n` randomly chosen entries with TTL,
+//
+// never touching entries without expiration, pinned or spared ones.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) evictVolatileRandom(n int) {
+	now := c.now()
+	volatile := c.entries.Sample(n, func(key []byte, entry *cacheEntry) bool {
+		return entry.HasTTL() && entry.IsEvictable(now) && !c.isSpared(key)
+	})
+
+	for _, e := range volatile {
+		c.evict(e.Key, e.Value)
+	}
+}
+
+// ExpirationHistogram counts live entries by remaining TTL.
+//
+// Each entry is counted under the smallest bucket greater than its remaining TTL.
+// Entries lasting at least the largest bucket are counted under math.MaxInt64.
+//
+// Permanent entries are counted separately under NoExpiration, so
+// non-positive buckets are ignored. Tombstones and keys cached by SetNotFound
+// are not counted, like Keys
+func (c *ActiveCache) ExpirationHistogram(buckets []time.Duration) map[time.Duration]int {
+	bounds := make([]time.Duration, 0, len(buckets)+1)
+	for _, b := range buckets {
+		if b > NoExpiration {
+			bounds = append(bounds, b)
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	bounds = append(bounds, math.MaxInt64)
+
+	c.rlock()
+	defer c.runlock()
+
+	now := c.now()
+	histogram := map[time.Duration]int{}
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if entry.Tombstone || entry.NotFound {
+			return true
+		}
+
+		if !entry.HasTTL() {
+			histogram[NoExpiration]++
+			return true
+		}
+
+		if entry.IsExpired(now) {
+			return true
+		}
+
+		remaining := entry.RemainingTTL(now)
+		i := sort.Search(len(bounds), func(i int) bool { return remaining < bounds[i] })
+		histogram[bounds[i]]++
+		return true
+	})
+
+	return histogram
+}
+
+// ExpiredCount returns the estimated amount of entries that are expired
+//
+// but still stored because the cleaner has not removed them yet.
+//
+// The value is extrapolated from the expired ratio observed by the last clean
+// cycle, so it is refreshed once per cycle and is only an estimate.
+//
+// It is exact (zero) when the last cycle inspected every entry with TTL
+func (c *ActiveCache) ExpiredCount() int {
+	return int(min(c.expiredEstimate.Load(), c.expiring.Load()))
+}
+
+// ExpiringCount returns the exact amount of stored entries with TTL,
+//
+// including expired entries not removed yet
+func (c *ActiveCache) ExpiringCount() int {
+	return int(c.expiring.Load())
+}
+
+// ExpiringSoon returns the channel receiving the keys of entries about to expire,
+//
+// see Config.ExpiryWarning. It holds up to ExpiryWarningBufferSize keys,
+// warnings sent while it is full are dropped and counted in
+// Stats.ExpiryWarningsDropped. The channel is never closed
+func (c *ActiveCache) ExpiringSoon() <-chan []byte {
+	return c.expiryWarnings
+}
+
+// Flush removes every entry, reporting each one to Hooks as deleted
+func (c *ActiveCache) Flush() {
+	c.lock("set")
+	defer c.unlock()
+
+	c.removeAll()
+}
+
+// ForEach calls `fn` for each live entry with its remaining TTL
+//
+// until `fn` returns false.
+//
+// Entries are copied under the read lock first (see Entries) and `fn` is
+// called without holding any lock, so it may safely call back into the cache.
+//
+// Iteration order is unspecified
+func (c *ActiveCache) ForEach(fn func(key, value []byte, ttl time.Duration) bool) {
+	for _, item := range c.Entries() {
+		if !fn(item.Key, item.Value, item.TTL) {
+			return
+		}
+	}
+}
+
+// Get returns Value and TTL from specified key if it exists.
+//
+// If key is nil OR does not exist returns (nil, 0)
+func (c *ActiveCache) Get(key []byte) ([]byte, time.Duration) {
+	if key == nil {
+		return emptyValueTTL()
+	}
+
+	value, ttl, _ := c.GetE(key)
+	return value, ttl
+}
+
+// GetBatch returns one BatchResult per key, at the same index as the key.
+//
+// Missing, expired and nil keys are reported with Found set to false.
+//
+// All keys are read under a single acquisition of the cache lock, holding
+// every stripe, so the results are consistent with each other
+func (c *ActiveCache) GetBatch(keys [][]byte) []BatchResult {
+	results := make([]BatchResult, len(keys))
+
+	c.lock("get")
+	defer c.unlock()
+
+	for i, key := range keys {
+		if key == nil {
+			continue
+		}
+
+		if value, ttl, err := c.getE(key); err == nil {
+			results[i] = BatchResult{Value: value, TTL: ttl, Found: true}
+		}
+	}
+
+	return results
+}
+
+// GetByPrefix returns copies of every live entry whose key starts with `prefix`,
+//
+// at most `limit` of them unless `limit` is zero or negative. An empty prefix
+// matches every entry.
+//
+// Storage is not ordered, so it scans all entries in O(n) under the read lock
+// and results are returned in no particular order
+func (c *ActiveCache) GetByPrefix(prefix []byte, limit int) []Item {
+	c.rlock()
+	defer c.runlock()
+
+	now := c.now()
+	items := []Item{}
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !bytes.HasPrefix(key, prefix) || entry.IsExpired(now) || entry.NotFound {
+			return true
+		}
+
+		items = append(items, Item{
+			Key:   bytes.Clone(key),
+			Value: bytes.Clone(entry.Bytes()),
+			TTL:   entry.RemainingTTL(now),
+		})
+		return limit <= 0 || len(items) < limit
+	})
+
+	return items
+}
+
+// GetCtx behaves like GetE, but gives up waiting for the cache lock
+//
+// when `ctx` is cancelled or its deadline is exceeded, returning ctx.Err().
+//
+// Misses pass `ctx` to `Config.Backing` if it is a ContextBacking, a plain
+// Backing is not consulted once `ctx` is done
+func (c *ActiveCache) GetCtx(ctx context.Context, key []byte) (value []byte, ttl time.Duration, err error) {
+	if key == nil {
+		return nil, 0, ErrNilKey
+	}
+
+	if err := c.lockCtx(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	// Registered after locking, so `Config.Backing` is consulted once unlocked
+	defer func() {
+		if err == ErrKeyNotFound || err == ErrKeyExpired {
+			value, ttl, err = c.readThroughCtx(ctx, key, err)
+		}
+	}()
+	defer c.unlock()
+
+	return c.getE(key)
+}
+
+// GetE returns Value and TTL from specified key like Get,
+//
+// but also reports why a value could not be returned.
+//
+// Returns ErrNilKey if key is nil, ErrKeyNotFound if key does not exist
+// and ErrKeyExpired if key exists but is expired. Error is nil on hit,
+//
+// so an empty stored value can be told apart from a miss.
+//
+// Returns ErrNegativeCached if key was cached as not found by SetNotFound
+// and ErrKeyDeleted if it is kept as a tombstone, see Config.TombstoneTTL.
+//
+// On a miss the key is loaded from `Config.Backing` if set, returning its
+// error unless the backing store does not have the key either
+func (c *ActiveCache) GetE(key []byte) (value []byte, ttl time.Duration, err error) {
+	if key == nil {
+		return nil, 0, ErrNilKey
+	}
+
+	// Runs after unlocking, Backing is never called while holding the lock
+	defer func() {
+		if err == ErrKeyNotFound || err == ErrKeyExpired {
+			value, ttl, err = c.readThrough(key, err)
+		}
+	}()
+
+	//Lock cache while reading
+	stripe := c.lockKey("get", c.entries.Stripe(key))
+	defer c.unlockKey(stripe)
+
+	return c.getE(key)
+}
+
+// getE looks up `key` without locking. Caller must hold the lock
+func (c *ActiveCache) getE(key []byte) ([]byte, time.Duration, error) {
+	if c.State() == Closed {
+		return nil, 0, ErrClosed
+	}
+
+	entry, ok := c.entries.Get(key)
+	return c.readEntry(key, entry, ok)
+}
+
+// GetEntry returns everything stored about a live `key` and `true`,
+//
+// or an empty EntryInfo and `false` if it is not stored, expired, negative
+// cached or deleted. Fields are copied under the cache lock, and unlike Get
+// the call is not counted as an access, a hit or a hook event.
+//
+// Every field is always populated. EntryInfo.Value is decompressed with
+// `Config.Compress`, EntryInfo.ExpiresAt includes `Config.TTLJitter` unlike
+// EntryInfo.TTL, and EntryInfo.CreatedAt holds Op.Timestamp for writes of ApplyOp
+func (c *ActiveCache) GetEntry(key []byte) (EntryInfo, bool) {
+	if key == nil {
+		return EntryInfo{}, false
+	}
+
+	stripe := c.lockKey("get", c.entries.Stripe(key))
+	defer c.unlockKey(stripe)
+
+	entry, ok := c.entries.Get(key)
+	if !ok || entry.IsExpired(c.now()) || entry.NotFound {
+		return EntryInfo{}, false
+	}
+
+	info := EntryInfo{
+		Value:        bytes.Clone(entry.Bytes()),
+		TTL:          entry.Ttl,
+		RemainingTTL: entry.RemainingTTL(c.now()),
+		CreatedAt:    time.Unix(0, entry.CreatedAt),
+		LastAccessAt: time.Unix(0, entry.AccessedAt),
+		Version:      entry.Version,
+		Hits:         entry.Hits,
+		Pinned:       entry.Pinned,
+	}
+	if entry.HasTTL() {
+		info.ExpiresAt = time.Unix(0, entry.ExpiresAt)
+	}
+
+	return info, true
+}
+
+// GetMulti reads every key under a single lock, implementing BatchCache,
+//
+// see GetBatch
+func (c *ActiveCache) GetMulti(keys [][]byte) []BatchResult {
+	return c.GetBatch(keys)
+}
+
+// GetOK returns Value and TTL from specified key and whether it was found.
+//
+// ok is false if key is nil, does not exist, is expired or is cached as not
+// found by SetNotFound. GetWithState tells a negative hit apart from a miss
+func (c *ActiveCache) GetOK(key []byte) ([]byte, time.Duration, bool) {
+	value, ttl, err := c.GetE(key)
+	return value, ttl, err == nil
+}
+
+// GetOrDefault returns the Value stored for the specified key if it exists
+//
+// and is not expired, otherwise returns a copy of `def` (nil if `def` is nil).
+//
+// The default is never stored
+func (c *ActiveCache) GetOrDefault(key, def []byte) []byte {
+	if value, _, err := c.GetE(key); err == nil {
+		return value
+	}
+
+	return bytes.Clone(def)
+}
+
+// GetString returns Value and TTL stored for string key `key` like Get,
+//
+// hashing the key without converting it to []byte. String and []byte keys
+// with the same bytes address the same entry.
+//
+// The key is only copied when a hook or `Config.Backing` needs it
+func (c *ActiveCache) GetString(key string) (value []byte, ttl time.Duration) {
+	var err error
+	// Runs after unlocking, Backing is never called while holding the lock
+	defer func() {
+		if (err == ErrKeyNotFound || err == ErrKeyExpired) && c.config.Load().Backing != nil {
+			value, ttl, _ = c.readThrough([]byte(key), err)
+		}
+	}()
+
+	stripe := c.lockKey("get", c.entries.StripeString(key))
+	defer c.unlockKey(stripe)
+
+	if c.State() == Closed {
+		return nil, 0
+	}
+
+	// Also needed to remove an entry failing `Config.VerifyChecksums`
+	var hookKey []byte
+	if conf := c.config.Load(); conf.Hooks != nil || conf.VerifyChecksums {
+		hookKey = []byte(key)
+	}
+
+	entry, ok := c.entries.GetString(key)
+	value, ttl, err = c.readEntry(hookKey, entry, ok)
+	return value, ttl
+}
+
+// GetWithState returns Value, TTL and lookup state of specified key,
+//
+// telling a stored value (Present) apart from a key cached as not found by
+// SetNotFound (NegativeCached), from a key kept as a tombstone (Deleted, see
+// Config.TombstoneTTL) and from a key without live entry (Missing).
+//
+// Value and TTL are only set when Present. Misses are loaded from
+// `Config.Backing` like GetE, a failed load reports Missing
+func (c *ActiveCache) GetWithState(key []byte) ([]byte, EntryState, time.Duration) {
+	value, ttl, err := c.GetE(key)
+	switch err {
+	case nil:
+		return value, Present, ttl
+	case ErrNegativeCached:
+		return nil, NegativeCached, 0
+	case ErrKeyDeleted:
+		return nil, Deleted, 0
+	default:
+		return nil, Missing, 0
+	}
+}
+
+// Has reports whether `key` is stored and not expired,
+//
+// without recording an access or calling Hooks. Returns false if key is nil
+func (c *ActiveCache) Has(key []byte) bool {
+	if key == nil {
+		return false
+	}
+
+	stripe := c.lockKey("get", c.entries.Stripe(key))
+	defer c.unlockKey(stripe)
+
+	entry, ok := c.entries.Get(key)
+	return ok && !entry.IsExpired(c.now()) && !entry.NotFound
+}
+
+// IsCleanerPaused reports whether the cleaner skips its cycles, see PauseCleaner
+func (c *ActiveCache) IsCleanerPaused() bool {
+	return c.cleanerPaused.Load()
+}
+
+// IsCleanerRunning reports whether the cleaner is running
+func (c *ActiveCache) IsCleanerRunning() bool {
+	return c.isCleanerRunning.Load()
+}
+
+// isSpared reports whether eviction must keep `key`, see ActiveCache.spared.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) isSpared(key []byte) bool {
+	return c.spared != nil && c.spared(key)
+}
+
+// isUnchanged reports whether writing `value` with `ttl` and `opts` would leave
+//
+// the live entry of `key` as it is, see WithSkipIfEqual.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) isUnchanged(key, value []byte, ttl time.Duration, opts setOptions) bool {
+	if ttl < NoExpiration {
+		return false
+	}
+
+	old, ok := c.entries.Get(key)
+	if !ok || old.IsExpired(c.now()) || old.NotFound || old.Ttl != c.clampTTL(ttl) || (opts.pinned && !old.Pinned) || old.Cost != opts.cost {
+		return false
+	}
+
+	// Cheap length check first, large values differ in length most of the time
+	if !old.Compressed && len(old.Value) != len(value) {
+		return false
+	}
+
+	return bytes.Equal(old.Bytes(), value)
+}
+
+// Items returns a copy of every live key and value.
+//
+// Memory cost: like Entries, all live data is duplicated, plus the map itself,
+// so on huge caches prefer ForEach or Snapshot to avoid building the map
+func (c *ActiveCache) Items() map[string][]byte {
+	entries := c.Entries()
+	items := make(map[string][]byte, len(entries))
+	for _, item := range entries {
+		items[string(item.Key)] = item.Value
+	}
+
+	return items
+}
+
+// jitter returns the random offset added to the expiration of an entry
+//
+// written with positive `ttl`, see `Config.TTLJitter`
+func (c *ActiveCache) jitter(ttl time.Duration) time.Duration {
+	conf := c.config.Load()
+	if conf.TTLJitter <= 0 {
+		return 0
+	}
+
+	if !conf.TTLJitterBothWays {
+		return time.Duration(rand.Int63n(int64(conf.TTLJitter) + 1))
+	}
+
+	// Early expiry is capped, so entries live at least half their TTL
+	early := min(conf.TTLJitter, ttl/2)
+	return time.Duration(rand.Int63n(int64(early)+int64(conf.TTLJitter)+1)) - early
+}
+
+// Keys returns copies of every live key in no particular order.
+//
+// Storage is scanned in O(n) under the read lock
+func (c *ActiveCache) Keys() [][]byte {
+	c.rlock()
+	defer c.runlock()
+
+	now := c.now()
+	keys := make([][]byte, 0, c.length.Load())
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !entry.IsExpired(now) && !entry.NotFound {
+			keys = append(keys, bytes.Clone(key))
+		}
+		return true
+	})
+
+	return keys
+}
+
+// KeysSorted returns copies of every live key like Keys, ordered by key bytes.
+//
+// Sorting costs O(n log n) after the scan, without holding the lock
+func (c *ActiveCache) KeysSorted() [][]byte {
+	keys := c.Keys()
+	sortByKey(keys, func(key []byte) []byte { return key })
+	return keys
+}
+
+// LastCleanPanic returns the last panic recovered from a clean cycle
+//
+// as a *CleanPanicError, or nil if the cleaner never panicked
+func (c *ActiveCache) LastCleanPanic() error {
+	if err := c.lastCleanPanic.Load(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Len returns the amount of stored entries, expired or not.
+//
+// Tombstones are not counted, see Config.TombstoneTTL
+func (c *ActiveCache) Len() int {
+	return int(c.length.Load() - c.tombstones.Load())
+}
+
+// linkRecency links `entry`, just stored with `key`, in the recency list of its
+//
+// stripe: at the newest end, or at the oldest one if it was never accessed
+// such as tombstones. `old`, the entry it replaced if any, is unlinked and its
+// key reused, since the hashmap keeps the key an entry was first stored with.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) linkRecency(key []byte, old, entry *cacheEntry) {
+	if old != nil && old.Key != nil {
+		key = old.Key
+		c.recencyOf(key).unlink(old)
+	}
+
+	if entry.LastAccess == 0 {
+		c.recencyOf(key).linkOldest(key, entry)
+	} else {
+		c.recencyOf(key).link(key, entry)
+	}
+}
+
+// LoadFactor returns the amount of stored entries per storage bucket
+func (c *ActiveCache) LoadFactor() float64 {
+	c.rlock()
+	defer c.runlock()
+
+	return c.entries.LoadFactor()
+}
+
+// lock acquires the write lock for operation `op`, reporting how long
+//
+// it waited to `Config.LockWaitObserver` when it is set.
+//
+// With `Config.LockStripes` every stripe is acquired too, so no Get or Set
+// of any key runs while it is held
+func (c *ActiveCache) lock(op string) {
+	observer := c.config.Load().LockWaitObserver
+	if observer == nil {
+		c.mtx.Lock()
+		c.lockStripes()
+		return
+	}
+
+	start := time.Now()
+	c.mtx.Lock()
+	c.lockStripes()
+	observer(op, time.Since(start))
+}
+
+// lockCtx acquires the cache write lock unless `ctx` is done first.
+//
+// If the context wins, the pending acquisition is released as soon as it
+// completes, so the lock is never leaked. Returns ctx.Err() on failure
+func (c *ActiveCache) lockCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Stripes are only held briefly by Get and Set, waiting for them is fine
+	if c.mtx.TryLock() {
+		c.lockStripes()
+		return nil
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		c.mtx.Lock()
+		c.lockStripes()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			c.unlockStripes()
+			c.mtx.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// lockKey acquires the lock guarding the keys of entries stripe `stripe`
+//
+// for operation `op` ("get" or "set") and returns the stripe to release with
+// unlockKey. With `Config.LockStripes` it is the lock of that stripe only,
+// otherwise the write lock like lock, returning -1.
+//
+// Writes take every stripe instead while a write may have to make room, as
+// evictions remove keys of other stripes, see stripeHasRoom
+func (c *ActiveCache) lockKey(op string, stripe int) int {
+	if c.stripes == nil {
+		c.lock(op)
+		return -1
+	}
+
+	if observer := c.config.Load().LockWaitObserver; observer != nil {
+		start := time.Now()
+		defer func() { observer(op, time.Since(start)) }()
+	}
+
+	c.stripes[stripe].Lock()
+	if op == "set" && !c.stripeHasRoom() {
+		c.stripes[stripe].Unlock()
+		c.mtx.Lock()
+		c.lockStripes()
+		return -1
+	}
+
+	return stripe
+}
+
+// lockStripes acquires every stripe lock in index order, the order
+//
+// everyone holding more than one stripe uses. Caller must hold mtx
+func (c *ActiveCache) lockStripes() {
+	for i := range c.stripes {
+		c.stripes[i].Lock()
+	}
+}
+
+// MemoryUsage returns the approximate memory used by entries in bytes.
+//
+// Each entry costs len(key) + len(value) + EntryOverheadBytes.
+//
+// Expired entries are accounted until the cleaner removes them
+func (c *ActiveCache) MemoryUsage() int64 {
+	return c.memoryUsage.Load()
+}
+
+// nextCleanInterval returns the interval until the next clean cycle.
+//
+// After `Config.CleanerBackoffCycles` consecutive cycles removing nothing
+// the interval is multiplied by `Config.CleanerBackoffFactor`, up to
+// `Config.CleanerBackoffMax`. It resets to `Config.CleanerInterval`
+// as soon as a cycle removes any entry.
+//
+// It is halved once after a cycle ran out of `Config.MaxCleanDuration`
+// with a high expired ratio.
+//
+// Must only be called by the cleaner
+func (c *ActiveCache) nextCleanInterval(removed bool) time.Duration {
+	conf := c.config.Load()
+	base := time.Millisecond * time.Duration(conf.CleanerInterval)
+	backoffMax := time.Millisecond * time.Duration(conf.CleanerBackoffMax)
+	if c.cleanHurry.Swap(false) {
+		c.cleanIdleCycles = 0
+		c.cleanInterval = base
+		return base / 2
+	}
+
+	if removed || backoffMax <= base || c.cleanInterval < base {
+		c.cleanIdleCycles = 0
+		c.cleanInterval = base
+		return c.cleanInterval
+	}
+
+	c.cleanIdleCycles++
+	if c.cleanIdleCycles >= conf.CleanerBackoffCycles {
+		c.cleanIdleCycles = 0
+		c.cleanInterval = min(backoffMax, time.Duration(float64(c.cleanInterval)*conf.CleanerBackoffFactor))
+	}
+
+	return c.cleanInterval
+}
+
+// notifyState calls `Config.OnStateChange` if set
+func (c *ActiveCache) notifyState(from, to CacheState) {
+	if f := c.config.Load().OnStateChange; f != nil {
+		f(from, to)
+	}
+}
+
+// PauseCleaner makes the cleaner skip its cycles until ResumeCleaner,
+//
+// e.g. to avoid lock contention during a bulk import. Unlike StopCleaner the
+// goroutine keeps running, so pausing and resuming are cheap. Expired entries
+// are still hidden from reads while paused.
+//
+// The pause is kept across StopCleaner and StartCleaner, CleanNow still cleans
+func (c *ActiveCache) PauseCleaner() {
+	c.cleanerPaused.Store(true)
+}
+
+// PeekExpired returns the stored Value of `key` even if it is expired,
+//
+// with the time it expired or will expire at (zero if it never expires).
+// It is a debugging API telling a key awaiting cleanup apart from a removed one:
+// ok is false only when the key is not stored at all, e.g. the cleaner already
+// removed it. A tombstone is returned with a nil value and the time it
+// is purged at, see Config.TombstoneTTL and GetWithState.
+//
+// It never mutates the cache: no access is recorded and no Hooks are called
+func (c *ActiveCache) PeekExpired(key []byte) (value []byte, expiredAt time.Time, ok bool) {
+	if key == nil {
+		return nil, time.Time{}, false
+	}
+
+	stripe := c.lockKey("get", c.entries.Stripe(key))
+	defer c.unlockKey(stripe)
+
+	entry, ok := c.entries.Get(key)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+
+	if entry.ExpiresAt != NoExpiration {
+		expiredAt = time.Unix(0, entry.ExpiresAt)
+	}
+
+	if entry.Tombstone {
+		return nil, expiredAt, true
+	}
+
+	return entry.Bytes(), expiredAt, true
+}
+
+// performClean locks cache entries and perform clean function.
+//
+// Reports whether any entry was removed.
+//
+// Cycles are skipped without locking while no entry has TTL, see ExpiringCount.
+//
+// A panic in the clean function or the dispatched Hooks is recovered
+// after the lock is released and reported to `Config.OnCleanPanic`,
+// so the cleaner keeps running
+func (c *ActiveCache) performClean() (removed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.reportCleanPanic(&CleanPanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+
+	if c.expiring.Load() == 0 && !c.overCapacity() {
+		c.expiredEstimate.Store(0)
+		c.lastCleanAt.Store(c.now().UnixNano())
+		return false
+	}
+
+	c.lock("clean")
+	defer c.unlock()
+
+	c.cleanCycleStart = c.now()
+	before := c.length.Load()
+	c.cleanFunc(c)
+	c.trimToCapacity()
+	c.lastCleanAt.Store(c.now().UnixNano())
+	return c.length.Load() < before
+}
+
+// Pin excludes an existing live Key from eviction, see WithPinned.
+//
+// Returns false if key is nil, does not exist, is expired or cached as not found
+func (c *ActiveCache) Pin(key []byte) bool {
+	return c.setPinned(key, true)
+}
+
+// PreviewClean returns copies of the keys a clean cycle would remove now,
+//
+// without removing anything, to check KeysAmountByCycle and
+// ExpiredKeysPercentageTolerance against real traffic. It inspects a single
+// random sample of up to `Config.KeysAmountByCycle` entries under the read lock
+// and returns the expired ones, tombstones included.
+//
+// It is a sample, not the full expired set: a cycle removing many expired keys
+// samples again, and `Config.SequentialScan` is ignored as its position is
+// kept by the cleaner. Use ExpiredCount for an estimate of the whole cache
+func (c *ActiveCache) PreviewClean() [][]byte {
+	c.rlock()
+	defer c.runlock()
+
+	now := c.now()
+	var keys [][]byte
+	for _, e := range c.entries.Sample(c.config.Load().KeysAmountByCycle, nil) {
+		if e.Value.IsExpired(now) {
+			keys = append(keys, bytes.Clone(e.Key))
+		}
+	}
+
+	return keys
+}
+
+// readEntry returns the result of a lookup of `key` that found `entry`
+//
+// when ok, counting it and emitting its hook. Caller must hold the lock
+func (c *ActiveCache) readEntry(key []byte, entry *cacheEntry, ok bool) ([]byte, time.Duration, error) {
+	if !ok {
+		c.misses.Add(1)
+		c.emit(hookGetMiss, key, 0)
+		return nil, 0, ErrKeyNotFound
+	}
+
+	if entry.IsExpired(c.now()) {
+		c.misses.Add(1)
+		c.emit(hookGetMiss, key, 0)
+		return nil, 0, ErrKeyExpired
+	}
+
+	if entry.Tombstone {
+		c.misses.Add(1)
+		c.emit(hookGetMiss, key, 0)
+		return nil, 0, ErrKeyDeleted
+	}
+
+	if entry.Checksummed && !c.verifyChecksum(key, entry) {
+		c.misses.Add(1)
+		c.emit(hookGetMiss, key, 0)
+		return nil, 0, ErrKeyNotFound
+	}
+
+	c.touch(entry)
+	if entry.NotFound {
+		c.misses.Add(1)
+		c.emit(hookGetMiss, key, 0)
+		return nil, 0, ErrNegativeCached
+	}
+
+	c.hits.Add(1)
+	entry.Hits++
+	c.emit(hookGetHit, key, 0)
+	return entry.Bytes(), entry.Ttl, nil
+}
+
+// ReadOnly returns a view of the cache exposing only reads, for components
+//
+// that must not write. The view reads live data under the same locks as the
+// cache, Get loading misses from `Config.Backing` like ActiveCache.Get
+func (c *ActiveCache) ReadOnly() ReadOnlyCache {
+	return &readOnlyCache{cache: c}
+}
+
+// recencyOf returns the recency list of the stripe storing `key`
+func (c *ActiveCache) recencyOf(key []byte) *recencyList {
+	return &c.recency[c.entries.Stripe(key)]
+}
+
+// Reconfigure validates `conf` and atomically replaces the whole config,
+//
+// so every parameter takes effect at once. A running cleaner restarts its
+// interval from the new `Config.CleanerInterval`.
+//
+// A nil `conf` resets to DefaultConfig. `conf` must not be modified afterwards
+func (c *ActiveCache) Reconfigure(conf *Config) {
+	if conf == nil {
+		conf = DefaultConfig()
+	} else {
+		validateAndAdjustConfig(conf)
+	}
+
+	c.config.Store(conf)
+
+	select {
+	case c.reconfigChan <- struct{}{}:
+	default:
+	}
+}
+
+// RemapTTL replaces the remaining TTL of every live entry with the one `f`
+//
+// returns for it, e.g. to cap every remaining TTL or extend them all, under a
+// single write lock acquisition. `f` receives NoExpiration for permanent
+// entries. Returning NoExpiration makes the entry permanent and a negative
+// value deletes it, like Set.
+//
+// New TTLs are capped by `Config.MaxTTL` without jitter. Changed entries are
+// reported to Hooks as set or deleted, `Config.Backing` is not written.
+// Keys cached by SetNotFound and tombstones are left untouched.
+//
+// `f` runs while the lock is held and must not call the cache
+func (c *ActiveCache) RemapTTL(f func(remaining time.Duration) time.Duration) {
+	c.lock("set")
+	defer c.unlock()
+
+	now := c.now()
+
+	type remap struct {
+		key   []byte
+		entry *cacheEntry
+		ttl   time.Duration
+	}
+
+	// Entries are changed once the range completes, deletes cannot run during it
+	var remaps []remap
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !entry.IsExpired(now) && !entry.NotFound {
+			remaps = append(remaps, remap{key: key, entry: entry, ttl: f(entry.RemainingTTL(now))})
+		}
+		return true
+	})
+
+	for _, r := range remaps {
+		if r.ttl < NoExpiration {
+			if c.deleteOrBury(r.key, now) {
+				c.emit(hookDelete, r.key, 0)
+			}
+			continue
+		}
+
+		entry := r.entry
+		c.track(r.key, entry, -1)
+		entry.Ttl = c.clampTTL(r.ttl)
+		entry.ExpiresAt = NoExpiration
+		if entry.Ttl > NoExpiration {
+			entry.ExpiresAt = now.Add(entry.Ttl).UnixNano()
+		}
+
+		// The expiration changed, so is warned again
+		entry.Warned = false
+
+		c.track(r.key, entry, 1)
+		c.emit(hookSet, r.key, entry.Ttl)
+	}
+}
+
+// removeAll removes every entry, reporting each one to Hooks as deleted.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) removeAll() {
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !entry.Tombstone {
+			c.emit(hookDelete, key, 0)
+		}
+		return true
+	})
+
+	c.entries.Clear()
+	clear(c.recency)
+	c.length.Store(0)
+	c.memoryUsage.Store(0)
+	c.cost.Store(0)
+	c.expiring.Store(0)
+	c.expiredEstimate.Store(0)
+	c.tombstones.Store(0)
+}
+
+// reportCleanPanic records `err` as the last clean panic
+//
+// and reports it to `Config.OnCleanPanic` or the standard logger
+func (c *ActiveCache) reportCleanPanic(err *CleanPanicError) {
+	c.lastCleanPanic.Store(err)
+
+	if onPanic := c.config.Load().OnCleanPanic; onPanic != nil {
+		onPanic(err)
+		return
+	}
+
+	log.Printf("%v\n%s", err, err.Stack)
+}
+
+// ResumeCleaner makes a cleaner paused by PauseCleaner run its cycles again,
+//
+// from its next scheduled cycle. Does nothing if it is not paused
+func (c *ActiveCache) ResumeCleaner() {
+	c.cleanerPaused.Store(false)
+}
+
+// rlock acquires the read lock, and with `Config.LockStripes` every stripe
+//
+// in index order, so no Get or Set of any key runs while it is held
+func (c *ActiveCache) rlock() {
+	c.mtx.RLock()
+	for i := range c.stripes {
+		c.stripes[i].RLock()
+	}
+}
+
+// runCleaner runs a clean cycle every time `Config.Scheduler` is due, or every
+//
+// interval without it, until `stop` is closed, then closes `done`. Both follow
+// Reconfigure, the backoff and CleanHighWater, see Scheduler
+func (c *ActiveCache) runCleaner(stop chan interface{}, done chan struct{}) {
+	defer close(done)
+
+	fallback := &intervalScheduler{}
+	scheduler := func() Scheduler {
+		if sched := c.config.Load().Scheduler; sched != nil {
+			return sched
+		}
+		return fallback
+	}
+
+	sched := scheduler()
+	c.cleanInterval = 0
+	due := sched.Next(c.nextCleanInterval(true))
+	for {
+		select {
+		case <-stop:
+			sched.Stop()
+			return
+		case <-c.reconfigChan:
+			if next := scheduler(); next != sched {
+				sched.Stop()
+				sched = next
+			}
+
+			c.cleanInterval = 0
+			due = sched.Next(c.nextCleanInterval(true))
+		case <-c.cleanSignal:
+			sinceLastClean := c.now().Sub(time.Unix(0, c.lastCleanAt.Load()))
+			if c.cleanerPaused.Load() || sinceLastClean < MinCleanerInterval*time.Millisecond {
+				continue
+			}
+
+			due = sched.Next(c.nextCleanInterval(c.performClean()))
+		case <-due:
+			if c.cleanerPaused.Load() {
+				// Skipped cycles leave the interval and its backoff untouched
+				due = sched.Next(c.cleanInterval)
+				continue
+			}
+
+			due = sched.Next(c.nextCleanInterval(c.performClean()))
+		}
+	}
+}
+
+// runlock releases the read lock acquired by rlock
+func (c *ActiveCache) runlock() {
+	for i := range c.stripes {
+		c.stripes[i].RUnlock()
+	}
+	c.mtx.RUnlock()
+}
+
+// Scan returns up to `limit` live items starting at `cursor`, the cursor to
+//
+// resume from and whether the scan is done, like Redis SCAN. Start with the
+// zero hashmap.Cursor and call again with the returned one until done, each
+// call holding the read lock only for its own page. A `limit` below 1 is 1.
+//
+// Every key stored for the whole scan is returned exactly once, even if its
+// value changes. Keys set or deleted meanwhile may or may not be returned, and
+// an entry expiring during the scan is returned only if reached before. A page
+// may be empty before the scan is done.
+//
+// Items are copies like Entries, with Item.TTL holding the remaining TTL
+func (c *ActiveCache) Scan(cursor hashmap.Cursor, limit int) ([]Item, hashmap.Cursor, bool) {
+	c.rlock()
+	defer c.runlock()
+
+	now := c.now()
+	entries, next := c.entries.ScanCursor(cursor, max(limit, 1), func(key []byte, entry *cacheEntry) bool {
+		return !entry.IsExpired(now) && !entry.NotFound
+	})
+
+	items := make([]Item, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, Item{
+			Key:   bytes.Clone(e.Key),
+			Value: bytes.Clone(e.Value.Bytes()),
+			TTL:   e.Value.RemainingTTL(now),
+		})
+	}
+
+	return items, next, next.Done()
+}
+
+// Set sets Value for specified Key with TTL.
+//
+// If TTL is equal to NoExpiration (zero), then it will never expires.
+//
+// Prefer SetPermanent for clarity on never-expiring entries.
+//
+// If TTL is negative (e.g. ExpireNow) the key expires instantly.
+//
+// TTLs longer than MaxSupportedTTL, about 100 years, are stored as
+// MaxSupportedTTL, so huge computed durations never wrap to an expired entry.
+//
+// With `Config.AsyncWrites` the write is queued like SetAsync
+func (c *ActiveCache) Set(key, value []byte, ttl time.Duration) {
+	if c.config.Load().AsyncWrites {
+		c.SetAsync(key, value, ttl)
+		return
+	}
+
+	// Rejected writes are silently dropped, SetE reports the reason
+	_ = c.SetE(key, value, ttl)
+}
+
+// set stores Value for specified Key with TTL without locking.
+//
+// Returns ErrCacheFull if a new key is rejected by `Config.FullBehavior`.
+//
+// Caller must hold the write lock and ensure key is not nil
+func (c *ActiveCache) set(key, value []byte, ttl time.Duration) error {
+	return c.setEntry(key, value, ttl, setOptions{})
+}
+
+// SetCleanFunc replaces the cleaner algorithm with `f`, run on every
+//
+// clean cycle. Removed keys are reported to Hooks as expired or deleted.
+//
+// A nil `f` restores the default sampling algorithm
+func (c *ActiveCache) SetCleanFunc(f CleanFunc) {
+	c.lock("set")
+	defer c.unlock()
+
+	if f == nil {
+		c.cleanFunc = defaultClean
+		return
+	}
+
+	c.cleanFunc = func(c *ActiveCache) {
+		views := make([]EntryView, 0, c.length.Load())
+		c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+			views = append(views, entry.View(key))
+			return true
+		})
+
+		for _, key := range f(views) {
+			if entry, ok := c.entries.Get(key); ok {
+				c.evict(key, entry)
+			}
+		}
+	}
+}
+
+// SetCtx behaves like SetE, but gives up waiting for the cache lock
+//
+// when `ctx` is cancelled or its deadline is exceeded, returning ctx.Err().
+//
+// Nothing is written once `ctx` is done before the write is applied. The
+// applied write is passed to `Config.Backing` without the cancellation of
+// `ctx`, so a context done meanwhile never removes it again. A ContextBacking
+// still receives the values of `ctx`, unless writes are queued by
+// `Config.WriteBehind`. A failed backing write removes the key like SetE
+func (c *ActiveCache) SetCtx(ctx context.Context, key, value []byte, ttl time.Duration) (err error) {
+	if err := c.validateEntry(key, value, ttl); err != nil {
+		return err
+	}
+
+	if err := c.lockCtx(ctx); err != nil {
+		return err
+	}
+
+	// Registered after locking, so `Config.Backing` is written once unlocked
+	var entry *cacheEntry
+	defer func() {
+		if err == nil {
+			err = c.writeThroughCtx(context.WithoutCancel(ctx), key, value, ttl, entry)
+		}
+	}()
+	defer c.unlock()
+
+	// The lock may be acquired right as `ctx` is done
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := c.set(key, value, ttl); err != nil {
+		return err
+	}
+
+	entry, _ = c.entries.Get(key)
+	return nil
+}
+
+// SetE sets Value for specified Key with TTL like Set, but reports rejected writes.
+//
+// Returns ErrNilKey if key is nil, ErrKeyTooLarge if key exceeds `Config.MaxKeyBytes`
+// and ErrValueTooLarge if value exceeds `Config.MaxValueBytes`.
+//
+// Returns ErrCacheFull if the cache is full and `Config.FullBehavior` is RejectWrites.
+//
+// With `Config.Backing` set the write goes through to it, a failed synchronous
+// write removes the key from the cache and its error is returned
+func (c *ActiveCache) SetE(key, value []byte, ttl time.Duration) error {
+	return c.SetWithOptions(key, value, ttl)
+}
+
+// setEntry stores Value for specified Key with TTL like set, applying `opts`.
+//
+// Overwriting a pinned key keeps it pinned. Caller must hold the write lock
+func (c *ActiveCache) setEntry(key, value []byte, ttl time.Duration, opts setOptions) error {
+	if c.State() == Closed {
+		return ErrClosed
+	}
+
+	appliedAt := c.now()
+	writtenAt := appliedAt
+	if !opts.writtenAt.IsZero() {
+		writtenAt = opts.writtenAt
+	}
+
+	// delete key if ttl is negative
+	if ttl < NoExpiration {
+		if c.deleteOrBury(key, writtenAt) {
+			c.emit(hookDelete, key, 0)
+		}
+		return nil
+	}
+
+	if err := c.detectCollision(key); err != nil {
+		return err
+	}
+
+	ttl = c.clampTTL(ttl)
+	var expiresAt int64
+	if ttl > NoExpiration {
+		// Jitter never extends the lifetime past the cap either
+		expiresAt = appliedAt.Add(c.clampTTL(ttl + c.jitter(ttl))).UnixNano()
+	}
+
+	entry := &cacheEntry{
+		Ttl:       ttl,
+		ExpiresAt: expiresAt,
+		CreatedAt: writtenAt.UnixNano(),
+		NotFound:  opts.notFound,
+		Pinned:    opts.pinned,
+		Cost:      opts.cost,
+		Version:   1,
+	}
+	entry.Value, entry.Compressed = c.encodeValue(value)
+	if c.config.Load().VerifyChecksums {
+		entry.Checksum, entry.Checksummed = crc32.ChecksumIEEE(entry.Value), true
+	}
+
+	// Reject before ensureCapacity evicts anything for a write that cannot land
+	if err := c.admitCost(key, entry.Charge(key)); err != nil {
+		return err
+	}
+
+	if err := c.ensureCapacity(key); err != nil {
+		return err
+	}
+
+	if err := c.ensureCost(key, entry.Charge(key)); err != nil {
+		return err
+	}
+
+	c.touch(entry)
+	old, replaced := c.entries.Put(key, entry)
+	if replaced {
+		// Not visible to readers yet, the write lock is held
+		entry.Pinned = entry.Pinned || old.Pinned
+		entry.Version = old.Version + 1
+		c.track(key, old, -1)
+		c.emitReplace(key, old, value)
+	}
+	c.linkRecency(key, old, entry)
+	c.track(key, entry, 1)
+	c.emit(hookSet, key, ttl)
+
+	if highWater := c.config.Load().CleanHighWater; highWater > 0 && c.Len() > highWater {
+		select {
+		case c.cleanSignal <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// SetKeepTTL replaces the Value of an existing live Key keeping its
+//
+// expiration untouched, like Redis's SET ... KEEPTTL.
+//
+// Returns false and stores nothing if key is nil, does not exist, is expired,
+// the value exceeds `Config.MaxValueBytes` or the entry does not fit under
+// `Config.MaxCostBytes`. The entry is charged for its new key and value like
+// Set, a cost given to SetWithCost is not kept.
+//
+// A never-expiring entry stays permanent. `Config.Backing` errors are
+// only reported to `Config.OnBackingError`
+func (c *ActiveCache) SetKeepTTL(key, value []byte) (ok bool) {
+	if c.validateEntry(key, value, NoExpiration) != nil {
+		return false
+	}
+
+	var ttl time.Duration
+	var entry *cacheEntry
+	defer func() {
+		if ok {
+			c.writeThrough(key, value, ttl, entry)
+		}
+	}()
+
+	c.lock("set")
+	defer c.unlock()
+
+	if c.State() == Closed || c.detectCollision(key) != nil {
+		return false
+	}
+
+	now := c.now()
+	old, ok := c.entries.Get(key)
+	if !ok || old.IsExpired(now) || old.NotFound {
+		return false
+	}
+	ttl = old.RemainingTTL(now)
+
+	entry = &cacheEntry{
+		Ttl:       old.Ttl,
+		ExpiresAt: old.ExpiresAt,
+		CreatedAt: now.UnixNano(),
+		Pinned:    old.Pinned,
+		Version:   old.Version + 1,
+
+		// The expiration is kept, so is its warning
+		Warned: old.Warned,
+	}
+	entry.Value, entry.Compressed = c.encodeValue(value)
+	if c.config.Load().VerifyChecksums {
+		entry.Checksum, entry.Checksummed = crc32.ChecksumIEEE(entry.Value), true
+	}
+
+	// Checked like setEntry, making room never evicts the replaced entry
+	if c.admitCost(key, entry.Charge(key)) != nil {
+		return false
+	}
+
+	c.spared = func(k []byte) bool { return bytes.Equal(k, key) }
+	err := c.ensureCost(key, entry.Charge(key))
+	c.spared = nil
+	if err != nil {
+		return false
+	}
+
+	c.touch(entry)
+	c.entries.Put(key, entry)
+	c.linkRecency(key, old, entry)
+	c.track(key, old, -1)
+	c.track(key, entry, 1)
+	c.emitReplace(key, old, value)
+	c.emit(hookSet, key, entry.Ttl)
+	return true
+}
+
+// SetMany writes every item like SetE under a single write lock
+//
+// and returns one SetResult per item, in the same order.
+//
+// Item.TTL is used as the TTL to write with
+func (c *ActiveCache) SetMany(items []Item) []SetResult {
+	results := make([]SetResult, len(items))
+	for i, item := range items {
+		results[i] = SetResult{
+			Key: item.Key,
+			Err: c.validateEntry(item.Key, item.Value, item.TTL),
+		}
+	}
+
+	entries := make([]*cacheEntry, len(items))
+	c.lock("set")
+	for i, item := range items {
+		if results[i].Err == nil {
+			results[i].Err = c.set(item.Key, item.Value, item.TTL)
+		}
+		if results[i].Err == nil {
+			entries[i], _ = c.entries.Get(item.Key)
+		}
+	}
+	c.unlock()
+
+	for i, item := range items {
+		if results[i].Err == nil {
+			results[i].Err = c.writeThrough(item.Key, item.Value, item.TTL, entries[i])
+		}
+	}
+
+	return results
+}
+
+// SetMiss caches the absence of a value for specified Key with TTL, see SetNotFound.
+//
+// GetWithState reports the key as NegativeCached until it expires
+func (c *ActiveCache) SetMiss(key []byte, ttl time.Duration) {
+	c.SetNotFound(key, ttl)
+}
+
+// SetMulti writes every item under a single lock, implementing BatchCache,
+//
+// see SetMany
+func (c *ActiveCache) SetMulti(items []Item) []SetResult {
+	return c.SetMany(items)
+}
+
+// SetNotFound caches the absence of a value for specified Key with TTL,
+//
+// so callers can skip a slow lookup known to find nothing.
+//
+// GetE reports the key with ErrNegativeCached, Get returns (nil, 0) and misses are
+// not loaded from `Config.Backing` until it expires or the key is set again.
+// Nothing is written to `Config.Backing`. Rejected writes are dropped like Set
+func (c *ActiveCache) SetNotFound(key []byte, ttl time.Duration) {
+	if c.validateEntry(key, nil, ttl) != nil {
+		return
+	}
+
+	c.lock("set")
+	defer c.unlock()
+
+	c.setEntry(key, nil, ttl, setOptions{notFound: true})
+}
+
+// SetPermanent sets Value for specified Key that never expires.
+//
+// It is equivalent to Set with NoExpiration TTL
+func (c *ActiveCache) SetPermanent(key, value []byte) {
+	c.Set(key, value, NoExpiration)
+}
+
+// setPinned marks the live entry of Key as pinned or not, see Pin and Unpin
+func (c *ActiveCache) setPinned(key []byte, pinned bool) bool {
+	if key == nil {
+		return false
+	}
+
+	c.lock("set")
+	defer c.unlock()
+
+	entry, ok := c.entries.Get(key)
+	if !ok || entry.IsExpired(c.now()) || entry.NotFound {
+		return false
+	}
+
+	entry.Pinned = pinned
+	return true
+}
+
+// SetProtected sets Value for specified Key with TTL like Set, protecting it
+//
+// from capacity eviction: once `Config.MaxEntries` is reached other keys are
+// evicted instead, or new ones rejected if only protected keys are left.
+// Protected entries still expire by TTL.
+//
+// It is equivalent to SetWithOptions with WithPinned, use Unpin to release it
+func (c *ActiveCache) SetProtected(key, value []byte, ttl time.Duration) {
+	_ = c.SetWithOptions(key, value, ttl, WithPinned())
+}
+
+// setState moves the cache to `to`, never leaving Closed.
+//
+// Reports the previous state and whether it changed, callers notify the
+// transition once lifecycleMtx is released. Caller must hold lifecycleMtx
+func (c *ActiveCache) setState(to CacheState) (CacheState, bool) {
+	from := c.State()
+	if from == Closed || from == to {
+		return from, false
+	}
+
+	c.state.Store(int32(to))
+	return from, true
+}
+
+// SetString stores Value for string key `key` with TTL like Set.
+//
+// Stored keys are []byte, so the key is copied once. Read it back with
+// GetString to avoid the conversion on lookups
+func (c *ActiveCache) SetString(key string, value []byte, ttl time.Duration) {
+	c.Set([]byte(key), value, ttl)
+}
+
+// SetWithCost sets Value for specified Key with TTL like SetE, charging `cost`
+//
+// against `Config.MaxCostBytes` instead of the approximate memory used by
+// the entry, e.g. the size of a decoded object it stands for. A cost less
+// than or equal to zero charges the default, see WithCost.
+//
+// Returns the same errors as SetE
+func (c *ActiveCache) SetWithCost(key, value []byte, ttl time.Duration, cost int64) error {
+	return c.SetWithOptions(key, value, ttl, WithCost(cost))
+}
+
+// SetWithOptions sets Value for specified Key with TTL like SetE, applying `opts`
+//
+// to the written entry, e.g. WithPinned.
+//
+// Returns the same errors as SetE, nil for a write skipped by WithSkipIfEqual
+func (c *ActiveCache) SetWithOptions(key, value []byte, ttl time.Duration, opts ...SetOption) (err error) {
+	if err := c.validateEntry(key, value, ttl); err != nil {
+		return err
+	}
+
+	var options setOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	// Runs after unlocking, Backing is never called while holding the lock
+	var skipped bool
+	var entry *cacheEntry
+	defer func() {
+		if err == nil && !skipped {
+			err = c.writeThrough(key, value, ttl, entry)
+		}
+	}()
+
+	// Lock cache while writing
+	stripe := c.lockKey("set", c.entries.Stripe(key))
+	defer c.unlockKey(stripe)
+
+	if options.skipIfEqual && c.State() != Closed && c.isUnchanged(key, value, ttl, options) {
+		skipped = true
+		c.skippedWrites.Add(1)
+		return nil
+	}
+
+	if err := c.setEntry(key, value, ttl, options); err != nil {
+		return err
+	}
+
+	entry, _ = c.entries.Get(key)
+	return nil
+}
+
+// Snapshot returns a point-in-time, immutable view of all non-expired entries.
+//
+// Keys and entries are copied while holding the read lock, so later reads,
+// writes and TTL changes of the cache never show up in the snapshot, and slow
+// consumers such as exports run against it without blocking the cache.
+// Entries keep showing up in the snapshot after they expire or change in the cache.
+//
+// Values are shared with the cache like Get returns them and must not be
+// modified, use Entries for copies
+func (c *ActiveCache) Snapshot() *CacheSnapshot {
+	c.rlock()
+	now := c.now()
+
+	// The capacity fits every stored entry, so copies are allocated at once
+	copies := make([]cacheEntry, 0, c.length.Load())
+	snapshot := &CacheSnapshot{
+		entries: c.entries.Clone(func(entry *cacheEntry) *cacheEntry {
+			copies = append(copies, entry.Detached())
+			return &copies[len(copies)-1]
+		}),
+		takenAt: now.UnixNano(),
+	}
+	c.runlock()
+
+	var dead [][]byte
+	snapshot.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if entry.IsExpired(now) || entry.NotFound || entry.Tombstone {
+			dead = append(dead, key)
+		}
+		return true
+	})
+
+	for _, key := range dead {
+		snapshot.entries.Delete(key)
+	}
+
+	return snapshot
+}
+
+// StartCleaner starts active cache cleaning, moving the cache to the Running state.
+//
+// Does nothing if the cleaner is running or the cache is Closed
+func (c *ActiveCache) StartCleaner() {
+	c.lifecycleMtx.Lock()
+	from, ok := c.setState(Running)
+	if ok {
+		c.stopChan = make(chan interface{})
+		c.cleanerDone = make(chan struct{})
+		c.isCleanerRunning.Store(true)
+		c.lastCleanAt.Store(c.now().UnixNano())
+		go c.runCleaner(c.stopChan, c.cleanerDone)
+	}
+	c.lifecycleMtx.Unlock()
+
+	if ok {
+		c.notifyState(from, Running)
+	}
+}
+
+// State returns the current lifecycle state of the cache
+func (c *ActiveCache) State() CacheState {
+	return CacheState(c.state.Load())
+}
+
+// StopCleaner stops active cache cleaning, moving the cache to the CleanerStopped state.
+//
+// It waits for a running clean cycle to finish, so it must not be called from Hooks
+func (c *ActiveCache) StopCleaner() {
+	c.lifecycleMtx.Lock()
+	c.stopCleaner()
+	from, ok := c.setState(CleanerStopped)
+	c.lifecycleMtx.Unlock()
+
+	if ok {
+		c.notifyState(from, CleanerStopped)
+	}
+}
+
+// stopCleaner stops a running cleaner and waits until it exits.
+//
+// Caller must hold lifecycleMtx and not the cache lock
+func (c *ActiveCache) stopCleaner() {
+	if c.isCleanerRunning.Load() {
+		close(c.stopChan)
+		<-c.cleanerDone
+		c.isCleanerRunning.Store(false)
+	}
+}
+
+// stripeHasRoom reports whether a write holding a single stripe never has
+//
+// to evict: `Config.MaxCostBytes` is unset, and `Config.MaxEntries` is not
+// reached even if every other stripe stores a new key meanwhile.
+// Caller must hold a stripe
+func (c *ActiveCache) stripeHasRoom() bool {
+	conf := c.config.Load()
+	if conf.MaxCostBytes > 0 {
+		return false
+	}
+
+	return conf.MaxEntries <= 0 || c.length.Load()+int64(len(c.stripes)) <= int64(conf.MaxEntries)
+}
+
+// touch marks `entry` as the most recently accessed one, moving it to the
+//
+// newest end of its recency list once linked.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) touch(entry *cacheEntry) {
+	entry.LastAccess = c.accessTick.Add(1)
+	entry.AccessedAt = c.now().UnixNano()
+	if entry.Key != nil {
+		c.recencyOf(entry.Key).moveNewest(entry)
+	}
+}
+
+// track adds (`delta` = 1) or removes (`delta` = -1) `entry`
+//
+// stored with `key` from the cache counters
+func (c *ActiveCache) track(key []byte, entry *cacheEntry, delta int64) {
+	c.length.Add(delta)
+	c.memoryUsage.Add(delta * entry.Size(key))
+	c.cost.Add(delta * entry.Charge(key))
+	if entry.HasTTL() {
+		c.expiring.Add(delta)
+	}
+
+	if entry.Tombstone {
+		c.tombstones.Add(delta)
+	}
+}
+
+// unlinkRecency removes `entry` from the recency list of its stripe if linked.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) unlinkRecency(entry *cacheEntry) {
+	if entry.Key != nil {
+		c.recencyOf(entry.Key).unlink(entry)
+	}
+}
+
+// unlockStripes releases every stripe lock acquired by lockStripes
+func (c *ActiveCache) unlockStripes() {
+	for i := range c.stripes {
+		c.stripes[i].Unlock()
+	}
+}
+
+// Unpin makes a pinned Key evictable again.
+//
+// Returns false if key is nil, does not exist, is expired or cached as not found
+func (c *ActiveCache) Unpin(key []byte) bool {
+	return c.setPinned(key, false)
+}
+
+// validateAndAdjustConfig validate if parameters
+//
+// has valid values and if not change them to default values
+func validateAndAdjustConfig(conf *Config) {
+	if conf.CleanerInterval < MinCleanerInterval {
+		conf.CleanerInterval = DefaultCleanerInterval
+	}
+
+	if conf.KeysAmountByCycle < MinKeysAmountByCycle {
+		conf.KeysAmountByCycle = DefaultKeysAmountByCycle
+	}
+
+	if conf.CleanerBackoffCycles < 1 {
+		conf.CleanerBackoffCycles = DefaultCleanerBackoffCycles
+	}
+
+	if conf.CleanerBackoffFactor <= 1 {
+		conf.CleanerBackoffFactor = DefaultCleanerBackoffFactor
+	}
+
+	if conf.MaxCleanDuration == 0 {
+		conf.MaxCleanDuration = DefaultMaxCleanDuration
+	}
+
+	if conf.CompressMinBytes <= 0 {
+		conf.CompressMinBytes = DefaultCompressMinBytes
+	}
+
+	if conf.WriteBehindQueueSize <= 0 {
+		conf.WriteBehindQueueSize = DefaultWriteBehindQueueSize
+	}
+
+	if conf.AsyncQueueSize <= 0 {
+		conf.AsyncQueueSize = DefaultAsyncQueueSize
+	}
+
+	if conf.AsyncBatchSize <= 0 {
+		conf.AsyncBatchSize = DefaultAsyncBatchSize
+	}
+
+	if conf.AsyncFlushInterval <= 0 {
+		conf.AsyncFlushInterval = DefaultAsyncFlushInterval
+	}
+
+	if conf.MaxTTL < 0 {
+		conf.MaxTTL = 0
+	}
+
+	if conf.MaxTTL > 0 && conf.MaxTTL < MinMaxTTL {
+		conf.MaxTTL = MinMaxTTL
+	}
+
+	// Keeps expiration times computed from them representable
+	conf.MaxTTL = min(conf.MaxTTL, MaxSupportedTTL)
+	conf.TombstoneTTL = min(conf.TombstoneTTL, MaxSupportedTTL)
+	conf.TTLJitter = min(conf.TTLJitter, MaxSupportedTTL)
+}
+
+// validateEntry reports whether `key` and `value` can be written with `ttl`.
+//
+// Value size is not checked for negative TTLs as they only remove the key
+func (c *ActiveCache) validateEntry(key, value []byte, ttl time.Duration) error {
+	if key == nil {
+		return ErrNilKey
+	}
+
+	conf := c.config.Load()
+	if conf.MaxKeyBytes > 0 && len(key) > conf.MaxKeyBytes {
+		return ErrKeyTooLarge
+	}
+
+	if ttl >= NoExpiration && conf.MaxValueBytes > 0 && len(value) > conf.MaxValueBytes {
+		return ErrValueTooLarge
+	}
+
+	return nil
+}
+
+// verifyChecksum reports whether the value of `entry` stored with `key` still
+//
+// matches its checksum. Otherwise the entry is removed, counted and reported
+// to `Config.Eviction` and `Config.OnCorruption`. Entries are only checked
+// while `Config.VerifyChecksums` is set. Caller must hold the write lock
+func (c *ActiveCache) verifyChecksum(key []byte, entry *cacheEntry) bool {
+	if !c.config.Load().VerifyChecksums {
+		return true
+	}
+
+	actual := crc32.ChecksumIEEE(entry.Value)
+	if actual == entry.Checksum {
+		return true
+	}
+
+	c.delete(key)
+	c.corruptions.Add(1)
+	c.emitCorruption(key, entry.Checksum, actual)
+	return false
+}
+
+// WaitEmpty blocks until no entry is stored or `timeout` elapses,
+//
+// polling Len every WaitEmptyPollInterval. Reports whether the cache emptied.
+//
+// Expired entries count until removed, so with short TTLs this waits for
+// the cleaner. Permanent entries never expire, so while one is stored this
+// only returns true if it is deleted
+func (c *ActiveCache) WaitEmpty(timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	poll := time.NewTicker(WaitEmptyPollInterval)
+	defer poll.Stop()
+
+	for c.Len() > 0 {
+		select {
+		case <-deadline.C:
+			return c.Len() == 0
+		case <-poll.C:
+		}
+	}
+
+	return true
+}
+
+// warnExpiry sends a copy of `key` on ExpiringSoon once the remaining TTL of
+//
+// its live `entry` drops below `warning`, marking the entry as warned even if
+// the buffer is full. Entries cached by SetNotFound are not warned.
+// Caller must hold the write lock
+func (c *ActiveCache) warnExpiry(key []byte, entry *cacheEntry, warning time.Duration) {
+	if warning <= 0 || entry.Warned || entry.NotFound || !entry.HasTTL() || entry.RemainingTTL(c.now()) > warning {
+		return
+	}
+
+	entry.Warned = true
+	select {
+	case c.expiryWarnings <- bytes.Clone(key):
+	default:
+		c.expiryWarningsDropped.Add(1)
 	}
 }
@@ -1,85 +1,366 @@
 package cache
 
 import (
+	"flag"
 	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 const BenchmarkEntries = 100
 
-func BenchmarkActiveCache_Get(b *testing.B) {
-	// Setup
-	cache := NewActiveCacheWithConfig(&Config{
-		CleanerInterval: 1, // invalid, should adjust to DefaultCleanerInterval
-	})
-	cache.StopCleaner()
-	durations := []time.Duration{
-		time.Millisecond,
-		time.Second * 1,
-		time.Second * 5,
-		time.Second * 10,
-		NoExpiration,
+// HashMap has DefaultTableSize buckets, so filling a fixture takes time
+// quadratic in its size and the largest ones only run when asked for
+var benchLarge = flag.Bool("bench.large", false, "run benchmarks with 1M entries fixtures")
+
+// Seed of the key generators, fixed so every run reads the same keys
+const benchmarkSeed = 42
+
+// benchmarkDurations are the TTLs fixtures cycle through, long enough not to
+// expire during a benchmark
+var benchmarkDurations = []time.Duration{
+	time.Minute,
+	time.Minute * 5,
+	time.Minute * 10,
+	NoExpiration,
+}
+
+// benchmarkKeys returns `n` distinct keys, the same on every call
+func benchmarkKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%08d", i))
 	}
 
-	for i := 0; i < BenchmarkEntries; i++ {
-		cache.Set(
-			[]byte(fmt.Sprintf("key%v", i)),
-			[]byte(fmt.Sprintf("value%v", i)),
-			durations[i%len(durations)],
-		)
+	return keys
+}
+
+// benchmarkIndexes returns a reproducible sequence of `n` indexes in [0, max)
+//
+// generated from `seed`, so goroutines can pick keys without sharing a source
+func benchmarkIndexes(seed int64, n, max int) []int {
+	rnd := rand.New(rand.NewSource(seed))
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = rnd.Intn(max)
 	}
-	cache.StartCleaner()
+
+	return indexes
+}
+
+// newBenchmarkCache returns a cache without cleaner holding one entry per
+//
+// key of `keys`, with TTLs cycling through benchmarkDurations
+func newBenchmarkCache(b *testing.B, keys [][]byte, conf *Config) *ActiveCache {
+	b.Helper()
+
+	cache := NewActiveCacheWithConfig(conf)
+	cache.StopCleaner()
+	for i, key := range keys {
+		cache.Set(key, []byte(fmt.Sprintf("value%v", i)), benchmarkDurations[i%len(benchmarkDurations)])
+	}
+
+	return cache
+}
+
+// benchmarkParallel runs `op` on every goroutine of b.RunParallel, each one
+//
+// walking its own range of `keys` in a reproducible random order
+func benchmarkParallel(b *testing.B, keys [][]byte, op func(i int, key []byte)) {
+	var goroutines atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		id := int(goroutines.Add(1))
+		span := max(1, len(keys)/runtime.GOMAXPROCS(0))
+		first := (id - 1) * span % len(keys)
+		indexes := benchmarkIndexes(benchmarkSeed+int64(id), 1024, min(span, len(keys)-first))
+
+		for i := 0; pb.Next(); i++ {
+			op(i, keys[first+indexes[i%len(indexes)]])
+		}
+	})
+}
+
+func BenchmarkActiveCache_Get(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries)
+	cache := newBenchmarkCache(b, keys, nil)
+	missing := []byte("nonexistent key")
 	b.ResetTimer()
 
 	// Test
 	for n := 0; n < b.N; n++ {
-		cache.Get([]byte(fmt.Sprintf("key%v", n%10)))
-		cache.Get([]byte("nonexistent key"))
+		cache.Get(keys[n%BenchmarkEntries])
+		cache.Get(missing)
 		cache.Get(nil)
 	}
 
 	b.ReportAllocs()
 }
 
+func BenchmarkActiveCache_GetParallel(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries * 100)
+	cache := newBenchmarkCache(b, keys, nil)
+	b.ResetTimer()
+
+	// Test
+	benchmarkParallel(b, keys, func(i int, key []byte) {
+		cache.Get(key)
+	})
+
+	b.ReportAllocs()
+}
+
+func BenchmarkActiveCache_GetString(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries)
+	cache := newBenchmarkCache(b, keys, nil)
+	strKeys := make([]string, len(keys))
+	for i, key := range keys {
+		strKeys[i] = string(key)
+	}
+
+	// Test GetString against converting the key for Get
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cache.GetString(strKeys[n%BenchmarkEntries])
+		}
+	})
+
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			cache.Get([]byte(strKeys[n%BenchmarkEntries]))
+		}
+	})
+}
+
 func BenchmarkActiveCache_Set(b *testing.B) {
 	// Setup
 	cache := NewActiveCache()
-	type input struct {
-		key   []byte
-		value []byte
-	}
-	durations := []time.Duration{
-		time.Millisecond,
-		time.Second * -1,
-		time.Second * 5,
-		time.Second * 10,
-		NoExpiration,
-	}
-	var entries []input
-	for i := 0; i < BenchmarkEntries; i++ {
-		entries = append(
-			entries,
-			input{
-				key:   []byte(fmt.Sprintf("key%v", i)),
-				value: []byte(fmt.Sprintf("value%v", i)),
-			},
-		)
-	}
-	entries[BenchmarkEntries-1] = input{
-		key:   nil,
-		value: []byte("value"),
+	cache.StopCleaner()
+	keys := benchmarkKeys(BenchmarkEntries)
+	value := []byte("value")
+	b.ResetTimer()
+
+	// Test
+	for n := 0; n < b.N; n++ {
+		cache.Set(keys[n%BenchmarkEntries], value, benchmarkDurations[n%len(benchmarkDurations)])
 	}
 
+	b.ReportAllocs()
+}
+
+func BenchmarkActiveCache_SetParallel(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries * 100)
+	cache := newBenchmarkCache(b, nil, nil)
+	value := []byte("value")
 	b.ResetTimer()
+
 	// Test
+	benchmarkParallel(b, keys, func(i int, key []byte) {
+		cache.Set(key, value, benchmarkDurations[i%len(benchmarkDurations)])
+	})
+
+	b.ReportAllocs()
+}
+
+func BenchmarkActiveCache_SetAsyncParallel(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries * 100)
+	cache := newBenchmarkCache(b, nil, nil)
+	value := []byte("value")
+	b.ResetTimer()
+
+	// Test queued writes, applied in batches
+	benchmarkParallel(b, keys, func(i int, key []byte) {
+		cache.SetAsync(key, value, benchmarkDurations[i%len(benchmarkDurations)])
+	})
+	cache.FlushWrites()
+
+	b.ReportAllocs()
+}
+
+func BenchmarkActiveCache_Mixed(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries * 100)
+	cache := newBenchmarkCache(b, keys, nil)
+	value := []byte("value")
+	b.ResetTimer()
+
+	// Test 90% reads, 10% writes
+	benchmarkParallel(b, keys, func(i int, key []byte) {
+		if i%10 == 0 {
+			cache.Set(key, value, time.Minute)
+			return
+		}
+		cache.Get(key)
+	})
+
+	b.ReportAllocs()
+}
+
+func BenchmarkActiveCache_LockStripes(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries * 100)
+	value := []byte("value")
+
+	for _, stripes := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("stripes=%v", stripes), func(b *testing.B) {
+			conf := DefaultConfig()
+			conf.LockStripes = stripes
+			cache := newBenchmarkCache(b, keys, conf)
+			b.ResetTimer()
+
+			// Test 90% reads, 10% writes, every goroutine on its own keys
+			benchmarkParallel(b, keys, func(i int, key []byte) {
+				if i%10 == 0 {
+					cache.Set(key, value, time.Minute)
+					return
+				}
+				cache.Get(key)
+			})
+
+			b.ReportAllocs()
+		})
+	}
+}
+
+func BenchmarkActiveCache_Churn(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries * 10)
+	cache := newBenchmarkCache(b, keys[:len(keys)/2], nil)
+	value := []byte("value")
+	b.ResetTimer()
+
+	// Test sustained inserts of new keys and removals of old ones
 	for n := 0; n < b.N; n++ {
-		cache.Set(
-			entries[(b.N%BenchmarkEntries)].key,
-			entries[(b.N%BenchmarkEntries)].value,
-			durations[b.N%len(durations)],
-		)
+		cache.Set(keys[n%len(keys)], value, time.Minute)
+		cache.Set(keys[(n+len(keys)/2)%len(keys)], nil, ExpireNow)
 	}
 
 	b.ReportAllocs()
 }
+
+func BenchmarkActiveCache_DeleteMany(b *testing.B) {
+	// Setup
+	keys := benchmarkKeys(BenchmarkEntries)
+	value := []byte("value")
+	cache := newBenchmarkCache(b, nil, nil)
+	fill := func(b *testing.B) {
+		b.StopTimer()
+		for _, key := range keys {
+			cache.Set(key, value, time.Minute)
+		}
+		b.StartTimer()
+	}
+
+	// Test one lock for the batch against one lock per key
+	b.Run("many", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			fill(b)
+			cache.DeleteMany(keys)
+		}
+	})
+
+	b.Run("single", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			fill(b)
+			for _, key := range keys {
+				cache.Set(key, nil, ExpireNow)
+			}
+		}
+	})
+}
+
+func BenchmarkActiveCache_performClean(b *testing.B) {
+	for _, entries := range []int{10_000, 100_000, 1_000_000} {
+		var cache *ActiveCache
+		b.Run(fmt.Sprint(entries), func(b *testing.B) {
+			if entries >= 1_000_000 && !*benchLarge {
+				b.Skip("fixture takes minutes to fill, run with -bench.large")
+			}
+
+			// Setup once, the function runs again for every b.N.
+			// No entry expires, so every cycle inspects the same amount of keys
+			if cache == nil {
+				cache = newBenchmarkCache(b, benchmarkKeys(entries), nil)
+			}
+			b.ResetTimer()
+
+			// Test
+			for n := 0; n < b.N; n++ {
+				cache.performClean()
+			}
+
+			b.ReportAllocs()
+		})
+	}
+}
+
+func BenchmarkActiveCache_Hooks(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		hooks Hooks
+	}{
+		{name: "nil", hooks: nil},
+		{name: "noop", hooks: NoopHooks{}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			// Setup
+			cache := NewActiveCacheWithConfig(&Config{Hooks: bm.hooks})
+			cache.StopCleaner()
+			key := []byte("key")
+			value := []byte("value")
+			b.ResetTimer()
+
+			// Test
+			for n := 0; n < b.N; n++ {
+				cache.Set(key, value, NoExpiration)
+				cache.Get(key)
+			}
+
+			b.ReportAllocs()
+		})
+	}
+}
+
+func BenchmarkActiveCache_Compress(b *testing.B) {
+	value := []byte(strings.Repeat("lorem ipsum dolor sit amet ", 40)) // ~1KB of text
+	benchmarks := []struct {
+		name     string
+		compress bool
+	}{
+		{name: "plain", compress: false},
+		{name: "compressed", compress: true},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			// Setup
+			cache := NewActiveCacheWithConfig(&Config{Compress: bm.compress})
+			cache.StopCleaner()
+			key := []byte("key")
+			b.ResetTimer()
+
+			// Test
+			for n := 0; n < b.N; n++ {
+				cache.Set(key, value, NoExpiration)
+				cache.Get(key)
+			}
+
+			b.ReportMetric(float64(cache.MemoryUsage()), "bytes/entry")
+			b.ReportAllocs()
+		})
+	}
+}
@@ -1,17 +1,96 @@
 package cache
 
-import "time"
+import (
+	"bytes"
+	"time"
+)
 
 // A cacheEntry represents an entry with Value and TTL
 type cacheEntry struct {
-	// Entry value
+	// Entry value, compressed if Compressed is set.
+	//
+	// Use Bytes to read it
 	Value []byte
 
+	// Reports whether Value is compressed, see Config.Compress
+	Compressed bool
+
+	// CRC-32 of Value, set if Checksummed, see Config.VerifyChecksums
+	Checksum uint32
+
+	// Reports whether Checksum was computed when the entry was written
+	Checksummed bool
+
+	// Cost charged against Config.MaxCostBytes, see SetWithCost. Zero charges Size
+	Cost int64
+
 	// Entry duration time
 	Ttl time.Duration
 
 	// Expiration time in nanoseconds
 	ExpiresAt int64
+
+	// Write time in unix nanoseconds, reset by every write of the key.
+	//
+	// Writes of ApplyOp store the time of the operation instead, see Op
+	CreatedAt int64
+
+	// Cache access tick of the last read or write, used for LRU eviction
+	LastAccess uint64
+
+	// Time of the last read or write in unix nanoseconds, see GetEntry
+	AccessedAt int64
+
+	// Key stored with the entry while it is linked in the recency list of
+	// its stripe, nil otherwise, see recencyList
+	Key []byte
+
+	// Less and more recently accessed neighbours in the recency list
+	Older, Newer *cacheEntry
+
+	// Amount of reads that returned the value since it was written
+	Hits uint64
+
+	// Amount of writes of the key since it was stored, starting at 1.
+	//
+	// Kept while the key is overwritten, restarted once it is removed
+	Version uint64
+
+	// Reports whether the entry caches the absence of a value, see SetNotFound.
+	//
+	// Kept apart from Value so an empty stored value is never mistaken for it
+	NotFound bool
+
+	// Reports whether eviction must skip the entry, see WithPinned
+	Pinned bool
+
+	// Reports whether the entry marks a deleted key, see Config.TombstoneTTL.
+	//
+	// Tombstones are NotFound too, so reads skipping negative cached entries skip them
+	Tombstone bool
+
+	// Reports whether the key was sent on ExpiringSoon, see Config.ExpiryWarning
+	Warned bool
+}
+
+// Bytes returns the entry value, decompressed if needed
+func (c *cacheEntry) Bytes() []byte {
+	if c.Compressed {
+		return decompress(c.Value)
+	}
+
+	return c.Value
+}
+
+// Charge returns the cost the entry stored with `key` is charged
+//
+// against `Config.MaxCostBytes`: Cost when set, Size otherwise
+func (c *cacheEntry) Charge(key []byte) int64 {
+	if c.Cost > 0 {
+		return c.Cost
+	}
+
+	return c.Size(key)
 }
 
 // emptyValueTTL returns a nil value and time duration 0
@@ -19,16 +98,72 @@ func emptyValueTTL() ([]byte, time.Duration) {
 	return nil, 0
 }
 
-// GetValueTTL returns the value and TTL
-func (c *cacheEntry) GetValueTTL() ([]byte, time.Duration) {
-	if c.IsExpired() {
+// Detached returns a copy of the entry holding its fields at call time,
+//
+// unlinked from the recency list, see CacheSnapshot
+func (c *cacheEntry) Detached() cacheEntry {
+	detached := *c
+	detached.Key, detached.Older, detached.Newer = nil, nil, nil
+	return detached
+}
+
+// GetValueTTL returns the value and TTL, or emptyValueTTL if expired at `now`
+func (c *cacheEntry) GetValueTTL(now time.Time) ([]byte, time.Duration) {
+	if c.IsExpired(now) {
 		return emptyValueTTL()
 	}
 
-	return c.Value, c.Ttl
+	return c.Bytes(), c.Ttl
+}
+
+// HasTTL reports whether the cache entry expires
+func (c *cacheEntry) HasTTL() bool {
+	return c.ExpiresAt != NoExpiration
+}
+
+// IsEvictable reports whether eviction may remove the entry,
+//
+// that is when it is not pinned or already expired at `now`
+func (c *cacheEntry) IsEvictable(now time.Time) bool {
+	return !c.Pinned || c.IsExpired(now)
+}
+
+// IsExpired reports whether the cache entry is expired at `now` or not
+func (c *cacheEntry) IsExpired(now time.Time) bool {
+	return NoExpiration != c.ExpiresAt && now.UnixNano() >= c.ExpiresAt
+}
+
+// RemainingTTL returns the time left from `now` until the entry expires
+//
+// returns NoExpiration if the entry never expires
+func (c *cacheEntry) RemainingTTL(now time.Time) time.Duration {
+	if c.ExpiresAt == NoExpiration {
+		return NoExpiration
+	}
+
+	return time.Duration(c.ExpiresAt - now.UnixNano())
+}
+
+// Size returns the approximate memory used by the entry stored with `key`.
+//
+// Compressed values account for their compressed length
+func (c *cacheEntry) Size(key []byte) int64 {
+	return int64(len(key) + len(c.Value) + EntryOverheadBytes)
 }
 
-// IsExpired reports whether the cache entry is expired or not
-func (c *cacheEntry) IsExpired() bool {
-	return NoExpiration != c.ExpiresAt && time.Now().UnixNano() >= c.ExpiresAt
+// View returns a read-only EntryView of the entry stored with `key`
+func (c *cacheEntry) View(key []byte) EntryView {
+	view := EntryView{
+		Key:        bytes.Clone(key),
+		ValueLen:   len(c.Value),
+		TTL:        c.Ttl,
+		LastAccess: c.LastAccess,
+		Hits:       c.Hits,
+	}
+
+	if c.HasTTL() {
+		view.ExpiresAt = time.Unix(0, c.ExpiresAt)
+	}
+
+	return view
 }
@@ -4,8 +4,24 @@ import (
 	"bytes"
 	"testing"
 	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
 )
 
+func TestCacheEntry_Bytes(t *testing.T) {
+	// Setup
+	value := []byte("lorem ipsum")
+	plain := &cacheEntry{Value: value}
+	compressed := &cacheEntry{Value: compress(value), Compressed: true}
+
+	// Test
+	for _, entry := range []*cacheEntry{plain, compressed} {
+		if out := entry.Bytes(); !bytes.Equal(out, value) {
+			t.Errorf("wrong value for Bytes(). Expected %s but got %s", value, out)
+		}
+	}
+}
+
 func TestCacheEntry_emptyValueTTL(t *testing.T) {
 	// Test
 	val, ttl := emptyValueTTL()
@@ -18,10 +34,11 @@ func TestCacheEntry_GetValueTTL(t *testing.T) {
 	// Setup
 	expectedVal := []byte("test")
 	expectedTtl := time.Second
+	now := time.Now()
 	entry := &cacheEntry{
 		Value:     expectedVal,
 		Ttl:       expectedTtl,
-		ExpiresAt: time.Now().Add(time.Second).UnixNano(),
+		ExpiresAt: now.Add(time.Second).UnixNano(),
 	}
 
 	nonexpiringEntry := &cacheEntry{
@@ -31,7 +48,7 @@ func TestCacheEntry_GetValueTTL(t *testing.T) {
 	}
 
 	// Test
-	val, ttl := entry.GetValueTTL()
+	val, ttl := entry.GetValueTTL(now)
 	if !bytes.Equal(expectedVal, val) || ttl != expectedTtl {
 		t.Errorf(
 			"wrong value for GetValueTTL(). Expected (%s, %v) but got (%s, %v)",
@@ -42,13 +59,12 @@ func TestCacheEntry_GetValueTTL(t *testing.T) {
 		)
 	}
 
-	time.Sleep(time.Second)
-	val, ttl = entry.GetValueTTL() // expired value should return empty
+	val, ttl = entry.GetValueTTL(now.Add(time.Second)) // expired value should return empty
 	if val != nil || ttl != 0 {
 		t.Errorf("wrong value for GetValueTTL(). Expected (nil, 0) but got (%s, %v)", val, ttl)
 	}
 
-	val, ttl = nonexpiringEntry.GetValueTTL()
+	val, ttl = nonexpiringEntry.GetValueTTL(now)
 	if !bytes.Equal(expectedVal, val) || ttl != NoExpiration {
 		t.Errorf(
 			"wrong value for GetValueTTL(). Expected (%s, %v) but got (%s, %v)",
@@ -60,12 +76,80 @@ func TestCacheEntry_GetValueTTL(t *testing.T) {
 	}
 }
 
+func TestCacheEntry_HasTTL(t *testing.T) {
+	// Setup
+	entry := &cacheEntry{ExpiresAt: time.Now().UnixNano()}
+	nonexpiringEntry := &cacheEntry{ExpiresAt: NoExpiration}
+
+	// Test
+	if !entry.HasTTL() {
+		t.Error("wrong value for HasTTL(). Expected (true) but got (false)")
+	}
+
+	if nonexpiringEntry.HasTTL() {
+		t.Error("wrong value for HasTTL(). Expected (false) but got (true)")
+	}
+}
+
+func TestCacheEntry_IsEvictable(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	entry := &cacheEntry{Value: []byte("test"), Ttl: NoExpiration}
+	pinned := &cacheEntry{
+		Value:     []byte("test"),
+		Ttl:       time.Second,
+		ExpiresAt: clock.Now().Add(time.Second).UnixNano(),
+		Pinned:    true,
+	}
+
+	// Test
+	if !entry.IsEvictable(clock.Now()) {
+		t.Error("wrong value for IsEvictable() on unpinned entry. Expected (true) but got (false)")
+	}
+
+	if pinned.IsEvictable(clock.Now()) {
+		t.Error("wrong value for IsEvictable() on pinned entry. Expected (false) but got (true)")
+	}
+
+	clock.Advance(time.Second)
+	if !pinned.IsEvictable(clock.Now()) {
+		t.Error("wrong value for IsEvictable() on expired pinned entry. Expected (true) but got (false)")
+	}
+}
+
+func TestCacheEntry_RemainingTTL(t *testing.T) {
+	// Setup
+	now := time.Now()
+	entry := &cacheEntry{
+		Value:     []byte("test"),
+		Ttl:       time.Second,
+		ExpiresAt: now.Add(time.Second).UnixNano(),
+	}
+
+	nonexpiringEntry := &cacheEntry{
+		Value:     []byte("test"),
+		Ttl:       NoExpiration,
+		ExpiresAt: NoExpiration,
+	}
+
+	// Test
+	if ttl := entry.RemainingTTL(now.Add(time.Millisecond)); ttl != time.Second-time.Millisecond {
+		t.Errorf("wrong value for RemainingTTL(). Expected %v but got %v", time.Second-time.Millisecond, ttl)
+	}
+
+	if ttl := nonexpiringEntry.RemainingTTL(now); ttl != NoExpiration {
+		t.Errorf("wrong value for RemainingTTL(). Expected %v but got %v", NoExpiration, ttl)
+	}
+}
+
 func TestCacheEntry_IsExpired(t *testing.T) {
 	// Setup
+	now := time.Now()
 	entry := &cacheEntry{
 		Value:     []byte("test"),
 		Ttl:       time.Second,
-		ExpiresAt: time.Now().Add(time.Second).UnixNano(),
+		ExpiresAt: now.Add(time.Second).UnixNano(),
 	}
 
 	nonexpiringEntry := &cacheEntry{
@@ -75,17 +159,49 @@ func TestCacheEntry_IsExpired(t *testing.T) {
 	}
 
 	// Test
-	if entry.IsExpired() {
+	if entry.IsExpired(now) {
 		t.Error("wrong value for IsExpired(). Expected (false) but got (true)")
 	}
 
-	time.Sleep(time.Second)
-	if !entry.IsExpired() {
+	if !entry.IsExpired(now.Add(time.Second)) {
 		t.Error("wrong value for IsExpired(). Expected (true) but got (false)")
 	}
 
-	if nonexpiringEntry.IsExpired() {
+	if nonexpiringEntry.IsExpired(now) {
 		t.Error("wrong value for IsExpired(). Expected (false) but got (true)")
 	}
 
 }
+
+func TestCacheEntry_Size(t *testing.T) {
+	// Setup
+	entry := &cacheEntry{Value: []byte("ipsum")}
+
+	// Test
+	if size := entry.Size([]byte("lorem")); size != 10+EntryOverheadBytes {
+		t.Errorf("wrong value for Size(). Expected %v but got %v", 10+EntryOverheadBytes, size)
+	}
+}
+
+func TestCacheEntry_View(t *testing.T) {
+	// Setup
+	key := []byte("lorem")
+	expiresAt := time.Now().Add(time.Minute)
+	entry := &cacheEntry{Value: []byte("ipsum"), Ttl: time.Minute, ExpiresAt: expiresAt.UnixNano()}
+
+	// Test
+	view := entry.View(key)
+	if !bytes.Equal(view.Key, key) || view.ValueLen != 5 || view.TTL != time.Minute || !view.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("wrong value for View(). Expected {lorem 5 1m0s %v} but got %+v", expiresAt, view)
+	}
+
+	view.Key[0] = 'X'
+	if !bytes.Equal(key, []byte("lorem")) {
+		t.Errorf("View() should copy the key but it was modified to %s", key)
+	}
+
+	permanent := (&cacheEntry{Value: []byte("ipsum")}).View(key)
+	if permanent.TTL != NoExpiration || !permanent.ExpiresAt.IsZero() {
+		t.Errorf("wrong value for View() without TTL. Expected zero TTL and ExpiresAt but got %+v", permanent)
+	}
+}
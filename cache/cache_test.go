@@ -2,22 +2,476 @@ package cache
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"math"
+	"math/rand"
+	"reflect"
+	"runtime"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
 	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
 )
 
+// assertInvariants fails the test if CheckInvariants reports violations
+func assertInvariants(t *testing.T, cache *ActiveCache) {
+	t.Helper()
+	if err := cache.CheckInvariants(); err != nil {
+		t.Errorf("CheckInvariants() reported violations: %v", err)
+	}
+}
+
+// assertUnlocked fails the test if the cache write lock is not released within a second
+func assertUnlocked(t *testing.T, cache *ActiveCache, op string) {
+	t.Helper()
+	acquired := make(chan struct{})
+	go func() {
+		cache.lock("set")
+		cache.unlock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("%v leaked the cache lock after giving up", op)
+	}
+}
+
+func TestActiveCache_ActiveCount(t *testing.T) {
+	// Setup
+	const expiringEntries = 100
+	const permanentEntries = 50
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock:             clock,
+		KeysAmountByCycle: 1000,
+	})
+	cache.StopCleaner()
+	for i := 0; i < expiringEntries; i++ {
+		cache.Set([]byte(fmt.Sprintf("exp%v", i)), []byte("value"), time.Second)
+	}
+
+	for i := 0; i < permanentEntries; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("perm%v", i)), []byte("value"))
+	}
+
+	assertCounts := func(active, expired, expiring int) {
+		t.Helper()
+		if cache.ActiveCount() != active || cache.ExpiredCount() != expired || cache.ExpiringCount() != expiring {
+			t.Errorf(
+				"wrong counts. Expected (active %v, expired %v, expiring %v) but got (%v, %v, %v)",
+				active,
+				expired,
+				expiring,
+				cache.ActiveCount(),
+				cache.ExpiredCount(),
+				cache.ExpiringCount(),
+			)
+		}
+	}
+
+	// Test
+	assertCounts(expiringEntries+permanentEntries, 0, expiringEntries)
+
+	cache.SetPermanent([]byte("exp0"), []byte("value")) // overwrite to permanent
+	cache.Set([]byte("exp1"), nil, ExpireNow)
+	assertCounts(expiringEntries+permanentEntries-1, 0, expiringEntries-2)
+
+	clock.Advance(time.Second)
+	cache.performClean() // samples every entry
+	assertCounts(permanentEntries+1, 0, 0)
+}
+
+func TestActiveCache_Age(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+	cache.SetNotFound([]byte("missing"), time.Minute)
+
+	// Test age increases over time
+	clock.Advance(2 * time.Second)
+	for _, key := range []string{"lorem", "john"} {
+		if age, ok := cache.Age([]byte(key)); !ok || age != 2*time.Second {
+			t.Errorf("wrong value for Age(%s). Expected (2s, true) but got (%v, %v)", key, age, ok)
+		}
+	}
+
+	// Test overwrites reset the age
+	cache.Set([]byte("lorem"), []byte("dolor"), NoExpiration)
+	cache.SetKeepTTL([]byte("john"), []byte("smith"))
+	clock.Advance(time.Second)
+	for _, key := range []string{"lorem", "john"} {
+		if age, ok := cache.Age([]byte(key)); !ok || age != time.Second {
+			t.Errorf("wrong value for Age(%s) after overwrite. Expected (1s, true) but got (%v, %v)", key, age, ok)
+		}
+	}
+
+	for _, key := range []string{"jane", "missing", "nonexistent key"} {
+		if age, ok := cache.Age([]byte(key)); ok || age != 0 {
+			t.Errorf("wrong value for Age(%s). Expected (0, false) but got (%v, %v)", key, age, ok)
+		}
+	}
+
+	if _, ok := cache.Age(nil); ok {
+		t.Errorf("wrong value for Age(nil). Expected false but got true")
+	}
+}
+
+func TestActiveCache_ApproxLen(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, MaxEntries: 3})
+	cache.StopCleaner()
+
+	// Test
+	steps := []struct {
+		name     string
+		op       func()
+		expected int64
+	}{
+		{name: "empty", op: func() {}, expected: 0},
+		{name: "set", op: func() { cache.Set([]byte("lorem"), []byte("ipsum"), time.Second) }, expected: 1},
+		{name: "overwrite", op: func() { cache.Set([]byte("lorem"), []byte("dolor"), time.Second) }, expected: 1},
+		{name: "set many", op: func() {
+			cache.SetPermanent([]byte("john"), []byte("doe"))
+			cache.SetPermanent([]byte("jane"), []byte("foster"))
+		}, expected: 3},
+		{name: "eviction", op: func() { cache.Set([]byte("sit"), []byte("amet"), time.Second) }, expected: 3},
+		{name: "delete", op: func() { cache.DeleteString("john") }, expected: 2},
+		{name: "expired", op: func() { clock.Advance(time.Minute) }, expected: 2},
+		{name: "clean", op: func() { cache.performClean() }, expected: 1},
+	}
+
+	for _, step := range steps {
+		step.op()
+		if l := cache.ApproxLen(); l != step.expected || l != int64(cache.Len()) {
+			t.Errorf("wrong value for ApproxLen() after %s. Expected %v but got %v", step.name, step.expected, l)
+		}
+	}
+}
+
+func TestActiveCache_BucketHistogram(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for i := 0; i < 100; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+
+	// Test
+	var buckets, entries int
+	for length, amount := range cache.BucketHistogram() {
+		buckets += amount
+		entries += length * amount
+	}
+
+	if buckets != hashmap.DefaultTableSize || entries != 100 {
+		t.Errorf(
+			"wrong value for BucketHistogram(). Expected %v buckets and 100 entries but got %v and %v",
+			hashmap.DefaultTableSize,
+			buckets,
+			entries,
+		)
+	}
+}
+
+func TestActiveCache_CheckInvariants(t *testing.T) {
+	// Setup
+	newCache := func() *ActiveCache {
+		cache := NewActiveCacheWithConfig(&Config{TombstoneTTL: time.Minute})
+		cache.StopCleaner()
+		cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+		cache.Set([]byte("john"), []byte("doe"), time.Minute)
+		cache.Set([]byte("jane"), []byte("foster"), time.Minute)
+		cache.DeleteString("jane")
+		return cache
+	}
+
+	assertInvariants(t, newCache())
+
+	// Test every corrupted counter is reported alone
+	tests := []struct {
+		name    string
+		corrupt func(c *ActiveCache)
+		message string
+	}{
+		{name: "length", corrupt: func(c *ActiveCache) { c.length.Add(1) }, message: "entries kept as 4 but 3 found"},
+		{name: "memory usage", corrupt: func(c *ActiveCache) { c.memoryUsage.Add(-10) }, message: "memory usage kept as"},
+		{name: "expiring", corrupt: func(c *ActiveCache) { c.expiring.Add(-1) }, message: "entries with TTL kept as 1 but 2 found"},
+		{name: "tombstones", corrupt: func(c *ActiveCache) { c.tombstones.Store(0) }, message: "tombstones kept as 0 but 1 found"},
+	}
+
+	for _, tt := range tests {
+		cache := newCache()
+		tt.corrupt(cache)
+		err := cache.CheckInvariants()
+		if !errors.Is(err, ErrInvariantViolated) || strings.Contains(err.Error(), "\n") || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("wrong value for CheckInvariants() with a corrupted %s. Expected a single violation containing %q but got %v", tt.name, tt.message, err)
+		}
+	}
+
+	// Test every violation is reported
+	cache := newCache()
+	cache.length.Add(1)
+	cache.tombstones.Add(1)
+	if err := cache.CheckInvariants(); err == nil || strings.Count(err.Error(), "\n") != 1 {
+		t.Errorf("wrong value for CheckInvariants() with two corrupted counters. Expected two violations but got %v", err)
+	}
+}
+
+func TestActiveCache_clampTTL(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, MaxTTL: 24 * time.Hour, TTLJitter: time.Hour, Hooks: hooks})
+	cache.StopCleaner()
+	defer cache.Close()
+
+	tests := map[string]struct {
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		"permanent": {ttl: NoExpiration, expected: 24 * time.Hour},
+		"huge":      {ttl: 1000 * time.Hour, expected: 24 * time.Hour},
+		"exact cap": {ttl: 24 * time.Hour, expected: 24 * time.Hour},
+		"below cap": {ttl: time.Minute, expected: time.Minute},
+	}
+
+	// Test
+	for name, tt := range tests {
+		key := []byte(name)
+		cache.Set(key, []byte("value"), tt.ttl)
+
+		if _, ttl := cache.Get(key); ttl != tt.expected {
+			t.Errorf("wrong value for Get(%s) TTL with MaxTTL. Expected %v but got %v", name, tt.expected, ttl)
+		}
+
+		_, expiredAt, _ := cache.PeekExpired(key)
+		if lifetime := expiredAt.Sub(clock.Now()); lifetime < tt.expected || lifetime > min(tt.expected+time.Hour, 24*time.Hour) {
+			t.Errorf("wrong expiration for Set(%s) with MaxTTL. Expected at most 24h but got %v", name, lifetime)
+		}
+	}
+
+	cache.SetNotFound([]byte("missing"), NoExpiration)
+	if _, expiredAt, _ := cache.PeekExpired([]byte("missing")); !expiredAt.Equal(clock.Now().Add(24 * time.Hour)) {
+		t.Errorf("wrong expiration for SetNotFound() with MaxTTL. Expected %v but got %v", clock.Now().Add(24*time.Hour), expiredAt)
+	}
+
+	for _, call := range hooks.calls {
+		fields := strings.Fields(call)
+		if ttl, err := time.ParseDuration(fields[len(fields)-1]); fields[0] == "set" && (err != nil || ttl <= 0 || ttl > 24*time.Hour) {
+			t.Errorf("wrong TTL reported to Hooks with MaxTTL. Expected at most 24h but got %v", call)
+		}
+	}
+
+	clock.Advance(24 * time.Hour)
+	if cache.Has([]byte("permanent")) || cache.Has([]byte("huge")) {
+		t.Errorf("entries should expire once MaxTTL elapsed")
+	}
+}
+
+func TestActiveCache_clampTTL_overflow(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	configs := map[string]*Config{
+		"default": {Clock: clock},
+		"jitter":  {Clock: clock, TTLJitter: time.Duration(math.MaxInt64)},
+	}
+
+	// Test
+	for name, conf := range configs {
+		cache := NewActiveCacheWithConfig(conf)
+		cache.StopCleaner()
+		cache.Set([]byte("lorem"), []byte("ipsum"), time.Duration(math.MaxInt64))
+
+		if _, ttl, ok := cache.GetOK([]byte("lorem")); !ok || ttl != MaxSupportedTTL {
+			t.Errorf("wrong value for GetOK() of a math.MaxInt64 TTL with %s config. Expected (%v, true) but got (%v, %v)", name, MaxSupportedTTL, ttl, ok)
+		}
+
+		clock.Advance(10 * 365 * 24 * time.Hour)
+		if !cache.Has([]byte("lorem")) || cache.ExpiringCount() != 1 {
+			t.Errorf("entry with a math.MaxInt64 TTL and %s config should not expire but got found=%v", name, cache.Has([]byte("lorem")))
+		}
+	}
+
+	conf := &Config{MaxTTL: time.Duration(math.MaxInt64), TombstoneTTL: time.Duration(math.MaxInt64)}
+	NewActiveCacheWithConfig(conf).Close()
+	if conf.MaxTTL != MaxSupportedTTL || conf.TombstoneTTL != MaxSupportedTTL {
+		t.Errorf("config durations should be capped at MaxSupportedTTL but got MaxTTL %v and TombstoneTTL %v", conf.MaxTTL, conf.TombstoneTTL)
+	}
+}
+
+func TestActiveCache_cleanBudget(t *testing.T) {
+	// Setup
+	const expiredEntries = 100
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock:             clock,
+		KeysAmountByCycle: 20,
+		MaxCleanPerSecond: 30,
+	})
+	cache.StopCleaner()
+	for i := 0; i < expiredEntries; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), time.Millisecond)
+	}
+	clock.Advance(time.Millisecond)
+
+	// Test
+	cache.performClean() // all sampled keys expired, recursion stops at budget
+	cache.performClean()
+	if entriesLen := len(cache.entries.GetAll()); entriesLen != expiredEntries-30 {
+		t.Errorf("wrong entries amount. Expected %v but got %v", expiredEntries-30, entriesLen)
+	}
+
+	clock.Advance(time.Second) // new budget window
+	cache.performClean()
+	if entriesLen := len(cache.entries.GetAll()); entriesLen != expiredEntries-60 {
+		t.Errorf("wrong entries amount. Expected %v but got %v", expiredEntries-60, entriesLen)
+	}
+
+	cache.config.Load().MaxCleanPerSecond = 0 // unlimited
+	cache.performClean()
+	if entriesLen := len(cache.entries.GetAll()); entriesLen != 0 {
+		t.Errorf("wrong entries amount. Expected 0 but got %v", entriesLen)
+	}
+}
+
+func TestActiveCache_CleanNow(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	// Test
+	cache.CleanNow()
+	if cache.Len() != 0 {
+		t.Errorf("CleanNow() should remove expired entries with the cleaner stopped but got %v entries", cache.Len())
+	}
+}
+
+func TestActiveCache_Close(t *testing.T) {
+	// Setup
+	sched := cachetest.NewManualScheduler()
+	cache := NewActiveCacheWithConfig(&Config{Scheduler: sched})
+	sched.Tick()
+
+	// Test Close waits for the cleaner to stop
+	if err := cache.Close(); err != nil {
+		t.Errorf("wrong value for Close(). Expected nil but got %v", err)
+	}
+
+	if cache.IsCleanerRunning() {
+		t.Errorf("Close() should stop the cleaner")
+	}
+
+	if err := cache.SetE([]byte("lorem"), []byte("ipsum"), NoExpiration); err != ErrClosed {
+		t.Errorf("wrong value for SetE() after Close(). Expected %v but got %v", ErrClosed, err)
+	}
+
+	if _, _, err := cache.GetE([]byte("lorem")); err != ErrClosed {
+		t.Errorf("wrong value for GetE() after Close(). Expected %v but got %v", ErrClosed, err)
+	}
+}
+
+func TestActiveCache_Close_concurrent(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	stop := make(chan struct{})
+	var attempts atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				key := []byte(fmt.Sprintf("key%v-%v", g, i))
+				cache.Set(key, []byte("value"), time.Minute)
+				cache.Get(key)
+				attempts.Add(1)
+			}
+		}(g)
+	}
+
+	// waitAttempts waits until the writers made `n` more attempts
+	waitAttempts := func(n int64) {
+		for target := attempts.Load() + n; attempts.Load() < target; {
+			runtime.Gosched()
+		}
+	}
+
+	// Test
+	waitAttempts(1000)
+	cache.Close()
+	length := cache.Len()
+	waitAttempts(1000)
+	close(stop)
+	wg.Wait()
+
+	if cache.Len() != length {
+		t.Errorf("no write should land after Close() but Len() went from %v to %v", length, cache.Len())
+	}
+}
+
+func TestActiveCache_Compact(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration)
+	}
+
+	for i := 1; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), nil, -1)
+	}
+
+	// Test
+	cache.Compact()
+	if val, _ := cache.Get([]byte("key0")); string(val) != "value" {
+		t.Errorf("wrong value after Compact(). Expected value but got %s", val)
+	}
+
+	if entries := cache.entries.GetAll(); len(entries) != 1 {
+		t.Errorf("wrong entries amount after Compact(). Expected 1 but got %v", len(entries))
+	}
+}
+
 func TestActiveCache_defaultClean(t *testing.T) {
 	// Setup
 	const expiringEntries = 150
 	const nonExpiringEntries = 25
 	const customKeysAmountByCycle = 100
 
-	var entries hashmap.HashMap[*cacheEntry]
+	var entries hashmap.StripedHashMap[*cacheEntry]
 	var expectedEntries, entriesLen int
+	clock := cachetest.NewFakeClock(time.Now())
 
 	durations := [3]time.Duration{
 		time.Second * 1,
@@ -30,258 +484,3310 @@ func TestActiveCache_defaultClean(t *testing.T) {
 		KeysAmountByCycle: customKeysAmountByCycle,
 	}
 
-	for i := 0; i < nonExpiringEntries; i++ {
-		entries.Put([]byte(fmt.Sprintf("key nonexp %v", i)), &cacheEntry{
-			Value:     []byte(fmt.Sprintf("value %v", i)),
-			Ttl:       NoExpiration,
-			ExpiresAt: NoExpiration,
-		})
+	for i := 0; i < nonExpiringEntries; i++ {
+		entries.Put([]byte(fmt.Sprintf("key nonexp %v", i)), &cacheEntry{
+			Value:     []byte(fmt.Sprintf("value %v", i)),
+			Ttl:       NoExpiration,
+			ExpiresAt: NoExpiration,
+		})
+	}
+
+	for i := 0; i < expiringEntries; i++ {
+		ttl := durations[i%len(durations)]
+		entries.Put([]byte(fmt.Sprintf("key exp %v", i)), &cacheEntry{
+			Value:     []byte(fmt.Sprintf("value %v", i)),
+			Ttl:       ttl,
+			ExpiresAt: clock.Now().Add(ttl).UnixNano(),
+		})
+	}
+
+	cache := &ActiveCache{clock: clock}
+	cache.config.Store(defaultConf)
+
+	// Test
+	defaultClean(cache) // Empty entries
+
+	cache.entries = entries
+	defaultClean(cache) // entries, no expired
+	entries = cache.entries
+	entriesLen = len(entries.GetAll())
+	expectedEntries = expiringEntries + nonExpiringEntries
+	if entriesLen != expectedEntries {
+		t.Errorf("wrong entries amount. Expected %v but got %v", expectedEntries, entriesLen)
+	}
+
+	clock.Advance(durations[1])
+	cache.config.Store(conf)
+	defaultClean(cache) // entries, more than half expired. Should call recursive
+	entries = cache.entries
+	entriesLen = len(entries.GetAll())
+	if entriesLen >= expectedEntries {
+		t.Errorf("wrong entries amount. Expected less than or equal %v but got %v", expectedEntries, entriesLen)
+	}
+
+	clock.Advance(durations[2] - durations[1])
+	cache.config.Store(defaultConf)
+	defaultClean(cache)
+	clock.Advance(DefaultCleanerInterval * time.Millisecond)
+	cache.config.Store(conf)
+	defaultClean(cache) //only non-expiring entries
+	entries = cache.entries
+	entriesLen = len(entries.GetAll())
+	expectedEntries = nonExpiringEntries
+	if entriesLen != expectedEntries {
+		t.Errorf("wrong entries amount. Expected %v but got %v", expectedEntries, entriesLen)
+	}
+}
+
+func TestActiveCache_defaultClean_SequentialScan(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock:             clock,
+		KeysAmountByCycle: MinKeysAmountByCycle,
+		SequentialScan:    true,
+	})
+	cache.StopCleaner()
+	for i := 0; i < 95; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("hot %v", i)), []byte("value"))
+	}
+	for i := 0; i < 5; i++ {
+		cache.Set([]byte(fmt.Sprintf("cold %v", i)), []byte("value"), time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	// Test
+	// 100 entries inspected 5 by cycle are all covered in 20 cycles
+	for i := 0; i < 20; i++ {
+		cache.CleanNow()
+	}
+
+	if cache.Len() != 95 {
+		t.Errorf("wrong value for Len() after a full sequential pass. Expected 95 but got %v", cache.Len())
+	}
+}
+
+func TestActiveCache_Delete(t *testing.T) {
+	// Setup
+	hooks := &recordingHooks{}
+	backing := NewMemoryBacking()
+	cache := NewActiveCacheWithConfig(&Config{Hooks: hooks, Backing: backing})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), ExpireNow)
+	hooks.calls = nil
+
+	// Test
+	if !cache.Delete([]byte("lorem")) {
+		t.Errorf("wrong value for Delete(lorem). Expected true but got false")
+	}
+
+	if cache.Has([]byte("lorem")) || cache.Len() != 0 || cache.MemoryUsage() != 0 {
+		t.Errorf("Delete() should remove the entry but got %v entries using %v bytes", cache.Len(), cache.MemoryUsage())
+	}
+
+	if backing.Len() != 0 {
+		t.Errorf("Delete() should remove the key from Config.Backing but got %v keys", backing.Len())
+	}
+
+	for _, key := range [][]byte{[]byte("lorem"), []byte("john"), []byte("nonexistent key"), nil} {
+		if cache.Delete(key) {
+			t.Errorf("wrong value for Delete(%s). Expected false but got true", key)
+		}
+	}
+
+	if len(hooks.calls) != 1 || hooks.calls[0] != "delete lorem" {
+		t.Errorf("wrong value for Delete() hooks. Expected [delete lorem] but got %v", hooks.calls)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_DeleteByPrefix(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	keys := []string{"user:1:name", "user:1:mail", "user:12:name", "user:2:name", "session:1"}
+	for _, k := range keys {
+		cache.SetPermanent([]byte(k), []byte("value"))
+	}
+
+	type testCase struct {
+		prefix    []byte
+		deleted   int
+		remaining int
+	}
+
+	testsCase := []testCase{
+		{prefix: []byte("user:1:"), deleted: 2, remaining: 3}, // must not touch user:12
+		{prefix: []byte("user:1"), deleted: 1, remaining: 2},
+		{prefix: []byte("nothing"), deleted: 0, remaining: 2},
+		{prefix: []byte(""), deleted: 2, remaining: 0},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		deleted := cache.DeleteByPrefix(tc.prefix)
+		remaining := len(cache.entries.GetAll())
+		if deleted != tc.deleted || remaining != tc.remaining {
+			t.Errorf(
+				"wrong result for DeleteByPrefix(%s). Expected (deleted %v, remaining %v) but got (%v, %v)",
+				tc.prefix,
+				tc.deleted,
+				tc.remaining,
+				deleted,
+				remaining,
+			)
+		}
+	}
+
+	if cache.MemoryUsage() != 0 {
+		t.Errorf("wrong value for MemoryUsage() after deleting all. Expected 0 but got %v", cache.MemoryUsage())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_DeleteFunc(t *testing.T) {
+	// Setup
+	const entries = 50
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for i := 0; i < entries; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("%v", i%2)))
+	}
+
+	// Test
+	if deleted := cache.DeleteFunc(func(key, value []byte) bool { return false }); deleted != 0 {
+		t.Errorf("wrong value for DeleteFunc() matching nothing. Expected 0 but got %v", deleted)
+	}
+
+	deleted := cache.DeleteFunc(func(key, value []byte) bool { return string(value) == "1" })
+	if deleted != entries/2 || len(cache.entries.GetAll()) != entries/2 {
+		t.Errorf("wrong value for DeleteFunc() matching odd values. Expected %v but got %v", entries/2, deleted)
+	}
+
+	// always-true predicate is equivalent to a full flush
+	deleted = cache.DeleteFunc(func(key, value []byte) bool { return true })
+	if deleted != entries/2 || len(cache.entries.GetAll()) != 0 || cache.ExpiringCount() != 0 || cache.MemoryUsage() != 0 {
+		t.Errorf("DeleteFunc() matching everything should empty the cache but deleted %v", deleted)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_DeleteMany(t *testing.T) {
+	// Setup
+	hooks := &recordingHooks{}
+	backing := NewMemoryBacking()
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Backing: backing, Hooks: hooks})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.Set([]byte("jane"), []byte("foster"), time.Minute)
+	cache.Set([]byte("expired"), []byte("value"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+	hooks.calls = nil
+
+	// Test
+	if deleted := cache.DeleteMany(nil); deleted != 0 {
+		t.Errorf("wrong value for DeleteMany(nil). Expected 0 but got %v", deleted)
+	}
+
+	keys := [][]byte{[]byte("lorem"), nil, []byte("jane"), []byte("lorem"), []byte("expired"), []byte("nonexistent key")}
+	if deleted := cache.DeleteMany(keys); deleted != 2 {
+		t.Errorf("wrong value for DeleteMany(). Expected 2 but got %v", deleted)
+	}
+
+	if cache.Len() != 1 || !cache.Has([]byte("john")) || cache.ExpiringCount() != 0 {
+		t.Errorf("DeleteMany() should only keep john but got %v entries", cache.Len())
+	}
+
+	expectedCalls := []string{"delete lorem", "delete jane", "expire expired"}
+	if !reflect.DeepEqual(hooks.calls, expectedCalls) {
+		t.Errorf("wrong value for DeleteMany() hooks. Expected %v but got %v", expectedCalls, hooks.calls)
+	}
+
+	// The expired key is deleted from the backing too
+	if backing.Len() != 1 {
+		t.Errorf("wrong value for MemoryBacking.Len() after DeleteMany(). Expected 1 but got %d", backing.Len())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_deleteOrBury(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks, TombstoneTTL: time.Minute, KeysAmountByCycle: 100})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	hooks.calls = nil
+
+	// Test deletes leave tombstones not counted by Len
+	cache.Set([]byte("lorem"), nil, ExpireNow)
+	cache.DeleteString("john")
+	cache.DeleteMany([][]byte{[]byte("john"), []byte("lorem")})
+
+	if cache.Len() != 1 || cache.ApproxLen() != 1 {
+		t.Errorf("wrong value for Len() with tombstones. Expected 1 but got %v", cache.Len())
+	}
+
+	if _, _, err := cache.GetE([]byte("lorem")); err != ErrKeyDeleted {
+		t.Errorf("wrong value for GetE() of a tombstone. Expected %v but got %v", ErrKeyDeleted, err)
+	}
+
+	if _, state, _ := cache.GetWithState([]byte("john")); state != Deleted {
+		t.Errorf("wrong value for GetWithState() of a tombstone. Expected %v but got %v", Deleted, state)
+	}
+
+	value, expiredAt, ok := cache.PeekExpired([]byte("john"))
+	if !ok || value != nil || !expiredAt.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("wrong value for PeekExpired() of a tombstone. Expected (nil, %v, true) but got (%s, %v, %v)", clock.Now().Add(time.Minute), value, expiredAt, ok)
+	}
+
+	expected := []string{"delete lorem", "delete john", "miss lorem", "miss john"}
+	if fmt.Sprint(hooks.calls) != fmt.Sprint(expected) {
+		t.Errorf("wrong value for hooks of deletes. Expected %v but got %v", expected, hooks.calls)
+	}
+
+	// Test re-Set over a tombstone
+	cache.SetPermanent([]byte("lorem"), []byte("dolor"))
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "dolor" || cache.Len() != 2 {
+		t.Errorf("wrong value for Get() after Set() over a tombstone. Expected dolor with 2 entries but got %s with %v", value, cache.Len())
+	}
+
+	// Test the cleaner purges tombstones silently once expired
+	hooks.calls = nil
+	clock.Advance(time.Minute)
+	cache.performClean()
+
+	if _, _, ok := cache.PeekExpired([]byte("john")); ok || cache.Len() != 2 || len(hooks.calls) != 0 {
+		t.Errorf("expired tombstone should be purged without hooks but got %v entries and hooks %v", cache.Len(), hooks.calls)
+	}
+
+	if _, _, err := cache.GetE([]byte("john")); err != ErrKeyNotFound {
+		t.Errorf("wrong value for GetE() of a purged tombstone. Expected %v but got %v", ErrKeyNotFound, err)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_DeleteString(t *testing.T) {
+	// Setup
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Hooks: hooks})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), ExpireNow)
+	hooks.calls = nil
+
+	// Test
+	if !cache.DeleteString("lorem") {
+		t.Errorf("wrong value for DeleteString(lorem). Expected true but got false")
+	}
+
+	if cache.Has([]byte("lorem")) || cache.Len() != 0 || cache.MemoryUsage() != 0 {
+		t.Errorf("DeleteString() should remove the entry but got %v entries using %v bytes", cache.Len(), cache.MemoryUsage())
+	}
+
+	for _, key := range []string{"lorem", "john", "nonexistent key"} {
+		if cache.DeleteString(key) {
+			t.Errorf("wrong value for DeleteString(%s). Expected false but got true", key)
+		}
+	}
+
+	if len(hooks.calls) != 1 || hooks.calls[0] != "delete lorem" {
+		t.Errorf("wrong value for DeleteString() hooks. Expected [delete lorem] but got %v", hooks.calls)
+	}
+}
+
+func TestActiveCache_detectCollision(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{DetectCollisions: true})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test same key is not a collision
+	if err := cache.SetE([]byte("lorem"), []byte("updated"), NoExpiration); err != nil {
+		t.Errorf("wrong value for SetE() overwriting the same key. Expected nil but got %v", err)
+	}
+
+	// force a collision: rename the stored key keeping the hash of "lorem"
+	cache.entries.Range(func(key []byte, _ *cacheEntry) bool {
+		copy(key, "dolor")
+		return false
+	})
+
+	if err := cache.SetE([]byte("lorem"), []byte("collision"), NoExpiration); err != ErrHashCollision {
+		t.Errorf("wrong value for SetE() with a collision. Expected %v but got %v", ErrHashCollision, err)
+	}
+
+	if cache.SetKeepTTL([]byte("lorem"), []byte("collision")) {
+		t.Errorf("wrong value for SetKeepTTL() with a collision. Expected false but got true")
+	}
+
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "updated" {
+		t.Errorf("colliding writes should not overwrite the stored entry but got %s", value)
+	}
+
+	expected := []Collision{{Stored: []byte("dolor"), Key: []byte("lorem")}, {Stored: []byte("dolor"), Key: []byte("lorem")}}
+	if collisions := cache.Collisions(); !reflect.DeepEqual(expected, collisions) {
+		t.Errorf("wrong value for Collisions(). Expected %s but got %s", expected, collisions)
+	}
+
+	if stats := cache.Stats(); stats.Collisions != 2 {
+		t.Errorf("wrong value for Stats().Collisions. Expected 2 but got %v", stats.Collisions)
+	}
+
+	// Test recorded collisions are capped but all are counted
+	for i := 0; i < MaxRecordedCollisions; i++ {
+		cache.Set([]byte("lorem"), []byte("collision"), NoExpiration)
+	}
+
+	if len(cache.Collisions()) != MaxRecordedCollisions || cache.Stats().Collisions != MaxRecordedCollisions+2 {
+		t.Errorf("wrong collisions after %v writes. Expected %v recorded and %v counted but got %v and %v",
+			MaxRecordedCollisions+2, MaxRecordedCollisions, MaxRecordedCollisions+2, len(cache.Collisions()), cache.Stats().Collisions)
+	}
+
+	// Test detection disabled silently overwrites
+	cache.Reconfigure(&Config{})
+	if err := cache.SetE([]byte("lorem"), []byte("overwritten"), NoExpiration); err != nil {
+		t.Errorf("wrong value for SetE() without DetectCollisions. Expected nil but got %v", err)
+	}
+}
+
+func TestActiveCache_Drain(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+	clock.Advance(2 * time.Second)
+	hooks.calls = nil
+
+	// Test
+	items := cache.Drain()
+	sort.Slice(items, func(i, j int) bool { return bytes.Compare(items[i].Key, items[j].Key) < 0 })
+	expected := []Item{
+		{Key: []byte("john"), Value: []byte("doe"), TTL: 58 * time.Second},
+		{Key: []byte("lorem"), Value: []byte("ipsum"), TTL: NoExpiration},
+	}
+	if !reflect.DeepEqual(expected, items) {
+		t.Errorf("wrong value for Drain(). Expected %v but got %v", expected, items)
+	}
+
+	if cache.Len() != 0 || cache.MemoryUsage() != 0 || cache.ExpiringCount() != 0 {
+		t.Errorf("Drain() should remove every entry but got %v entries using %v bytes", cache.Len(), cache.MemoryUsage())
+	}
+
+	sort.Strings(hooks.calls)
+	if expectedCalls := []string{"delete jane", "delete john", "delete lorem"}; !reflect.DeepEqual(expectedCalls, hooks.calls) {
+		t.Errorf("wrong hooks on Drain(). Expected %v but got %v", expectedCalls, hooks.calls)
+	}
+
+	if items := cache.Drain(); len(items) != 0 {
+		t.Errorf("wrong value for Drain() of an empty cache. Expected [] but got %v", items)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Drain_concurrent(t *testing.T) {
+	// Setup
+	const writers, keysPerWriter = 4, 500
+	cache := NewActiveCache()
+	cache.StopCleaner()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keysPerWriter; i++ {
+				cache.SetPermanent([]byte(fmt.Sprintf("key-%d-%d", w, i)), []byte("value"))
+			}
+		}(w)
+	}
+
+	// Test
+	seen := make(map[string]int)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for drained := false; !drained; {
+		select {
+		case <-done:
+			drained = true
+		default:
+		}
+
+		for _, item := range cache.Drain() {
+			seen[string(item.Key)]++
+		}
+	}
+
+	if len(seen) != writers*keysPerWriter {
+		t.Errorf("wrong amount of drained keys. Expected %v but got %v", writers*keysPerWriter, len(seen))
+	}
+
+	for key, count := range seen {
+		if count != 1 {
+			t.Errorf("key %s drained %v times. Expected exactly once", key, count)
+		}
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_ensureCapacity(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, MaxEntries: 4, FullBehavior: RejectWrites})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("dolor"), []byte("sit"))
+	cache.Set([]byte("john"), []byte("doe"), time.Second)
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+
+	// Test rejection once full
+	if err := cache.SetE([]byte("amet"), []byte("value"), NoExpiration); err != ErrCacheFull {
+		t.Errorf("wrong value for SetE() on full cache. Expected %v but got %v", ErrCacheFull, err)
+	}
+
+	cache.Set([]byte("amet"), []byte("value"), NoExpiration)
+	if _, _, ok := cache.GetOK([]byte("amet")); ok || cache.length.Load() != 4 {
+		t.Errorf("Set() on full cache should be a no-op but got %v entries", cache.length.Load())
+	}
+
+	// Test overwrites are always allowed
+	if err := cache.SetE([]byte("lorem"), []byte("updated"), NoExpiration); err != nil {
+		t.Errorf("wrong value for SetE() overwriting on full cache. Expected nil but got %v", err)
+	}
+
+	// Test removals free space
+	cache.Set([]byte("dolor"), nil, ExpireNow)
+	if err := cache.SetE([]byte("amet"), []byte("value"), NoExpiration); err != nil {
+		t.Errorf("wrong value for SetE() after delete. Expected nil but got %v", err)
+	}
+
+	// Test the cleaner freeing space allows writes again
+	clock.Advance(time.Second)
+	if err := cache.SetE([]byte("foo"), []byte("bar"), NoExpiration); err != ErrCacheFull {
+		t.Errorf("wrong value for SetE() with expired entries not cleaned. Expected %v but got %v", ErrCacheFull, err)
+	}
+
+	cache.performClean()
+	for _, key := range []string{"foo", "bar"} {
+		if err := cache.SetE([]byte(key), []byte("value"), NoExpiration); err != nil {
+			t.Errorf("wrong value for SetE(%q) after clean. Expected nil but got %v", key, err)
+		}
+	}
+
+	if err := cache.SetE([]byte("baz"), []byte("value"), NoExpiration); err != ErrCacheFull {
+		t.Errorf("wrong value for SetE() on full cache after clean. Expected %v but got %v", ErrCacheFull, err)
+	}
+
+	// Test EvictLRU keeps writing
+	cache.Reconfigure(&Config{MaxEntries: 4, FullBehavior: EvictLRU})
+	if err := cache.SetE([]byte("baz"), []byte("value"), NoExpiration); err != nil || cache.length.Load() != 4 {
+		t.Errorf("SetE() with EvictLRU should evict to make room but got %v and %v entries", err, cache.length.Load())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Entries(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	// Test
+	entries := cache.Entries()
+	sort.Slice(entries, func(i, j int) bool {
+		return string(entries[i].Key) < string(entries[j].Key)
+	})
+
+	if len(entries) != 2 || string(entries[0].Key) != "john" || string(entries[1].Key) != "lorem" {
+		t.Fatalf("Entries() should only return live entries but got %v", entries)
+	}
+
+	if entries[0].TTL <= 0 || entries[0].TTL > time.Minute || entries[1].TTL != NoExpiration {
+		t.Errorf("wrong remaining TTLs on Entries(). Expected (0, 1m] and 0 but got %v and %v", entries[0].TTL, entries[1].TTL)
+	}
+
+	// Entries must be deep copies
+	entries[1].Value[0] = 'X'
+	if val, _ := cache.Get([]byte("lorem")); string(val) != "ipsum" {
+		t.Errorf("Entries() must return copies. Cache value changed to %s", val)
+	}
+
+	empty := NewActiveCache()
+	empty.StopCleaner()
+	if entries := empty.Entries(); entries == nil || len(entries) != 0 {
+		t.Errorf("Entries() on empty cache should return an empty slice but got %#v", entries)
+	}
+}
+
+func TestActiveCache_EntriesSorted(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for _, key := range []string{"b", "ab", "B", "a", "\x00", "aa"} {
+		cache.Set([]byte(key), []byte("value "+key), time.Minute)
+	}
+
+	// Test
+	var keys []string
+	for _, item := range cache.EntriesSorted() {
+		if string(item.Value) != "value "+string(item.Key) {
+			t.Errorf("wrong value for EntriesSorted() item %q. Expected %q but got %q", item.Key, "value "+string(item.Key), item.Value)
+		}
+		keys = append(keys, string(item.Key))
+	}
+
+	if expected := []string{"\x00", "B", "a", "aa", "ab", "b"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("wrong value for EntriesSorted() order. Expected %q but got %q", expected, keys)
+	}
+}
+
+func TestActiveCache_estimateExpired(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.expiring.Store(100)
+	cache.length.Store(150)
+
+	// Test
+	cache.estimateExpired(10, 5) // 50% of the 95 entries with TTL not inspected
+	if expired := cache.ExpiredCount(); expired != 47 {
+		t.Errorf("wrong value for ExpiredCount(). Expected 47 but got %v", expired)
+	}
+
+	if active := cache.ActiveCount(); active != 103 {
+		t.Errorf("wrong value for ActiveCount(). Expected 103 but got %v", active)
+	}
+
+	cache.estimateExpired(0, 0) // no entries with TTL inspected
+	if expired := cache.ExpiredCount(); expired != 0 {
+		t.Errorf("wrong value for ExpiredCount(). Expected 0 but got %v", expired)
+	}
+}
+
+func TestActiveCache_evictLRU(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 3})
+	cache.StopCleaner()
+	hooks := &recordingHooks{}
+
+	// Test empty cache
+	if cache.evictLRU() {
+		t.Errorf("wrong value for evictLRU() on empty cache. Expected false but got true")
+	}
+
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	cache.Get([]byte("lorem"))
+	cache.SetKeepTTL([]byte("john"), []byte("updated"))
+	cache.config.Load().Hooks = hooks
+
+	// Test the least recently used key is evicted by a new write
+	cache.SetPermanent([]byte("dolor"), []byte("sit"))
+	if _, _, ok := cache.GetOK([]byte("jane")); ok {
+		t.Errorf("least recently used key should have been evicted")
+	}
+
+	for _, key := range []string{"lorem", "john", "dolor"} {
+		if _, _, ok := cache.GetOK([]byte(key)); !ok {
+			t.Errorf("key %q should not have been evicted", key)
+		}
+	}
+
+	if len(hooks.calls) < 2 || hooks.calls[0] != "delete jane" || hooks.calls[1] != "set dolor 0s" {
+		t.Errorf("wrong hooks on eviction. Expected [delete jane set dolor 0s ...] but got %v", hooks.calls)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_evictVolatileRandom(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 10, EvictVolatileRandom: true, FullBehavior: RejectWrites})
+	cache.StopCleaner()
+	for i := 0; i < 5; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("permanent%v", i)), []byte("value"))
+		cache.Set([]byte(fmt.Sprintf("volatile%v", i)), []byte("value"), time.Minute)
+	}
+
+	// Test pressure only evicts entries with TTL
+	for i := 0; i < 5; i++ {
+		if err := cache.SetE([]byte(fmt.Sprintf("new%v", i)), []byte("value"), NoExpiration); err != nil {
+			t.Fatalf("wrong value for SetE() with volatile entries left. Expected nil but got %v", err)
+		}
+
+		if length := cache.length.Load(); length != 10 {
+			t.Errorf("wrong entries amount after eviction. Expected 10 but got %v", length)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, _, ok := cache.GetOK([]byte(fmt.Sprintf("permanent%v", i))); !ok {
+			t.Errorf("permanent%v should never be evicted by pressure", i)
+		}
+	}
+
+	if expiring := cache.ExpiringCount(); expiring != 0 {
+		t.Errorf("wrong value for ExpiringCount(). Expected 0 but got %v", expiring)
+	}
+
+	// Test FullBehavior applies once no entry with TTL is left
+	if err := cache.SetE([]byte("lorem"), []byte("ipsum"), time.Minute); err != ErrCacheFull {
+		t.Errorf("wrong value for SetE() without volatile entries. Expected %v but got %v", ErrCacheFull, err)
+	}
+
+	// Test evicting more than available
+	cache.Set([]byte("permanent0"), nil, ExpireNow)
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.evictVolatileRandom(5)
+	if length, expiring := cache.length.Load(), cache.ExpiringCount(); length != 9 || expiring != 0 {
+		t.Errorf("wrong entries after evictVolatileRandom(). Expected 9 entries without TTL but got %v and %v", length, expiring)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_ExpirationHistogram(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	ttls := []time.Duration{
+		500 * time.Millisecond, 900 * time.Millisecond, // < 1s
+		2 * time.Second, 5 * time.Second, // < 10s
+		30 * time.Second,         // < 1m
+		time.Hour, 2 * time.Hour, // overflow
+		NoExpiration, NoExpiration, // permanent
+		10 * time.Millisecond, // expired
+	}
+	for i, ttl := range ttls {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), ttl)
+	}
+	clock.Advance(50 * time.Millisecond)
+
+	// Test
+	expected := map[time.Duration]int{
+		time.Second:      2,
+		10 * time.Second: 2,
+		time.Minute:      1,
+		math.MaxInt64:    2,
+		NoExpiration:     2,
+	}
+	histogram := cache.ExpirationHistogram([]time.Duration{time.Minute, time.Second, 10 * time.Second, -time.Second})
+	if !reflect.DeepEqual(expected, histogram) {
+		t.Errorf("wrong value for ExpirationHistogram(). Expected %v but got %v", expected, histogram)
+	}
+
+	expected = map[time.Duration]int{math.MaxInt64: 7, NoExpiration: 2}
+	if histogram := cache.ExpirationHistogram(nil); !reflect.DeepEqual(expected, histogram) {
+		t.Errorf("wrong value for ExpirationHistogram(nil). Expected %v but got %v", expected, histogram)
+	}
+}
+
+func TestActiveCache_ExpirationHistogram_removedKeys(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{TombstoneTTL: time.Minute})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	cache.Delete([]byte("jane"))
+	cache.SetNotFound([]byte("missing"), time.Minute)
+	cache.SetNotFound([]byte("unknown"), NoExpiration)
+
+	// Test tombstones and negative cached keys are not counted
+	expected := map[time.Duration]int{math.MaxInt64: 1, NoExpiration: 1}
+	histogram := cache.ExpirationHistogram(nil)
+	if !reflect.DeepEqual(expected, histogram) {
+		t.Errorf("wrong value for ExpirationHistogram(nil). Expected %v but got %v", expected, histogram)
+	}
+
+	var total int
+	for _, count := range histogram {
+		total += count
+	}
+
+	if keys := len(cache.Keys()); total != keys {
+		t.Errorf("ExpirationHistogram() should count the entries of Keys(). Expected %v but got %v", keys, total)
+	}
+}
+
+func TestActiveCache_ExpiringSoon(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, ExpiryWarning: 10 * time.Second, Hooks: hooks})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), 30*time.Second)
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+
+	received := func() []string {
+		var keys []string
+		for {
+			select {
+			case key := <-cache.ExpiringSoon():
+				keys = append(keys, string(key))
+			default:
+				return keys
+			}
+		}
+	}
+
+	// Test
+	cache.performClean()
+	if keys := received(); len(keys) != 0 {
+		t.Errorf("wrong value for ExpiringSoon() before the threshold. Expected [] but got %v", keys)
+	}
+
+	clock.Advance(25 * time.Second)
+	cache.performClean()
+	cache.performClean()
+	if keys := received(); !reflect.DeepEqual(keys, []string{"lorem"}) {
+		t.Errorf("wrong value for ExpiringSoon() below the threshold. Expected [lorem] but got %v", keys)
+	}
+
+	hooks.calls = nil
+	clock.Advance(10 * time.Second)
+	cache.performClean()
+	if keys := received(); len(keys) != 0 || !reflect.DeepEqual(hooks.calls, []string{"expire lorem"}) {
+		t.Errorf("expected only the expiry of lorem after its warning but got warnings %v and hooks %v", keys, hooks.calls)
+	}
+
+	// Test a write storing a new entry is warned again
+	cache.Set([]byte("john"), []byte("doe"), 5*time.Second)
+	cache.performClean()
+	cache.SetKeepTTL([]byte("john"), []byte("smith"))
+	cache.performClean()
+	if keys := received(); !reflect.DeepEqual(keys, []string{"john"}) {
+		t.Errorf("wrong value for ExpiringSoon() after overwrites. Expected [john] but got %v", keys)
+	}
+
+	// Test warnings are dropped on a full buffer
+	cache.expiryWarnings = make(chan []byte, 1)
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+	cache.Set([]byte("dolor"), []byte("sit"), time.Second)
+	cache.performClean()
+	if keys := received(); len(keys) != 1 || cache.Stats().ExpiryWarningsDropped != 1 {
+		t.Errorf("expected one warning and one dropped but got %v and %v dropped", keys, cache.Stats().ExpiryWarningsDropped)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Flush(t *testing.T) {
+	// Setup
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Hooks: hooks})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	hooks.calls = nil
+
+	// Test
+	cache.Flush()
+	if cache.Len() != 0 || cache.MemoryUsage() != 0 || cache.ExpiringCount() != 0 || cache.Snapshot().Len() != 0 {
+		t.Errorf("Flush() should remove every entry but got %v entries using %v bytes", cache.Len(), cache.MemoryUsage())
+	}
+
+	sort.Strings(hooks.calls)
+	if expected := []string{"delete john", "delete lorem"}; !reflect.DeepEqual(expected, hooks.calls) {
+		t.Errorf("wrong hooks on Flush(). Expected %v but got %v", expected, hooks.calls)
+	}
+
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "ipsum" || cache.Len() != 1 {
+		t.Errorf("cache should keep working after Flush() but got %s and %v entries", value, cache.Len())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_ForEach(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	// Test
+	visited := map[string]string{}
+	cache.ForEach(func(key, value []byte, ttl time.Duration) bool {
+		visited[string(key)] = string(value)
+		if string(key) == "john" && (ttl <= 0 || ttl > time.Minute) {
+			t.Errorf("wrong remaining TTL for john. Expected (0, 1m] but got %v", ttl)
+		}
+
+		cache.Set(key, nil, ExpireNow) // deleting from the callback must not deadlock
+		return true
+	})
+
+	expected := map[string]string{"lorem": "ipsum", "john": "doe"}
+	if !reflect.DeepEqual(expected, visited) {
+		t.Errorf("wrong entries visited by ForEach(). Expected %v but got %v", expected, visited)
+	}
+
+	if entries := cache.Entries(); len(entries) != 0 {
+		t.Errorf("entries deleted from ForEach() callback should be gone but got %v", len(entries))
+	}
+
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	calls := 0
+	cache.ForEach(func(key, value []byte, ttl time.Duration) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("ForEach() should stop when fn returns false. Expected 1 call but got %v", calls)
+	}
+}
+
+func TestActiveCache_Get(t *testing.T) {
+	// Setup
+	const expiringEntries = 10
+	clock := cachetest.NewFakeClock(time.Now())
+	var entries hashmap.StripedHashMap[*cacheEntry]
+	durations := [2]time.Duration{
+		NoExpiration,
+		time.Second,
+	}
+
+	for i := 0; i < expiringEntries; i++ {
+		var expiresAt int64
+		ttl := durations[i%len(durations)]
+		if ttl > NoExpiration {
+			expiresAt = clock.Now().Add(ttl).UnixNano()
+		}
+		entries.Put([]byte(fmt.Sprintf("%v", i)), &cacheEntry{
+			Value:     []byte(fmt.Sprintf("value %v", i)),
+			Ttl:       ttl,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.entries = entries
+	cacheEntries := entries.GetAll()
+	sort.Slice(cacheEntries, func(i, j int) bool {
+		return string(cacheEntries[i].Key) < string(cacheEntries[j].Key)
+	})
+
+	// Test
+	var outVal []byte
+	var outTTL time.Duration
+	outVal, outTTL = cache.Get(nil) //get with key nil
+	if outVal != nil || outTTL != 0 {
+		t.Errorf("wrong value for get(nil). Expected (nil, 0) but got (%s, %v)", outVal, outTTL)
+	}
+
+	outVal, outTTL = cache.Get([]byte("nonexistent key")) //nonexistent key
+	if outVal != nil || outTTL != 0 {
+		t.Errorf("wrong value for get(nonexistent key). Expected (nil, 0) but got (%s, %v)", outVal, outTTL)
+	}
+
+	for _, e := range cacheEntries {
+		outVal, outTTL = cache.Get(e.Key)
+		if !bytes.Equal(e.Value.Value, outVal) || outTTL != e.Value.Ttl {
+			t.Errorf(
+				"wrong value for get(%s). Expected (%s, %s) but got (%s, %s)",
+				e.Key,
+				e.Value.Value,
+				e.Value.Ttl,
+				outVal,
+				outTTL,
+			)
+		}
+	}
+
+	clock.Advance(time.Second)
+
+	for i, e := range cacheEntries {
+		outVal, outTTL = cache.Get(e.Key)
+		if i%2 == 0 {
+			// No expiring keys
+			if !bytes.Equal(e.Value.Value, outVal) || outTTL != e.Value.Ttl {
+				t.Errorf(
+					"wrong value for get(%s). Expected (%s, %s) but got (%s, %s)",
+					e.Key,
+					e.Value.Value,
+					e.Value.Ttl,
+					outVal,
+					outTTL,
+				)
+			}
+
+		} else {
+			// expired keys
+			if outVal != nil || outTTL != 0 {
+				t.Errorf(
+					"wrong value for get(%s). Expected (nil, 0) but got (%s, %s)",
+					e.Key,
+					outVal,
+					outTTL,
+				)
+			}
+		}
+	}
+}
+
+func TestActiveCache_GetBatch(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	cache.SetPermanent([]byte("empty"), []byte{})
+	clock.Advance(time.Millisecond * 5)
+
+	keys := [][]byte{
+		[]byte("lorem"),
+		[]byte("missing"),
+		nil,
+		[]byte("jane"),
+		[]byte("john"),
+		[]byte("empty"),
+		[]byte("lorem"),
+	}
+	expected := []BatchResult{
+		{Value: []byte("ipsum"), TTL: NoExpiration, Found: true},
+		{},
+		{},
+		{},
+		{Value: []byte("doe"), TTL: time.Minute, Found: true},
+		{Value: []byte{}, TTL: NoExpiration, Found: true},
+		{Value: []byte("ipsum"), TTL: NoExpiration, Found: true},
+	}
+
+	// Test
+	results := cache.GetBatch(keys)
+	if !reflect.DeepEqual(expected, results) {
+		t.Errorf("wrong value for GetBatch(). Expected %v but got %v", expected, results)
+	}
+
+	if results := cache.GetBatch(nil); len(results) != 0 {
+		t.Errorf("wrong value for GetBatch(nil). Expected no results but got %v", results)
+	}
+}
+
+func TestActiveCache_GetByPrefix(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("route:GET:/users"), []byte("users"))
+	cache.Set([]byte("route:GET:/orders"), []byte("orders"), time.Minute)
+	cache.Set([]byte("route:GET:/expired"), []byte("expired"), time.Millisecond)
+	cache.SetPermanent([]byte("route:POST:/users"), []byte("create"))
+	cache.SetPermanent([]byte{0x00, 0xff, 0x01}, []byte("binary"))
+	cache.SetPermanent([]byte{0x00, 0xfe}, []byte("other binary"))
+	clock.Advance(time.Millisecond * 5)
+
+	keys := func(items []Item) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, string(item.Key))
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	tests := []struct {
+		prefix   []byte
+		limit    int
+		expected []string
+	}{
+		{prefix: []byte("route:GET:"), expected: []string{"route:GET:/orders", "route:GET:/users"}},
+		{prefix: []byte{0x00, 0xff}, expected: []string{string([]byte{0x00, 0xff, 0x01})}},
+		{prefix: []byte("missing"), expected: nil},
+		{
+			prefix: nil,
+			expected: []string{
+				string([]byte{0x00, 0xfe}), string([]byte{0x00, 0xff, 0x01}),
+				"route:GET:/orders", "route:GET:/users", "route:POST:/users",
+			},
+		},
+	}
+
+	// Test
+	for _, tt := range tests {
+		items := cache.GetByPrefix(tt.prefix, 0)
+		if out := keys(items); !reflect.DeepEqual(tt.expected, out) {
+			t.Errorf("wrong value for GetByPrefix(%q). Expected %q but got %q", tt.prefix, tt.expected, out)
+		}
+	}
+
+	items := cache.GetByPrefix([]byte("route:GET:/users"), 0)
+	if len(items) != 1 || string(items[0].Value) != "users" || items[0].TTL != NoExpiration {
+		t.Errorf("wrong item for GetByPrefix(). Expected {route:GET:/users users 0} but got %v", items)
+	}
+
+	if items := cache.GetByPrefix([]byte("route:"), 2); len(items) != 2 {
+		t.Errorf("wrong value for GetByPrefix() with limit. Expected 2 items but got %v", len(items))
+	}
+
+	if items := cache.GetByPrefix([]byte("missing"), 0); items == nil {
+		t.Errorf("GetByPrefix() without matches should return an empty slice but got nil")
+	}
+}
+
+func TestActiveCache_GetCtx(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+
+	// Test
+	val, ttl, err := cache.GetCtx(context.Background(), []byte("lorem"))
+	if err != nil || string(val) != "ipsum" || ttl != NoExpiration {
+		t.Errorf("wrong value for GetCtx(lorem). Expected (ipsum, 0, nil) but got (%s, %v, %v)", val, ttl, err)
+	}
+
+	if _, _, err = cache.GetCtx(context.Background(), nil); !errors.Is(err, ErrNilKey) {
+		t.Errorf("wrong error for GetCtx(nil). Expected %v but got %v", ErrNilKey, err)
+	}
+
+	// Lock held by another operation, context must win
+	cache.mtx.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	start := time.Now()
+	_, _, err = cache.GetCtx(ctx, []byte("lorem"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error for GetCtx() under contention. Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetCtx() should return promptly after deadline but took %v", elapsed)
+	}
+	cache.mtx.Unlock()
+
+	// Abandoned acquisition must not leak the lock
+	assertUnlocked(t, cache, "GetCtx()")
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if _, _, err = cache.GetCtx(cancelled, []byte("lorem")); !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error for GetCtx() with cancelled context. Expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestActiveCache_GetE(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.Set([]byte("empty"), []byte{}, NoExpiration)
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.Set([]byte("expired"), []byte("value"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	type testCase struct {
+		key         []byte
+		expectedVal []byte
+		expectedTtl time.Duration
+		expectedErr error
+	}
+
+	testsCase := []testCase{
+		{key: []byte("empty"), expectedVal: []byte{}, expectedTtl: NoExpiration},
+		{key: []byte("lorem"), expectedVal: []byte("ipsum"), expectedTtl: time.Minute},
+		{key: []byte("expired"), expectedErr: ErrKeyExpired},
+		{key: []byte("nonexistent key"), expectedErr: ErrKeyNotFound},
+		{key: nil, expectedErr: ErrNilKey},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		val, ttl, err := cache.GetE(tc.key)
+		if !errors.Is(err, tc.expectedErr) || !bytes.Equal(tc.expectedVal, val) || ttl != tc.expectedTtl {
+			t.Errorf(
+				"wrong value for GetE(%s). Expected (%s, %v, %v) but got (%s, %v, %v)",
+				tc.key,
+				tc.expectedVal,
+				tc.expectedTtl,
+				tc.expectedErr,
+				val,
+				ttl,
+				err,
+			)
+		}
+	}
+
+	// Empty value hit must be distinguishable from a miss
+	val, _, err := cache.GetE([]byte("empty"))
+	if err != nil || val == nil || len(val) != 0 {
+		t.Errorf("GetE() must return an empty non-nil value with nil error but got (%v, %v)", val, err)
+	}
+}
+
+func TestActiveCache_GetEntry(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	createdAt := clock.Now()
+	cache.SetWithOptions([]byte("lorem"), []byte("ipsum"), time.Minute, WithPinned())
+	cache.Set([]byte("lorem"), []byte("dolor"), time.Minute)
+	cache.SetNotFound([]byte("missing"), time.Minute)
+
+	clock.Advance(time.Second)
+	cache.Get([]byte("lorem"))
+	cache.Get([]byte("lorem"))
+	accessedAt := clock.Now()
+	clock.Advance(time.Second)
+
+	// Test
+	info, ok := cache.GetEntry([]byte("lorem"))
+	if !ok {
+		t.Fatalf("wrong value for GetEntry(lorem). Expected found but got not found")
+	}
+
+	if string(info.Value) != "dolor" || info.TTL != time.Minute || info.RemainingTTL != 58*time.Second {
+		t.Errorf("wrong value for GetEntry(lorem) value and TTL. Expected (dolor, 1m, 58s) but got (%s, %v, %v)", info.Value, info.TTL, info.RemainingTTL)
+	}
+
+	if !info.CreatedAt.Equal(createdAt) || !info.LastAccessAt.Equal(accessedAt) || !info.ExpiresAt.Equal(createdAt.Add(time.Minute)) {
+		t.Errorf("wrong value for GetEntry(lorem) times. Expected (%v, %v, %v) but got (%v, %v, %v)",
+			createdAt, accessedAt, createdAt.Add(time.Minute), info.CreatedAt, info.LastAccessAt, info.ExpiresAt)
+	}
+
+	if info.Version != 2 || info.Hits != 2 || !info.Pinned {
+		t.Errorf("wrong value for GetEntry(lorem) counters. Expected (version 2, 2 hits, pinned) but got (version %v, %v hits, pinned %v)", info.Version, info.Hits, info.Pinned)
+	}
+
+	// GetEntry is not an access
+	if again, _ := cache.GetEntry([]byte("lorem")); again.Hits != 2 || !again.LastAccessAt.Equal(accessedAt) {
+		t.Errorf("GetEntry() should not count as an access but got %v hits, last access %v", again.Hits, again.LastAccessAt)
+	}
+
+	// Rewriting after removal restarts the version
+	cache.DeleteString("lorem")
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	if info, ok := cache.GetEntry([]byte("lorem")); !ok || info.Version != 1 || info.Hits != 0 || !info.ExpiresAt.IsZero() {
+		t.Errorf("wrong value for GetEntry(lorem) after removal. Expected (version 1, 0 hits, no expiry) but got %+v", info)
+	}
+
+	for _, key := range []string{"missing", "unknown"} {
+		if info, ok := cache.GetEntry([]byte(key)); ok {
+			t.Errorf("wrong value for GetEntry(%s). Expected not found but got %+v", key, info)
+		}
+	}
+}
+
+func TestActiveCache_GetOK(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.Set([]byte("empty"), []byte{}, NoExpiration)
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.Set([]byte("expired"), []byte("value"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	type testCase struct {
+		name        string
+		key         []byte
+		expectedVal []byte
+		expectedTtl time.Duration
+		expectedOk  bool
+	}
+
+	testsCase := []testCase{
+		{name: "empty value hit", key: []byte("empty"), expectedVal: []byte{}, expectedOk: true},
+		{name: "hit", key: []byte("lorem"), expectedVal: []byte("ipsum"), expectedTtl: time.Minute, expectedOk: true},
+		{name: "expired", key: []byte("expired")},
+		{name: "nonexistent", key: []byte("nonexistent key")},
+		{name: "nil key", key: nil},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		val, ttl, ok := cache.GetOK(tc.key)
+		if ok != tc.expectedOk || !bytes.Equal(tc.expectedVal, val) || ttl != tc.expectedTtl {
+			t.Errorf(
+				"%s: wrong value for GetOK(%s). Expected (%s, %v, %v) but got (%s, %v, %v)",
+				tc.name,
+				tc.key,
+				tc.expectedVal,
+				tc.expectedTtl,
+				tc.expectedOk,
+				val,
+				ttl,
+				ok,
+			)
+		}
+	}
+}
+
+func TestActiveCache_GetOrDefault(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("empty"), []byte{})
+	cache.Set([]byte("expired"), []byte("value"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+	def := []byte("default")
+
+	type testCase struct {
+		key      []byte
+		def      []byte
+		expected []byte
+	}
+
+	testsCase := []testCase{
+		{key: []byte("lorem"), def: def, expected: []byte("ipsum")},
+		{key: []byte("empty"), def: def, expected: []byte{}},
+		{key: []byte("expired"), def: def, expected: def},
+		{key: []byte("nonexistent key"), def: def, expected: def},
+		{key: nil, def: def, expected: def},
+		{key: []byte("nonexistent key"), def: nil, expected: nil},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		val := cache.GetOrDefault(tc.key, tc.def)
+		if !bytes.Equal(tc.expected, val) || (tc.expected == nil) != (val == nil) {
+			t.Errorf("wrong value for GetOrDefault(%s, %s). Expected %v but got %v", tc.key, tc.def, tc.expected, val)
+		}
+	}
+
+	val := cache.GetOrDefault([]byte("nonexistent key"), def)
+	val[0] = 'X'
+	if string(def) != "default" {
+		t.Errorf("GetOrDefault() must return a copy of the default but it changed to %s", def)
+	}
+
+	if _, ok := cache.entries.Get([]byte("nonexistent key")); ok {
+		t.Error("GetOrDefault() must not store the default")
+	}
+}
+
+func TestActiveCache_GetString(t *testing.T) {
+	// Setup
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Hooks: hooks})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.Set([]byte("john"), []byte("doe"), ExpireNow)
+	cache.SetNotFound([]byte("jane"), time.Minute)
+	hooks.calls = nil
+
+	type testCase struct {
+		key           string
+		expectedValue []byte
+		expectedTTL   time.Duration
+	}
+
+	testsCase := []testCase{
+		{key: "lorem", expectedValue: []byte("ipsum"), expectedTTL: time.Minute},
+		{key: "john"},
+		{key: "jane"},
+		{key: "nonexistent key"},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		value, ttl := cache.GetString(tc.key)
+		expectedValue, expectedTTL := cache.Get([]byte(tc.key))
+		if !bytes.Equal(value, tc.expectedValue) || ttl != tc.expectedTTL ||
+			!bytes.Equal(value, expectedValue) || ttl != expectedTTL {
+			t.Errorf("wrong value for GetString(%s). Expected (%q, %v) but got (%q, %v)",
+				tc.key, tc.expectedValue, tc.expectedTTL, value, ttl)
+		}
+	}
+
+	expectedCalls := []string{
+		"hit lorem", "hit lorem",
+		"miss john", "miss john",
+		"miss jane", "miss jane",
+		"miss nonexistent key", "miss nonexistent key",
+	}
+	if !reflect.DeepEqual(hooks.calls, expectedCalls) {
+		t.Errorf("wrong value for GetString() hooks. Expected %v but got %v", expectedCalls, hooks.calls)
+	}
+
+	cache.Close()
+	if value, ttl := cache.GetString("lorem"); value != nil || ttl != 0 {
+		t.Errorf("wrong value for GetString() after Close(). Expected (nil, 0) but got (%q, %v)", value, ttl)
+	}
+}
+
+func TestActiveCache_GetWithState(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.SetPermanent([]byte("empty"), []byte{})
+	cache.SetNotFound([]byte("john"), time.Second)
+
+	type testCase struct {
+		key           string
+		expectedValue []byte
+		expectedState EntryState
+		expectedTTL   time.Duration
+	}
+
+	testsCase := []testCase{
+		{key: "lorem", expectedValue: []byte("ipsum"), expectedState: Present, expectedTTL: time.Minute},
+		{key: "empty", expectedValue: []byte{}, expectedState: Present},
+		{key: "john", expectedState: NegativeCached},
+		{key: "nonexistent key", expectedState: Missing},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		value, state, ttl := cache.GetWithState([]byte(tc.key))
+		if !bytes.Equal(value, tc.expectedValue) || state != tc.expectedState || ttl != tc.expectedTTL {
+			t.Errorf("wrong value for GetWithState(%s). Expected (%q, %v, %v) but got (%q, %v, %v)",
+				tc.key, tc.expectedValue, tc.expectedState, tc.expectedTTL, value, state, ttl)
+		}
+	}
+
+	if _, state, _ := cache.GetWithState(nil); state != Missing {
+		t.Errorf("wrong value for GetWithState(nil). Expected %v but got %v", Missing, state)
+	}
+
+	// Negative entries expire like any other entry
+	clock.Advance(time.Second)
+	if _, state, _ := cache.GetWithState([]byte("john")); state != Missing {
+		t.Errorf("wrong value for GetWithState(john) after TTL. Expected %v but got %v", Missing, state)
+	}
+}
+
+func TestActiveCache_Has(t *testing.T) {
+	// Setup
+	hooks := &recordingHooks{}
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("empty"), nil)
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+	hooks.calls = nil
+
+	// Test
+	tests := map[string]bool{
+		"lorem":           true,
+		"empty":           true,
+		"jane":            false,
+		"nonexistent key": false,
+	}
+
+	for key, expected := range tests {
+		if has := cache.Has([]byte(key)); has != expected {
+			t.Errorf("wrong value for Has(%s). Expected %v but got %v", key, expected, has)
+		}
+	}
+
+	if cache.Has(nil) {
+		t.Errorf("wrong value for Has(nil). Expected false but got true")
+	}
+
+	if len(hooks.calls) != 0 {
+		t.Errorf("Has() should not call Hooks but got %v", hooks.calls)
+	}
+}
+
+func TestActiveCache_IsCleanerRunning(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{Scheduler: cachetest.NewManualScheduler()})
+	cache.StopCleaner()
+
+	//Test
+	if cache.IsCleanerRunning() || cache.IsCleanerRunning() != cache.isCleanerRunning.Load() {
+		t.Error("wrong value on IsCleanerRunning(). Must return the same value as ActiveCache.isCleanerRunning")
+	}
+
+	cache.StartCleaner()
+	if !cache.IsCleanerRunning() || cache.IsCleanerRunning() != cache.isCleanerRunning.Load() {
+		t.Error("wrong value on IsCleanerRunning(). Must return the same value as ActiveCache.isCleanerRunning")
+	}
+	cache.StopCleaner()
+}
+
+func TestActiveCache_Items(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	value := []byte("ipsum")
+	cache.SetPermanent([]byte("lorem"), value)
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	// Test
+	items := cache.Items()
+	expected := map[string][]byte{"lorem": []byte("ipsum")}
+	if !reflect.DeepEqual(expected, items) {
+		t.Errorf("wrong value for Items(). Expected %v but got %v", expected, items)
+	}
+
+	items["lorem"][0] = 'X'
+	if string(value) != "ipsum" {
+		t.Errorf("Items() must return copies. Stored value changed to %s", value)
+	}
+}
+
+func TestActiveCache_jitter(t *testing.T) {
+	// Setup
+	const keys = 1000
+	clock := cachetest.NewFakeClock(time.Now())
+
+	tests := []struct {
+		name     string
+		conf     *Config
+		ttl      time.Duration
+		min, max time.Duration
+	}{
+		{name: "disabled", conf: &Config{}, ttl: time.Minute, min: time.Minute, max: time.Minute},
+		{name: "extend", conf: &Config{TTLJitter: 10 * time.Second}, ttl: time.Minute, min: time.Minute, max: 70 * time.Second},
+		{name: "both ways", conf: &Config{TTLJitter: 10 * time.Second, TTLJitterBothWays: true}, ttl: time.Minute, min: 50 * time.Second, max: 70 * time.Second},
+		{name: "both ways capped", conf: &Config{TTLJitter: time.Minute, TTLJitterBothWays: true}, ttl: 10 * time.Second, min: 5 * time.Second, max: 70 * time.Second},
+	}
+
+	// Test
+	for _, tt := range tests {
+		tt.conf.Clock = clock
+		cache := NewActiveCacheWithConfig(tt.conf)
+		cache.StopCleaner()
+
+		spread := map[time.Duration]bool{}
+		early := false
+		for i := 0; i < keys; i++ {
+			key := []byte(fmt.Sprint(i))
+			cache.Set(key, []byte("value"), tt.ttl)
+
+			_, expiredAt, _ := cache.PeekExpired(key)
+			lifetime := expiredAt.Sub(clock.Now())
+			if lifetime < tt.min || lifetime > tt.max {
+				t.Fatalf("%s: wrong expiration for Set() with jitter. Expected within [%v, %v] but got %v", tt.name, tt.min, tt.max, lifetime)
+			}
+			spread[lifetime] = true
+			early = early || lifetime < tt.ttl
+
+			if _, ttl := cache.Get(key); ttl != tt.ttl {
+				t.Fatalf("%s: wrong value for Get() TTL with jitter. Expected %v but got %v", tt.name, tt.ttl, ttl)
+			}
+		}
+		cache.Close()
+
+		if tt.conf.TTLJitter > 0 && len(spread) < keys*9/10 {
+			t.Errorf("%s: expirations should be spread out but got %v distinct values for %v keys", tt.name, len(spread), keys)
+		}
+
+		if early != tt.conf.TTLJitterBothWays {
+			t.Errorf("%s: wrong early expirations. Expected %v but got %v", tt.name, tt.conf.TTLJitterBothWays, early)
+		}
+	}
+}
+
+func TestActiveCache_Keys(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+
+	// Test
+	keys := cache.Keys()
+	sort.Slice(keys, func(i, j int) bool {
+		return string(keys[i]) < string(keys[j])
+	})
+
+	if len(keys) != 2 || string(keys[0]) != "john" || string(keys[1]) != "lorem" {
+		t.Fatalf("wrong value for Keys(). Expected [john lorem] but got %s", keys)
+	}
+
+	// Keys must be copies
+	keys[1][0] = 'X'
+	if _, _, ok := cache.GetOK([]byte("lorem")); !ok {
+		t.Errorf("Keys() must return copies. Key lorem not found anymore")
+	}
+
+	empty := NewActiveCache()
+	empty.StopCleaner()
+	if keys := empty.Keys(); keys == nil || len(keys) != 0 {
+		t.Errorf("Keys() on empty cache should return an empty slice but got %#v", keys)
+	}
+}
+
+func TestActiveCache_KeysSorted(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for i := 0; i < 50; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+
+	// Test
+	keys := cache.KeysSorted()
+	if len(keys) != 50 {
+		t.Fatalf("wrong value for KeysSorted() length. Expected 50 but got %v", len(keys))
+	}
+
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Errorf("KeysSorted() should be ordered by key bytes but got %s before %s", keys[i-1], keys[i])
+		}
+	}
+}
+
+func TestActiveCache_LastCleanPanic(t *testing.T) {
+	// Setup
+	var reported *CleanPanicError
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock: clock,
+		OnCleanPanic: func(err *CleanPanicError) {
+			reported = err
+		},
+	})
+	cache.StopCleaner()
+
+	// Test
+	if err := cache.LastCleanPanic(); err != nil {
+		t.Errorf("wrong value for LastCleanPanic(). Expected nil but got %v", err)
+	}
+
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.cleanFunc = func(c *ActiveCache) {
+		panic("boom")
+	}
+	if cache.performClean() {
+		t.Errorf("wrong value for performClean() on panic. Expected false but got true")
+	}
+
+	var panicErr *CleanPanicError
+	err := cache.LastCleanPanic()
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("wrong value for LastCleanPanic(). Expected boom panic but got %v", err)
+	}
+
+	if reported != panicErr {
+		t.Errorf("OnCleanPanic should receive the recovered panic. Expected %v but got %v", panicErr, reported)
+	}
+
+	// Test panics in hooks dispatched by the cleaner are recovered too
+	cache.cleanFunc = defaultClean
+	cache.config.Load().Hooks = &expirePanicHooks{}
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Nanosecond)
+	clock.Advance(time.Millisecond)
+	cache.performClean()
+	if err := cache.LastCleanPanic(); err == nil || err.Error() != "cache: clean panic: expire" {
+		t.Errorf("wrong value for LastCleanPanic() after hook panic. Expected expire panic but got %v", err)
+	}
+}
+
+func TestActiveCache_Len(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+
+	// Test
+	if cache.Len() != 0 {
+		t.Errorf("wrong value for Len() on empty cache. Expected 0 but got %v", cache.Len())
+	}
+
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Millisecond)
+	cache.SetPermanent([]byte("lorem"), []byte("updated"))
+	clock.Advance(time.Millisecond * 5)
+	if cache.Len() != 2 {
+		t.Errorf("wrong value for Len() with an expired entry. Expected 2 but got %v", cache.Len())
+	}
+
+	cache.Set([]byte("lorem"), nil, ExpireNow)
+	if cache.Len() != 1 {
+		t.Errorf("wrong value for Len() after delete. Expected 1 but got %v", cache.Len())
+	}
+
+	cache.CleanNow()
+	if cache.Len() != 0 {
+		t.Errorf("wrong value for Len() after a clean cycle. Expected 0 but got %v", cache.Len())
+	}
+
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Delete([]byte("lorem"))
+	if cache.Len() != 0 {
+		t.Errorf("wrong value for Len() after Delete(). Expected 0 but got %v", cache.Len())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_LoadFactor(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for i := 0; i < 100; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+
+	// Test
+	if lf := cache.LoadFactor(); lf != 100/float64(hashmap.DefaultTableSize) {
+		t.Errorf("wrong value for LoadFactor(). Expected %v but got %v", 100/float64(hashmap.DefaultTableSize), lf)
+	}
+}
+
+func TestActiveCache_lock(t *testing.T) {
+	// Setup
+	var ops []string
+	cache := NewActiveCacheWithConfig(&Config{
+		LockWaitObserver: func(op string, wait time.Duration) {
+			if wait < 0 {
+				t.Errorf("lock wait must not be negative but got %v", wait)
+			}
+			ops = append(ops, op)
+		},
+	})
+	cache.StopCleaner()
+
+	// Test
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.Get([]byte("lorem"))
+	cache.performClean()
+	cache.CheckInvariants()
+	cache.Close()
+
+	expected := []string{"set", "get", "clean", "check", "close"}
+	if !reflect.DeepEqual(expected, ops) {
+		t.Errorf("wrong observed operations. Expected %v but got %v", expected, ops)
+	}
+}
+
+func TestActiveCache_lockKey(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{LockStripes: 8})
+	defer cache.Close()
+
+	lorem := []byte("lorem")
+	held := cache.entries.Stripe(lorem)
+	other := []byte("key0")
+	for i := 1; cache.entries.Stripe(other) == held; i++ {
+		other = []byte(fmt.Sprintf("key%v", i))
+	}
+	cache.Set(lorem, []byte("ipsum"), NoExpiration)
+
+	// Test a key of another stripe is written and read while lorem's is held
+	cache.stripes[held].Lock()
+	done := make(chan struct{})
+	go func() {
+		cache.Set(other, []byte("value"), NoExpiration)
+		cache.Get(other)
+		cache.PeekExpired(other)
+		cache.GetEntry(other)
+		cache.Has(other)
+		cache.Age(other)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Set() and single key reads of a key of another stripe should not wait for a held stripe")
+	}
+
+	// Whole-cache operations wait for every stripe
+	keys := make(chan int)
+	go func() {
+		keys <- len(cache.Keys())
+	}()
+
+	select {
+	case <-keys:
+		t.Error("Keys() should wait for every stripe to be released")
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	cache.stripes[held].Unlock()
+	if n := <-keys; n != 2 {
+		t.Errorf("wrong value for len(Keys()). Expected 2 but got %v", n)
+	}
+
+	// Writes that may have to make room take every stripe
+	bounded := NewActiveCacheWithConfig(&Config{LockStripes: 8, MaxEntries: 20})
+	defer bounded.Close()
+	for i := 0; i < 13; i++ {
+		stripe := bounded.lockKey("set", 0)
+		bounded.unlockKey(stripe)
+		if stripe != 0 {
+			t.Errorf("wrong value for lockKey(set) with %v of 20 entries. Expected 0 but got %v", i, stripe)
+		}
+		bounded.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration)
+	}
+
+	stripe := bounded.lockKey("set", 0)
+	bounded.unlockKey(stripe)
+	if stripe != -1 {
+		t.Errorf("wrong value for lockKey(set) with 13 of 20 entries. Expected -1 but got %v", stripe)
+	}
+
+	stripe = bounded.lockKey("get", 3)
+	bounded.unlockKey(stripe)
+	if stripe != 3 {
+		t.Errorf("wrong value for lockKey(get) with 13 of 20 entries. Expected 3 but got %v", stripe)
+	}
+
+	single := NewActiveCache()
+	defer single.Close()
+	stripe = single.lockKey("get", 0)
+	single.unlockKey(stripe)
+	if stripe != -1 {
+		t.Errorf("wrong value for lockKey() without LockStripes. Expected -1 but got %v", stripe)
+	}
+}
+
+func TestActiveCache_lockKey_concurrent(t *testing.T) {
+	// Setup: features recording shared state from Get and Set
+	hooks := &setCountHooks{}
+	cache := NewActiveCacheWithConfig(&Config{
+		LockStripes:      16,
+		MaxEntries:       300,
+		Hooks:            hooks,
+		AuditLogSize:     32,
+		DetectCollisions: true,
+		VerifyChecksums:  true,
+		OnReplace:        func(key, oldValue, newValue []byte) {},
+	})
+	defer cache.Close()
+
+	// Test Get, Set and whole-cache operations racing, see go test -race
+	const writers, sets = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := 0; n < sets; n++ {
+				key := []byte(fmt.Sprintf("w%v-%v", w, n%50))
+				cache.Set(key, key, time.Minute)
+				if value, _ := cache.Get(key); value != nil && !bytes.Equal(value, key) {
+					t.Errorf("wrong value for Get(%s). Expected %s but got %s", key, key, value)
+				}
+				cache.GetString(string(key))
+				cache.PeekExpired(key)
+				cache.GetEntry(key)
+				cache.Has(key)
+				cache.Age(key)
+				if n%7 == 0 {
+					cache.Delete(key)
+				}
+			}
+		}(w)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			cache.Keys()
+			cache.CleanNow()
+			cache.AuditLog()
+		}
+	}()
+	wg.Wait()
+
+	assertInvariants(t, cache)
+	if sets := hooks.sets.Load(); sets != writers*500 {
+		t.Errorf("wrong amount of OnSet calls. Expected %v but got %v", writers*500, sets)
+	}
+
+	if n := cache.Len(); n > 300 {
+		t.Errorf("wrong value for Len(). Expected at most 300 but got %v", n)
+	}
+}
+
+func TestActiveCache_MemoryUsage(t *testing.T) {
+	// Setup
+	const mutations = 100000
+	const keys = 500
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	rnd := rand.New(rand.NewSource(1))
+	durations := []time.Duration{
+		NoExpiration,
+		ExpireNow,
+		time.Nanosecond,
+		time.Minute,
+	}
+
+	recompute := func() int64 {
+		var total int64
+		for _, e := range cache.entries.GetAll() {
+			total += e.Value.Size(e.Key)
+		}
+		return total
+	}
+
+	// Test
+	if usage := cache.MemoryUsage(); usage != 0 {
+		t.Errorf("wrong value for MemoryUsage() on empty cache. Expected 0 but got %v", usage)
+	}
+
+	for i := 0; i < mutations; i++ {
+		key := []byte(fmt.Sprintf("key%v", rnd.Intn(keys)))
+		switch rnd.Intn(10) {
+		case 0:
+			cache.performClean()
+		default:
+			value := make([]byte, rnd.Intn(64))
+			cache.Set(key, value, durations[rnd.Intn(len(durations))])
+		}
+
+		if cache.MemoryUsage() < 0 {
+			t.Fatalf("MemoryUsage() must never be negative but got %v", cache.MemoryUsage())
+		}
+	}
+
+	if usage, expected := cache.MemoryUsage(), recompute(); usage != expected {
+		t.Errorf("MemoryUsage() drifted. Expected %v but got %v", expected, usage)
+	}
+
+	if stats := cache.Stats(); stats.MemoryUsage != cache.MemoryUsage() {
+		t.Errorf("wrong value for Stats().MemoryUsage. Expected %v but got %v", cache.MemoryUsage(), stats.MemoryUsage)
+	}
+}
+
+func TestActiveCache_nextCleanInterval(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock:                clock,
+		CleanerInterval:      MinCleanerInterval,
+		CleanerBackoffMax:    MinCleanerInterval * 8,
+		CleanerBackoffCycles: 2,
+		CleanerBackoffFactor: 2,
+	})
+	cache.StopCleaner()
+	for i := 0; i < 10; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+	base := time.Millisecond * MinCleanerInterval
+
+	// Test
+	if interval := cache.nextCleanInterval(true); interval != base {
+		t.Errorf("wrong initial clean interval. Expected %v but got %v", base, interval)
+	}
+
+	expected := []time.Duration{base, base * 2, base * 2, base * 4, base * 4, base * 8, base * 8, base * 8}
+	for i, e := range expected {
+		if interval := cache.nextCleanInterval(cache.performClean()); interval != e {
+			t.Errorf("wrong clean interval after %v idle cycles. Expected %v but got %v", i+1, e, interval)
+		}
+	}
+
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Millisecond)
+	clock.Advance(time.Millisecond * 5)
+	for cache.ExpiringCount() > 0 {
+		if interval := cache.nextCleanInterval(cache.performClean()); cache.ExpiringCount() == 0 && interval != base {
+			t.Errorf("clean interval should reset after removing entries. Expected %v but got %v", base, interval)
+		}
+	}
+
+	// Backoff disabled
+	cache.config.Load().CleanerBackoffMax = 0
+	for i := 0; i < 5; i++ {
+		if interval := cache.nextCleanInterval(false); interval != base {
+			t.Errorf("clean interval should not grow without CleanerBackoffMax. Expected %v but got %v", base, interval)
+		}
+	}
+}
+
+func TestActiveCache_PeekExpired(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Second)
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+	expiresAt := clock.Now().Add(time.Second)
+	clock.Advance(2 * time.Second)
+
+	// Lazily delete jane only, like the cleaner would
+	cache.mtx.Lock()
+	cache.delete([]byte("jane"))
+	cache.mtx.Unlock()
+	hooks.calls = nil
+	usage := cache.MemoryUsage()
+
+	// Test
+	tests := []struct {
+		key       string
+		value     string
+		expiredAt time.Time
+		ok        bool
+	}{
+		{key: "lorem", value: "ipsum", ok: true},
+		{key: "john", value: "doe", expiredAt: expiresAt, ok: true},
+		{key: "jane"},
+		{key: "nonexistent key"},
+	}
+
+	for _, tt := range tests {
+		value, expiredAt, ok := cache.PeekExpired([]byte(tt.key))
+		if string(value) != tt.value || !expiredAt.Equal(tt.expiredAt) || ok != tt.ok {
+			t.Errorf("wrong value for PeekExpired(%s). Expected (%s, %v, %v) but got (%s, %v, %v)",
+				tt.key,
+				tt.value,
+				tt.expiredAt,
+				tt.ok,
+				value,
+				expiredAt,
+				ok,
+			)
+		}
+	}
+
+	if _, _, ok := cache.PeekExpired(nil); ok {
+		t.Errorf("wrong value for PeekExpired(nil). Expected false but got true")
+	}
+
+	// Nothing must change
+	if _, _, ok := cache.GetOK([]byte("john")); ok {
+		t.Errorf("expired key must stay expired after PeekExpired()")
+	}
+
+	if cache.Len() != 2 || cache.MemoryUsage() != usage || len(hooks.calls) != 1 {
+		t.Errorf("PeekExpired() should not mutate the cache but got %v entries, %v bytes and hooks %v", cache.Len(), cache.MemoryUsage(), hooks.calls)
+	}
+}
+
+func TestActiveCache_performClean(t *testing.T) {
+	// Setup
+	var cleanExecuted atomic.Bool
+	sched := cachetest.NewManualScheduler()
+	cache := NewActiveCacheWithConfig(&Config{Scheduler: sched})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.cleanFunc = func(c *ActiveCache) {
+		cleanExecuted.Store(true)
+	}
+	cache.StartCleaner()
+	sched.Tick()
+
+	// Test
+	if !cleanExecuted.Load() {
+		t.Error("performClean() is not being called or is not calling ActiveCache.cleanFunc")
+	}
+
+	// Test a panicking clean function does not stop the cleaner
+	var panics atomic.Int64
+	sched = cachetest.NewManualScheduler()
+	cache = NewActiveCacheWithConfig(&Config{
+		Scheduler: sched,
+		OnCleanPanic: func(err *CleanPanicError) {
+			panics.Add(1)
+		},
+	})
+	cache.StopCleaner()
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.cleanFunc = func(c *ActiveCache) {
+		panic("boom")
+	}
+	cache.StartCleaner()
+	defer cache.StopCleaner()
+	sched.Tick()
+	sched.Tick()
+
+	if panics.Load() != 2 || !cache.IsCleanerRunning() {
+		t.Errorf("cleaner should survive panics and keep ticking but got %v panics, running %v", panics.Load(), cache.IsCleanerRunning())
+	}
+
+	// lock must have been released
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	if _, _, ok := cache.GetOK([]byte("lorem")); !ok {
+		t.Errorf("cache should keep working after a clean panic")
+	}
+
+	// Test cycles are skipped without locking while no entry has TTL
+	var locks, cleans atomic.Int64
+	sched = cachetest.NewManualScheduler()
+	cache = NewActiveCacheWithConfig(&Config{
+		Scheduler: sched,
+		LockWaitObserver: func(op string, wait time.Duration) {
+			if op == "clean" {
+				locks.Add(1)
+			}
+		},
+	})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.SetPermanent([]byte("john"), []byte("doe")) // overwrite to permanent
+	cache.cleanFunc = func(c *ActiveCache) {
+		cleans.Add(1)
+	}
+	cache.StartCleaner()
+	defer cache.StopCleaner()
+	for i := 0; i < 5; i++ {
+		sched.Tick()
+	}
+
+	if locks.Load() != 0 || cleans.Load() != 0 {
+		t.Errorf("cleaner should skip cycles without entries with TTL but locked %v and cleaned %v times", locks.Load(), cleans.Load())
+	}
+}
+
+func TestActiveCache_PauseCleaner(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	sched := cachetest.NewManualScheduler()
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Scheduler: sched, KeysAmountByCycle: MinKeysAmountByCycle})
+	defer cache.Close()
+	cache.PauseCleaner()
+	for i := 0; i < 10; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	// Test no cleaning occurs while paused
+	for i := 0; i < 3; i++ {
+		sched.Tick()
+	}
+	if !cache.IsCleanerPaused() || !cache.IsCleanerRunning() || cache.Len() != 10 {
+		t.Errorf("paused cleaner should keep running without cleaning but got %v entries", cache.Len())
+	}
+
+	// Test cleaning resumes afterwards
+	cache.ResumeCleaner()
+	sched.Tick()
+	if cache.IsCleanerPaused() || cache.Len() != 0 {
+		t.Errorf("resumed cleaner should remove expired entries but got %v entries", cache.Len())
+	}
+}
+
+func TestActiveCache_Pin(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 3})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.SetNotFound([]byte("missing"), time.Minute)
+	snapshot := cache.Snapshot()
+
+	// Test
+	if !cache.Pin([]byte("lorem")) {
+		t.Errorf("wrong value for Pin(lorem). Expected true but got false")
+	}
+
+	for _, key := range []string{"nonexistent key", "missing"} {
+		if cache.Pin([]byte(key)) {
+			t.Errorf("wrong value for Pin(%s). Expected false but got true", key)
+		}
+	}
+
+	if cache.Pin(nil) {
+		t.Errorf("wrong value for Pin(nil). Expected false but got true")
+	}
+
+	// lorem is the least recently used key but pinned
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	if _, _, ok := cache.GetOK([]byte("lorem")); !ok {
+		t.Errorf("pinned key lorem should not have been evicted")
+	}
+
+	if _, _, ok := cache.GetOK([]byte("john")); ok {
+		t.Errorf("unpinned key john should have been evicted")
+	}
+
+	// Snapshots hold copies of the entries
+	if entry, _ := snapshot.entries.Get([]byte("lorem")); entry.Pinned {
+		t.Errorf("Pin() should not change entries of a previous Snapshot()")
+	}
+}
+
+func TestActiveCache_PreviewClean(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("john"), []byte("doe"), time.Hour)
+	for _, key := range []string{"key0", "key1", "key2"} {
+		cache.Set([]byte(key), []byte("value"), time.Second)
+	}
+	clock.Advance(2 * time.Second)
+
+	// Test every expired key is in the sample as it covers the whole cache
+	preview := cache.PreviewClean()
+	sortByKey(preview, func(key []byte) []byte { return key })
+	if fmt.Sprintf("%s", preview) != "[key0 key1 key2]" {
+		t.Errorf("wrong value for PreviewClean(). Expected [key0 key1 key2] but got %s", preview)
+	}
+
+	if cache.Len() != 5 || cache.ExpiringCount() != 4 {
+		t.Errorf("PreviewClean() should remove nothing but got %v entries and %v with TTL", cache.Len(), cache.ExpiringCount())
+	}
+
+	// Test keys are copies
+	preview[0][0] = 'x'
+	preview = cache.PreviewClean()
+	sortByKey(preview, func(key []byte) []byte { return key })
+	if fmt.Sprintf("%s", preview) != "[key0 key1 key2]" {
+		t.Errorf("wrong value for PreviewClean() after changing a returned key. Expected [key0 key1 key2] but got %s", preview)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_ReadOnly(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	view := cache.ReadOnly()
+
+	// Test
+	if _, ok := view.(Cache); ok {
+		t.Errorf("ReadOnly() view should not expose Set")
+	}
+
+	// The view reflects live data
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	if val, _ := view.Get([]byte("lorem")); string(val) != "ipsum" || !view.Has([]byte("lorem")) {
+		t.Errorf("wrong value for ReadOnly().Get(lorem). Expected ipsum but got %s", val)
+	}
+
+	if view.Len() != 1 || len(view.Keys()) != 1 {
+		t.Errorf("wrong value for ReadOnly() Len() and Keys(). Expected 1 and 1 but got %v and %v", view.Len(), len(view.Keys()))
+	}
+
+	cache.Set([]byte("lorem"), nil, ExpireNow)
+	if view.Has([]byte("lorem")) || view.Len() != 0 {
+		t.Errorf("ReadOnly() view should reflect deletes but got %v entries", view.Len())
+	}
+}
+
+func TestActiveCache_Reconfigure(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	sched := cachetest.NewManualScheduler()
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Scheduler: sched, CleanerInterval: 5000})
+	defer cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Millisecond)
+
+	// Test reconfiguring while the cleaner and writers run
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cache.Reconfigure(&Config{Clock: clock, Scheduler: sched, CleanerInterval: MinCleanerInterval + i, MaxKeyBytes: 10})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cache.SetPermanent([]byte(fmt.Sprintf("key%d", i%5)), []byte("value"))
+		}
+	}()
+	wg.Wait()
+
+	conf := cache.config.Load()
+	if conf.CleanerInterval != MinCleanerInterval+99 || conf.KeysAmountByCycle != DefaultKeysAmountByCycle {
+		t.Errorf("wrong config after Reconfigure(). Expected interval %d and keys %d but got %d and %d",
+			MinCleanerInterval+99, DefaultKeysAmountByCycle, conf.CleanerInterval, conf.KeysAmountByCycle)
+	}
+
+	if err := cache.SetE([]byte("a very long key"), []byte("value"), NoExpiration); err != ErrKeyTooLarge {
+		t.Errorf("wrong value for SetE() after Reconfigure(). Expected %v but got %v", ErrKeyTooLarge, err)
+	}
+
+	// Test the cleaner picks up the new interval instead of waiting the old one
+	clock.Advance(time.Second)
+	sched.Tick()
+	cache.mtx.Lock()
+	_, ok := cache.entries.Get([]byte("lorem"))
+	cache.mtx.Unlock()
+	if ok {
+		t.Errorf("expired key should have been cleaned with the reconfigured interval")
+	}
+
+	if interval := sched.Interval(); interval != time.Millisecond*(MinCleanerInterval+99) {
+		t.Errorf("wrong clean interval after Reconfigure(). Expected %v but got %v", time.Millisecond*(MinCleanerInterval+99), interval)
+	}
+
+	// Test nil resets to default config
+	cache.Reconfigure(nil)
+	if cache.config.Load().MaxKeyBytes != 0 {
+		t.Errorf("Reconfigure(nil) should reset to DefaultConfig but got %+v", cache.config.Load())
+	}
+}
+
+func TestActiveCache_RemapTTL(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), 2*time.Hour)
+	cache.Set([]byte("john"), []byte("doe"), 30*time.Minute)
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	clock.Advance(time.Minute)
+
+	ttls := func() map[string]time.Duration {
+		ttls := map[string]time.Duration{}
+		for _, item := range cache.Entries() {
+			ttls[string(item.Key)] = item.TTL
+		}
+		return ttls
+	}
+
+	// Test capping every remaining TTL at 1 hour, permanent entries included
+	snapshot := cache.Snapshot()
+	cache.RemapTTL(func(remaining time.Duration) time.Duration {
+		if remaining == NoExpiration || remaining > time.Hour {
+			return time.Hour
+		}
+		return remaining
+	})
+
+	expected := map[string]time.Duration{"lorem": time.Hour, "john": 29 * time.Minute, "jane": time.Hour}
+	if got := ttls(); !reflect.DeepEqual(expected, got) {
+		t.Errorf("wrong TTLs after capping with RemapTTL(). Expected %v but got %v", expected, got)
+	}
+
+	if _, ttl, _ := snapshot.Get([]byte("jane")); ttl != NoExpiration {
+		t.Errorf("RemapTTL() should not change snapshots. Expected jane permanent but got %v", ttl)
+	}
+
+	// Test extending every TTL by 10 minutes, and making one permanent
+	cache.RemapTTL(func(remaining time.Duration) time.Duration {
+		if remaining == 29*time.Minute {
+			return NoExpiration
+		}
+		return remaining + 10*time.Minute
+	})
+
+	expected = map[string]time.Duration{"lorem": 70 * time.Minute, "john": NoExpiration, "jane": 70 * time.Minute}
+	if got := ttls(); !reflect.DeepEqual(expected, got) || cache.ExpiringCount() != 2 {
+		t.Errorf("wrong TTLs after extending with RemapTTL(). Expected %v with 2 expiring but got %v with %v", expected, got, cache.ExpiringCount())
+	}
+
+	// Test negative TTLs delete entries
+	hooks.calls = nil
+	cache.RemapTTL(func(remaining time.Duration) time.Duration {
+		if remaining == NoExpiration {
+			return ExpireNow
+		}
+		return remaining
+	})
+
+	if cache.Has([]byte("john")) || cache.Len() != 2 {
+		t.Errorf("RemapTTL() returning a negative TTL should delete the entry but got john found=%v with %v entries", cache.Has([]byte("john")), cache.Len())
+	}
+
+	sort.Strings(hooks.calls)
+	if expectedCalls := []string{"delete john", "set jane 1h10m0s", "set lorem 1h10m0s"}; !reflect.DeepEqual(expectedCalls, hooks.calls) {
+		t.Errorf("wrong hooks on RemapTTL(). Expected %v but got %v", expectedCalls, hooks.calls)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Scan(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	defer cache.Close()
+	for i := 0; i < 50; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration)
+	}
+	cache.Set([]byte("expired"), []byte("value"), time.Nanosecond)
+	cache.SetNotFound([]byte("missing"), NoExpiration)
+	clock.Advance(time.Millisecond)
+
+	// Test scanning a cache mutated between pages
+	seen := map[string]int{}
+	var cursor hashmap.Cursor
+	for i, done := 0, false; !done; i++ {
+		if i > 100 {
+			t.Fatalf("Scan() should terminate but did not after %v pages", i)
+		}
+
+		var items []Item
+		items, cursor, done = cache.Scan(cursor, 7)
+		if len(items) > 7 {
+			t.Errorf("wrong value for Scan() page length. Expected at most 7 but got %v", len(items))
+		}
+		for _, item := range items {
+			seen[string(item.Key)]++
+		}
+
+		cache.Set([]byte(fmt.Sprintf("tmp%v", i)), []byte("value"), NoExpiration)
+		cache.DeleteString(fmt.Sprintf("tmp%v", i-1))
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("updated"), NoExpiration)
+	}
+
+	for i := 0; i < 50; i++ {
+		if key := fmt.Sprintf("key%v", i); seen[key] != 1 {
+			t.Errorf("wrong value for Scan() of %s. Expected 1 visit but got %v", key, seen[key])
+		}
+	}
+	for key, visits := range seen {
+		if key == "expired" || key == "missing" || visits != 1 {
+			t.Errorf("wrong value for Scan() of %s. Expected no expired, not found or repeated keys but got %v visits", key, visits)
+		}
+	}
+
+	if items, _, done := cache.Scan(hashmap.Cursor{}, 0); len(items) != 1 || done {
+		t.Errorf("wrong value for Scan() with limit 0. Expected 1 item and not done but got %v items, done %v", len(items), done)
+	}
+}
+
+func TestActiveCache_Set(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+
+	type testEntry struct {
+		key   []byte
+		value []byte
+		ttl   time.Duration
+	}
+
+	testsCase := []testEntry{
+		{key: []byte("lorem"), value: []byte("ipsum"), ttl: NoExpiration},
+		{key: []byte("lorem"), value: []byte("dolor"), ttl: 10},
+		{key: []byte("lorem"), value: []byte("ipsum"), ttl: 5},
+		{key: []byte("jane"), value: []byte("foster"), ttl: 1},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		cache.Set(tc.key, tc.value, tc.ttl)
+		e, ok := cache.entries.Get(tc.key)
+
+		if !ok || !bytes.Equal(tc.value, e.Value) || tc.ttl != e.Ttl {
+			t.Errorf(
+				"wrong value when performing Set() for key %s. Expected (%s, %v) got (%s, %v)",
+				tc.key,
+				tc.value,
+				tc.ttl,
+				e.Value,
+				e.Ttl,
+			)
+		}
+	}
+
+	cache.Set(nil, []byte("doe"), time.Second) // nil key
+	e, ok := cache.entries.Get(nil)
+	if ok || e != nil {
+		t.Errorf(
+			"wrong value when performing Set() for key nil. Expected to not found entry but got (%s, %v)",
+			e.Value,
+			e.Ttl,
+		)
+	}
+
+	cache.Set([]byte("jane"), []byte("thor"), -100) // negative TTL
+	e, ok = cache.entries.Get([]byte("jane"))
+	if ok || e != nil {
+		t.Errorf(
+			"wrong value when performing Set() for key %s with negative TTL. Expected to not found entry but got (%s, %v)",
+			[]byte("jane"),
+			e.Value,
+			e.Ttl,
+		)
+	}
+}
+
+func TestActiveCache_Set_cleanHighWater(t *testing.T) {
+	for _, highWater := range []int{5, 100} {
+		// Setup
+		clock := cachetest.NewFakeClock(time.Now())
+		hooks := &expireHooks{expired: make(chan []byte, 5)}
+		cache := NewActiveCacheWithConfig(&Config{
+			Clock:          clock,
+			Scheduler:      cachetest.NewManualScheduler(),
+			Hooks:          hooks,
+			CleanHighWater: highWater,
+		})
+		defer cache.Close()
+		for i := 0; i < 5; i++ {
+			cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), 20*time.Millisecond)
+		}
+		clock.Advance(MinCleanerInterval * time.Millisecond)
+
+		// Test the write crossing the mark triggers a cycle without a tick of the scheduler
+		cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+		expected := 5
+		if highWater < 6 {
+			expected = 0
+			for i := 0; i < 5; i++ {
+				select {
+				case <-hooks.expired:
+				case <-time.After(time.Second):
+					t.Fatalf("crossing CleanHighWater %v should run a clean cycle", highWater)
+				}
+			}
+		}
+
+		if cache.ExpiringCount() != expected {
+			t.Errorf("wrong value for ExpiringCount() with CleanHighWater %v. Expected %v but got %v", highWater, expected, cache.ExpiringCount())
+		}
+	}
+}
+
+func TestActiveCache_Set_churn(t *testing.T) {
+	// Setup
+	const writers, keysPerWriter, rounds = 4, 50, 40
+	cache := NewActiveCache()
+	cache.StopCleaner()
+
+	// Test deleted entries reused for new keys never expose another key's value
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				for i := 0; i < keysPerWriter; i++ {
+					key := fmt.Sprintf("key-%d-%d", w, i)
+					if (i+round)%2 == 0 {
+						cache.SetPermanent([]byte(key), []byte(key))
+					} else {
+						cache.DeleteString(key)
+					}
+
+					if value, _, ok := cache.GetOK([]byte(key)); ok && string(value) != key {
+						t.Errorf("wrong value for GetOK(%s). Expected %s but got %s", key, key, value)
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if expected := writers * keysPerWriter / 2; cache.Len() != expected {
+		t.Errorf("wrong value for Len() after churn. Expected %v but got %v", expected, cache.Len())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_SetCleanFunc(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	clock.Advance(time.Second)
+
+	var views []EntryView
+	cache.SetCleanFunc(func(entries []EntryView) [][]byte {
+		views = entries
+		return [][]byte{[]byte("lorem"), []byte("jane"), []byte("missing")}
+	})
+
+	// Test
+	hooks.calls = nil
+	cache.performClean()
+	sort.Slice(views, func(i, j int) bool { return string(views[i].Key) < string(views[j].Key) })
+	if len(views) != 3 || string(views[0].Key) != "jane" || views[1].ValueLen != 3 || views[2].TTL != time.Second {
+		t.Errorf("wrong views given to CleanFunc. Expected jane, john and lorem but got %+v", views)
+	}
+
+	expected := []string{"expire lorem", "delete jane"}
+	if !reflect.DeepEqual(expected, hooks.calls) {
+		t.Errorf("wrong hooks for removed keys. Expected %v but got %v", expected, hooks.calls)
+	}
+
+	if _, _, ok := cache.GetOK([]byte("john")); !ok || cache.length.Load() != 1 {
+		t.Errorf("CleanFunc should only remove returned keys but got %v entries", cache.length.Load())
+	}
+
+	// Test nil restores the default algorithm
+	cache.SetCleanFunc(nil)
+	if reflect.ValueOf(cache.cleanFunc).Pointer() != reflect.ValueOf(defaultClean).Pointer() {
+		t.Errorf("SetCleanFunc(nil) should restore defaultClean")
+	}
+}
+
+func TestActiveCache_SetCtx(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+
+	// Test
+	if err := cache.SetCtx(context.Background(), []byte("lorem"), []byte("ipsum"), time.Minute); err != nil {
+		t.Errorf("wrong error for SetCtx(lorem). Expected nil but got %v", err)
+	}
+
+	if val, ttl := cache.Get([]byte("lorem")); string(val) != "ipsum" || ttl != time.Minute {
+		t.Errorf("wrong value after SetCtx(lorem). Expected (ipsum, 1m) but got (%s, %v)", val, ttl)
+	}
+
+	if err := cache.SetCtx(context.Background(), nil, []byte("doe"), time.Minute); !errors.Is(err, ErrNilKey) {
+		t.Errorf("wrong error for SetCtx(nil). Expected %v but got %v", ErrNilKey, err)
+	}
+
+	// Lock held by another operation, write must not be applied
+	cache.mtx.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	err := cache.SetCtx(ctx, []byte("john"), []byte("doe"), NoExpiration)
+	cache.mtx.Unlock()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error for SetCtx() under contention. Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	assertUnlocked(t, cache, "SetCtx()")
+	if val, _ := cache.Get([]byte("john")); val != nil {
+		t.Errorf("SetCtx() must not write after context is done but found %s", val)
+	}
+}
+
+func TestActiveCache_SetE(t *testing.T) {
+	// Setup
+	const maxKeyBytes = 8
+	const maxValueBytes = 16
+	cache := NewActiveCacheWithConfig(&Config{
+		MaxKeyBytes:   maxKeyBytes,
+		MaxValueBytes: maxValueBytes,
+	})
+	cache.StopCleaner()
+
+	type testCase struct {
+		key         []byte
+		value       []byte
+		ttl         time.Duration
+		expectedErr error
+	}
+
+	testsCase := []testCase{
+		{key: bytes.Repeat([]byte("k"), maxKeyBytes), value: bytes.Repeat([]byte("v"), maxValueBytes)},
+		{key: bytes.Repeat([]byte("k"), maxKeyBytes+1), value: []byte("v"), expectedErr: ErrKeyTooLarge},
+		{key: []byte("lorem"), value: bytes.Repeat([]byte("v"), maxValueBytes+1), expectedErr: ErrValueTooLarge},
+		{key: []byte("lorem"), value: bytes.Repeat([]byte("v"), maxValueBytes+1), ttl: ExpireNow}, // removal only
+		{key: nil, value: []byte("v"), expectedErr: ErrNilKey},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		err := cache.SetE(tc.key, tc.value, tc.ttl)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("wrong error for SetE(%s) with %v value bytes. Expected %v but got %v", tc.key, len(tc.value), tc.expectedErr, err)
+		}
+
+		_, stored := cache.entries.Get(tc.key)
+		if stored != (tc.expectedErr == nil && tc.ttl >= NoExpiration) {
+			t.Errorf("wrong stored state for SetE(%s). Expected stored %v but got %v", tc.key, !stored, stored)
+		}
+	}
+
+	// Set silently drops oversized writes
+	cache.Set([]byte("john"), bytes.Repeat([]byte("v"), maxValueBytes+1), NoExpiration)
+	if _, ok := cache.entries.Get([]byte("john")); ok {
+		t.Error("Set() should drop values larger than MaxValueBytes")
+	}
+
+	cache.Set(bytes.Repeat([]byte("k"), maxKeyBytes+1), []byte("v"), NoExpiration)
+	if _, ok := cache.entries.Get(bytes.Repeat([]byte("k"), maxKeyBytes+1)); ok {
+		t.Error("Set() should drop keys larger than MaxKeyBytes")
+	}
+
+	cache.Set([]byte("jane"), []byte("v"), NoExpiration)
+	if _, ok := cache.entries.Get([]byte("jane")); !ok {
+		t.Error("Set() should store keys within MaxKeyBytes")
+	}
+
+	err := cache.SetCtx(context.Background(), bytes.Repeat([]byte("k"), maxKeyBytes+1), nil, NoExpiration)
+	if !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("wrong error for SetCtx() with oversized key. Expected %v but got %v", ErrKeyTooLarge, err)
+	}
+
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	if cache.SetKeepTTL([]byte("jane"), bytes.Repeat([]byte("v"), maxValueBytes+1)) {
+		t.Error("SetKeepTTL() should reject values larger than MaxValueBytes")
+	}
+}
+
+func TestActiveCache_SetKeepTTL(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+	lorem, _ := cache.entries.Get([]byte("lorem"))
+	expiresAt := lorem.ExpiresAt
+	clock.Advance(time.Second)
+
+	// Test
+	if !cache.SetKeepTTL([]byte("lorem"), []byte("dolor")) {
+		t.Error("SetKeepTTL() should replace an existing key")
+	}
+
+	lorem, _ = cache.entries.Get([]byte("lorem"))
+	if string(lorem.Value) != "dolor" || lorem.ExpiresAt != expiresAt || lorem.Ttl != time.Minute {
+		t.Errorf(
+			"SetKeepTTL() must only change the value. Expected (dolor, %v, 1m) but got (%s, %v, %v)",
+			expiresAt,
+			lorem.Value,
+			lorem.ExpiresAt,
+			lorem.Ttl,
+		)
+	}
+
+	if !cache.SetKeepTTL([]byte("john"), []byte("wick")) {
+		t.Error("SetKeepTTL() should replace a permanent key")
+	}
+
+	if val, ttl := cache.Get([]byte("john")); string(val) != "wick" || ttl != NoExpiration {
+		t.Errorf("permanent key should stay permanent. Expected (wick, 0) but got (%s, %v)", val, ttl)
+	}
+
+	if cache.SetKeepTTL([]byte("jane"), []byte("thor")) { // expired is absent
+		t.Error("SetKeepTTL() should not replace an expired key")
+	}
+
+	if jane, _ := cache.entries.Get([]byte("jane")); string(jane.Value) != "foster" {
+		t.Errorf("SetKeepTTL() should not store on expired key but got %s", jane.Value)
+	}
+
+	if cache.SetKeepTTL([]byte("nonexistent key"), []byte("value")) || cache.SetKeepTTL(nil, []byte("value")) {
+		t.Error("SetKeepTTL() should not store missing or nil keys")
+	}
+
+	if _, ok := cache.entries.Get([]byte("nonexistent key")); ok {
+		t.Error("SetKeepTTL() must not create missing keys")
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_SetMany(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{
+		MaxKeyBytes:   5,
+		MaxValueBytes: 5,
+		MaxEntries:    2,
+		FullBehavior:  RejectWrites,
+	})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+
+	items := []Item{
+		{Key: []byte("lorem"), Value: []byte("ipsum"), TTL: time.Minute},
+		{Key: nil, Value: []byte("value")},
+		{Key: []byte("too long"), Value: []byte("value")},
+		{Key: []byte("key"), Value: []byte("too long")},
+		{Key: []byte("john"), Value: nil, TTL: ExpireNow},
+		{Key: []byte("dolor"), Value: []byte("sit")},
+		{Key: []byte("amet"), Value: []byte("full")},
+	}
+
+	// Test
+	results := cache.SetMany(items)
+	expected := []error{nil, ErrNilKey, ErrKeyTooLarge, ErrValueTooLarge, nil, nil, ErrCacheFull}
+	if len(results) != len(expected) {
+		t.Fatalf("wrong results length for SetMany(). Expected %v but got %v", len(expected), len(results))
+	}
+
+	for i, result := range results {
+		if !bytes.Equal(result.Key, items[i].Key) || result.Err != expected[i] {
+			t.Errorf("wrong result %v for SetMany(). Expected %s: %v but got %s: %v", i, items[i].Key, expected[i], result.Key, result.Err)
+		}
+	}
+
+	for key, expected := range map[string]bool{"lorem": true, "john": false, "dolor": true, "amet": false} {
+		if _, _, ok := cache.GetOK([]byte(key)); ok != expected {
+			t.Errorf("wrong value for GetOK(%q) after SetMany(). Expected %v but got %v", key, expected, ok)
+		}
+	}
+
+	if results := cache.SetMany(nil); len(results) != 0 {
+		t.Errorf("wrong value for SetMany(nil). Expected no results but got %v", results)
+	}
+}
+
+func TestActiveCache_SetMiss(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.SetMiss([]byte("lorem"), time.Minute)
+	cache.SetMiss(nil, time.Minute)
+
+	// Test
+	if val, state, ttl := cache.GetWithState([]byte("lorem")); state != NegativeCached || val != nil || ttl != 0 {
+		t.Errorf("wrong value for GetWithState(lorem). Expected (nil, NegativeCached, 0) but got (%s, %v, %v)", val, state, ttl)
+	}
+
+	if _, state, _ := cache.GetWithState([]byte("ipsum")); state != Missing {
+		t.Errorf("wrong value for GetWithState(ipsum). Expected Missing but got %v", state)
+	}
+
+	if _, _, ok := cache.GetOK([]byte("lorem")); ok || cache.Len() != 1 {
+		t.Errorf("negative entry should be stored but not found by GetOK(). Got %v entries", cache.Len())
+	}
+
+	// The negative entry expires like any other entry
+	clock.Advance(time.Minute)
+	if _, state, _ := cache.GetWithState([]byte("lorem")); state != Missing {
+		t.Errorf("wrong value for GetWithState(lorem) after expiration. Expected Missing but got %v", state)
+	}
+}
+
+func TestActiveCache_SetNotFound(t *testing.T) {
+	// Setup
+	backing := NewMemoryBacking()
+	backing.Store([]byte("lorem"), []byte("ipsum"), NoExpiration)
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Backing: backing})
+	cache.StopCleaner()
+	cache.SetNotFound([]byte("lorem"), time.Minute)
+	cache.SetNotFound([]byte("jane"), time.Millisecond)
+	cache.SetPermanent([]byte("empty"), []byte{})
+	clock.Advance(time.Millisecond * 5)
+
+	// Test
+	if val, ttl, err := cache.GetE([]byte("lorem")); err != ErrNegativeCached || val != nil || ttl != 0 {
+		t.Errorf("wrong value for GetE(lorem). Expected (nil, 0, %v) but got (%s, %v, %v)", ErrNegativeCached, val, ttl, err)
+	}
+
+	if val, ttl := cache.Get([]byte("lorem")); val != nil || ttl != 0 {
+		t.Errorf("wrong value for Get(lorem). Expected (nil, 0) but got (%s, %v)", val, ttl)
+	}
+
+	if _, _, ok := cache.GetOK([]byte("lorem")); ok || cache.Has([]byte("lorem")) {
+		t.Errorf("negative entry should not be reported found by GetOK() and Has()")
+	}
+
+	// An empty stored value is a hit, never a negative entry
+	if val, _, err := cache.GetE([]byte("empty")); err != nil || val == nil || len(val) != 0 {
+		t.Errorf("wrong value for GetE(empty). Expected (empty, nil) but got (%#v, %v)", val, err)
+	}
+
+	// Expired negative entries fall back to Backing
+	if val, _, err := cache.GetE([]byte("jane")); err != ErrKeyExpired || val != nil {
+		t.Errorf("wrong value for GetE(jane). Expected (nil, %v) but got (%s, %v)", ErrKeyExpired, val, err)
+	}
+
+	if cache.Len() != 3 || len(cache.Entries()) != 1 || len(cache.Keys()) != 1 || cache.Snapshot().Len() != 1 {
+		t.Errorf("negative entries should be stored but not exported. Got %v entries and %v exported", cache.Len(), len(cache.Entries()))
+	}
+
+	if cache.SetKeepTTL([]byte("lorem"), []byte("dolor")) {
+		t.Errorf("wrong value for SetKeepTTL() on a negative entry. Expected false but got true")
+	}
+
+	// Setting a value replaces the negative entry
+	cache.SetPermanent([]byte("lorem"), []byte("dolor"))
+	if val, _, err := cache.GetE([]byte("lorem")); err != nil || string(val) != "dolor" {
+		t.Errorf("wrong value for GetE(lorem) after Set(). Expected (dolor, nil) but got (%s, %v)", val, err)
+	}
+
+	cache.SetNotFound(nil, time.Minute)
+	if cache.Len() != 3 {
+		t.Errorf("SetNotFound(nil) should be dropped but got %v entries", cache.Len())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_SetPermanent(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+	sched := cachetest.NewManualScheduler()
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock:             clock,
+		Scheduler:         sched,
+		CleanerInterval:   MinCleanerInterval,
+		KeysAmountByCycle: MinKeysAmountByCycle,
+	})
+	defer cache.Close()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	cache.Set([]byte("john"), []byte("doe"), ExpireNow)
+
+	// Test
+	clock.Advance(MinCleanerInterval * time.Millisecond)
+	sched.Tick()
+
+	if val, ttl := cache.Get([]byte("lorem")); string(val) != "ipsum" || ttl != NoExpiration {
+		t.Errorf("wrong value for SetPermanent() entry. Expected (ipsum, 0) but got (%s, %v)", val, ttl)
+	}
+
+	if _, ok := cache.entries.Get([]byte("jane")); ok {
+		t.Error("expiring entry should have been removed by the cleaner")
+	}
+
+	if _, ok := cache.entries.Get([]byte("john")); ok {
+		t.Error("entry set with ExpireNow should not be stored")
+	}
+}
+
+func TestActiveCache_SetProtected(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, MaxEntries: 5})
+	cache.StopCleaner()
+	cache.SetProtected([]byte("hot0"), []byte("value"), time.Minute)
+	cache.SetProtected([]byte("hot1"), []byte("value"), NoExpiration)
+
+	// Test filling past capacity only evicts unprotected keys
+	for i := 0; i < 20; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration)
+	}
+
+	if !cache.Has([]byte("hot0")) || !cache.Has([]byte("hot1")) || cache.Len() != 5 {
+		t.Errorf("protected keys should survive eviction but got hot0 %v, hot1 %v with %v entries",
+			cache.Has([]byte("hot0")), cache.Has([]byte("hot1")), cache.Len())
+	}
+
+	if cache.Has([]byte("key0")) || !cache.Has([]byte("key19")) {
+		t.Errorf("least recently used unprotected keys should be evicted")
+	}
+
+	// Test protected keys still expire by TTL
+	clock.Advance(time.Minute)
+	if _, _, err := cache.GetE([]byte("hot0")); err != ErrKeyExpired {
+		t.Errorf("wrong value for GetE(hot0) after TTL. Expected %v but got %v", ErrKeyExpired, err)
+	}
+}
+
+func TestActiveCache_SetString(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+
+	// Test
+	cache.SetString("lorem", []byte("ipsum"), time.Minute)
+	if value, ttl := cache.Get([]byte("lorem")); string(value) != "ipsum" || ttl != time.Minute {
+		t.Errorf("wrong value for Get() after SetString(). Expected (ipsum, %v) but got (%s, %v)", time.Minute, value, ttl)
+	}
+
+	// string and []byte keys address the same entry
+	cache.Set([]byte("lorem"), []byte("dolor"), NoExpiration)
+	if value, _ := cache.GetString("lorem"); string(value) != "dolor" || cache.Len() != 1 {
+		t.Errorf("wrong value for GetString() after Set(). Expected dolor in 1 entry but got %s in %v", value, cache.Len())
+	}
+}
+
+func TestActiveCache_SetWithCost(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxCostBytes: 100})
+	cache.StopCleaner()
+	cache.SetWithCost([]byte("lorem"), []byte("ipsum"), NoExpiration, 40)
+	cache.SetWithCost([]byte("john"), []byte("doe"), NoExpiration, 40)
+	cache.Get([]byte("lorem"))
+
+	// Test the least recently used entry is evicted to fit the budget
+	if err := cache.SetWithCost([]byte("jane"), []byte("foster"), NoExpiration, 40); err != nil || cache.Cost() != 80 || cache.Has([]byte("john")) {
+		t.Errorf("wrong value for SetWithCost(jane). Expected nil evicting john but got %v, cost %v and john found=%v", err, cache.Cost(), cache.Has([]byte("john")))
+	}
+
+	if err := cache.SetWithCost([]byte("sit"), []byte("amet"), NoExpiration, 200); err != ErrCostTooHigh || cache.Len() != 2 {
+		t.Errorf("wrong value for SetWithCost() beyond MaxCostBytes. Expected %v evicting nothing but got %v and %v entries", ErrCostTooHigh, err, cache.Len())
+	}
+
+	// Overwrites free the cost of the replaced entry, writes without a cost are charged their size
+	cache.SetWithCost([]byte("lorem"), []byte("ipsum"), NoExpiration, 10)
+	if err := cache.SetE([]byte("e"), nil, NoExpiration); err != nil || cache.Cost() != 1+EntryOverheadBytes || cache.Len() != 1 {
+		t.Errorf("wrong value for SetE(e). Expected nil evicting every other entry but got %v, cost %v and %v entries", err, cache.Cost(), cache.Len())
+	}
+
+	// Test RejectWrites
+	cache.Reconfigure(&Config{MaxCostBytes: 100, FullBehavior: RejectWrites})
+	if err := cache.SetWithCost([]byte("lorem"), []byte("ipsum"), NoExpiration, 10); err != ErrCacheFull {
+		t.Errorf("wrong value for SetWithCost() with RejectWrites. Expected %v but got %v", ErrCacheFull, err)
+	}
+
+	if rejections := cache.Stats().CostRejections; rejections != 2 {
+		t.Errorf("wrong value for Stats().CostRejections. Expected 2 but got %v", rejections)
 	}
 
-	for i := 0; i < expiringEntries; i++ {
-		ttl := durations[i%len(durations)]
-		entries.Put([]byte(fmt.Sprintf("key exp %v", i)), &cacheEntry{
-			Value:     []byte(fmt.Sprintf("value %v", i)),
-			Ttl:       ttl,
-			ExpiresAt: time.Now().Add(ttl).UnixNano(),
-		})
+	// Test a clean cycle evicts entries beyond a lowered budget
+	cache.Reconfigure(&Config{MaxCostBytes: 50})
+	cache.CleanNow()
+	if cache.Len() != 0 || cache.Cost() != 0 {
+		t.Errorf("a clean cycle should evict entries beyond MaxCostBytes but got %v entries costing %v", cache.Len(), cache.Cost())
 	}
 
-	// Test
-	defaultClean(&hashmap.HashMap[*cacheEntry]{}, defaultConf) // Empty entries
+	assertInvariants(t, cache)
+}
 
-	defaultClean(&entries, defaultConf) // entries, no expired
-	entriesLen = len(entries.GetAll())
-	expectedEntries = expiringEntries + nonExpiringEntries
-	if entriesLen != expectedEntries {
-		t.Errorf("wrong entries amount. Expected %v but got %v", expectedEntries, entriesLen)
+func TestActiveCache_SetWithCost_rejectedWrite(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 1, MaxCostBytes: 200})
+	cache.StopCleaner()
+	cache.SetWithCost([]byte("lorem"), []byte("ipsum"), NoExpiration, 100)
+
+	// Test a write beyond MaxCostBytes evicts nothing, even with the cache full
+	if err := cache.SetWithCost([]byte("john"), []byte("doe"), NoExpiration, 300); err != ErrCostTooHigh {
+		t.Errorf("wrong value for SetWithCost() beyond MaxCostBytes. Expected %v but got %v", ErrCostTooHigh, err)
 	}
 
-	time.Sleep(durations[1])
-	defaultClean(&entries, conf) // entries, more than half expired. Should call recursive
-	entriesLen = len(entries.GetAll())
-	if entriesLen >= expectedEntries {
-		t.Errorf("wrong entries amount. Expected less than or equal %v but got %v", expectedEntries, entriesLen)
+	if !cache.Has([]byte("lorem")) || cache.Len() != 1 || cache.Cost() != 100 {
+		t.Errorf("rejected write should evict nothing but got lorem found=%v, %v entries costing %v",
+			cache.Has([]byte("lorem")), cache.Len(), cache.Cost())
 	}
 
-	time.Sleep(durations[2] - durations[1])
-	defaultClean(&entries, defaultConf)
-	time.Sleep(DefaultCleanerInterval * time.Millisecond)
-	defaultClean(&entries, conf) //only non-expiring entries
-	entriesLen = len(entries.GetAll())
-	expectedEntries = nonExpiringEntries
-	if entriesLen != expectedEntries {
-		t.Errorf("wrong entries amount. Expected %v but got %v", expectedEntries, entriesLen)
+	// Test RejectWrites refuses a write over budget before evicting
+	cache.Reconfigure(&Config{MaxEntries: 1, MaxCostBytes: 150, FullBehavior: RejectWrites})
+	if err := cache.SetWithCost([]byte("john"), []byte("doe"), NoExpiration, 100); err != ErrCacheFull {
+		t.Errorf("wrong value for SetWithCost(john) with RejectWrites. Expected %v but got %v", ErrCacheFull, err)
 	}
+
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "ipsum" {
+		t.Errorf("wrong value for Get(lorem) after a rejected write. Expected ipsum but got %s", value)
+	}
+
+	assertInvariants(t, cache)
 }
 
-func TestActiveCache_Get(t *testing.T) {
+func TestActiveCache_SetWithCost_keepTTL(t *testing.T) {
 	// Setup
-	const expiringEntries = 10
-	var entries hashmap.HashMap[*cacheEntry]
-	durations := [2]time.Duration{
-		NoExpiration,
-		time.Second,
+	cache := NewActiveCacheWithConfig(&Config{MaxCostBytes: 10000})
+	cache.StopCleaner()
+	cache.SetWithCost([]byte("lorem"), []byte("ipsum"), time.Minute, 5000)
+
+	// Test SetKeepTTL charges the entry for its new key and value
+	if !cache.SetKeepTTL([]byte("lorem"), []byte("dolor")) {
+		t.Errorf("wrong value for SetKeepTTL(lorem). Expected true but got false")
 	}
 
-	for i := 0; i < expiringEntries; i++ {
-		var expiresAt int64
-		ttl := durations[i%len(durations)]
-		if ttl > NoExpiration {
-			expiresAt = time.Now().Add(ttl).UnixNano()
-		}
-		entries.Put([]byte(fmt.Sprintf("%v", i)), &cacheEntry{
-			Value:     []byte(fmt.Sprintf("value %v", i)),
-			Ttl:       ttl,
-			ExpiresAt: expiresAt,
-		})
+	if cost := cache.Cost(); cost != 5+5+EntryOverheadBytes {
+		t.Errorf("wrong value for Cost() after SetKeepTTL(). Expected %v but got %v", 5+5+EntryOverheadBytes, cost)
 	}
 
-	cache := NewActiveCache()
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_SetWithCost_keepTTLBeyondBudget(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxCostBytes: 300, FullBehavior: RejectWrites})
 	cache.StopCleaner()
-	cache.entries = entries
-	cacheEntries := entries.GetAll()
-	sort.Slice(cacheEntries, func(i, j int) bool {
-		return string(cacheEntries[i].Key) < string(cacheEntries[j].Key)
-	})
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	large := bytes.Repeat([]byte("a"), 10000)
 
-	// Test
-	var outVal []byte
-	var outTTL time.Duration
-	outVal, outTTL = cache.Get(nil) //get with key nil
-	if outVal != nil || outTTL != 0 {
-		t.Errorf("wrong value for get(nil). Expected (nil, 0) but got (%s, %v)", outVal, outTTL)
+	// Test SetKeepTTL refuses a value costing more than the whole budget
+	if cache.SetKeepTTL([]byte("lorem"), large) {
+		t.Errorf("wrong value for SetKeepTTL(lorem) beyond MaxCostBytes. Expected false but got true")
 	}
 
-	outVal, outTTL = cache.Get([]byte("nonexistent key")) //nonexistent key
-	if outVal != nil || outTTL != 0 {
-		t.Errorf("wrong value for get(nonexistent key). Expected (nil, 0) but got (%s, %v)", outVal, outTTL)
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "ipsum" {
+		t.Errorf("wrong value for Get(lorem) after a rejected SetKeepTTL. Expected ipsum but got %s", value)
 	}
 
-	for _, e := range cacheEntries {
-		outVal, outTTL = cache.Get(e.Key)
-		if !bytes.Equal(e.Value.Value, outVal) || outTTL != e.Value.Ttl {
-			t.Errorf(
-				"wrong value for get(%s). Expected (%s, %s) but got (%s, %s)",
-				e.Key,
-				e.Value.Value,
-				e.Value.Ttl,
-				outVal,
-				outTTL,
-			)
-		}
+	// Test RejectWrites refuses a value growing the cost past the budget
+	if cache.SetKeepTTL([]byte("lorem"), large[:150]) {
+		t.Errorf("wrong value for SetKeepTTL(lorem) with RejectWrites. Expected false but got true")
 	}
 
-	time.Sleep(time.Second)
+	cost := int64(5+5+EntryOverheadBytes) + 4 + 3 + EntryOverheadBytes
+	if cache.Cost() != cost {
+		t.Errorf("wrong value for Cost() after rejected SetKeepTTL. Expected %v but got %v", cost, cache.Cost())
+	}
 
-	for i, e := range cacheEntries {
-		outVal, outTTL = cache.Get(e.Key)
-		if i%2 == 0 {
-			// No expiring keys
-			if !bytes.Equal(e.Value.Value, outVal) || outTTL != e.Value.Ttl {
-				t.Errorf(
-					"wrong value for get(%s). Expected (%s, %s) but got (%s, %s)",
-					e.Key,
-					e.Value.Value,
-					e.Value.Ttl,
-					outVal,
-					outTTL,
-				)
-			}
+	// Test growing the value evicts other entries but never the replaced one
+	cache.Reconfigure(&Config{MaxCostBytes: 300})
+	if !cache.SetKeepTTL([]byte("lorem"), large[:150]) {
+		t.Errorf("wrong value for SetKeepTTL(lorem) with EvictLRU. Expected true but got false")
+	}
 
-		} else {
-			// expired keys
-			if outVal != nil || outTTL != 0 {
-				t.Errorf(
-					"wrong value for get(%s). Expected (nil, 0) but got (%s, %s)",
-					e.Key,
-					outVal,
-					outTTL,
-				)
-			}
-		}
+	if cache.Has([]byte("john")) || !cache.Has([]byte("lorem")) || cache.Cost() > 300 {
+		t.Errorf("SetKeepTTL should evict john to fit under MaxCostBytes but got john found=%v, lorem found=%v, cost %v",
+			cache.Has([]byte("john")), cache.Has([]byte("lorem")), cache.Cost())
 	}
+
+	assertInvariants(t, cache)
 }
 
-func TestActiveCache_IsCleanerRunning(t *testing.T) {
+func TestActiveCache_SetWithOptions(t *testing.T) {
 	// Setup
-	cache := NewActiveCache()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, MaxEntries: 3})
 	cache.StopCleaner()
-	time.Sleep(time.Millisecond * 10)
+	for i := 0; i < 3; i++ {
+		key := []byte(fmt.Sprintf("pinned%v", i))
+		if err := cache.SetWithOptions(key, []byte("value"), time.Minute, WithPinned()); err != nil {
+			t.Errorf("wrong value for SetWithOptions(%s). Expected nil but got %v", key, err)
+		}
+	}
 
-	//Test
-	if cache.IsCleanerRunning() != cache.isCleanerRunning.Load() {
-		t.Error("wrong value on IsCleanerRunning(). Must return the same value as ActiveCache.isCleanerRunning")
+	// Test new keys are rejected while every entry is pinned
+	if err := cache.SetE([]byte("lorem"), []byte("ipsum"), NoExpiration); err != ErrCacheFull {
+		t.Errorf("wrong value for SetE() on cache full of pinned entries. Expected %v but got %v", ErrCacheFull, err)
 	}
 
-	cache.StartCleaner()
-	time.Sleep(time.Millisecond * 10)
-	if cache.IsCleanerRunning() != cache.isCleanerRunning.Load() {
-		t.Error("wrong value on IsCleanerRunning(). Must return the same value as ActiveCache.isCleanerRunning")
+	// Test overwrites keep the pin
+	if err := cache.SetE([]byte("pinned0"), []byte("updated"), time.Minute); err != nil {
+		t.Errorf("wrong value for SetE(pinned0). Expected nil but got %v", err)
 	}
-}
 
-func TestActiveCache_performClean(t *testing.T) {
-	// Setup
-	var cleanExecuted bool
-	cache := NewActiveCache()
-	cache.StopCleaner()
-	cache.cleanFunc = func(entries *hashmap.HashMap[*cacheEntry], conf *Config) {
-		cleanExecuted = true
+	if !cache.Unpin([]byte("pinned1")) {
+		t.Errorf("wrong value for Unpin(pinned1). Expected true but got false")
 	}
-	cache.StartCleaner()
-	time.Sleep(time.Millisecond * 200)
 
-	// Test
-	if !cleanExecuted {
-		t.Error("performClean() is not being called or is not calling ActiveCache.cleanFunc")
+	// Test only the unpinned entry is evicted
+	cache.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+	for key, expected := range map[string]bool{"pinned0": true, "pinned1": false, "pinned2": true, "lorem": true} {
+		if _, _, ok := cache.GetOK([]byte(key)); ok != expected {
+			t.Errorf("wrong value for GetOK(%s) after eviction. Expected %v but got %v", key, expected, ok)
+		}
+	}
+
+	// Test pinned entries still expire by TTL
+	clock.Advance(time.Minute)
+	if _, _, err := cache.GetE([]byte("pinned2")); err != ErrKeyExpired {
+		t.Errorf("wrong value for GetE(pinned2) after TTL. Expected %v but got %v", ErrKeyExpired, err)
+	}
+
+	if err := cache.SetE([]byte("john"), []byte("doe"), NoExpiration); err != nil {
+		t.Errorf("wrong value for SetE() once pinned entries expired. Expected nil but got %v", err)
 	}
 }
 
-func TestActiveCache_Set(t *testing.T) {
+func TestActiveCache_SetWithOptions_skipIfEqual(t *testing.T) {
 	// Setup
-	cache := NewActiveCache()
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	backing := NewMemoryBacking()
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks, Backing: backing})
 	cache.StopCleaner()
-	time.Sleep(time.Millisecond * 100)
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	before, _ := cache.GetEntry([]byte("lorem"))
+	backing.Delete([]byte("lorem"))
+	hooks.calls = nil
 
-	type testEntry struct {
-		key   []byte
+	// Test an identical write is skipped without refreshing the expiration
+	clock.Advance(30 * time.Second)
+	if err := cache.SetWithOptions([]byte("lorem"), []byte("ipsum"), time.Minute, WithSkipIfEqual()); err != nil {
+		t.Errorf("wrong value for SetWithOptions() of an identical value. Expected nil but got %v", err)
+	}
+
+	after, _ := cache.GetEntry([]byte("lorem"))
+	if !after.ExpiresAt.Equal(before.ExpiresAt) || after.Version != before.Version {
+		t.Errorf("skipped write should leave the entry untouched. Expected (%v, version %v) but got (%v, version %v)",
+			before.ExpiresAt, before.Version, after.ExpiresAt, after.Version)
+	}
+
+	if len(hooks.calls) != 0 || backing.Len() != 0 || cache.Stats().SkippedWrites != 1 {
+		t.Errorf("skipped write should call no hooks nor backing. Got hooks %v, %v stored, %v skipped",
+			hooks.calls, backing.Len(), cache.Stats().SkippedWrites)
+	}
+
+	// Test real changes are written
+	for _, write := range []struct {
 		value []byte
 		ttl   time.Duration
+		opts  []SetOption
+	}{
+		{[]byte("dolor"), time.Minute, nil},
+		{[]byte("dolor!"), time.Minute, nil},
+		{[]byte("dolor!"), time.Hour, nil},
+		{[]byte("dolor!"), time.Hour, []SetOption{WithPinned()}},
+	} {
+		hooks.calls = nil
+		opts := append(write.opts, WithSkipIfEqual())
+		if err := cache.SetWithOptions([]byte("lorem"), write.value, write.ttl, opts...); err != nil || len(hooks.calls) != 1 {
+			t.Errorf("wrong value for SetWithOptions(%s, %v) of a change. Expected a written entry but got (%v, hooks %v)", write.value, write.ttl, err, hooks.calls)
+		}
 	}
 
-	testsCase := []testEntry{
-		{key: []byte("lorem"), value: []byte("ipsum"), ttl: NoExpiration},
-		{key: []byte("lorem"), value: []byte("dolor"), ttl: 10},
-		{key: []byte("lorem"), value: []byte("ipsum"), ttl: 5},
-		{key: []byte("jane"), value: []byte("foster"), ttl: 1},
+	// Test expired entries are rewritten
+	clock.Advance(time.Hour)
+	hooks.calls = nil
+	cache.SetWithOptions([]byte("lorem"), []byte("dolor!"), time.Hour, WithSkipIfEqual())
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "dolor!" || len(hooks.calls) != 2 || cache.Stats().SkippedWrites != 1 {
+		t.Errorf("write over an expired entry should not be skipped but got (%s, hooks %v)", value, hooks.calls)
+	}
+}
+
+func TestActiveCache_Snapshot(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	for i := 0; i < 100; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i)), time.Minute)
 	}
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.Set([]byte("jane"), []byte("foster"), ExpireNow)
 
 	// Test
-	for _, tc := range testsCase {
-		cache.Set(tc.key, tc.value, tc.ttl)
-		e, ok := cache.entries.Get(tc.key)
+	snapshot := cache.Snapshot()
 
-		if !ok || !bytes.Equal(tc.value, e.Value) || tc.ttl != e.Ttl {
-			t.Errorf(
-				"wrong value when performing Set() for key %s. Expected (%s, %v) got (%s, %v)",
-				tc.key,
-				tc.value,
-				tc.ttl,
-				e.Value,
-				e.Ttl,
-			)
+	// Mutate the live cache heavily
+	clock.Advance(2 * time.Minute)
+	cache.CleanNow()
+	for i := 0; i < 100; i += 2 {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("changed"), NoExpiration)
+	}
+	cache.Set([]byte("jane"), []byte("foster"), NoExpiration)
+	cache.DeleteByPrefix([]byte("lorem"))
+	cache.Flush()
+
+	if snapshot.Len() != 101 {
+		t.Fatalf("wrong value for CacheSnapshot.Len() after mutations. Expected 101 but got %v", snapshot.Len())
+	}
+
+	for i := 0; i < 100; i++ {
+		value, ttl, ok := snapshot.Get([]byte(fmt.Sprintf("key%v", i)))
+		if !ok || string(value) != fmt.Sprintf("value%v", i) || ttl != time.Minute {
+			t.Errorf("wrong value for CacheSnapshot.Get(key%v). Expected (value%v, 1m, true) but got (%s, %v, %v)", i, i, value, ttl, ok)
 		}
 	}
 
-	cache.Set(nil, []byte("doe"), time.Second) // nil key
-	e, ok := cache.entries.Get(nil)
-	if ok || e != nil {
-		t.Errorf(
-			"wrong value when performing Set() for key nil. Expected to not found entry but got (%s, %v)",
-			e.Value,
-			e.Ttl,
-		)
+	if value, ttl, ok := snapshot.Get([]byte("lorem")); !ok || string(value) != "ipsum" || ttl != NoExpiration {
+		t.Errorf("wrong value for CacheSnapshot.Get(lorem). Expected (ipsum, 0, true) but got (%s, %v, %v)", value, ttl, ok)
 	}
 
-	cache.Set([]byte("jane"), []byte("thor"), -100) // negative TTL
-	e, ok = cache.entries.Get([]byte("jane"))
-	if ok || e != nil {
-		t.Errorf(
-			"wrong value when performing Set() for key %s with negative TTL. Expected to not found entry but got (%s, %v)",
-			[]byte("jane"),
-			e.Value,
-			e.Ttl,
-		)
+	if _, _, ok := snapshot.Get([]byte("jane")); ok {
+		t.Errorf("wrong value for CacheSnapshot.Get(jane). Expected false for a key set after the snapshot")
+	}
+
+	empty := NewActiveCache()
+	empty.StopCleaner()
+	if snapshot := empty.Snapshot(); snapshot.Len() != 0 {
+		t.Errorf("wrong value for Len() on empty Snapshot(). Expected 0 but got %v", snapshot.Len())
 	}
 }
 
 func TestActiveCache_StartCleaner(t *testing.T) {
 	// Setup
-	var cleanExecuted bool
-	conf := &Config{
-		CleanerInterval: MinCleanerInterval,
-	}
-	cache := NewActiveCacheWithConfig(conf)
+	var cleanExecuted atomic.Bool
+	sched := cachetest.NewManualScheduler()
+	cache := NewActiveCacheWithConfig(&Config{Scheduler: sched})
 	cache.StopCleaner()
-	cache.cleanFunc = func(entries *hashmap.HashMap[*cacheEntry], conf *Config) {
-		cleanExecuted = true
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.cleanFunc = func(c *ActiveCache) {
+		cleanExecuted.Store(true)
 	}
 
 	// Test
 	cache.StartCleaner()
-	time.Sleep(time.Second)
-	if !cache.IsCleanerRunning() || !cleanExecuted {
+	sched.Tick()
+	if !cache.IsCleanerRunning() || !cleanExecuted.Load() {
 		t.Error("StartCleaner() is not being called or is not calling ActiveCache.performClean()")
 	}
 
+	var cycles atomic.Int32
+	cache.lock("clean")
+	cache.cleanFunc = func(c *ActiveCache) {
+		cycles.Add(1)
+	}
+	cache.unlock()
+	for i := 0; i < 3; i++ {
+		sched.Tick()
+	}
+	if cycles.Load() != 3 {
+		t.Errorf("cleaner should run a cycle on every tick but ran %v times", cycles.Load())
+	}
+
 	cache.StopCleaner()
-	time.Sleep(time.Second)
 	if cache.isCleanerRunning.Load() {
 		t.Error("StartCleaner() should stop running when ActiveCache.stopChan is closed")
 	}
 }
 
+func TestActiveCache_State(t *testing.T) {
+	// Setup
+	var transitions []string
+	cache := NewActiveCacheWithConfig(&Config{
+		OnStateChange: func(from, to CacheState) {
+			transitions = append(transitions, fmt.Sprintf("%v->%v", from, to))
+		},
+	})
+
+	// Test
+	if cache.State() != Running {
+		t.Errorf("wrong value for State() after NewActiveCache(). Expected %v but got %v", Running, cache.State())
+	}
+
+	cache.StopCleaner()
+	cache.StopCleaner()
+	if cache.State() != CleanerStopped {
+		t.Errorf("wrong value for State() after StopCleaner(). Expected %v but got %v", CleanerStopped, cache.State())
+	}
+
+	cache.StartCleaner()
+	cache.Close()
+	cache.Close()
+	cache.StartCleaner()
+	if cache.State() != Closed {
+		t.Errorf("wrong value for State() after Close(). Expected %v but got %v", Closed, cache.State())
+	}
+
+	expected := []string{"CleanerStopped->Running", "Running->CleanerStopped", "CleanerStopped->Running", "Running->Closed"}
+	if !reflect.DeepEqual(transitions, expected) {
+		t.Errorf("wrong OnStateChange calls. Expected %v but got %v", expected, transitions)
+	}
+
+	if s := CacheState(7).String(); s != "CacheState(7)" {
+		t.Errorf("wrong value for CacheState.String(). Expected CacheState(7) but got %v", s)
+	}
+}
+
 func TestActiveCache_StopCleaner(t *testing.T) {
 	// Setup
 	cache := NewActiveCache()
@@ -293,6 +3799,27 @@ func TestActiveCache_StopCleaner(t *testing.T) {
 	}
 }
 
+func TestActiveCache_Unpin(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 1})
+	cache.StopCleaner()
+	cache.SetWithOptions([]byte("lorem"), []byte("ipsum"), NoExpiration, WithPinned())
+
+	// Test
+	if !cache.Unpin([]byte("lorem")) {
+		t.Errorf("wrong value for Unpin(lorem). Expected true but got false")
+	}
+
+	if cache.Unpin([]byte("nonexistent key")) {
+		t.Errorf("wrong value for Unpin(nonexistent key). Expected false but got true")
+	}
+
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	if _, _, ok := cache.GetOK([]byte("lorem")); ok {
+		t.Errorf("unpinned key lorem should have been evicted")
+	}
+}
+
 func TestActiveCache_validateAndAdjustConfig(t *testing.T) {
 	// Setup
 	conf := &Config{
@@ -300,12 +3827,106 @@ func TestActiveCache_validateAndAdjustConfig(t *testing.T) {
 		KeysAmountByCycle: 1,
 	}
 	cache := NewActiveCacheWithConfig(conf)
+	cache.StopCleaner()
 
-	if cache.config.CleanerInterval != DefaultCleanerInterval {
+	if cache.config.Load().CleanerInterval != DefaultCleanerInterval {
 		t.Error("validateAndAdjustConfig shold force DefaultCleanerInterval if CleanerInterval less than MinCleanerInterval")
 	}
 
-	if cache.config.KeysAmountByCycle != DefaultKeysAmountByCycle {
+	if cache.config.Load().KeysAmountByCycle != DefaultKeysAmountByCycle {
 		t.Error("validateAndAdjustConfig shold force DefaultKeysAmountByCycle if KeysAmountByCycle less than DefaultKeysAmountByCycle")
 	}
+
+	for maxTTL, expected := range map[time.Duration]time.Duration{-time.Second: 0, time.Millisecond: MinMaxTTL, time.Hour: time.Hour} {
+		conf := &Config{MaxTTL: maxTTL}
+		validateAndAdjustConfig(conf)
+		if conf.MaxTTL != expected {
+			t.Errorf("wrong value for MaxTTL adjusted from %v. Expected %v but got %v", maxTTL, expected, conf.MaxTTL)
+		}
+	}
+}
+
+func TestActiveCache_verifyChecksum(t *testing.T) {
+	// Setup
+	var corruptions []string
+	cache := NewActiveCacheWithConfig(&Config{
+		VerifyChecksums: true,
+		OnCorruption: func(key []byte, expected, actual uint32) {
+			corruptions = append(corruptions, fmt.Sprintf("%s %v %v", key, expected, actual))
+		},
+	})
+	cache.StopCleaner()
+
+	// Test a slice given to Set and modified afterwards
+	value := []byte("ipsum")
+	cache.Set([]byte("lorem"), value, NoExpiration)
+	value[0] = 'X'
+	if got, _, err := cache.GetE([]byte("lorem")); err != ErrKeyNotFound || got != nil {
+		t.Errorf("wrong value for GetE() of a modified value. Expected (nil, %v) but got (%s, %v)", ErrKeyNotFound, got, err)
+	}
+
+	expected := fmt.Sprintf("lorem %v %v", crc32.ChecksumIEEE([]byte("ipsum")), crc32.ChecksumIEEE([]byte("Xpsum")))
+	if len(corruptions) != 1 || corruptions[0] != expected || cache.Len() != 0 {
+		t.Errorf("wrong value for OnCorruption() calls. Expected [%s] with the entry removed but got %v with %v entries", expected, corruptions, cache.Len())
+	}
+
+	// Test a slice returned by Get and modified afterwards
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	got, _ := cache.GetString("john")
+	got[0] = 'X'
+	if _, _, ok := cache.GetOK([]byte("john")); ok {
+		t.Errorf("wrong value for GetOK() of a value modified after Get(). Expected not found but got found")
+	}
+
+	// Test the cleaner checks sampled entries
+	value = []byte("foster")
+	cache.Set([]byte("jane"), value, time.Minute)
+	value[0] = 'X'
+	cache.performClean()
+	if _, ok := cache.entries.Get([]byte("jane")); ok || len(corruptions) != 3 || cache.Stats().Corruptions != 3 {
+		t.Errorf("cleaner should remove modified entries but got %v corruptions, %v counted", corruptions, cache.Stats().Corruptions)
+	}
+
+	// Test the eviction policy is told of removed entries without OnCorruption
+	policy := &recordingPolicy{}
+	cache = NewActiveCacheWithConfig(&Config{VerifyChecksums: true, Eviction: policy})
+	cache.StopCleaner()
+	value = []byte("ipsum")
+	cache.Set([]byte("lorem"), value, NoExpiration)
+	value[0] = 'X'
+	cache.Get([]byte("lorem"))
+	if expected := []string{"set lorem", "delete lorem"}; !reflect.DeepEqual(expected, policy.calls) {
+		t.Errorf("wrong EvictionPolicy calls for a corrupted entry. Expected %q but got %q", expected, policy.calls)
+	}
+
+	// Test nothing is checked when disabled
+	cache = NewActiveCache()
+	cache.StopCleaner()
+	value = []byte("ipsum")
+	cache.Set([]byte("lorem"), value, NoExpiration)
+	value[0] = 'X'
+	if got, _ := cache.Get([]byte("lorem")); string(got) != "Xpsum" || cache.Stats().Corruptions != 0 {
+		t.Errorf("wrong value for Get() without VerifyChecksums. Expected the shared Xpsum but got %s", got)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_WaitEmpty(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{CleanerInterval: MinCleanerInterval})
+	defer cache.StopCleaner()
+	for i := 0; i < 10; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), 20*time.Millisecond)
+	}
+
+	// Test
+	if !cache.WaitEmpty(2 * time.Second) {
+		t.Errorf("wrong value for WaitEmpty() with short TTLs. Expected true but got false with %v entries", cache.Len())
+	}
+
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	if cache.WaitEmpty(100 * time.Millisecond) {
+		t.Errorf("wrong value for WaitEmpty() with a permanent entry. Expected false but got true")
+	}
 }
@@ -0,0 +1,36 @@
+package cachetest
+
+import (
+	"sync"
+	"time"
+)
+
+// A FakeClock is a manually advanced clock for deterministic expiry in tests
+type FakeClock struct {
+	// Mutex for read and write lock
+	mtx sync.RWMutex
+
+	// Current fake time
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock pointer instance starting at `start`
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Advance moves the clock forward by `d`
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() time.Time {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	return c.now
+}
@@ -0,0 +1,22 @@
+package cachetest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock_Advance(t *testing.T) {
+	// Setup
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	// Test
+	if !clock.Now().Equal(start) {
+		t.Errorf("wrong value for Now(). Expected %v but got %v", start, clock.Now())
+	}
+
+	clock.Advance(time.Minute)
+	if expected := start.Add(time.Minute); !clock.Now().Equal(expected) {
+		t.Errorf("wrong value for Now() after Advance(). Expected %v but got %v", expected, clock.Now())
+	}
+}
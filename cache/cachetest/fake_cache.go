@@ -0,0 +1,234 @@
+package cachetest
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
+)
+
+// OpKind identifies the cache method recorded in an Op
+type OpKind int
+
+const (
+	OpSet OpKind = iota
+	OpGet
+	OpGetOK
+	OpDelete
+	OpHas
+)
+
+// An Op represents a single recorded call to FakeCache
+type Op struct {
+	// Called method
+	Kind OpKind
+
+	// Key copy given to the call
+	Key []byte
+
+	// Value copy given to Set or returned on read hits
+	Value []byte
+
+	// TTL given to Set or returned on read hits
+	TTL time.Duration
+
+	// Reports whether a read or delete found the key
+	Hit bool
+}
+
+// fakeEntry represents a FakeCache stored entry
+type fakeEntry struct {
+	value     []byte
+	ttl       time.Duration
+	expiresAt time.Time
+}
+
+// A FakeCache is a deterministic in-memory Cache for tests.
+//
+// It records every call in an ordered op log and expires entries
+// only when its FakeClock is advanced
+type FakeCache struct {
+	// Clock used to decide expiration
+	Clock *FakeClock
+
+	// Stored entries
+	entries hashmap.HashMap[*fakeEntry]
+
+	// Read hits and misses
+	hits, misses int
+
+	// Mutex for read and write lock
+	mtx sync.Mutex
+
+	// Ordered log of recorded calls
+	ops []Op
+}
+
+// NewFakeCache returns a FakeCache pointer instance with a FakeClock
+//
+// starting at the current time
+func NewFakeCache() *FakeCache {
+	return &FakeCache{Clock: NewFakeClock(time.Now())}
+}
+
+// AssertHitCount fails the test if read hits are not equal to `expected`
+func (f *FakeCache) AssertHitCount(t testing.TB, expected int) {
+	t.Helper()
+	if hits := f.Hits(); hits != expected {
+		t.Errorf("wrong hit count. Expected %v but got %v", expected, hits)
+	}
+}
+
+// AssertMissCount fails the test if read misses are not equal to `expected`
+func (f *FakeCache) AssertMissCount(t testing.TB, expected int) {
+	t.Helper()
+	if misses := f.Misses(); misses != expected {
+		t.Errorf("wrong miss count. Expected %v but got %v", expected, misses)
+	}
+}
+
+// AssertSet fails the test if Set was never called with `key` and `value`
+func (f *FakeCache) AssertSet(t testing.TB, key, value []byte) {
+	t.Helper()
+	for _, op := range f.Ops() {
+		if op.Kind == OpSet && bytes.Equal(op.Key, key) && bytes.Equal(op.Value, value) {
+			return
+		}
+	}
+
+	t.Errorf("expected Set(%s, %s) to be called", key, value)
+}
+
+// Delete removes `key` and reports whether it existed and was not expired
+func (f *FakeCache) Delete(key []byte) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	_, ok := f.lookup(key)
+	if ok {
+		f.entries.Delete(key)
+	}
+
+	f.record(Op{Kind: OpDelete, Key: key, Hit: ok})
+	return ok
+}
+
+// Get returns the value and TTL stored using `key`.
+//
+// If the key is nil, not present or expired returns (nil, 0)
+func (f *FakeCache) Get(key []byte) ([]byte, time.Duration) {
+	value, ttl, _ := f.get(OpGet, key)
+	return value, ttl
+}
+
+// GetOK returns the value and TTL stored using `key` and whether it was found
+func (f *FakeCache) GetOK(key []byte) ([]byte, time.Duration, bool) {
+	return f.get(OpGetOK, key)
+}
+
+// Has reports whether `key` is stored and not expired.
+//
+// Has does not count as a hit or miss
+func (f *FakeCache) Has(key []byte) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	_, ok := f.lookup(key)
+	f.record(Op{Kind: OpHas, Key: key, Hit: ok})
+	return ok
+}
+
+// Hits returns the amount of Get and GetOK calls that found the key
+func (f *FakeCache) Hits() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.hits
+}
+
+// Misses returns the amount of Get and GetOK calls that did not find the key
+func (f *FakeCache) Misses() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.misses
+}
+
+// Ops returns a copy of the ordered op log
+func (f *FakeCache) Ops() []Op {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return append([]Op(nil), f.ops...)
+}
+
+// Set stores `value` with `key` and TTL following ActiveCache semantics:
+//
+// nil keys are ignored, NoExpiration (zero) never expires
+//
+// and a negative TTL removes the key
+func (f *FakeCache) Set(key, value []byte, ttl time.Duration) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.record(Op{Kind: OpSet, Key: key, Value: value, TTL: ttl})
+	if key == nil {
+		return
+	}
+
+	if ttl < 0 {
+		f.entries.Delete(key)
+		return
+	}
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = f.Clock.Now().Add(ttl)
+	}
+
+	f.entries.Put(bytes.Clone(key), &fakeEntry{
+		value:     value,
+		ttl:       ttl,
+		expiresAt: expiresAt,
+	})
+}
+
+// get looks up `key`, records the op and updates hit and miss counters
+func (f *FakeCache) get(kind OpKind, key []byte) ([]byte, time.Duration, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	e, ok := f.lookup(key)
+	if !ok {
+		f.misses++
+		f.record(Op{Kind: kind, Key: key})
+		return nil, 0, false
+	}
+
+	f.hits++
+	f.record(Op{Kind: kind, Key: key, Value: e.value, TTL: e.ttl, Hit: true})
+	return e.value, e.ttl, true
+}
+
+// lookup returns the live entry stored with `key`. Caller must hold the lock
+func (f *FakeCache) lookup(key []byte) (*fakeEntry, bool) {
+	if key == nil {
+		return nil, false
+	}
+
+	e, ok := f.entries.Get(key)
+	if !ok || (!e.expiresAt.IsZero() && !f.Clock.Now().Before(e.expiresAt)) {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// record appends `op` to the op log copying key and value. Caller must hold the lock
+func (f *FakeCache) record(op Op) {
+	op.Key = bytes.Clone(op.Key)
+	op.Value = bytes.Clone(op.Value)
+	f.ops = append(f.ops, op)
+}
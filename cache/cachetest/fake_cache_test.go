@@ -0,0 +1,109 @@
+package cachetest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache"
+)
+
+var _ cache.CacheV2 = (*FakeCache)(nil)
+
+func TestFakeCache_Delete(t *testing.T) {
+	// Setup
+	fake := NewFakeCache()
+	fake.Set([]byte("lorem"), []byte("ipsum"), cache.NoExpiration)
+
+	// Test
+	if !fake.Delete([]byte("lorem")) {
+		t.Error("Delete() should report an existing key")
+	}
+
+	if fake.Delete([]byte("lorem")) {
+		t.Error("Delete() should not report a removed key")
+	}
+
+	if fake.Has([]byte("lorem")) {
+		t.Error("key should not exist after Delete()")
+	}
+}
+
+func TestFakeCache_Expiry(t *testing.T) {
+	// Setup
+	fake := NewFakeCache()
+	fake.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+	fake.Set([]byte("john"), []byte("doe"), cache.NoExpiration)
+
+	// Test
+	fake.Clock.Advance(time.Second - 1)
+	if val, ttl := fake.Get([]byte("lorem")); string(val) != "ipsum" || ttl != time.Second {
+		t.Errorf("wrong value for Get(lorem) before expiry. Expected (ipsum, 1s) but got (%s, %v)", val, ttl)
+	}
+
+	fake.Clock.Advance(1)
+	if val, ttl := fake.Get([]byte("lorem")); val != nil || ttl != 0 {
+		t.Errorf("wrong value for Get(lorem) after expiry. Expected (nil, 0) but got (%s, %v)", val, ttl)
+	}
+
+	fake.Clock.Advance(time.Hour * 24 * 365)
+	if !fake.Has([]byte("john")) {
+		t.Error("non-expiring key should never expire")
+	}
+
+	fake.AssertHitCount(t, 1)
+	fake.AssertMissCount(t, 1)
+}
+
+func TestFakeCache_GetOK(t *testing.T) {
+	// Setup
+	fake := NewFakeCache()
+	fake.Set([]byte("empty"), []byte{}, cache.NoExpiration)
+
+	// Test
+	if val, _, ok := fake.GetOK([]byte("empty")); !ok || val == nil {
+		t.Errorf("wrong value for GetOK(empty). Expected ([], true) but got (%v, %v)", val, ok)
+	}
+
+	if _, _, ok := fake.GetOK([]byte("nonexistent key")); ok {
+		t.Error("GetOK() should not find nonexistent key")
+	}
+
+	if _, _, ok := fake.GetOK(nil); ok {
+		t.Error("GetOK() should not find nil key")
+	}
+
+	fake.AssertHitCount(t, 1)
+	fake.AssertMissCount(t, 2)
+}
+
+func TestFakeCache_Ops(t *testing.T) {
+	// Setup
+	fake := NewFakeCache()
+	key := []byte("lorem")
+	value := []byte("ipsum")
+
+	// Test
+	fake.Set(key, value, time.Minute)
+	fake.Get(key)
+	fake.Set(key, nil, -1)
+	fake.GetOK(key)
+	value[0] = 'X' // op log must hold copies
+
+	expected := []Op{
+		{Kind: OpSet, Key: []byte("lorem"), Value: []byte("ipsum"), TTL: time.Minute},
+		{Kind: OpGet, Key: []byte("lorem"), Value: []byte("ipsum"), TTL: time.Minute, Hit: true},
+		{Kind: OpSet, Key: []byte("lorem"), TTL: -1},
+		{Kind: OpGetOK, Key: []byte("lorem")},
+	}
+
+	if ops := fake.Ops(); !reflect.DeepEqual(expected, ops) {
+		t.Errorf("wrong op log. Expected %v but got %v", expected, ops)
+	}
+
+	fake.AssertSet(t, []byte("lorem"), []byte("ipsum"))
+	if !bytes.Equal(fake.Ops()[0].Value, []byte("ipsum")) {
+		t.Error("op log should not be affected by caller mutations")
+	}
+}
@@ -0,0 +1,101 @@
+package cachetest
+
+import (
+	"sync"
+	"time"
+)
+
+// A ManualScheduler is a cleaner schedule advanced by Tick, implementing
+//
+// cache.Scheduler so tests run clean cycles without waiting
+type ManualScheduler struct {
+	// Mutex guarding the fields below
+	mtx sync.Mutex
+
+	// Signaled whenever the cleaner waits for a tick
+	waiting *sync.Cond
+
+	// Channel the cleaner waits on, nil while it does not wait
+	next chan time.Time
+
+	// Channel the last Tick sent on, until its cycle completed
+	ticked chan time.Time
+
+	// Closed by the Next call following the cycle of the last Tick
+	cycled chan struct{}
+
+	// Interval given to the last Next call
+	interval time.Duration
+}
+
+// NewManualScheduler returns a ManualScheduler pointer instance,
+//
+// to set as Config.Scheduler
+func NewManualScheduler() *ManualScheduler {
+	s := &ManualScheduler{}
+	s.waiting = sync.NewCond(&s.mtx)
+	return s
+}
+
+// Interval returns the interval given to the last Next call, that is the
+//
+// one the cleaner would have waited for, backoff included
+func (s *ManualScheduler) Interval() time.Duration {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.interval
+}
+
+// Next returns a new channel for Tick to send on, ignoring `interval`, and
+//
+// reports the cycle of the last Tick as completed. A tick the cleaner did not
+// receive yet, e.g. when Next is called on Reconfigure, moves to the new channel
+func (s *ManualScheduler) Next(interval time.Duration) <-chan time.Time {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.interval = interval
+	next := make(chan time.Time, 1)
+	if s.ticked != nil {
+		select {
+		case tick := <-s.ticked:
+			next <- tick
+			s.ticked = next
+		default:
+			close(s.cycled)
+			s.ticked, s.cycled = nil, nil
+		}
+	}
+
+	if s.ticked == nil {
+		s.next = next
+		s.waiting.Broadcast()
+	}
+	return next
+}
+
+// Stop records that the cleaner no longer waits for a tick
+func (s *ManualScheduler) Stop() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.next = nil
+}
+
+// Tick runs one clean cycle and returns once it completed, that is once the
+//
+// cleaner waits for the next tick. It blocks while the cleaner is stopped
+func (s *ManualScheduler) Tick() {
+	s.mtx.Lock()
+	for s.next == nil {
+		s.waiting.Wait()
+	}
+
+	cycled := make(chan struct{})
+	s.next <- time.Now()
+	s.next, s.ticked, s.cycled = nil, s.next, cycled
+	s.mtx.Unlock()
+
+	<-cycled
+}
@@ -0,0 +1,70 @@
+package cachetest
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestManualScheduler_Tick(t *testing.T) {
+	// Setup: a consumer looping like the cache cleaner
+	sched := NewManualScheduler()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	cycles := 0
+	go func() {
+		defer close(done)
+		due := sched.Next(0)
+		for {
+			select {
+			case <-stop:
+				sched.Stop()
+				return
+			case <-due:
+				cycles++
+				due = sched.Next(time.Duration(cycles))
+			}
+		}
+	}()
+
+	// Test every Tick returns once its cycle completed
+	for i := 1; i <= 5; i++ {
+		sched.Tick()
+		if cycles != i {
+			t.Errorf("wrong value for cycles after Tick(). Expected %v but got %v", i, cycles)
+		}
+
+		if interval := sched.Interval(); interval != time.Duration(i) {
+			t.Errorf("wrong value for Interval() after Tick(). Expected %v but got %v", time.Duration(i), interval)
+		}
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestManualScheduler_Next_pendingTick(t *testing.T) {
+	// Setup
+	sched := NewManualScheduler()
+	due := sched.Next(0)
+	ticked := make(chan struct{})
+	go func() {
+		sched.Tick()
+		close(ticked)
+	}()
+
+	// Test a tick not received yet moves to the channel of the next Next call
+	for len(due) == 0 {
+		runtime.Gosched()
+	}
+	due = sched.Next(0)
+
+	select {
+	case <-ticked:
+		t.Fatal("Tick() should wait for its cycle when Next() is called before the tick is received")
+	case <-due:
+	}
+
+	sched.Next(0)
+	<-ticked
+}
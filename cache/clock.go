@@ -0,0 +1,24 @@
+package cache
+
+import "time"
+
+// A Clock tells the current time used for every expiration computation,
+//
+// see Config.Clock. cachetest.FakeClock implements it
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+}
+
+// systemClock is the Clock of caches created without Config.Clock
+type systemClock struct{}
+
+// Now returns time.Now()
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// now returns the current time of the clock the cache was created with
+func (c *ActiveCache) now() time.Time {
+	return c.clock.Now()
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// Pools of flate writers and readers, which are expensive to allocate
+var (
+	flateWriters = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed) // error only on invalid level
+		return w
+	}}
+
+	flateReaders = sync.Pool{New: func() interface{} {
+		return flate.NewReader(nil)
+	}}
+)
+
+// compress returns `value` compressed with flate at BestSpeed,
+//
+// the level keeping the cost paid under the write lock low
+func compress(value []byte) []byte {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+
+	w.Reset(&buf)
+	w.Write(value)
+	w.Close()
+	return buf.Bytes()
+}
+
+// decompress returns the value compressed by compress.
+//
+// It panics on invalid data, which can only come from a bug
+func decompress(data []byte) []byte {
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+
+	r.(flate.Resetter).Reset(bytes.NewReader(data), nil)
+	value, err := io.ReadAll(r)
+	if err != nil {
+		panic("cache: corrupted compressed value: " + err.Error())
+	}
+
+	return value
+}
+
+// encodeValue returns the bytes to store for `value` and whether they are
+//
+// compressed. Values are compressed when `Config.Compress` is set, they are
+// larger than `Config.CompressMinBytes` and compression makes them smaller
+func (c *ActiveCache) encodeValue(value []byte) ([]byte, bool) {
+	conf := c.config.Load()
+	if !conf.Compress || len(value) <= conf.CompressMinBytes {
+		return value, false
+	}
+
+	if data := compress(value); len(data) < len(value) {
+		return data, true
+	}
+
+	return value, false
+}
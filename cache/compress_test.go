@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActiveCache_compress(t *testing.T) {
+	// Setup
+	values := [][]byte{
+		nil,
+		[]byte("lorem"),
+		[]byte(strings.Repeat("lorem ipsum dolor sit amet ", 100)),
+	}
+
+	// Test
+	for _, value := range values {
+		if out := decompress(compress(value)); !bytes.Equal(out, value) {
+			t.Errorf("wrong value for decompress(compress()). Expected %q but got %q", value, out)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("decompress() should panic on invalid data")
+		}
+	}()
+	decompress([]byte("not flate data"))
+}
+
+func TestActiveCache_encodeValue(t *testing.T) {
+	// Setup
+	compressible := []byte(strings.Repeat("lorem ipsum dolor sit amet ", 100))
+	incompressible := make([]byte, 1024)
+	rand.Read(incompressible)
+	small := []byte("lorem ipsum")
+
+	cache := NewActiveCacheWithConfig(&Config{Compress: true})
+	cache.StopCleaner()
+	cache.Set([]byte("compressible"), compressible, time.Minute)
+	cache.Set([]byte("incompressible"), incompressible, time.Minute)
+	cache.SetPermanent([]byte("small"), small)
+
+	// Test round trips
+	tests := []struct {
+		key        string
+		value      []byte
+		compressed bool
+	}{
+		{key: "compressible", value: compressible, compressed: true},
+		{key: "incompressible", value: incompressible, compressed: false},
+		{key: "small", value: small, compressed: false},
+	}
+
+	var stored int64
+	for _, tt := range tests {
+		if value, _ := cache.Get([]byte(tt.key)); !bytes.Equal(value, tt.value) {
+			t.Errorf("wrong value for Get(%q) with compression. Expected %v bytes but got %v", tt.key, len(tt.value), len(value))
+		}
+
+		cache.mtx.Lock()
+		entry, _ := cache.entries.Get([]byte(tt.key))
+		cache.mtx.Unlock()
+		if entry.Compressed != tt.compressed {
+			t.Errorf("wrong compressed flag for %q. Expected %v but got %v", tt.key, tt.compressed, entry.Compressed)
+		}
+		stored += entry.Size([]byte(tt.key))
+	}
+
+	// Test size accounting reflects compressed sizes
+	if usage := cache.MemoryUsage(); usage != stored || usage >= int64(len(compressible)) {
+		t.Errorf("wrong value for MemoryUsage() with compression. Expected %v below %v but got %v", stored, len(compressible), usage)
+	}
+
+	// Test overwrites keep compressing and mixed entries survive disabling it
+	cache.SetKeepTTL([]byte("compressible"), compressible)
+	cache.Reconfigure(&Config{})
+	cache.SetPermanent([]byte("plain"), compressible)
+	for _, key := range []string{"compressible", "plain"} {
+		if value, _ := cache.Get([]byte(key)); !bytes.Equal(value, compressible) {
+			t.Errorf("wrong value for Get(%q) with mixed entries. Expected %v bytes but got %v", key, len(compressible), len(value))
+		}
+	}
+
+	if items := cache.Entries(); len(items) != 4 {
+		t.Errorf("wrong value for Entries() with mixed entries. Expected 4 items but got %v", len(items))
+	}
+}
@@ -1,5 +1,29 @@
 package cache
 
+import "time"
+
+// A FullBehavior defines what happens to writes of new keys
+//
+// once the cache holds `Config.MaxEntries` entries
+type FullBehavior int
+
+const (
+	// Evict removes an entry to make room, the one Config.Eviction
+	//
+	// chooses, or the least recently used one when it is nil
+	Evict FullBehavior = iota
+
+	// EvictLRU removes the least recently used entry to make room,
+	//
+	// ignoring Config.Eviction
+	EvictLRU
+
+	// RejectWrites drops the write, SetE returns ErrCacheFull.
+	//
+	// Overwrites of existing keys are always allowed
+	RejectWrites
+)
+
 // A Config represents an ActiveCache parameters configuration
 type Config struct {
 	// CleanerInterval is the interval in ms that cleaner will run
@@ -11,6 +35,333 @@ type Config struct {
 	//
 	// If value is less than `MinKeysAmountByCycle` then `DefaultKeysAmountByCycle` will be set
 	KeysAmountByCycle int
+
+	// SequentialScan makes the cleaner inspect entries in storage order,
+	//
+	// resuming where the previous cycle stopped, instead of sampling at random.
+	// Every entry is then inspected within Len/KeysAmountByCycle cycles, unless
+	// MaxCleanDuration or MaxCleanPerSecond cut cycles short
+	SequentialScan bool
+
+	// Scheduler decides when the cleaner runs its cycles, e.g. to clean more
+	//
+	// at night or to drive cycles from tests, given the interval computed from
+	// CleanerInterval and the backoff settings, see Scheduler. Reconfigure
+	// switches to a new one at once, so it must be comparable, e.g. a pointer.
+	// Nil waits for the interval
+	Scheduler Scheduler
+
+	// Clock tells the time entries expire by, e.g. a cachetest.FakeClock
+	//
+	// to control expiration from tests. It is read once by
+	// NewActiveCacheWithConfig, Reconfigure keeps the clock the cache was
+	// created with. Nil uses time.Now
+	Clock Clock
+
+	// CleanHighWater runs a clean cycle promptly, instead of at the next
+	//
+	// interval, once a write leaves more than CleanHighWater entries (see Len),
+	// bounding peak memory more tightly. Writes signal the cleaner without
+	// blocking and triggered cycles run at most every `MinCleanerInterval` ms.
+	// Ignored while the cleaner is stopped or paused.
+	//
+	// Zero or negative disables the trigger
+	CleanHighWater int
+
+	// CleanerBackoffMax is the maximum interval in ms the cleaner backs off to
+	//
+	// while cycles remove nothing. Backoff is disabled if value is less than
+	// or equal to CleanerInterval
+	CleanerBackoffMax int
+
+	// CleanerBackoffCycles is the amount of consecutive cycles removing nothing
+	//
+	// before the interval grows. If value is less than 1 then `DefaultCleanerBackoffCycles` will be set
+	CleanerBackoffCycles int
+
+	// CleanerBackoffFactor multiplies the interval on each backoff step
+	//
+	// If value is less than or equal to 1 then `DefaultCleanerBackoffFactor` will be set
+	CleanerBackoffFactor float64
+
+	// MaxCleanDuration is the time budget of a clean cycle, including
+	//
+	// recursive re-cleans. Once exceeded the cycle returns and the remaining
+	// work is deferred to the next cycle.
+	//
+	// If value is zero then `DefaultMaxCleanDuration` will be set. Negative means unlimited
+	MaxCleanDuration time.Duration
+
+	// MaxCleanPerSecond is the maximum amount of keys the cleaner inspects
+	//
+	// within the same second. Once reached, sampling stops and the remaining
+	//
+	// work is deferred to the next cycle, including recursive re-cleans.
+	//
+	// It caps KeysAmountByCycle: a cycle inspects min(KeysAmountByCycle, budget left).
+	//
+	// Zero or negative means unlimited
+	MaxCleanPerSecond int
+
+	// LockWaitObserver is called after an operation acquires the write lock
+	//
+	// or the stripe of its key with the operation name and the time spent
+	// waiting: "get" for Get and the single key reads, "set" for Set and every
+	// other write, "clean" for the cleaner, "check" for CheckInvariants and
+	// "close" for Close. Operations taking the read lock, or a context, are not timed.
+	//
+	// It runs while the lock is held and must not call the cache.
+	//
+	// When nil no timing is performed
+	LockWaitObserver func(op string, wait time.Duration)
+
+	// LockStripes splits the entries into this many stripes, each one guarded
+	//
+	// by its own lock chosen by key hash, e.g. 256. Get, Set and single key
+	// reads such as Has of keys of different stripes then run in parallel,
+	// while every other operation and the cleaner acquire all stripes in
+	// order. Set falls back to acquiring all stripes while MaxCostBytes is
+	// set or fewer than LockStripes entries are left before MaxEntries,
+	// since making room evicts keys of other stripes. Hooks are still
+	// called one at a time in the order operations happened.
+	//
+	// It is read once by NewActiveCacheWithConfig, Reconfigure keeps the
+	// stripes the cache was created with. Zero or 1 uses a single lock
+	LockStripes int
+
+	// OnCleanPanic is called with the panic recovered from a clean cycle,
+	//
+	// including Hooks dispatched by the cleaner. The cleaner keeps running.
+	//
+	// When nil the panic is written to the standard logger
+	OnCleanPanic func(err *CleanPanicError)
+
+	// MaxKeyBytes is the maximum key length accepted by writes
+	//
+	// Set silently drops larger keys and SetE returns ErrKeyTooLarge.
+	//
+	// Zero or negative means unlimited
+	MaxKeyBytes int
+
+	// MaxValueBytes is the maximum value length accepted by writes
+	//
+	// Set silently drops larger values and SetE returns ErrValueTooLarge.
+	//
+	// Zero or negative means unlimited
+	MaxValueBytes int
+
+	// MaxEntries is the maximum amount of stored entries, expired or not.
+	//
+	// Writes of new keys beyond it follow FullBehavior.
+	//
+	// Zero or negative means unlimited
+	MaxEntries int
+
+	// FullBehavior defines how writes of new keys are handled
+	//
+	// once MaxEntries is reached, see FullBehavior
+	FullBehavior FullBehavior
+
+	// MaxCostBytes is the approximate memory budget of the stored entries,
+	//
+	// charging each one its cost given to SetWithCost, or len(key) +
+	// len(value) + EntryOverheadBytes like MemoryUsage. Writes beyond it
+	// evict entries like MaxEntries does, following FullBehavior and
+	// Eviction, and are rejected with ErrCacheFull if nothing can be evicted
+	// or ErrCostTooHigh if the entry alone exceeds it, see
+	// Stats.CostRejections. Clean cycles evict until the budget holds again,
+	// e.g. after Reconfigure lowered it.
+	//
+	// Zero or negative means unlimited
+	MaxCostBytes int64
+
+	// Eviction chooses the entries FullBehavior Evict removes, e.g.
+	//
+	// an LFUPolicy, among EvictionSampleSize random candidates of at most
+	// EvictionSampleWindow consecutive entries per eviction. Clean cycles also
+	// evict with it while more than MaxEntries entries are stored, e.g. after
+	// Reconfigure lowered MaxEntries.
+	//
+	// Nil or an LRUPolicy evicts the exact least recently used entry from the
+	// recency lists, without sampling
+	Eviction EvictionPolicy
+
+	// Compress stores values larger than CompressMinBytes compressed
+	//
+	// with flate, trading CPU on every write and read for memory.
+	// Values that do not shrink are stored uncompressed
+	Compress bool
+
+	// CompressMinBytes is the value length above which values are compressed
+	//
+	// If value is less than or equal to zero then `DefaultCompressMinBytes` will be set
+	CompressMinBytes int
+
+	// DetectCollisions compares key bytes on writes and refuses to overwrite
+	//
+	// a different key with the same hash, recording the collision instead.
+	// Set silently drops the write and SetE returns ErrHashCollision.
+	//
+	// It is a debugging aid costing an extra lookup and comparison per write
+	DetectCollisions bool
+
+	// EvictVolatileRandom evicts randomly chosen entries with TTL
+	//
+	// once MaxEntries is reached, never touching entries without expiration.
+	// FullBehavior applies when no entry with TTL is left
+	EvictVolatileRandom bool
+
+	// TTLJitter spreads the expiration of entries written with the same TTL,
+	//
+	// avoiding mass expiry and reload stampedes after bulk loads. Each write
+	// with a positive TTL expires up to TTLJitter later, picked at random, so
+	// entries always live at least their TTL. The TTL reported by Get is
+	// the one written, permanent entries are not affected.
+	//
+	// Zero disables jitter
+	TTLJitter time.Duration
+
+	// TTLJitterBothWays picks the jitter within [-TTLJitter, +TTLJitter]
+	//
+	// instead, keeping the average lifetime at the TTL written. Entries may
+	// then expire up to TTLJitter early, at most halving their TTL
+	TTLJitterBothWays bool
+
+	// MaxTTL caps the lifetime of every entry when set, e.g. for compliance.
+	//
+	// Writes with a longer TTL or NoExpiration are stored with MaxTTL
+	// instead, reported by Get and Hooks, and jitter never extends past it.
+	// `Backing` still receives the TTL written.
+	//
+	// If value is between zero and `MinMaxTTL` then `MinMaxTTL` will be set,
+	// values above `MaxSupportedTTL` are capped to it, zero disables the cap
+	MaxTTL time.Duration
+
+	// Hooks is an optional tap on every cache operation, see Hooks.
+	//
+	// When nil no events are recorded
+	Hooks Hooks
+
+	// AuditLogSize is the amount of recent sets, deletes, expirations and
+	//
+	// evictions kept with their time for debugging, see ActiveCache.AuditLog.
+	// Events are recorded under the lock the operation already holds, the
+	// oldest being overwritten once the log is full.
+	//
+	// Zero or negative disables the audit log
+	AuditLogSize int
+
+	// OnReplace is called when a write overwrites a live entry with the
+	//
+	// key, the replaced value and the new value, e.g. to release resources
+	// tied to the old value. It is not called on first inserts, nor when the
+	// replaced entry was expired or cached by SetNotFound.
+	//
+	// Like Hooks it runs after the cache lock is released, so it may call the
+	// cache. Values must not be modified
+	OnReplace func(key, oldValue, newValue []byte)
+
+	// VerifyChecksums stores a CRC-32 of every written value and checks it on
+	//
+	// reads and on entries sampled by the cleaner, to catch callers modifying
+	// slices given to Set or returned by Get, which the cache shares. A
+	// mismatching entry is removed, counted in Stats.Corruptions and reported
+	// to OnCorruption, reads then miss it.
+	//
+	// Meant for debugging: writes hash their value and reads hash it again.
+	// Entries written while it is unset are never checked
+	VerifyChecksums bool
+
+	// OnCorruption is called with the key, stored checksum and checksum of the
+	//
+	// modified value of every entry removed by VerifyChecksums. Like Hooks it
+	// runs after the cache lock is released
+	OnCorruption func(key []byte, expected, actual uint32)
+
+	// ExpiryWarning sends the key of every entry whose remaining TTL drops
+	//
+	// below it on ExpiringSoon, e.g. to refresh entries before they expire.
+	// Warnings are found by the default clean function among sampled entries,
+	// so like expiry they are delivered at the pace of the cleaner. Each entry
+	// is warned at most once, writes storing a new entry warn again.
+	//
+	// Zero disables warnings
+	ExpiryWarning time.Duration
+
+	// TombstoneTTL keeps deleted keys as tombstones for that long when set,
+	//
+	// so replication consumers can tell a deleted key apart from one never
+	// stored. Deleting a live entry, by a delete method or a Set with negative
+	// TTL, replaces it with an empty tombstone that GetE reports with
+	// ErrKeyDeleted and Len does not count. Hooks see the delete once, the
+	// cleaner purges the tombstone after TombstoneTTL without reporting it.
+	// Tombstones still take room towards MaxEntries and may be evicted.
+	//
+	// Zero removes deleted keys at once
+	TombstoneTTL time.Duration
+
+	// Backing is an optional slower store the cache sits in front of.
+	//
+	// Get misses are loaded from it and populate the cache, writes and
+	// deletes go through to it. Expiration, eviction and Flush only
+	// affect the cache
+	Backing Backing
+
+	// WriteBehind queues writes to Backing instead of waiting for them,
+	//
+	// applied in order by a single worker. Close flushes the queue
+	WriteBehind bool
+
+	// WriteBehindQueueSize is the amount of writes queued before writers block
+	//
+	// If value is less than or equal to zero then `DefaultWriteBehindQueueSize` will be set
+	WriteBehindQueueSize int
+
+	// AsyncQueueSize is the amount of SetAsync writes queued before
+	//
+	// AsyncDropWhenFull applies. It is read once, on the first SetAsync.
+	//
+	// If value is less than or equal to zero then `DefaultAsyncQueueSize` will be set
+	AsyncQueueSize int
+
+	// AsyncBatchSize is the maximum amount of SetAsync writes applied
+	//
+	// under a single lock acquisition.
+	//
+	// If value is less than or equal to zero then `DefaultAsyncBatchSize` will be set
+	AsyncBatchSize int
+
+	// AsyncFlushInterval is the longest time a SetAsync write waits for
+	//
+	// its batch to fill before being applied, bounding the visibility lag.
+	//
+	// If value is less than or equal to zero then `DefaultAsyncFlushInterval` will be set
+	AsyncFlushInterval time.Duration
+
+	// AsyncDropWhenFull drops SetAsync writes while the queue is full,
+	//
+	// counting them in Stats.AsyncDropped. Otherwise SetAsync blocks until
+	// the worker makes room
+	AsyncDropWhenFull bool
+
+	// AsyncWrites makes Set, SetPermanent and SetString queue their writes
+	//
+	// like SetAsync instead of waiting for the cache lock. Reads no longer see
+	// the caller's own writes at once, see FlushWrites, and a queued write may be
+	// applied after a later synchronous write of the same key, e.g. by SetE
+	AsyncWrites bool
+
+	// OnBackingError is called with every error returned by Backing,
+	//
+	// including writes queued by WriteBehind. Keys whose write failed
+	// are removed from the cache
+	OnBackingError func(key []byte, err error)
+
+	// OnStateChange is called after every lifecycle transition of the cache,
+	//
+	// see CacheState. It runs on the goroutine calling StartCleaner,
+	// StopCleaner or Close without holding any cache lock
+	OnStateChange func(from, to CacheState)
 }
 
 // DefaultConfig returns a Config pointer instance
@@ -18,7 +369,15 @@ type Config struct {
 // with default values for parameters
 func DefaultConfig() *Config {
 	return &Config{
-		CleanerInterval:   DefaultCleanerInterval,
-		KeysAmountByCycle: DefaultKeysAmountByCycle,
+		CleanerInterval:      DefaultCleanerInterval,
+		KeysAmountByCycle:    DefaultKeysAmountByCycle,
+		CleanerBackoffCycles: DefaultCleanerBackoffCycles,
+		CleanerBackoffFactor: DefaultCleanerBackoffFactor,
+		MaxCleanDuration:     DefaultMaxCleanDuration,
+		CompressMinBytes:     DefaultCompressMinBytes,
+		WriteBehindQueueSize: DefaultWriteBehindQueueSize,
+		AsyncQueueSize:       DefaultAsyncQueueSize,
+		AsyncBatchSize:       DefaultAsyncBatchSize,
+		AsyncFlushInterval:   DefaultAsyncFlushInterval,
 	}
 }
@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"cmp"
+	"hash/maphash"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultShardReplicas is the amount of points each shard of a
+//
+// ConsistentHashCache owns on the ring when none is given
+const DefaultShardReplicas = 100
+
+// A ConsistentHashCache routes each key to one of several ActiveCache shards
+//
+// by consistent hashing, for scaling across independent caches. Each shard
+// owns several points of a hash ring and a key is stored on the shard owning
+// the first point following the hash of the key, so adding or removing a shard
+// only reroutes the keys of the points it gains or loses, about 1/N of them.
+//
+// Entries are not moved between shards: rerouted keys miss until written again,
+// see RemoveShard. Keys and shard names are hashed with hash/maphash using a
+// seed drawn by NewConsistentHashCache, so routing is deterministic for the
+// lifetime of the instance only
+type ConsistentHashCache struct {
+	// Mutex guarding the ring and the shards
+	mtx sync.RWMutex
+
+	// Points owned by each shard
+	replicas int
+
+	// Points of the ring sorted by hash
+	ring []ringPoint
+
+	// Seed hashing keys and shard names
+	seed maphash.Seed
+
+	// Shards by name
+	shards map[string]*ActiveCache
+}
+
+// A ringPoint represents a point of the ring owned by a shard
+type ringPoint struct {
+	hash  uint64
+	shard string
+}
+
+var _ CacheV2 = (*ConsistentHashCache)(nil)
+
+var _ Admin = (*ConsistentHashCache)(nil)
+
+// NewConsistentHashCache returns a ConsistentHashCache pointer instance without shards,
+//
+// each shard owning `replicas` points of the ring. More points spread keys
+// more evenly at the cost of memory, DefaultShardReplicas is used if
+// `replicas` is less than or equal to zero
+func NewConsistentHashCache(replicas int) *ConsistentHashCache {
+	if replicas <= 0 {
+		replicas = DefaultShardReplicas
+	}
+
+	return &ConsistentHashCache{
+		replicas: replicas,
+		seed:     maphash.MakeSeed(),
+		shards:   make(map[string]*ActiveCache),
+	}
+}
+
+// AddShard adds `shard` to the ring under `name`, rerouting to it the keys
+//
+// of the points it takes over. Entries stored for them on other shards are
+// left there until they expire or are evicted.
+//
+// Returns ErrShardExists if a shard is already added under `name`
+func (h *ConsistentHashCache) AddShard(name string, shard *ActiveCache) error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if _, ok := h.shards[name]; ok {
+		return ErrShardExists
+	}
+
+	h.shards[name] = shard
+	for i := 0; i < h.replicas; i++ {
+		h.ring = append(h.ring, ringPoint{hash: maphash.String(h.seed, name+"#"+strconv.Itoa(i)), shard: name})
+	}
+
+	// Points hashing alike are ordered by shard name, so routing does not
+	// depend on the order shards were added in
+	slices.SortFunc(h.ring, func(a, b ringPoint) int {
+		if a.hash != b.hash {
+			return cmp.Compare(a.hash, b.hash)
+		}
+		return cmp.Compare(a.shard, b.shard)
+	})
+	return nil
+}
+
+// admin returns the shards added when called as an adminGroup
+func (h *ConsistentHashCache) admin() adminGroup {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	group := make(adminGroup, 0, len(h.shards))
+	for _, shard := range h.shards {
+		group = append(group, shard)
+	}
+
+	return group
+}
+
+// CleanNow runs a clean cycle of every shard, implementing Admin
+func (h *ConsistentHashCache) CleanNow() {
+	h.admin().CleanNow()
+}
+
+// Close closes every shard, implementing Admin. Shards stay on the ring.
+//
+// Returns the errors of the shards joined
+func (h *ConsistentHashCache) Close() error {
+	return h.admin().Close()
+}
+
+// Delete removes `key` from the shard it is routed to
+//
+// and reports whether it was stored there
+func (h *ConsistentHashCache) Delete(key []byte) bool {
+	_, shard := h.ShardFor(key)
+	if key == nil || shard == nil {
+		return false
+	}
+
+	return shard.Delete(key)
+}
+
+// Flush removes every entry of every shard, implementing Admin
+func (h *ConsistentHashCache) Flush() {
+	h.admin().Flush()
+}
+
+// Get returns Value and TTL from the shard `key` is routed to.
+//
+// If key is nil, does not exist OR no shard was added returns (nil, 0)
+func (h *ConsistentHashCache) Get(key []byte) ([]byte, time.Duration) {
+	value, ttl, _ := h.GetOK(key)
+	return value, ttl
+}
+
+// GetOK returns Value and TTL from the shard `key` is routed to
+//
+// and whether it was found
+func (h *ConsistentHashCache) GetOK(key []byte) ([]byte, time.Duration, bool) {
+	_, shard := h.ShardFor(key)
+	if key == nil || shard == nil {
+		return nil, 0, false
+	}
+
+	return shard.GetOK(key)
+}
+
+// Len returns the sum of the amount of entries stored by every shard,
+//
+// implementing Admin. Entries left on a shard by rerouting are counted
+func (h *ConsistentHashCache) Len() int {
+	return h.admin().Len()
+}
+
+// RemoveShard removes the shard added under `name` from the ring and returns it,
+//
+// rerouting its keys to the shards owning the following points. Its entries
+// are not moved: to keep them, write the Entries of the returned shard back
+// with Set. The shard is not closed.
+//
+// Returns false if no shard is added under `name`
+func (h *ConsistentHashCache) RemoveShard(name string) (*ActiveCache, bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	shard, ok := h.shards[name]
+	if !ok {
+		return nil, false
+	}
+
+	delete(h.shards, name)
+	h.ring = slices.DeleteFunc(h.ring, func(p ringPoint) bool { return p.shard == name })
+	return shard, true
+}
+
+// Set sets Value for specified Key with TTL on the shard `key` is routed to.
+//
+// Writes are dropped while no shard is added
+func (h *ConsistentHashCache) Set(key, value []byte, ttl time.Duration) {
+	_, shard := h.ShardFor(key)
+	if key == nil || shard == nil {
+		return
+	}
+
+	shard.Set(key, value, ttl)
+}
+
+// Stats returns the sum of the metrics of every shard, implementing Admin
+func (h *ConsistentHashCache) Stats() Stats {
+	return h.admin().Stats()
+}
+
+// ShardFor returns the name and the shard `key` is routed to,
+//
+// ("", nil) if no shard is added
+func (h *ConsistentHashCache) ShardFor(key []byte) (string, *ActiveCache) {
+	hash := maphash.Bytes(h.seed, key)
+
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if len(h.ring) == 0 {
+		return "", nil
+	}
+
+	// The first point at or after the hash, wrapping around to the first one
+	i, _ := slices.BinarySearchFunc(h.ring, hash, func(p ringPoint, hash uint64) int {
+		return cmp.Compare(p.hash, hash)
+	})
+	if i == len(h.ring) {
+		i = 0
+	}
+
+	name := h.ring[i].shard
+	return name, h.shards[name]
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// routes returns the shard name of every key of `keys` on `h`
+func routes(h *ConsistentHashCache, keys [][]byte) []string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i], _ = h.ShardFor(key)
+	}
+
+	return names
+}
+
+func TestConsistentHashCache(t *testing.T) {
+	// Setup
+	h := NewConsistentHashCache(0)
+	for _, name := range []string{"a", "b", "c"} {
+		shard := NewActiveCache()
+		defer shard.Close()
+		if err := h.AddShard(name, shard); err != nil {
+			t.Fatalf("wrong value for AddShard(%s). Expected nil but got %v", name, err)
+		}
+	}
+
+	// Test
+	h.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	value, ttl, ok := h.GetOK([]byte("lorem"))
+	if !ok || string(value) != "ipsum" || ttl != time.Minute {
+		t.Errorf("wrong value for GetOK(lorem). Expected (ipsum, 1m, true) but got (%s, %v, %v)", value, ttl, ok)
+	}
+
+	name, shard := h.ShardFor([]byte("lorem"))
+	if value, _ := shard.Get([]byte("lorem")); string(value) != "ipsum" {
+		t.Errorf("lorem should be stored on its shard %s but got %s", name, value)
+	}
+
+	if !h.Delete([]byte("lorem")) || shard.Len() != 0 {
+		t.Errorf("Delete(lorem) should remove the key from its shard %s but got %v entries", name, shard.Len())
+	}
+
+	if h.Delete([]byte("lorem")) || h.Delete(nil) {
+		t.Errorf("wrong value for Delete() of a missing key. Expected false but got true")
+	}
+
+	duplicate := NewActiveCache()
+	duplicate.StopCleaner()
+	if err := h.AddShard("a", duplicate); err != ErrShardExists {
+		t.Errorf("wrong value for AddShard(a) twice. Expected %v but got %v", ErrShardExists, err)
+	}
+
+	if _, ok := h.RemoveShard("nonexistent shard"); ok {
+		t.Errorf("wrong value for RemoveShard(nonexistent shard). Expected false but got true")
+	}
+
+	// Test without shards
+	empty := NewConsistentHashCache(0)
+	empty.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+	if name, shard := empty.ShardFor([]byte("lorem")); name != "" || shard != nil {
+		t.Errorf("wrong value for ShardFor() without shards. Expected (\"\", nil) but got (%s, %v)", name, shard)
+	}
+}
+
+func TestConsistentHashCache_Admin(t *testing.T) {
+	// Setup
+	h := NewConsistentHashCache(0)
+	shards := []*ActiveCache{NewActiveCache(), NewActiveCache()}
+	for i, shard := range shards {
+		shard.StopCleaner()
+		if err := h.AddShard(fmt.Sprint(i), shard); err != nil {
+			t.Fatalf("wrong value for AddShard(%v). Expected nil but got %v", i, err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		h.Set([]byte(fmt.Sprint(i)), []byte("ipsum"), time.Minute)
+	}
+
+	// Test
+	admin, ok := AsAdmin(AsBatchCache(h))
+	if !ok || admin != Admin(h) {
+		t.Fatalf("wrong value for AsAdmin() through the adapter. Expected %p but got %v", h, admin)
+	}
+
+	if admin.Len() != 10 || shards[0].Len()+shards[1].Len() != 10 {
+		t.Errorf("wrong value for Admin.Len(). Expected 10 but got %v", admin.Len())
+	}
+
+	h.Get([]byte("0"))
+	h.Get([]byte("missing"))
+	if stats := admin.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("wrong value for Admin.Stats(). Expected 1 hit and 1 miss but got %+v", stats)
+	}
+
+	admin.Flush()
+	if admin.Len() != 0 {
+		t.Errorf("Admin.Flush() should empty every shard but got %v entries", admin.Len())
+	}
+
+	if err := admin.Close(); err != nil {
+		t.Errorf("wrong value for Admin.Close(). Expected nil but got %v", err)
+	}
+}
+
+func TestConsistentHashCache_routing(t *testing.T) {
+	// Setup
+	const amount = 2000
+	keys := make([][]byte, amount)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%v", i))
+	}
+
+	// Shards stay empty, so their cleaners are not needed
+	newShard := func() *ActiveCache {
+		shard := NewActiveCache()
+		shard.StopCleaner()
+		return shard
+	}
+
+	h := NewConsistentHashCache(0)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		h.AddShard(name, newShard())
+	}
+	before := routes(h, keys)
+
+	// Test keys land on deterministic shards, whatever the order shards were added in
+	reversed := NewConsistentHashCache(0)
+	reversed.seed = h.seed
+	for _, name := range []string{"d", "c", "b", "a"} {
+		reversed.AddShard(name, newShard())
+	}
+
+	for i, name := range routes(reversed, keys) {
+		if name != before[i] {
+			t.Fatalf("wrong value for ShardFor(%s). Expected %s on every call but got %s", keys[i], before[i], name)
+		}
+	}
+
+	// Test adding a shard only moves keys to it
+	h.AddShard("e", newShard())
+	var moved int
+	for i, name := range routes(h, keys) {
+		if name != before[i] && name != "e" {
+			t.Fatalf("wrong value for ShardFor(%s) after AddShard(e). Expected %s or e but got %s", keys[i], before[i], name)
+		}
+		if name != before[i] {
+			moved++
+		}
+	}
+
+	// About 1/5 of the keys should move
+	if moved < amount/10 || moved > amount*2/5 {
+		t.Errorf("wrong amount of keys moved by AddShard(e). Expected about %v but got %v", amount/5, moved)
+	}
+
+	// Test removing it restores the previous routing
+	if _, ok := h.RemoveShard("e"); !ok {
+		t.Errorf("wrong value for RemoveShard(e). Expected true but got false")
+	}
+
+	for i, name := range routes(h, keys) {
+		if name != before[i] {
+			t.Fatalf("wrong value for ShardFor(%s) after RemoveShard(e). Expected %s but got %s", keys[i], before[i], name)
+		}
+	}
+
+	// Test removing a shard only moves its keys
+	h.RemoveShard("a")
+	for i, name := range routes(h, keys) {
+		if (before[i] == "a") == (name == before[i]) {
+			t.Fatalf("wrong value for ShardFor(%s) after RemoveShard(a). Expected only keys of a to move but got %s to %s", keys[i], before[i], name)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Dump format, all integers are varints:
+//
+//	header: DumpMagic, DumpVersion
+//	entry:  1, key length, key, value length, value, remaining TTL in ns
+//	footer: 0, amount of entries
+//
+// The amount of entries is written last, so entries are streamed as they
+// are encoded and the reader can still tell a complete dump from a cut one
+const (
+	// DumpMagic identifies cache dumps
+	DumpMagic = "ACDUMP"
+
+	// DumpVersion is the dump format version written by WriteDump
+	DumpVersion = 1
+)
+
+// Dump record kinds
+const (
+	dumpEnd byte = iota
+	dumpEntry
+)
+
+// ExportWhere streams the live entries of `c` for which `pred` returns true
+//
+// to `w`, in the dump format read by ReadDump and Import. `pred` receives
+// shared key and value slices that must not be modified or retained. A nil
+// `pred` exports every entry like WriteDump
+func (c *ActiveCache) ExportWhere(pred func(key, value []byte) bool, w io.Writer) error {
+	return writeDump(w, c, pred)
+}
+
+// Import restores every entry of a dump written by WriteDump or ExportWhere,
+//
+// see ImportWhere
+func (c *ActiveCache) Import(r io.Reader) (int, error) {
+	return c.ImportWhere(nil, r)
+}
+
+// ImportWhere restores the entries of a dump for which `pred` returns true,
+//
+// with the remaining TTL they had when dumped. Entries already expired are
+// skipped, a nil `pred` imports every entry. Entries are written under a single
+// lock like SetMany, replacing existing values.
+//
+// Returns the amount of imported entries. Returns ErrInvalidDump without
+// importing anything if `r` is not a complete dump, or the first rejected
+// write once every other entry is imported
+func (c *ActiveCache) ImportWhere(pred func(key, value []byte) bool, r io.Reader) (int, error) {
+	items, err := ReadDump(r)
+	if err != nil {
+		return 0, err
+	}
+
+	selected := items[:0]
+	for _, item := range items {
+		if item.TTL < 0 || (pred != nil && !pred(item.Key, item.Value)) {
+			continue
+		}
+		selected = append(selected, item)
+	}
+
+	imported := 0
+	for _, result := range c.SetMany(selected) {
+		if result.Err != nil {
+			if err == nil {
+				err = fmt.Errorf("key %q: %w", result.Key, result.Err)
+			}
+			continue
+		}
+		imported++
+	}
+
+	return imported, err
+}
+
+// ReadDump reads every entry of a dump written by WriteDump.
+//
+// Item.TTL holds the remaining TTL when the entry was dumped, NoExpiration
+// if it never expires. Returns ErrInvalidDump if `r` is not a complete dump
+func ReadDump(r io.Reader) ([]Item, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(DumpMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != DumpMagic {
+		return nil, fmt.Errorf("%w: missing magic header", ErrInvalidDump)
+	}
+
+	version, err := binary.ReadUvarint(br)
+	if err != nil || version != DumpVersion {
+		return nil, fmt.Errorf("%w: unsupported version %v", ErrInvalidDump, version)
+	}
+
+	items := []Item{}
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+
+		if kind == dumpEnd {
+			break
+		}
+
+		if kind != dumpEntry {
+			return nil, fmt.Errorf("%w: unknown record %v", ErrInvalidDump, kind)
+		}
+
+		item, err := readDumpEntry(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		items = append(items, item)
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil || count != uint64(len(items)) {
+		return nil, fmt.Errorf("%w: expected %v entries but read %v", ErrInvalidDump, count, len(items))
+	}
+
+	return items, nil
+}
+
+// readDumpEntry reads the fields of one entry record
+func readDumpEntry(br *bufio.Reader) (Item, error) {
+	key, err := readDumpBytes(br)
+	if err != nil {
+		return Item{}, err
+	}
+
+	value, err := readDumpBytes(br)
+	if err != nil {
+		return Item{}, err
+	}
+
+	ttl, err := binary.ReadVarint(br)
+	if err != nil {
+		return Item{}, err
+	}
+
+	return Item{Key: key, Value: value, TTL: time.Duration(ttl)}, nil
+}
+
+// readDumpBytes reads a length prefixed byte slice.
+//
+// Bytes are read before allocating, so a corrupt length cannot allocate more than the dump holds
+func readDumpBytes(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(br, int64(min(n, 1<<62))))
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(data)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return data, nil
+}
+
+// WriteDump streams every live entry of `c` to `w` in the dump format read by ReadDump.
+//
+// Entries are taken from a Snapshot, so the cache is only locked briefly, and
+// encoded one by one. Entries expiring while the dump is written are skipped
+// and the remaining TTL is computed when each entry is written
+func WriteDump(w io.Writer, c *ActiveCache) error {
+	return writeDump(w, c, nil)
+}
+
+// writeDump streams the live entries of `c` accepted by `pred` to `w`,
+//
+// every entry if `pred` is nil
+func writeDump(w io.Writer, c *ActiveCache, pred func(key, value []byte) bool) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	bw.WriteString(DumpMagic)
+	bw.Write(binary.AppendUvarint(buf[:0], DumpVersion))
+
+	var count uint64
+	now := c.now()
+	c.Snapshot().entries.Range(func(key []byte, entry *cacheEntry) bool {
+		ttl := entry.RemainingTTL(now)
+		if entry.HasTTL() && ttl <= 0 {
+			return true
+		}
+
+		value := entry.Bytes()
+		if pred != nil && !pred(key, value) {
+			return true
+		}
+
+		bw.WriteByte(dumpEntry)
+		bw.Write(binary.AppendUvarint(buf[:0], uint64(len(key))))
+		bw.Write(key)
+
+		bw.Write(binary.AppendUvarint(buf[:0], uint64(len(value))))
+		bw.Write(value)
+		bw.Write(binary.AppendVarint(buf[:0], int64(ttl)))
+		count++
+		return true
+	})
+
+	bw.WriteByte(dumpEnd)
+	bw.Write(binary.AppendUvarint(buf[:0], count))
+
+	// bufio.Writer keeps the first write error and returns it on Flush
+	return bw.Flush()
+}
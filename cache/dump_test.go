@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+func TestReadDump(t *testing.T) {
+	// Setup
+	var dump bytes.Buffer
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	if err := WriteDump(&dump, cache); err != nil {
+		t.Fatalf("wrong value for WriteDump() on empty cache. Expected nil but got %v", err)
+	}
+	empty := dump.Bytes()
+
+	// Test
+	if items, err := ReadDump(bytes.NewReader(empty)); err != nil || items == nil || len(items) != 0 {
+		t.Errorf("wrong value for ReadDump() of an empty dump. Expected empty slice but got %#v, %v", items, err)
+	}
+
+	tests := map[string][]byte{
+		"no data":           nil,
+		"wrong magic":       []byte("NOTADUMP"),
+		"wrong version":     append([]byte(DumpMagic), 99),
+		"missing footer":    empty[:len(empty)-2],
+		"wrong count":       append(append([]byte{}, empty[:len(empty)-1]...), 5),
+		"unknown record":    append([]byte(DumpMagic), DumpVersion, 7),
+		"truncated entry":   append([]byte(DumpMagic), DumpVersion, dumpEntry, 10, 'k'),
+		"truncated counter": append([]byte(DumpMagic), DumpVersion, dumpEnd),
+	}
+
+	for name, data := range tests {
+		if _, err := ReadDump(bytes.NewReader(data)); !errors.Is(err, ErrInvalidDump) {
+			t.Errorf("wrong value for ReadDump() with %s. Expected %v but got %v", name, ErrInvalidDump, err)
+		}
+	}
+}
+
+func TestWriteDump(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	compressible := []byte(strings.Repeat("lorem ipsum dolor sit amet ", 100))
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Compress: true})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), compressible)
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	cache.SetPermanent([]byte("empty"), []byte{})
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+	clock.Advance(2 * time.Second)
+
+	expected := []Item{
+		{Key: []byte("empty"), Value: []byte{}, TTL: NoExpiration},
+		{Key: []byte("john"), Value: []byte("doe"), TTL: time.Minute - 2*time.Second},
+		{Key: []byte("lorem"), Value: compressible, TTL: NoExpiration},
+	}
+
+	assertItems := func(source string, items []Item) {
+		sort.Slice(items, func(i, j int) bool {
+			return string(items[i].Key) < string(items[j].Key)
+		})
+
+		if len(items) != len(expected) {
+			t.Fatalf("wrong items amount read from %s. Expected %v but got %v", source, len(expected), len(items))
+		}
+
+		for i, item := range items {
+			if !bytes.Equal(item.Key, expected[i].Key) || !bytes.Equal(item.Value, expected[i].Value) || item.TTL != expected[i].TTL {
+				t.Errorf("wrong item read from %s. Expected (%s, %v bytes, %v) but got (%s, %v bytes, %v)",
+					source,
+					expected[i].Key,
+					len(expected[i].Value),
+					expected[i].TTL,
+					item.Key,
+					len(item.Value),
+					item.TTL,
+				)
+			}
+		}
+	}
+
+	// Test round trip through memory
+	var dump bytes.Buffer
+	if err := WriteDump(&dump, cache); err != nil {
+		t.Fatalf("wrong value for WriteDump(). Expected nil but got %v", err)
+	}
+
+	items, err := ReadDump(&dump)
+	if err != nil {
+		t.Fatalf("wrong value for ReadDump(). Expected nil but got %v", err)
+	}
+	assertItems("buffer", items)
+
+	// Test round trip through a file
+	path := filepath.Join(t.TempDir(), "cache.dump")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteDump(f, cache); err != nil {
+		t.Fatalf("wrong value for WriteDump() to file. Expected nil but got %v", err)
+	}
+	f.Close()
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	items, err = ReadDump(f)
+	if err != nil {
+		t.Fatalf("wrong value for ReadDump() from file. Expected nil but got %v", err)
+	}
+	assertItems("file", items)
+
+	// Test write errors are returned
+	if err := WriteDump(failingWriter{}, cache); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("wrong value for WriteDump() on failing writer. Expected %v but got %v", os.ErrClosed, err)
+	}
+}
+
+// failingWriter is an io.Writer failing every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, os.ErrClosed
+}
+
+func TestActiveCache_ExportWhere(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	source := NewActiveCacheWithConfig(&Config{Clock: clock})
+	source.StopCleaner()
+	defer source.Close()
+	source.SetPermanent([]byte("tenant1:lorem"), []byte("ipsum"))
+	source.Set([]byte("tenant1:john"), []byte("doe"), time.Minute)
+	source.Set([]byte("tenant1:jane"), []byte("foster"), time.Second)
+	source.SetPermanent([]byte("tenant2:lorem"), []byte("dolor"))
+	clock.Advance(2 * time.Second)
+
+	tenant1 := func(key, value []byte) bool {
+		return bytes.HasPrefix(key, []byte("tenant1:"))
+	}
+
+	// Test only matching live entries are exported
+	var dump bytes.Buffer
+	if err := source.ExportWhere(tenant1, &dump); err != nil {
+		t.Fatalf("wrong value for ExportWhere(). Expected nil but got %v", err)
+	}
+	data := dump.Bytes()
+
+	target := NewActiveCacheWithConfig(&Config{Clock: clock})
+	target.StopCleaner()
+	defer target.Close()
+	target.SetPermanent([]byte("tenant1:lorem"), []byte("old"))
+
+	if imported, err := target.Import(bytes.NewReader(data)); err != nil || imported != 2 {
+		t.Fatalf("wrong value for Import(). Expected (2, nil) but got (%v, %v)", imported, err)
+	}
+
+	expected := map[string]struct {
+		value string
+		ttl   time.Duration
+	}{
+		"tenant1:lorem": {"ipsum", NoExpiration},
+		"tenant1:john":  {"doe", time.Minute - 2*time.Second},
+	}
+	if target.Len() != len(expected) {
+		t.Errorf("wrong value for Len() after Import(). Expected %v but got %v", len(expected), target.Len())
+	}
+
+	for key, e := range expected {
+		if value, ttl := target.Get([]byte(key)); string(value) != e.value || ttl != e.ttl {
+			t.Errorf("wrong value for Get(%s) after Import(). Expected (%s, %v) but got (%s, %v)", key, e.value, e.ttl, value, ttl)
+		}
+	}
+
+	// Test ImportWhere filters again and skips expired entries
+	fresh := NewActiveCacheWithConfig(&Config{Clock: clock})
+	fresh.StopCleaner()
+	defer fresh.Close()
+
+	var expiredDump bytes.Buffer
+	expiredDump.WriteString(DumpMagic)
+	expiredDump.Write([]byte{DumpVersion, dumpEntry, 1, 'k', 1, 'v', 1, dumpEnd, 1})
+
+	john := func(key, value []byte) bool {
+		return string(value) == "doe"
+	}
+	if imported, err := fresh.ImportWhere(john, bytes.NewReader(data)); err != nil || imported != 1 || !fresh.Has([]byte("tenant1:john")) {
+		t.Errorf("wrong value for ImportWhere(). Expected (1, nil) with tenant1:john but got (%v, %v)", imported, err)
+	}
+
+	if imported, err := fresh.Import(&expiredDump); err != nil || imported != 0 || fresh.Has([]byte("k")) {
+		t.Errorf("wrong value for Import() of an expired entry. Expected (0, nil) but got (%v, %v)", imported, err)
+	}
+
+	if imported, err := fresh.Import(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, ErrInvalidDump) || imported != 0 {
+		t.Errorf("wrong value for Import() of a cut dump. Expected (0, %v) but got (%v, %v)", ErrInvalidDump, imported, err)
+	}
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCacheFull is returned when a new key is rejected because the cache
+	// holds Config.MaxEntries entries and Config.FullBehavior is RejectWrites
+	ErrCacheFull = errors.New("cache: cache full")
+
+	// ErrClosed is returned when writing to a cache after Close
+	ErrClosed = errors.New("cache: closed")
+
+	// ErrCostTooHigh is returned when an entry alone costs more than Config.MaxCostBytes
+	ErrCostTooHigh = errors.New("cache: cost too high")
+
+	// ErrHashCollision is returned when Config.DetectCollisions is set and the key
+	// hashes like a different stored key, which would otherwise be overwritten
+	ErrHashCollision = errors.New("cache: hash collision")
+
+	// ErrInvalidDump is returned when reading data that is not a complete cache dump
+	ErrInvalidDump = errors.New("cache: invalid dump")
+
+	// ErrInvalidOp is returned by ApplyOp for an unknown operation type
+	ErrInvalidOp = errors.New("cache: invalid operation")
+
+	// ErrInvariantViolated is wrapped by the violations CheckInvariants reports
+	ErrInvariantViolated = errors.New("cache: invariant violated")
+
+	// ErrKeyDeleted is returned when the key was deleted and is kept as a tombstone,
+	// see Config.TombstoneTTL
+	ErrKeyDeleted = errors.New("cache: key deleted")
+
+	// ErrKeyExpired is returned when the key is stored but its TTL has expired
+	ErrKeyExpired = errors.New("cache: key expired")
+
+	// ErrKeyTooLarge is returned when the key exceeds Config.MaxKeyBytes
+	ErrKeyTooLarge = errors.New("cache: key too large")
+
+	// ErrKeyNotFound is returned when the key is not stored in cache
+	ErrKeyNotFound = errors.New("cache: key not found")
+
+	// ErrNegativeCached is returned when the key is cached as not found, see SetNotFound
+	ErrNegativeCached = errors.New("cache: key cached as not found")
+
+	// ErrNilKey is returned when a nil key is given
+	ErrNilKey = errors.New("cache: nil key")
+
+	// ErrShardExists is returned by ConsistentHashCache.AddShard when a shard is already added under the name
+	ErrShardExists = errors.New("cache: shard exists")
+
+	// ErrStaleOp is returned by ApplyOp when the stored entry was written after the operation
+	ErrStaleOp = errors.New("cache: stale operation")
+
+	// ErrValueTooLarge is returned when the value exceeds Config.MaxValueBytes
+	ErrValueTooLarge = errors.New("cache: value too large")
+)
+
+// A CleanPanicError represents a panic recovered from a clean cycle
+type CleanPanicError struct {
+	// Value given to panic
+	Value interface{}
+
+	// Stack trace of the cleaner when it panicked
+	Stack []byte
+}
+
+// Error returns the panic value description
+func (e *CleanPanicError) Error() string {
+	return fmt.Sprintf("cache: clean panic: %v", e.Value)
+}
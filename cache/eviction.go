@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"math/rand"
+
+	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
+)
+
+// An EvictionPolicy chooses the entries removed to make room, see Config.Eviction.
+//
+// Eviction runs once `Config.MaxEntries` is reached or the stored entries
+// cost more than `Config.MaxCostBytes`. Methods are called while holding the
+// cache write lock, so they must be fast and must not call the cache. Keys
+// must not be modified nor retained
+type EvictionPolicy interface {
+	// OnGet is called after a read returns the value of `key`
+	OnGet(key []byte)
+
+	// OnSet is called after a write stores `key`
+	OnSet(key []byte)
+
+	// OnDelete is called after `key` is deleted, evicted, expired or removed
+	// as corrupted, see Config.VerifyChecksums
+	OnDelete(key []byte)
+
+	// Victim returns the index in `candidates` of the entry to evict,
+	//
+	// or a negative index to evict none. Candidates are up to
+	// EvictionSampleSize random entries eviction may remove, pinned
+	// entries are never offered
+	Victim(candidates []EntryView) int
+}
+
+// A LRUPolicy evicts the least recently read or written entry.
+//
+// The cache evicts the exact one from its recency lists instead of sampling,
+// so Victim is only called when the policy is used on its own
+type LRUPolicy struct{}
+
+func (LRUPolicy) OnGet(key []byte)    {}
+func (LRUPolicy) OnSet(key []byte)    {}
+func (LRUPolicy) OnDelete(key []byte) {}
+
+// Victim returns the candidate with the lowest EntryView.LastAccess
+func (LRUPolicy) Victim(candidates []EntryView) int {
+	victim := -1
+	for i, e := range candidates {
+		if victim < 0 || e.LastAccess < candidates[victim].LastAccess {
+			victim = i
+		}
+	}
+
+	return victim
+}
+
+// A LFUPolicy evicts the least frequently read or written candidate,
+//
+// counting the reads and writes of every stored key from OnGet and OnSet
+// until OnDelete. The zero value is ready to use, a policy must not be shared
+// by several caches
+type LFUPolicy struct {
+	// Reads and writes of every stored key
+	counts hashmap.HashMap[uint64]
+}
+
+// OnGet counts a read of `key`
+func (p *LFUPolicy) OnGet(key []byte) {
+	p.count(key)
+}
+
+// OnSet counts a write of `key`
+func (p *LFUPolicy) OnSet(key []byte) {
+	p.count(key)
+}
+
+// OnDelete forgets the count of `key`
+func (p *LFUPolicy) OnDelete(key []byte) {
+	p.counts.Delete(key)
+}
+
+// count adds one to the count of `key`
+func (p *LFUPolicy) count(key []byte) {
+	count, _ := p.counts.Get(key)
+	p.counts.Put(key, count+1)
+}
+
+// Victim returns the candidate with the lowest count,
+//
+// the least recently used one among those with as low
+func (p *LFUPolicy) Victim(candidates []EntryView) int {
+	victim := -1
+	var victimCount uint64
+	for i, e := range candidates {
+		count, _ := p.counts.Get(e.Key)
+		if victim < 0 || count < victimCount || (count == victimCount && e.LastAccess < candidates[victim].LastAccess) {
+			victim, victimCount = i, count
+		}
+	}
+
+	return victim
+}
+
+// A RandomPolicy evicts a candidate chosen at random
+type RandomPolicy struct{}
+
+func (RandomPolicy) OnGet(key []byte)    {}
+func (RandomPolicy) OnSet(key []byte)    {}
+func (RandomPolicy) OnDelete(key []byte) {}
+
+// Victim returns the index of a random candidate
+func (RandomPolicy) Victim(candidates []EntryView) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+
+	return rand.Intn(len(candidates))
+}
+
+// evictByPolicy removes one evictable entry chosen by `Config.Eviction`
+//
+// among candidates sampled from EvictionSampleWindow consecutive entries, or
+// the least recently accessed one when it is nil, an LRUPolicy or FullBehavior
+// is EvictLRU, see evictLRU. The whole cache is sampled only when the window
+// holds no candidate. Reports whether an entry was removed.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) evictByPolicy() bool {
+	conf := c.config.Load()
+	if conf.FullBehavior == EvictLRU {
+		return c.evictLRU()
+	}
+
+	policy := conf.Eviction
+	switch policy.(type) {
+	case nil, LRUPolicy, *LRUPolicy:
+		return c.evictLRU()
+	}
+
+	now := c.now()
+	evictable := func(key []byte, entry *cacheEntry) bool {
+		return entry.IsEvictable(now) && !c.isSpared(key)
+	}
+
+	sample := c.entries.SampleWindow(EvictionSampleSize, EvictionSampleWindow, evictable)
+	if len(sample) == 0 {
+		sample = c.entries.Sample(EvictionSampleSize, evictable)
+	}
+
+	candidates := make([]EntryView, len(sample))
+	for i, e := range sample {
+		candidates[i] = e.Value.View(e.Key)
+	}
+
+	i := policy.Victim(candidates)
+	if i < 0 || i >= len(sample) {
+		return false
+	}
+
+	return c.evict(sample[i].Key, sample[i].Value)
+}
+
+// notifyPolicy reports the read, write or removal of `key` recorded as `kind`
+//
+// to `Config.Eviction` when it is set. Caller must hold the write lock
+func (c *ActiveCache) notifyPolicy(kind hookKind, key []byte) {
+	policy := c.config.Load().Eviction
+	if policy == nil {
+		return
+	}
+
+	switch kind {
+	case hookSet:
+		policy.OnSet(key)
+	case hookGetHit:
+		policy.OnGet(key)
+	case hookDelete, hookEvict, hookExpire, hookCorruption:
+		policy.OnDelete(key)
+	}
+}
+
+// overCapacity reports whether more than `Config.MaxEntries` entries are stored
+//
+// or their costs exceed `Config.MaxCostBytes`
+func (c *ActiveCache) overCapacity() bool {
+	conf := c.config.Load()
+	return (conf.MaxEntries > 0 && c.length.Load() > int64(conf.MaxEntries)) ||
+		(conf.MaxCostBytes > 0 && c.cost.Load() > conf.MaxCostBytes)
+}
+
+// trimToCapacity evicts entries following `Config.Eviction` until at most
+//
+// `Config.MaxEntries` are stored within `Config.MaxCostBytes`, e.g. after
+// Reconfigure lowered them. Not done when FullBehavior is RejectWrites.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) trimToCapacity() {
+	if c.config.Load().FullBehavior == RejectWrites {
+		return
+	}
+
+	for c.overCapacity() && c.evictByPolicy() {
+	}
+}
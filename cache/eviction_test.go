@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recordingPolicy is an EvictionPolicy recording its calls
+//
+// and evicting the candidate of key `victim` if offered
+type recordingPolicy struct {
+	calls  []string
+	victim string
+}
+
+func (r *recordingPolicy) OnGet(key []byte)    { r.calls = append(r.calls, "get "+string(key)) }
+func (r *recordingPolicy) OnSet(key []byte)    { r.calls = append(r.calls, "set "+string(key)) }
+func (r *recordingPolicy) OnDelete(key []byte) { r.calls = append(r.calls, "delete "+string(key)) }
+
+func (r *recordingPolicy) Victim(candidates []EntryView) int {
+	for i, e := range candidates {
+		if string(e.Key) == r.victim {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func TestActiveCache_evictByPolicy(t *testing.T) {
+	// Setup
+	policy := &recordingPolicy{victim: "john"}
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 2, Eviction: policy})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.Get([]byte("lorem"))
+	cache.Get([]byte("nonexistent key"))
+
+	// Test the policy chooses the victim and is told about hits, writes and removals
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	calls := fmt.Sprint(policy.calls)
+
+	if cache.Has([]byte("john")) || !cache.Has([]byte("lorem")) {
+		t.Errorf("Eviction should choose the evicted entry. Expected john evicted but got lorem found=%v and john found=%v", cache.Has([]byte("lorem")), cache.Has([]byte("john")))
+	}
+
+	if expected := "[set lorem set john get lorem delete john set jane]"; calls != expected {
+		t.Errorf("wrong calls to EvictionPolicy. Expected %s but got %s", expected, calls)
+	}
+
+	// Test a policy evicting none leaves the cache full
+	policy.victim = ""
+	if err := cache.SetE([]byte("sit"), []byte("amet"), NoExpiration); err != ErrCacheFull {
+		t.Errorf("wrong value for SetE() when Victim() evicts none. Expected %v but got %v", ErrCacheFull, err)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_evictByPolicy_lru(t *testing.T) {
+	// Setup
+	const entries = 1000
+	policy := &recordingPolicy{victim: "key500"}
+	for name, conf := range map[string]*Config{
+		"LRUPolicy":         {MaxEntries: entries, Eviction: LRUPolicy{}},
+		"FullBehavior LRU":  {MaxEntries: entries, Eviction: policy, FullBehavior: EvictLRU},
+		"nil Eviction":      {MaxEntries: entries},
+		"LRUPolicy pointer": {MaxEntries: entries, Eviction: &LRUPolicy{}},
+	} {
+		cache := NewActiveCacheWithConfig(conf)
+		cache.StopCleaner()
+		for i := 0; i < entries; i++ {
+			cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+		}
+		cache.Get([]byte("key0"))
+
+		// Test the exact least recently used entry is evicted instead of a sampled one
+		cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+		if cache.Has([]byte("key1")) || !cache.Has([]byte("key0")) || !cache.Has([]byte("key500")) {
+			t.Errorf("%s should evict the least recently used key1 but got key0 found=%v, key1 found=%v and key500 found=%v",
+				name, cache.Has([]byte("key0")), cache.Has([]byte("key1")), cache.Has([]byte("key500")))
+		}
+
+		assertInvariants(t, cache)
+	}
+}
+
+func TestActiveCache_evictByPolicy_window(t *testing.T) {
+	// Setup
+	const entries = EvictionSampleWindow * 8
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: entries, Eviction: RandomPolicy{}})
+	cache.StopCleaner()
+	for i := 1; i < entries; i++ {
+		cache.SetWithOptions([]byte(fmt.Sprintf("key%v", i)), []byte("value"), NoExpiration, WithPinned())
+	}
+
+	// Test the only evictable entry is found even when the sampled window misses it
+	for i := 0; i < 10; i++ {
+		cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+		if err := cache.SetE([]byte("john"), []byte("doe"), NoExpiration); err != nil {
+			t.Fatalf("wrong value for SetE() with a single evictable entry. Expected nil but got %v", err)
+		}
+
+		if cache.Has([]byte("lorem")) || !cache.Has([]byte("john")) {
+			t.Fatalf("the only evictable entry should have been evicted but got lorem found=%v and john found=%v", cache.Has([]byte("lorem")), cache.Has([]byte("john")))
+		}
+		cache.Delete([]byte("john"))
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_trimToCapacity(t *testing.T) {
+	// Setup
+	policy := &LFUPolicy{}
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 4, Eviction: policy})
+	cache.StopCleaner()
+	for i := 0; i < 4; i++ {
+		key := []byte(fmt.Sprintf("key%v", i))
+		cache.SetPermanent(key, []byte("value"))
+		for j := 0; j < i; j++ {
+			cache.Get(key)
+		}
+	}
+
+	// Test a clean cycle evicts the least frequently read entries beyond MaxEntries
+	cache.Reconfigure(&Config{MaxEntries: 2, Eviction: policy})
+	cache.CleanNow()
+
+	if keys := fmt.Sprintf("%s", cache.KeysSorted()); keys != "[key2 key3]" {
+		t.Errorf("wrong keys after a clean cycle lowering MaxEntries. Expected [key2 key3] but got %s", keys)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestLFUPolicy_Victim(t *testing.T) {
+	// Setup
+	policy := &LFUPolicy{}
+	candidates := []EntryView{
+		{Key: []byte("lorem"), LastAccess: 1},
+		{Key: []byte("john"), LastAccess: 5},
+		{Key: []byte("jane"), LastAccess: 4},
+	}
+	for _, e := range candidates {
+		policy.OnSet(e.Key)
+	}
+	policy.OnGet([]byte("lorem"))
+	policy.OnSet([]byte("lorem"))
+
+	// Test the counts decide, then the last access among as low counts
+	if i := policy.Victim(candidates); i != 2 {
+		t.Errorf("wrong value for LFUPolicy.Victim(). Expected 2 but got %v", i)
+	}
+
+	policy.OnGet([]byte("jane"))
+	if i := policy.Victim(candidates); i != 1 {
+		t.Errorf("wrong value for LFUPolicy.Victim() after OnGet(jane). Expected 1 but got %v", i)
+	}
+
+	// Test deleted keys restart from zero
+	policy.OnDelete([]byte("lorem"))
+	if i := policy.Victim(candidates); i != 0 {
+		t.Errorf("wrong value for LFUPolicy.Victim() after OnDelete(lorem). Expected 0 but got %v", i)
+	}
+
+	if i := policy.Victim(nil); i != -1 {
+		t.Errorf("wrong value for LFUPolicy.Victim(nil). Expected -1 but got %v", i)
+	}
+}
+
+func TestLRUPolicy_Victim(t *testing.T) {
+	// Setup
+	candidates := []EntryView{
+		{Key: []byte("lorem"), Hits: 3, LastAccess: 2},
+		{Key: []byte("john"), Hits: 0, LastAccess: 5},
+		{Key: []byte("jane"), Hits: 9, LastAccess: 1},
+	}
+
+	// Test
+	if i := (LRUPolicy{}).Victim(candidates); i != 2 {
+		t.Errorf("wrong value for LRUPolicy.Victim(). Expected 2 but got %v", i)
+	}
+
+	if i := (LRUPolicy{}).Victim(nil); i != -1 {
+		t.Errorf("wrong value for LRUPolicy.Victim(nil). Expected -1 but got %v", i)
+	}
+}
+
+func TestRandomPolicy_Victim(t *testing.T) {
+	// Setup
+	candidates := make([]EntryView, 3)
+	seen := make([]bool, len(candidates))
+
+	// Test
+	for i := 0; i < 1000; i++ {
+		seen[(RandomPolicy{}).Victim(candidates)] = true
+	}
+
+	if fmt.Sprint(seen) != "[true true true]" {
+		t.Errorf("RandomPolicy.Victim() should choose every candidate but got %v", seen)
+	}
+
+	if i := (RandomPolicy{}).Victim(nil); i != -1 {
+		t.Errorf("wrong value for RandomPolicy.Victim(nil). Expected -1 but got %v", i)
+	}
+}
@@ -0,0 +1,82 @@
+package cache_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache"
+)
+
+// Basic usage: values expire after their TTL, permanent ones never do
+func Example() {
+	c := cache.NewActiveCache()
+	defer c.StopCleaner()
+
+	c.Set([]byte("session"), []byte("token"), time.Minute)
+	c.SetPermanent([]byte("config"), []byte("v1"))
+
+	value, ttl := c.Get([]byte("session"))
+	fmt.Println(string(value), ttl)
+
+	value, ttl = c.Get([]byte("missing"))
+	fmt.Println(value == nil, ttl)
+	// Output:
+	// token 1m0s
+	// true 0s
+}
+
+// GetOK tells a stored empty value apart from a missing key
+func ExampleActiveCache_GetOK() {
+	c := cache.NewActiveCache()
+	defer c.StopCleaner()
+
+	c.SetPermanent([]byte("empty"), []byte{})
+
+	_, _, ok := c.GetOK([]byte("empty"))
+	fmt.Println(ok)
+
+	_, _, ok = c.GetOK([]byte("missing"))
+	fmt.Println(ok)
+	// Output:
+	// true
+	// false
+}
+
+// A full-sweep cleaner removing every expired entry on each cycle,
+// implemented with the exported API only
+func ExampleActiveCache_SetCleanFunc() {
+	c := cache.NewActiveCacheWithConfig(&cache.Config{CleanerInterval: cache.MinCleanerInterval})
+	defer c.StopCleaner()
+
+	c.SetCleanFunc(func(entries []cache.EntryView) [][]byte {
+		var expired [][]byte
+		for _, e := range entries {
+			if !e.ExpiresAt.IsZero() && !time.Now().Before(e.ExpiresAt) {
+				expired = append(expired, e.Key)
+			}
+		}
+		return expired
+	})
+
+	c.Set([]byte("lorem"), []byte("ipsum"), time.Millisecond)
+	c.SetPermanent([]byte("john"), []byte("doe"))
+	time.Sleep(cache.MinCleanerInterval * time.Millisecond * 4)
+
+	fmt.Println(c.ExpiringCount(), len(c.Items()))
+	// Output: 0 1
+}
+
+// Pinned entries survive eviction, a full cache of pinned entries rejects new keys
+func ExampleActiveCache_SetWithOptions() {
+	c := cache.NewActiveCacheWithConfig(&cache.Config{MaxEntries: 1})
+	defer c.StopCleaner()
+
+	c.SetWithOptions([]byte("lorem"), []byte("ipsum"), time.Minute, cache.WithPinned())
+	fmt.Println(c.SetE([]byte("john"), []byte("doe"), time.Minute))
+
+	c.Unpin([]byte("lorem"))
+	fmt.Println(c.SetE([]byte("john"), []byte("doe"), time.Minute), c.Len())
+	// Output:
+	// cache: cache full
+	// <nil> 1
+}
@@ -0,0 +1,60 @@
+package cache
+
+import "time"
+
+// A HealthStatus represents the liveness of the cleaner, see ActiveCache.Health
+type HealthStatus struct {
+	// Reports whether the cleaner is supposed to be running, see IsCleanerRunning
+	CleanerRunning bool
+
+	// Reports whether the cleaner skips its cycles, see PauseCleaner
+	CleanerPaused bool
+
+	// Time the last clean cycle completed, or the cleaner started if none
+	// did since. Zero if the cleaner never ran
+	LastCleanAt time.Time
+
+	// Time elapsed since LastCleanAt, zero if the cleaner never ran
+	SinceLastClean time.Duration
+
+	// Reports whether the cleaner is running but no cycle completed for
+	// HealthStallCycles of its longest interval, e.g. its goroutine died
+	Stalled bool
+}
+
+// Health reports whether the cleaner is alive, for liveness probes.
+//
+// The cleaner is stalled when it claims to be running but no clean cycle
+// completed for HealthStallCycles times `Config.CleanerBackoffMax`, or
+// `Config.CleanerInterval` without backoff. A stopped or paused cleaner is not
+// stalled, nor one run by `Config.Scheduler` whose intervals are unknown.
+//
+// It takes no lock, so a cache blocked by a long writer still reports
+func (c *ActiveCache) Health() HealthStatus {
+	status := HealthStatus{CleanerRunning: c.IsCleanerRunning(), CleanerPaused: c.IsCleanerPaused()}
+
+	lastCleanAt := c.lastCleanAt.Load()
+	if lastCleanAt == 0 {
+		return status
+	}
+
+	status.LastCleanAt = time.Unix(0, lastCleanAt)
+	status.SinceLastClean = c.now().Sub(status.LastCleanAt)
+
+	conf := c.config.Load()
+	interval := time.Millisecond * time.Duration(max(conf.CleanerInterval, conf.CleanerBackoffMax))
+	status.Stalled = status.CleanerRunning && !status.CleanerPaused && conf.Scheduler == nil &&
+		status.SinceLastClean > HealthStallCycles*interval
+	return status
+}
+
+// Ready reports whether at least `threshold` of `expected` entries are
+//
+// stored, e.g. 0.9 for 90%, for readiness probes of a cache warmed up from
+// a snapshot. That is Len >= int(float64(expected) * threshold).
+//
+// It is a point-in-time check: entries expiring or deleted afterwards may
+// make the cache unready again
+func (c *ActiveCache) Ready(expected int, threshold float64) bool {
+	return c.Len() >= int(float64(expected)*threshold)
+}
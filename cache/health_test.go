@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+func TestActiveCache_Health(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, CleanerInterval: MinCleanerInterval})
+	defer cache.Close()
+	startedAt := clock.Now()
+
+	// Test a started cleaner is healthy
+	if health := cache.Health(); !health.CleanerRunning || health.Stalled || !health.LastCleanAt.Equal(startedAt) {
+		t.Errorf("wrong value for Health() of a started cleaner. Expected running since %v but got %+v", startedAt, health)
+	}
+
+	// Test a stopped cleaner grows stale without being stalled
+	cache.StopCleaner()
+	clock.Advance(time.Hour)
+
+	health := cache.Health()
+	if health.CleanerRunning || health.Stalled || health.SinceLastClean < time.Hour {
+		t.Errorf("wrong value for Health() of a stopped cleaner. Expected stale by 1h and not stalled but got %+v", health)
+	}
+
+	// Test a cleaner claiming to run without completing cycles is stalled
+	cache.isCleanerRunning.Store(true)
+	if health := cache.Health(); !health.Stalled {
+		t.Errorf("wrong value for Health() of a dead cleaner. Expected stalled but got %+v", health)
+	}
+
+	cache.PauseCleaner()
+	if health := cache.Health(); !health.CleanerPaused || health.Stalled {
+		t.Errorf("wrong value for Health() of a paused cleaner. Expected paused and not stalled but got %+v", health)
+	}
+	cache.ResumeCleaner()
+
+	cache.CleanNow()
+	if health := cache.Health(); health.Stalled || health.SinceLastClean != 0 {
+		t.Errorf("wrong value for Health() after a clean cycle. Expected not stalled but got %+v", health)
+	}
+	cache.isCleanerRunning.Store(false)
+
+	// Test a cleaner that never ran reports no clean
+	never := NewActiveCacheWithConfig(&Config{Clock: clock})
+	defer never.Close()
+	never.StopCleaner()
+	never.lastCleanAt.Store(0)
+	if health := never.Health(); !health.LastCleanAt.IsZero() || health.SinceLastClean != 0 || health.Stalled {
+		t.Errorf("wrong value for Health() of a cleaner that never ran. Expected zero status but got %+v", health)
+	}
+}
+
+func TestActiveCache_Ready(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for i := 0; i < 8; i++ {
+		cache.SetPermanent([]byte{byte(i)}, []byte("value"))
+	}
+
+	tests := []struct {
+		name      string
+		expected  int
+		threshold float64
+		ready     bool
+	}{
+		{name: "below threshold", expected: 10, threshold: 0.9, ready: false},
+		{name: "at threshold", expected: 10, threshold: 0.8, ready: true},
+		{name: "above threshold", expected: 10, threshold: 0.5, ready: true},
+		{name: "nothing expected", expected: 0, threshold: 1, ready: true},
+	}
+
+	// Test
+	for _, tt := range tests {
+		if got := cache.Ready(tt.expected, tt.threshold); got != tt.ready {
+			t.Errorf("wrong value for Ready(%v, %v) %s. Expected %v but got %v", tt.expected, tt.threshold, tt.name, tt.ready, got)
+		}
+	}
+
+	// Test readiness is a point-in-time check
+	cache.DeleteString(string([]byte{0}))
+	if cache.Ready(10, 0.8) {
+		t.Errorf("wrong value for Ready(10, 0.8) after a delete. Expected false but got true")
+	}
+}
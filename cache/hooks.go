@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"bytes"
+	"time"
+)
+
+// hookKind identifies the Hooks method to call for a recorded event
+type hookKind int
+
+const (
+	hookSet hookKind = iota
+	hookGetHit
+	hookGetMiss
+	hookDelete
+	hookExpire
+
+	// Calls OnDelete, recorded apart in the audit log
+	hookEvict
+
+	// Calls Config.OnReplace instead of Hooks
+	hookReplace
+
+	// Calls Config.OnCorruption instead of Hooks
+	hookCorruption
+)
+
+// Hooks is an optional tap on every cache operation.
+//
+// Methods are called after the cache lock is released, one at a time in the
+// order operations happened, with copies of the keys. Events of an operation
+// made while another goroutine is calling hooks are dispatched by that
+// goroutine, so the operation may return before its hooks are called.
+//
+// Embed NoopHooks to implement only the needed methods
+type Hooks interface {
+	// OnSet is called after a key is stored with `ttl`
+	OnSet(key []byte, ttl time.Duration)
+
+	// OnGetHit is called after a read finds a live key
+	OnGetHit(key []byte)
+
+	// OnGetMiss is called after a read does not find a live key
+	OnGetMiss(key []byte)
+
+	// OnDelete is called after an existing key is removed by a write
+	OnDelete(key []byte)
+
+	// OnExpire is called after the cleaner removes an expired key
+	OnExpire(key []byte)
+}
+
+// A NoopHooks implements Hooks doing nothing
+type NoopHooks struct{}
+
+func (NoopHooks) OnSet(key []byte, ttl time.Duration) {}
+func (NoopHooks) OnGetHit(key []byte)                 {}
+func (NoopHooks) OnGetMiss(key []byte)                {}
+func (NoopHooks) OnDelete(key []byte)                 {}
+func (NoopHooks) OnExpire(key []byte)                 {}
+
+// A MultiHooks calls every Hooks in order
+type MultiHooks []Hooks
+
+func (m MultiHooks) OnSet(key []byte, ttl time.Duration) {
+	for _, h := range m {
+		h.OnSet(key, ttl)
+	}
+}
+
+func (m MultiHooks) OnGetHit(key []byte) {
+	for _, h := range m {
+		h.OnGetHit(key)
+	}
+}
+
+func (m MultiHooks) OnGetMiss(key []byte) {
+	for _, h := range m {
+		h.OnGetMiss(key)
+	}
+}
+
+func (m MultiHooks) OnDelete(key []byte) {
+	for _, h := range m {
+		h.OnDelete(key)
+	}
+}
+
+func (m MultiHooks) OnExpire(key []byte) {
+	for _, h := range m {
+		h.OnExpire(key)
+	}
+}
+
+// A hookEvent represents an operation recorded under the lock
+//
+// to be dispatched to Hooks once it is released
+type hookEvent struct {
+	kind hookKind
+	key  []byte
+	ttl  time.Duration
+
+	// Replaced and new values of hookReplace events
+	oldValue []byte
+	value    []byte
+
+	// Stored and actual checksums of hookCorruption events
+	expected uint32
+	actual   uint32
+}
+
+// dispatch calls `conf.Hooks`, `conf.OnReplace` and `conf.OnCorruption` for every event in order,
+//
+// skipping events whose callback is not set
+func dispatch(conf *Config, events []hookEvent) {
+	hooks := conf.Hooks
+	for _, e := range events {
+		if e.kind == hookReplace {
+			if conf.OnReplace != nil {
+				conf.OnReplace(e.key, e.oldValue, e.value)
+			}
+			continue
+		}
+
+		if e.kind == hookCorruption {
+			if conf.OnCorruption != nil {
+				conf.OnCorruption(e.key, e.expected, e.actual)
+			}
+			continue
+		}
+
+		if hooks == nil {
+			continue
+		}
+
+		switch e.kind {
+		case hookSet:
+			hooks.OnSet(e.key, e.ttl)
+		case hookGetHit:
+			hooks.OnGetHit(e.key)
+		case hookGetMiss:
+			hooks.OnGetMiss(e.key)
+		case hookDelete, hookEvict:
+			hooks.OnDelete(e.key)
+		case hookExpire:
+			hooks.OnExpire(e.key)
+		}
+	}
+}
+
+// dispatchQueued dispatches the queued hook events in order unless another
+//
+// goroutine already does, which then also dispatches the events queued
+// meanwhile. Caller must not hold the lock
+func (c *ActiveCache) dispatchQueued() {
+	c.dispatchMtx.Lock()
+	if c.dispatching {
+		c.dispatchMtx.Unlock()
+		return
+	}
+
+	c.dispatching = true
+	locked := true
+	defer func() {
+		// A panicking hook leaves the events left to the next dispatch
+		if !locked {
+			c.dispatchMtx.Lock()
+		}
+		c.dispatching = false
+		c.dispatchMtx.Unlock()
+	}()
+
+	for len(c.dispatchQueue) > 0 {
+		events := c.dispatchQueue
+		c.dispatchQueue = nil
+		locked = false
+		c.dispatchMtx.Unlock()
+
+		// Callbacks may have been removed by Reconfigure while the lock was held
+		dispatch(c.config.Load(), events)
+		c.dispatchMtx.Lock()
+		locked = true
+	}
+}
+
+// emit records a hook event with a copy of `key` when Hooks is set,
+//
+// and the operation in the audit log, see Config.AuditLogSize.
+//
+// Caller must hold the write lock
+func (c *ActiveCache) emit(kind hookKind, key []byte, ttl time.Duration) {
+	c.lockEvents()
+	defer c.unlockEvents()
+
+	c.audit(kind, key, ttl)
+	c.notifyPolicy(kind, key)
+	if c.config.Load().Hooks == nil {
+		return
+	}
+
+	c.events = append(c.events, hookEvent{kind: kind, key: bytes.Clone(key), ttl: ttl})
+}
+
+// emitCorruption notifies `Config.Eviction` of the removal of the entry of
+//
+// `key` whose checksum changed and records it for `Config.OnCorruption` when
+// it is set. Caller must hold the write lock
+func (c *ActiveCache) emitCorruption(key []byte, expected, actual uint32) {
+	c.lockEvents()
+	defer c.unlockEvents()
+
+	c.notifyPolicy(hookCorruption, key)
+	if c.config.Load().OnCorruption == nil {
+		return
+	}
+
+	c.events = append(c.events, hookEvent{
+		kind:     hookCorruption,
+		key:      bytes.Clone(key),
+		expected: expected,
+		actual:   actual,
+	})
+}
+
+// emitReplace records the overwrite of `old` by `value` for `Config.OnReplace`
+//
+// when it is set and `old` was live. Caller must hold the write lock
+func (c *ActiveCache) emitReplace(key []byte, old *cacheEntry, value []byte) {
+	if c.config.Load().OnReplace == nil || old.IsExpired(c.now()) || old.NotFound {
+		return
+	}
+
+	c.lockEvents()
+	defer c.unlockEvents()
+
+	c.events = append(c.events, hookEvent{
+		kind:     hookReplace,
+		key:      bytes.Clone(key),
+		oldValue: old.Bytes(),
+		value:    value,
+	})
+}
+
+// lockEvents acquires the mutex guarding recorded events when Get and Set
+//
+// may record them under different stripes, see Config.LockStripes
+func (c *ActiveCache) lockEvents() {
+	if c.stripes != nil {
+		c.eventsMtx.Lock()
+	}
+}
+
+// queueEvents moves the hook events recorded so far to the dispatch queue
+//
+// and reports whether there were any. Caller must hold the write lock or a
+// stripe, so events are queued in the order they were recorded
+func (c *ActiveCache) queueEvents() bool {
+	c.lockEvents()
+	defer c.unlockEvents()
+
+	if len(c.events) == 0 {
+		return false
+	}
+
+	c.dispatchMtx.Lock()
+	c.dispatchQueue = append(c.dispatchQueue, c.events...)
+	c.dispatchMtx.Unlock()
+	c.events = nil
+	return true
+}
+
+// unlock releases the write lock and dispatches
+//
+// the hook events recorded while it was held
+func (c *ActiveCache) unlock() {
+	queued := c.queueEvents()
+	c.unlockStripes()
+	c.mtx.Unlock()
+
+	if queued {
+		c.dispatchQueued()
+	}
+}
+
+// unlockEvents releases the mutex acquired by lockEvents
+func (c *ActiveCache) unlockEvents() {
+	if c.stripes != nil {
+		c.eventsMtx.Unlock()
+	}
+}
+
+// unlockKey releases the lock acquired by lockKey for `stripe` and dispatches
+//
+// the hook events recorded so far. With `Config.LockStripes` they may include
+// events of Get and Set still holding other stripes, dispatched in the order
+// they were recorded, see dispatchQueued
+func (c *ActiveCache) unlockKey(stripe int) {
+	if stripe < 0 {
+		c.unlock()
+		return
+	}
+
+	queued := c.queueEvents()
+	c.stripes[stripe].Unlock()
+
+	if queued {
+		c.dispatchQueued()
+	}
+}
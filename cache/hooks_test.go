@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+// recordingHooks records every hook call as a string
+type recordingHooks struct {
+	NoopHooks
+	calls []string
+}
+
+func (r *recordingHooks) OnSet(key []byte, ttl time.Duration) {
+	r.calls = append(r.calls, fmt.Sprintf("set %s %v", key, ttl))
+}
+
+func (r *recordingHooks) OnGetHit(key []byte) {
+	r.calls = append(r.calls, fmt.Sprintf("hit %s", key))
+}
+
+func (r *recordingHooks) OnGetMiss(key []byte) {
+	r.calls = append(r.calls, fmt.Sprintf("miss %s", key))
+}
+
+func (r *recordingHooks) OnDelete(key []byte) {
+	r.calls = append(r.calls, fmt.Sprintf("delete %s", key))
+}
+
+func (r *recordingHooks) OnExpire(key []byte) {
+	r.calls = append(r.calls, fmt.Sprintf("expire %s", key))
+}
+
+// missHooks only counts misses, relying on NoopHooks for the rest
+type missHooks struct {
+	NoopHooks
+	misses int
+}
+
+func (m *missHooks) OnGetMiss(key []byte) {
+	m.misses++
+}
+
+// setCountHooks only counts sets, safe for concurrent dispatches
+type setCountHooks struct {
+	NoopHooks
+	sets atomic.Int64
+}
+
+func (s *setCountHooks) OnSet(key []byte, ttl time.Duration) {
+	s.sets.Add(1)
+}
+
+// expirePanicHooks panics on expiration
+type expirePanicHooks struct {
+	NoopHooks
+}
+
+func (e *expirePanicHooks) OnExpire(key []byte) {
+	panic("expire")
+}
+
+// expireHooks sends every expired key on expired
+type expireHooks struct {
+	NoopHooks
+	expired chan []byte
+}
+
+func (h *expireHooks) OnExpire(key []byte) {
+	h.expired <- key
+}
+
+// orderedHooks records the TTLs set on every key, "k0" to "k7", and counts
+//
+// the calls made while another one is running
+type orderedHooks struct {
+	NoopHooks
+	running    atomic.Int32
+	concurrent atomic.Int32
+	ttls       [8][]time.Duration
+}
+
+func (o *orderedHooks) OnSet(key []byte, ttl time.Duration) {
+	if o.running.Add(1) > 1 {
+		o.concurrent.Add(1)
+	}
+	defer o.running.Add(-1)
+
+	time.Sleep(time.Microsecond)
+	o.ttls[key[1]-'0'] = append(o.ttls[key[1]-'0'], ttl)
+}
+
+func TestActiveCache_Hooks(t *testing.T) {
+	// Setup
+	recorder := &recordingHooks{}
+	counter := &missHooks{}
+	cache := NewActiveCacheWithConfig(&Config{
+		KeysAmountByCycle: 100,
+		Hooks:             MultiHooks{recorder, counter},
+	})
+	cache.StopCleaner()
+	key := []byte("lorem")
+
+	// Test
+	cache.Set(key, []byte("ipsum"), time.Minute)
+	key[0] = 'X' // hooks receive copies
+	cache.Get([]byte("lorem"))
+	cache.Get([]byte("john"))
+	cache.Get(nil) // nil keys are not cache operations
+	cache.Set([]byte("lorem"), nil, ExpireNow)
+	cache.Set([]byte("lorem"), nil, ExpireNow) // nothing to delete
+	cache.Set([]byte("jane"), []byte("foster"), time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	cache.performClean()
+	cache.SetPermanent([]byte("user:1"), []byte("doe"))
+	cache.DeleteByPrefix([]byte("user:"))
+
+	expected := []string{
+		"set lorem 1m0s",
+		"hit lorem",
+		"miss john",
+		"delete lorem",
+		"set jane 1ms",
+		"expire jane",
+		"set user:1 0s",
+		"delete user:1",
+	}
+
+	if !reflect.DeepEqual(expected, recorder.calls) {
+		t.Errorf("wrong hook calls. Expected %q but got %q", expected, recorder.calls)
+	}
+
+	if counter.misses != 1 {
+		t.Errorf("wrong misses on second hook. Expected 1 but got %v", counter.misses)
+	}
+}
+
+func TestActiveCache_emitReplace(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	var calls []string
+	var cache *ActiveCache
+	cache = NewActiveCacheWithConfig(&Config{
+		Clock:            clock,
+		Compress:         true,
+		CompressMinBytes: 1,
+		OnReplace: func(key, oldValue, newValue []byte) {
+			// runs without the lock, the cache is usable
+			current, _ := cache.Get(key)
+			calls = append(calls, fmt.Sprintf("%s %s->%s (%s)", key, oldValue, newValue, current))
+		},
+	})
+	cache.StopCleaner()
+
+	// Test
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Second)                               // first insert
+	cache.Set([]byte("lorem"), []byte("dolor"), time.Second)                               // overwrite
+	cache.SetKeepTTL([]byte("lorem"), []byte("sit"))                                       // overwrite keeping TTL
+	cache.SetMany([]Item{{Key: []byte("lorem"), Value: []byte("amet"), TTL: time.Second}}) // batch overwrite
+	clock.Advance(time.Minute)
+	cache.Set([]byte("lorem"), []byte("expired"), NoExpiration) // old entry expired
+	cache.SetNotFound([]byte("john"), time.Minute)
+	cache.Set([]byte("john"), []byte("doe"), NoExpiration) // old entry cached as not found
+	cache.Set([]byte("john"), nil, ExpireNow)              // delete
+
+	expected := []string{
+		"lorem ipsum->dolor (dolor)",
+		"lorem dolor->sit (sit)",
+		"lorem sit->amet (amet)",
+	}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("wrong OnReplace calls. Expected %q but got %q", expected, calls)
+	}
+}
+
+func TestActiveCache_unlock(t *testing.T) {
+	// Setup
+	var cache *ActiveCache
+	reentrant := &reentrantHooks{cache: &cache}
+	cache = NewActiveCacheWithConfig(&Config{Hooks: reentrant})
+	cache.StopCleaner()
+
+	// Test
+	done := make(chan struct{})
+	go func() {
+		cache.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hooks must be called without holding the lock")
+	}
+
+	if reentrant.value != "ipsum" {
+		t.Errorf("wrong value read from hook. Expected ipsum but got %s", reentrant.value)
+	}
+}
+
+func TestActiveCache_unlockKey(t *testing.T) {
+	// Setup
+	hooks := &orderedHooks{}
+	cache := NewActiveCacheWithConfig(&Config{LockStripes: 8, Hooks: hooks})
+	cache.StopCleaner()
+	const sets = 200
+
+	// Test
+	var wg sync.WaitGroup
+	for i := range hooks.ttls {
+		wg.Add(1)
+		go func(key []byte) {
+			defer wg.Done()
+			for ttl := 1; ttl <= sets; ttl++ {
+				cache.Set(key, []byte("ipsum"), time.Duration(ttl)*time.Minute)
+			}
+		}([]byte(fmt.Sprintf("k%v", i)))
+	}
+	wg.Wait()
+
+	if concurrent := hooks.concurrent.Load(); concurrent != 0 {
+		t.Errorf("hooks must be called one at a time but %v calls overlapped", concurrent)
+	}
+
+	for i, ttls := range hooks.ttls {
+		if len(ttls) != sets {
+			t.Fatalf("wrong amount of OnSet() calls for k%v. Expected %v but got %v", i, sets, len(ttls))
+		}
+		for j, ttl := range ttls {
+			if ttl != time.Duration(j+1)*time.Minute {
+				t.Fatalf("OnSet() calls of k%v should follow the sets order but got %v at %v", i, ttl, j)
+			}
+		}
+	}
+}
+
+// reentrantHooks reads from the cache when a key is set
+type reentrantHooks struct {
+	NoopHooks
+	cache **ActiveCache
+	value string
+}
+
+func (r *reentrantHooks) OnSet(key []byte, ttl time.Duration) {
+	value, _ := (*r.cache).Get(key)
+	r.value = string(value)
+}
@@ -12,4 +12,86 @@ type Cache interface {
 	//
 	// If the key is not present value will be set to nil.
 	Get(key []byte) (value []byte, ttl time.Duration)
+
+	// Delete removes the entry stored using `key`.
+	//
+	// Returns whether a live entry was stored.
+	Delete(key []byte) bool
+}
+
+// CacheV2 extends Cache with an explicit found flag on reads,
+//
+// so a present key with an empty value can be told apart from a miss.
+//
+// Libraries accepting Cache can feature-detect it via type assertion
+type CacheV2 interface {
+	Cache
+
+	// GetOK returns the value stored using `key` and whether it was found.
+	//
+	// If the key is not present value will be set to nil and ok to false.
+	GetOK(key []byte) (value []byte, ttl time.Duration, ok bool)
+}
+
+// BatchCache extends Cache with operations on several keys at once,
+//
+// letting implementations amortize locking over the batch.
+//
+// Libraries accepting Cache can reach it with AsBatchCache
+type BatchCache interface {
+	Cache
+
+	// GetMulti returns one BatchResult per key, at the same index as the key.
+	//
+	// Missing, expired and nil keys are reported with Found set to false.
+	GetMulti(keys [][]byte) []BatchResult
+
+	// SetMulti writes every item with Item.TTL and returns one SetResult
+	//
+	// per item, in the same order. Nil keys are reported with ErrNilKey.
+	SetMulti(items []Item) []SetResult
+
+	// DeleteMulti removes the live entries of `keys`, skipping nil keys,
+	//
+	// and returns the amount of removed entries.
+	DeleteMulti(keys [][]byte) int
+}
+
+// Admin exposes administrative operations of a cache.
+//
+// Libraries accepting Cache can reach it through wrappers with AsAdmin
+type Admin interface {
+	// Flush removes every entry.
+	Flush()
+
+	// Len returns the amount of stored entries, expired or not.
+	Len() int
+
+	// Stats returns current cache metrics.
+	Stats() Stats
+
+	// CleanNow runs a clean cycle synchronously.
+	CleanNow()
+
+	// Close stops background work. The cache must not be used afterwards.
+	Close() error
+}
+
+// ReadOnlyCache exposes the reads of a cache without any way to write,
+//
+// for components that must not mutate it. See ActiveCache.ReadOnly
+type ReadOnlyCache interface {
+	// Get returns the value stored using `key`.
+	//
+	// If the key is not present value will be set to nil.
+	Get(key []byte) (value []byte, ttl time.Duration)
+
+	// Has reports whether `key` is stored and not expired.
+	Has(key []byte) bool
+
+	// Len returns the amount of stored entries, expired or not.
+	Len() int
+
+	// Keys returns copies of every live key.
+	Keys() [][]byte
 }
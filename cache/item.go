@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"bytes"
+	"slices"
+	"time"
+)
+
+// An Item represents a copy of a cache entry with Key, Value and remaining TTL
+type Item struct {
+	// Entry key
+	Key []byte
+
+	// Entry value
+	Value []byte
+
+	// Remaining time to live when the item was read
+	//
+	// NoExpiration if the entry never expires
+	TTL time.Duration
+}
+
+// A SetResult represents the outcome of writing one Item with SetMany
+type SetResult struct {
+	// Written key
+	Key []byte
+
+	// Reason why the write was rejected, nil on success
+	Err error
+}
+
+// An EntryView represents a read-only copy of a stored entry metadata,
+//
+// given to custom clean functions instead of internal types
+type EntryView struct {
+	// Copy of the entry key
+	Key []byte
+
+	// Length of the stored value, compressed length if compressed
+	ValueLen int
+
+	// TTL the entry was written with, NoExpiration if it never expires
+	TTL time.Duration
+
+	// Expiration time, zero if the entry never expires
+	ExpiresAt time.Time
+
+	// Cache access tick of the last read or write, higher is more recent
+	LastAccess uint64
+
+	// Amount of reads that returned the value since it was written
+	Hits uint64
+}
+
+// A BatchResult represents the outcome of reading one key with GetBatch
+type BatchResult struct {
+	// Stored value, nil if not found
+	Value []byte
+
+	// Entry TTL, zero if not found
+	TTL time.Duration
+
+	// Reports whether the key was stored and not expired
+	Found bool
+}
+
+// An EntryInfo represents a copy of everything stored about a key,
+//
+// returned by ActiveCache.GetEntry
+type EntryInfo struct {
+	// Copy of the stored value, decompressed if needed
+	Value []byte
+
+	// TTL the entry was written with, NoExpiration if it never expires
+	TTL time.Duration
+
+	// TTL left when GetEntry was called, NoExpiration if it never expires
+	RemainingTTL time.Duration
+
+	// Time the value was written
+	CreatedAt time.Time
+
+	// Time of the last read or write of the entry
+	LastAccessAt time.Time
+
+	// Expiration time, zero if the entry never expires
+	ExpiresAt time.Time
+
+	// Amount of writes of the key since it was stored, starting at 1
+	Version uint64
+
+	// Amount of reads that returned the value since it was written
+	Hits uint64
+
+	// Reports whether eviction skips the entry, see WithPinned
+	Pinned bool
+}
+
+// sortByKey sorts `s` in place by the bytes returned by `key`, lexicographically
+//
+// like bytes.Compare, for the sorted variants of scan-style methods
+func sortByKey[T any](s []T, key func(T) []byte) {
+	slices.SortFunc(s, func(a, b T) int {
+		return bytes.Compare(key(a), key(b))
+	})
+}
@@ -0,0 +1,148 @@
+package cache
+
+import "time"
+
+// A MultiCache fans writes out to several Cache instances for redundancy
+//
+// and reads from the first one holding the key.
+//
+// Writes are not atomic across caches: each cache is written in order, so a
+// concurrent Get may see the new value on some caches and the old one on
+// others, and caches evicting or expiring entries on their own diverge over time
+type MultiCache struct {
+	// Caches in read order
+	caches []CacheV2
+
+	// BackFill writes a value found on a later cache into the earlier caches
+	//
+	// that missed it, with the TTL returned by the hit. Enabled by NewMultiCache
+	BackFill bool
+}
+
+var _ CacheV2 = (*MultiCache)(nil)
+
+var _ Admin = (*MultiCache)(nil)
+
+// NewMultiCache returns a MultiCache pointer instance writing to every cache
+//
+// of `caches` and reading them in order, with BackFill enabled.
+//
+// Caches not implementing CacheV2 are wrapped with AsCacheV2
+func NewMultiCache(caches ...Cache) Cache {
+	multi := &MultiCache{
+		caches:   make([]CacheV2, len(caches)),
+		BackFill: true,
+	}
+	for i, c := range caches {
+		multi.caches[i] = AsCacheV2(c)
+	}
+
+	return multi
+}
+
+// admin returns the caches as an adminGroup
+func (m *MultiCache) admin() adminGroup {
+	group := make(adminGroup, len(m.caches))
+	for i, c := range m.caches {
+		group[i] = c
+	}
+
+	return group
+}
+
+// CleanNow runs a clean cycle of every cache, found with AsAdmin, implementing Admin
+func (m *MultiCache) CleanNow() {
+	m.admin().CleanNow()
+}
+
+// Close closes every cache, found with AsAdmin, implementing Admin.
+//
+// Returns the errors of the caches joined
+func (m *MultiCache) Close() error {
+	return m.admin().Close()
+}
+
+// Delete removes `key` from every cache, in order,
+//
+// and reports whether any of them stored it
+func (m *MultiCache) Delete(key []byte) bool {
+	if key == nil {
+		return false
+	}
+
+	var deleted bool
+	for _, c := range m.caches {
+		if c.Delete(key) {
+			deleted = true
+		}
+	}
+
+	return deleted
+}
+
+// Flush removes every entry of every cache, found with AsAdmin, implementing Admin
+func (m *MultiCache) Flush() {
+	m.admin().Flush()
+}
+
+// Get returns Value and TTL from the first cache holding `key`.
+//
+// If key is nil OR does not exist on any cache returns (nil, 0)
+func (m *MultiCache) Get(key []byte) ([]byte, time.Duration) {
+	value, ttl, _ := m.GetOK(key)
+	return value, ttl
+}
+
+// GetOK returns Value and TTL from the first cache holding `key`
+//
+// and whether it was found, back-filling earlier caches if BackFill is set
+func (m *MultiCache) GetOK(key []byte) ([]byte, time.Duration, bool) {
+	if key == nil {
+		return nil, 0, false
+	}
+
+	for i, c := range m.caches {
+		value, ttl, ok := c.GetOK(key)
+		if !ok {
+			continue
+		}
+
+		if m.BackFill {
+			for _, missed := range m.caches[:i] {
+				missed.Set(key, value, ttl)
+			}
+		}
+
+		return value, ttl, true
+	}
+
+	return nil, 0, false
+}
+
+// Len returns the sum of the amount of entries stored by every cache,
+//
+// found with AsAdmin, implementing Admin. Keys stored by several caches are
+// counted once per cache
+func (m *MultiCache) Len() int {
+	return m.admin().Len()
+}
+
+// Set sets Value for specified Key with TTL on every cache, in order.
+//
+// A negative TTL removes the key from every cache
+func (m *MultiCache) Set(key, value []byte, ttl time.Duration) {
+	if key == nil {
+		return
+	}
+
+	for _, c := range m.caches {
+		c.Set(key, value, ttl)
+	}
+}
+
+// Stats returns the sum of the metrics of every cache, found with AsAdmin,
+//
+// implementing Admin
+func (m *MultiCache) Stats() Stats {
+	return m.admin().Stats()
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMultiCache_Admin(t *testing.T) {
+	// Setup
+	first := NewActiveCache()
+	first.StopCleaner()
+	second := NewActiveCache()
+	second.StopCleaner()
+	first.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	second.SetPermanent([]byte("john"), []byte("doe"))
+	second.SetPermanent([]byte("jane"), []byte("doe"))
+
+	// the cache without Admin operations is skipped
+	multi := NewMultiCache(first, AsCacheV2(second), struct{ Cache }{NewActiveCache()})
+
+	// Test
+	admin, ok := AsAdmin(AsBatchCache(multi))
+	if !ok || admin != multi.(Admin) {
+		t.Fatalf("wrong value for AsAdmin() through the adapter. Expected %p but got %v", multi, admin)
+	}
+
+	if admin.Len() != 3 {
+		t.Errorf("wrong value for Admin.Len(). Expected 3 but got %v", admin.Len())
+	}
+
+	multi.Get([]byte("jane"))
+	if stats := admin.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("wrong value for Admin.Stats(). Expected 1 hit and 1 miss but got %+v", stats)
+	}
+
+	admin.Flush()
+	if first.Len() != 0 || second.Len() != 0 {
+		t.Errorf("Admin.Flush() should empty every cache but got %v and %v entries", first.Len(), second.Len())
+	}
+
+	if err := admin.Close(); err != nil {
+		t.Errorf("wrong value for Admin.Close(). Expected nil but got %v", err)
+	}
+}
+
+func TestMultiCache_Delete(t *testing.T) {
+	// Setup
+	first := NewActiveCache()
+	first.StopCleaner()
+	second := NewActiveCache()
+	second.StopCleaner()
+	multi := NewMultiCache(first, second)
+	second.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test
+	if !multi.Delete([]byte("lorem")) || second.Len() != 0 {
+		t.Errorf("Delete(lorem) should remove the key stored on any cache but got %v entries", second.Len())
+	}
+
+	if multi.Delete([]byte("lorem")) || multi.Delete(nil) {
+		t.Errorf("wrong value for Delete() of a missing key. Expected false but got true")
+	}
+}
+
+func TestMultiCache_Get(t *testing.T) {
+	// Setup
+	first := NewActiveCache()
+	first.StopCleaner()
+	second := NewActiveCache()
+	second.StopCleaner()
+	second.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	multi := NewMultiCache(first, second)
+
+	// Test
+	if val, ttl := multi.Get([]byte("lorem")); string(val) != "ipsum" || ttl != time.Minute {
+		t.Errorf("wrong value for Get(lorem) on second cache hit. Expected (ipsum, 1m) but got (%s, %v)", val, ttl)
+	}
+
+	if val, _ := first.Get([]byte("lorem")); string(val) != "ipsum" {
+		t.Errorf("first cache should be back-filled after a second cache hit but got %s", val)
+	}
+
+	if val, ttl := multi.Get([]byte("nonexistent key")); val != nil || ttl != 0 {
+		t.Errorf("wrong value for Get(nonexistent key). Expected (nil, 0) but got (%s, %v)", val, ttl)
+	}
+
+	if val, ttl := multi.Get(nil); val != nil || ttl != 0 {
+		t.Errorf("wrong value for Get(nil). Expected (nil, 0) but got (%s, %v)", val, ttl)
+	}
+
+	// Without BackFill misses are left alone
+	multi.(*MultiCache).BackFill = false
+	second.Set([]byte("john"), []byte("doe"), time.Minute)
+	if val, _ := multi.Get([]byte("john")); string(val) != "doe" {
+		t.Errorf("wrong value for Get(john) without BackFill. Expected doe but got %s", val)
+	}
+
+	if val, _ := first.Get([]byte("john")); val != nil {
+		t.Errorf("first cache should not be back-filled without BackFill but got %s", val)
+	}
+
+	// The first cache holding the key wins
+	first.Set([]byte("john"), []byte("smith"), time.Minute)
+	if val, _ := multi.Get([]byte("john")); string(val) != "smith" {
+		t.Errorf("wrong value for Get(john) on diverging caches. Expected smith but got %s", val)
+	}
+}
+
+func TestMultiCache_GetOK(t *testing.T) {
+	// Setup
+	first := NewActiveCache()
+	first.StopCleaner()
+	second := NewActiveCache()
+	second.StopCleaner()
+	second.SetPermanent([]byte("empty"), []byte{})
+	multi := NewMultiCache(first, second).(*MultiCache)
+
+	// Test
+	if val, _, ok := multi.GetOK([]byte("empty")); !ok || len(val) != 0 {
+		t.Errorf("wrong value for GetOK(empty). Expected (empty, true) but got (%q, %v)", val, ok)
+	}
+
+	if _, _, ok := first.GetOK([]byte("empty")); !ok {
+		t.Errorf("first cache should be back-filled with an empty value")
+	}
+
+	if _, _, ok := multi.GetOK([]byte("nonexistent key")); ok {
+		t.Errorf("wrong value for GetOK(nonexistent key). Expected false but got true")
+	}
+}
+
+func TestMultiCache_Set(t *testing.T) {
+	// Setup
+	first := NewActiveCache()
+	first.StopCleaner()
+	second := NewActiveCache()
+	second.StopCleaner()
+	multi := NewMultiCache(first, second)
+
+	// Test
+	multi.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+	for i, c := range []*ActiveCache{first, second} {
+		if val, ttl := c.Get([]byte("lorem")); string(val) != "ipsum" || ttl != time.Second {
+			t.Errorf("wrong value on cache %v after Set(). Expected (ipsum, 1s) but got (%s, %v)", i, val, ttl)
+		}
+	}
+
+	multi.Set([]byte("lorem"), nil, ExpireNow)
+	if first.Len() != 0 || second.Len() != 0 {
+		t.Errorf("negative TTL should remove the key from every cache but got %v and %v entries", first.Len(), second.Len())
+	}
+
+	multi.Set(nil, []byte("doe"), time.Second)
+	if first.Len() != 0 || second.Len() != 0 {
+		t.Error("Set() with nil key should not write to any cache")
+	}
+}
@@ -0,0 +1,131 @@
+package cache
+
+import "time"
+
+// An OpType represents the kind of a remote operation, see Op
+type OpType int
+
+const (
+	// OpSet writes Op.Value with Op.TTL like Set
+	OpSet OpType = iota
+
+	// OpDelete removes Op.Key
+	OpDelete
+
+	// OpFlush removes every entry written at or before Op.Timestamp
+	OpFlush
+)
+
+// An Op represents a cache mutation produced by another instance,
+//
+// applied with ActiveCache.ApplyOp to keep several caches consistent
+type Op struct {
+	// Kind of the operation
+	Type OpType
+
+	// Written or removed key, unused by OpFlush
+	Key []byte
+
+	// Written value, only used by OpSet
+	Value []byte
+
+	// TTL to write with, counted from when the operation is applied. Only used by OpSet
+	TTL time.Duration
+
+	// Time the operation happened at its origin, deciding conflicts.
+	//
+	// Zero means the time it is applied
+	Timestamp time.Time
+}
+
+// ApplyOp applies an operation produced by another instance, resolving
+//
+// conflicts by last writer wins: an OpSet or OpDelete older than the live entry
+// stored for its key is skipped with ErrStaleOp. The entry stores Op.Timestamp
+// as its write time, so later operations are compared to it.
+//
+// Deletes are only remembered while `Config.TombstoneTTL` keeps them as
+// tombstones, without it an older OpSet arriving after an OpDelete is applied.
+//
+// Hooks are called like for local writes. Nothing is written to
+// `Config.Backing`, the origin already did. Returns ErrInvalidOp for an
+// unknown type and the errors of SetE for rejected writes
+func (c *ActiveCache) ApplyOp(op Op) error {
+	c.lock("set")
+	defer c.unlock()
+
+	return c.applyOp(op)
+}
+
+// applyOp applies `op` like ApplyOp. Caller must hold the write lock
+func (c *ActiveCache) applyOp(op Op) error {
+	if c.State() == Closed {
+		return ErrClosed
+	}
+
+	at := op.Timestamp
+	if at.IsZero() {
+		at = c.now()
+	}
+
+	ttl := op.TTL
+	switch op.Type {
+	case OpFlush:
+		c.flushUntil(at)
+		return nil
+	case OpDelete:
+		ttl = ExpireNow
+	case OpSet:
+	default:
+		return ErrInvalidOp
+	}
+
+	if err := c.validateEntry(op.Key, op.Value, ttl); err != nil {
+		return err
+	}
+
+	// Ties go to the operation, so replaying the same stream converges
+	if old, ok := c.entries.Get(op.Key); ok && !old.IsExpired(c.now()) && old.CreatedAt > at.UnixNano() {
+		return ErrStaleOp
+	}
+
+	return c.setEntry(op.Key, op.Value, ttl, setOptions{writtenAt: at})
+}
+
+// ApplyOps applies `ops` in order like ApplyOp under a single write lock
+//
+// and returns one error per operation, nil when it was applied
+func (c *ActiveCache) ApplyOps(ops []Op) []error {
+	errs := make([]error, len(ops))
+
+	c.lock("set")
+	defer c.unlock()
+
+	for i, op := range ops {
+		errs[i] = c.applyOp(op)
+	}
+
+	return errs
+}
+
+// flushUntil removes every entry written at or before `at`, reporting
+//
+// live ones to Hooks as deleted. Caller must hold the write lock
+func (c *ActiveCache) flushUntil(at time.Time) {
+	// Collect victims first, the hashmap must not change while ranging
+	var victims [][]byte
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if entry.CreatedAt <= at.UnixNano() {
+			victims = append(victims, key)
+		}
+		return true
+	})
+
+	for _, key := range victims {
+		entry, _ := c.entries.Get(key)
+		c.delete(key)
+		if !entry.Tombstone {
+			c.emit(hookDelete, key, 0)
+		}
+	}
+}
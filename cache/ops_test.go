@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+func TestActiveCache_ApplyOp(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	hooks := &recordingHooks{}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Hooks: hooks, TombstoneTTL: time.Minute})
+	cache.StopCleaner()
+	defer cache.Close()
+
+	past := clock.Now().Add(-time.Second)
+	cache.SetPermanent([]byte("lorem"), []byte("local"))
+
+	// Test an older remote Set does not overwrite a newer local one
+	if err := cache.ApplyOp(Op{Type: OpSet, Key: []byte("lorem"), Value: []byte("remote"), Timestamp: past}); err != ErrStaleOp {
+		t.Errorf("wrong value for ApplyOp() of an older Set. Expected %v but got %v", ErrStaleOp, err)
+	}
+
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "local" {
+		t.Errorf("wrong value for Get() after an older remote Set. Expected local but got %s", value)
+	}
+
+	// Test a newer remote Set wins and keeps its write time
+	remoteAt := clock.Now().Add(time.Second)
+	if err := cache.ApplyOp(Op{Type: OpSet, Key: []byte("lorem"), Value: []byte("remote"), TTL: time.Minute, Timestamp: remoteAt}); err != nil {
+		t.Errorf("wrong value for ApplyOp() of a newer Set. Expected nil but got %v", err)
+	}
+
+	if value, ttl := cache.Get([]byte("lorem")); string(value) != "remote" || ttl != time.Minute {
+		t.Errorf("wrong value for Get() after a newer remote Set. Expected (remote, 1m) but got (%s, %v)", value, ttl)
+	}
+
+	if err := cache.ApplyOp(Op{Type: OpSet, Key: []byte("lorem"), Value: []byte("late"), Timestamp: clock.Now()}); err != ErrStaleOp {
+		t.Errorf("wrong value for ApplyOp() older than the remote write time. Expected %v but got %v", ErrStaleOp, err)
+	}
+
+	// Test a remote Delete beats an older Set, even one arriving later
+	deleteAt := remoteAt.Add(time.Second)
+	if err := cache.ApplyOp(Op{Type: OpDelete, Key: []byte("lorem"), Timestamp: deleteAt}); err != nil {
+		t.Errorf("wrong value for ApplyOp() of a newer Delete. Expected nil but got %v", err)
+	}
+
+	if err := cache.ApplyOp(Op{Type: OpSet, Key: []byte("lorem"), Value: []byte("stale"), Timestamp: remoteAt}); err != ErrStaleOp {
+		t.Errorf("wrong value for ApplyOp() of a Set older than a Delete. Expected %v but got %v", ErrStaleOp, err)
+	}
+
+	if _, _, err := cache.GetE([]byte("lorem")); err != ErrKeyDeleted {
+		t.Errorf("wrong value for GetE() after a remote Delete. Expected %v but got %v", ErrKeyDeleted, err)
+	}
+
+	// Test invalid operations
+	if err := cache.ApplyOp(Op{Type: OpType(42), Key: []byte("lorem")}); err != ErrInvalidOp {
+		t.Errorf("wrong value for ApplyOp() of an unknown type. Expected %v but got %v", ErrInvalidOp, err)
+	}
+
+	if err := cache.ApplyOp(Op{Type: OpSet, Value: []byte("value")}); err != ErrNilKey {
+		t.Errorf("wrong value for ApplyOp() with nil key. Expected %v but got %v", ErrNilKey, err)
+	}
+
+	expected := []string{"set lorem 0s", "hit lorem", "set lorem 1m0s", "hit lorem", "delete lorem", "miss lorem"}
+	if fmt.Sprint(hooks.calls) != fmt.Sprint(expected) {
+		t.Errorf("wrong value for hooks of ApplyOp(). Expected %v but got %v", expected, hooks.calls)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_ApplyOps(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	defer cache.Close()
+
+	start := clock.Now()
+	cache.SetPermanent([]byte("old"), []byte("value"))
+	clock.Advance(time.Minute)
+	cache.SetPermanent([]byte("new"), []byte("value"))
+
+	// Test operations apply in order, the flush only removes older writes
+	errs := cache.ApplyOps([]Op{
+		{Type: OpSet, Key: []byte("john"), Value: []byte("doe"), Timestamp: start},
+		{Type: OpFlush, Timestamp: start.Add(time.Second)},
+		{Type: OpSet, Key: []byte("jane"), Value: []byte("foster")},
+		{Type: OpSet, Key: []byte("new"), Value: []byte("stale"), Timestamp: start},
+	})
+
+	expected := []error{nil, nil, nil, ErrStaleOp}
+	if fmt.Sprint(errs) != fmt.Sprint(expected) {
+		t.Errorf("wrong value for ApplyOps(). Expected %v but got %v", expected, errs)
+	}
+
+	for key, stored := range map[string]bool{"old": false, "john": false, "new": true, "jane": true} {
+		if cache.Has([]byte(key)) != stored {
+			t.Errorf("wrong value for Has(%s) after ApplyOps(). Expected %v but got %v", key, stored, !stored)
+		}
+	}
+
+	assertInvariants(t, cache)
+}
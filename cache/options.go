@@ -0,0 +1,61 @@
+package cache
+
+import "time"
+
+// A SetOption configures a single write made with SetWithOptions
+type SetOption func(*setOptions)
+
+// setOptions holds the settings of a single write
+type setOptions struct {
+	// Cost charged against Config.MaxCostBytes, see WithCost
+	cost int64
+
+	// Caches the absence of a value, see SetNotFound
+	notFound bool
+
+	// Excludes the entry from eviction, see WithPinned
+	pinned bool
+
+	// Skips writes leaving the live entry unchanged, see WithSkipIfEqual
+	skipIfEqual bool
+
+	// Write time stored instead of now when set, see ApplyOp
+	writtenAt time.Time
+}
+
+// WithCost charges `cost` against `Config.MaxCostBytes` for the written entry
+//
+// instead of its approximate memory usage, see ActiveCache.SetWithCost.
+// A cost less than or equal to zero charges the default
+func WithCost(cost int64) SetOption {
+	return func(o *setOptions) {
+		o.cost = max(cost, 0)
+	}
+}
+
+// WithPinned pins the written entry, so eviction never removes it to make
+//
+// room for other keys. Pinned entries still expire by TTL.
+//
+// Use ActiveCache.Unpin to release it
+func WithPinned() SetOption {
+	return func(o *setOptions) {
+		o.pinned = true
+	}
+}
+
+// WithSkipIfEqual skips the write when the key holds a live entry with the
+//
+// same value, written with the same TTL and cost, and pinned if the write pins it.
+//
+// A skipped write leaves the entry untouched, so its expiration is not
+// refreshed like with ActiveCache.SetKeepTTL, and calls no Hooks nor
+// `Config.Backing`. Skipped writes are counted by Stats.SkippedWrites.
+//
+// Values are compared byte by byte after their lengths, decompressing the
+// stored one with `Config.Compress`
+func WithSkipIfEqual() SetOption {
+	return func(o *setOptions) {
+		o.skipIfEqual = true
+	}
+}
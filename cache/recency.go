@@ -0,0 +1,65 @@
+package cache
+
+// A recencyList links the entries of a stripe from the least to the most
+//
+// recently accessed, so evictLRU finds its victim at the oldest end instead
+// of visiting every entry. Entries are linked through their Key, Older and
+// Newer fields. It is guarded by the lock of its stripe
+type recencyList struct {
+	// Least recently accessed entry, nil if empty
+	oldest *cacheEntry
+
+	// Most recently accessed entry, nil if empty
+	newest *cacheEntry
+}
+
+// link adds the unlinked `entry` stored with `key` at the newest end
+func (l *recencyList) link(key []byte, entry *cacheEntry) {
+	entry.Key, entry.Older, entry.Newer = key, l.newest, nil
+	if l.newest != nil {
+		l.newest.Newer = entry
+	} else {
+		l.oldest = entry
+	}
+	l.newest = entry
+}
+
+// linkOldest adds the unlinked `entry` stored with `key` at the oldest end,
+//
+// for entries never accessed such as tombstones
+func (l *recencyList) linkOldest(key []byte, entry *cacheEntry) {
+	entry.Key, entry.Older, entry.Newer = key, nil, l.oldest
+	if l.oldest != nil {
+		l.oldest.Older = entry
+	} else {
+		l.newest = entry
+	}
+	l.oldest = entry
+}
+
+// moveNewest moves the linked `entry` to the newest end
+func (l *recencyList) moveNewest(entry *cacheEntry) {
+	if l.newest == entry {
+		return
+	}
+
+	key := entry.Key
+	l.unlink(entry)
+	l.link(key, entry)
+}
+
+// unlink removes the linked `entry`
+func (l *recencyList) unlink(entry *cacheEntry) {
+	if entry.Older != nil {
+		entry.Older.Newer = entry.Newer
+	} else {
+		l.oldest = entry.Newer
+	}
+
+	if entry.Newer != nil {
+		entry.Newer.Older = entry.Older
+	} else {
+		l.newest = entry.Older
+	}
+	entry.Key, entry.Older, entry.Newer = nil, nil, nil
+}
@@ -0,0 +1,51 @@
+package cache
+
+import "time"
+
+// A Scheduler decides when the cleaner runs its cycles, see Config.Scheduler
+type Scheduler interface {
+	// Next returns a channel receiving once the next clean cycle is due.
+	//
+	// `interval` is the one the cleaner would wait for, from CleanerInterval
+	// and its backoff, which schedulers may follow or ignore. The cleaner
+	// calls it when it starts, after each cycle and on Reconfigure, the
+	// channel returned last replacing the previous ones
+	Next(interval time.Duration) <-chan time.Time
+
+	// Stop is called once the cleaner stops. The cleaner calls Next again
+	// if it is restarted with the same scheduler
+	Stop()
+}
+
+// An intervalScheduler is the Scheduler of the cleaner while
+//
+// `Config.Scheduler` is nil, due once the interval given to Next elapsed
+type intervalScheduler struct {
+	// Timer of the next cycle, nil until the first Next call
+	timer *time.Timer
+}
+
+// Next returns the channel of the timer reset to fire after `interval`
+func (s *intervalScheduler) Next(interval time.Duration) <-chan time.Time {
+	if s.timer == nil {
+		s.timer = time.NewTimer(interval)
+		return s.timer.C
+	}
+
+	if !s.timer.Stop() {
+		select {
+		case <-s.timer.C:
+		default:
+		}
+	}
+
+	s.timer.Reset(interval)
+	return s.timer.C
+}
+
+// Stop stops the timer
+func (s *intervalScheduler) Stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
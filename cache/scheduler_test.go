@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+)
+
+// stopCountingScheduler counts the Stop calls of a ManualScheduler
+type stopCountingScheduler struct {
+	*cachetest.ManualScheduler
+	stops atomic.Int32
+}
+
+func (s *stopCountingScheduler) Stop() {
+	s.stops.Add(1)
+	s.ManualScheduler.Stop()
+}
+
+func TestActiveCache_runCleaner(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	sched := &stopCountingScheduler{ManualScheduler: cachetest.NewManualScheduler()}
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock, Scheduler: sched, KeysAmountByCycle: MinKeysAmountByCycle})
+	defer cache.Close()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+
+	// Test cycles only run on ticks, whatever the clock says
+	clock.Advance(time.Hour)
+	if health := cache.Health(); health.Stalled || cache.Len() != 2 {
+		t.Errorf("cleaner should wait for the scheduler and not be stalled but got %v entries, %+v", cache.Len(), health)
+	}
+
+	sched.Tick()
+	if cache.Len() != 1 || cache.Health().SinceLastClean != 0 {
+		t.Errorf("wrong value for Len() after a tick. Expected 1 but got %v", cache.Len())
+	}
+
+	// Test the scheduler is stopped with the cleaner and reused once restarted
+	cache.StopCleaner()
+	if sched.stops.Load() != 1 {
+		t.Errorf("wrong value for Scheduler.Stop() calls. Expected 1 but got %v", sched.stops.Load())
+	}
+
+	cache.StartCleaner()
+	cache.Set([]byte("jane"), []byte("foster"), time.Second)
+	clock.Advance(time.Minute)
+	sched.Tick()
+	if cache.Len() != 1 {
+		t.Errorf("wrong value for Len() after a tick of the restarted cleaner. Expected 1 but got %v", cache.Len())
+	}
+
+	// Test the backoff and Reconfigure apply to the scheduler
+	base := time.Millisecond * MinCleanerInterval
+	cache.Reconfigure(&Config{
+		Clock:                clock,
+		Scheduler:            sched,
+		CleanerInterval:      MinCleanerInterval,
+		CleanerBackoffMax:    MinCleanerInterval * 4,
+		CleanerBackoffCycles: 1,
+		CleanerBackoffFactor: 2,
+	})
+	for _, e := range []time.Duration{base * 2, base * 4, base * 4} {
+		sched.Tick()
+		if interval := sched.Interval(); interval != e {
+			t.Errorf("wrong clean interval after an idle tick. Expected %v but got %v", e, interval)
+		}
+	}
+
+	cache.Reconfigure(&Config{Clock: clock})
+	cache.StopCleaner()
+	if sched.stops.Load() != 2 {
+		t.Errorf("wrong value for Scheduler.Stop() calls after Reconfigure() without it. Expected 2 but got %v", sched.stops.Load())
+	}
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
+)
+
+// A CacheSnapshot represents an immutable point-in-time view of an ActiveCache,
+//
+// see ActiveCache.Snapshot. It is safe for concurrent use
+type CacheSnapshot struct {
+	// Copies of the live entries at snapshot time by key
+	entries *hashmap.StripedHashMap[*cacheEntry]
+
+	// Mutex serializing lookups, which update the hash state of entries
+	mtx sync.Mutex
+
+	// Snapshot time in unix nanoseconds
+	takenAt int64
+}
+
+// ForEach calls `fn` for each entry of the snapshot until `fn` returns false.
+//
+// `ttl` is the remaining TTL at snapshot time. Iteration order is unspecified
+func (s *CacheSnapshot) ForEach(fn func(key, value []byte, ttl time.Duration) bool) {
+	s.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		return fn(key, entry.Bytes(), s.remainingTTL(entry))
+	})
+}
+
+// ForEachSorted calls `fn` for each entry of the snapshot like ForEach,
+//
+// ordered by key bytes
+func (s *CacheSnapshot) ForEachSorted(fn func(key, value []byte, ttl time.Duration) bool) {
+	type keyed struct {
+		key   []byte
+		entry *cacheEntry
+	}
+
+	entries := make([]keyed, 0, s.entries.Len())
+	s.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		entries = append(entries, keyed{key: key, entry: entry})
+		return true
+	})
+	sortByKey(entries, func(e keyed) []byte { return e.key })
+
+	for _, e := range entries {
+		if !fn(e.key, e.entry.Bytes(), s.remainingTTL(e.entry)) {
+			return
+		}
+	}
+}
+
+// Get returns Value and the remaining TTL at snapshot time of `key`,
+//
+// and whether it was live when the snapshot was taken
+func (s *CacheSnapshot) Get(key []byte) ([]byte, time.Duration, bool) {
+	s.mtx.Lock()
+	entry, ok := s.entries.Get(key)
+	s.mtx.Unlock()
+	if !ok {
+		return nil, 0, false
+	}
+
+	return entry.Bytes(), s.remainingTTL(entry), true
+}
+
+// Len returns the amount of entries in the snapshot
+func (s *CacheSnapshot) Len() int {
+	return s.entries.Len()
+}
+
+// remainingTTL returns the time `entry` had left when the snapshot was taken
+//
+// returns NoExpiration if the entry never expires
+func (s *CacheSnapshot) remainingTTL(entry *cacheEntry) time.Duration {
+	if entry.ExpiresAt == NoExpiration {
+		return NoExpiration
+	}
+
+	return time.Duration(entry.ExpiresAt - s.takenAt)
+}
+
+// TakenAt returns the time the snapshot was taken
+func (s *CacheSnapshot) TakenAt() time.Time {
+	return time.Unix(0, s.takenAt)
+}
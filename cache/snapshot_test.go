@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheSnapshot_ForEach(t *testing.T) {
+	// Setup
+	compressible := []byte(strings.Repeat("lorem ipsum dolor sit amet ", 100))
+	cache := NewActiveCacheWithConfig(&Config{Compress: true})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), compressible)
+	cache.Set([]byte("john"), []byte("doe"), time.Minute)
+	snapshot := cache.Snapshot()
+
+	// Test
+	var keys []string
+	snapshot.ForEach(func(key, value []byte, ttl time.Duration) bool {
+		keys = append(keys, string(key))
+		if string(key) == "lorem" && (!bytes.Equal(value, compressible) || ttl != NoExpiration) {
+			t.Errorf("wrong value visited by ForEach() for lorem. Expected %v bytes and 0 but got %v bytes and %v", len(compressible), len(value), ttl)
+		}
+		return true
+	})
+
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "john,lorem" {
+		t.Errorf("wrong keys visited by ForEach(). Expected john,lorem but got %v", keys)
+	}
+
+	var calls int
+	snapshot.ForEach(func(key, value []byte, ttl time.Duration) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("ForEach() should stop when fn returns false. Expected 1 call but got %v", calls)
+	}
+}
+
+func TestCacheSnapshot_ForEachSorted(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	for _, key := range []string{"lorem", "john", "jane", "ipsum"} {
+		cache.SetPermanent([]byte(key), []byte("value"))
+	}
+	snapshot := cache.Snapshot()
+
+	// Test
+	var keys []string
+	snapshot.ForEachSorted(func(key, value []byte, ttl time.Duration) bool {
+		keys = append(keys, string(key))
+		return len(keys) < 3
+	})
+
+	if strings.Join(keys, ",") != "ipsum,jane,john" {
+		t.Errorf("wrong keys visited by ForEachSorted(). Expected ipsum,jane,john but got %v", keys)
+	}
+}
+
+func TestCacheSnapshot_isolated(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{TombstoneTTL: time.Minute})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.Delete([]byte("john"))
+	cache.SetNotFound([]byte("jane"), time.Minute)
+	snapshot := cache.Snapshot()
+
+	// Test tombstones and negative cached keys are left out
+	if snapshot.Len() != 1 {
+		t.Errorf("wrong value for Len(). Expected 1 but got %v", snapshot.Len())
+	}
+
+	// Test later reads and TTL changes are not seen by the snapshot
+	cache.Get([]byte("lorem"))
+	cache.Pin([]byte("lorem"))
+	cache.RemapTTL(func(time.Duration) time.Duration { return time.Hour })
+
+	entry, ok := snapshot.entries.Get([]byte("lorem"))
+	if !ok || entry.Hits != 0 || entry.Pinned || entry.Ttl != time.Minute || entry.Key != nil {
+		t.Errorf("snapshot entries should be copies taken at snapshot time but got %+v", entry)
+	}
+
+	if _, ttl, _ := snapshot.Get([]byte("lorem")); ttl > time.Minute {
+		t.Errorf("wrong value for Get(lorem) after RemapTTL(). Expected at most 1m but got %v", ttl)
+	}
+}
+
+func TestCacheSnapshot_concurrent(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{LockStripes: 4})
+	cache.StopCleaner()
+	keys := [][]byte{[]byte("lorem"), []byte("john"), []byte("jane"), []byte("ipsum")}
+	for _, key := range keys {
+		cache.SetPermanent(key, []byte("value"))
+	}
+	snapshot := cache.Snapshot()
+
+	// Test snapshot reads never race with stripe readers and writers
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := keys[i%len(keys)]
+				cache.Get(key)
+				cache.Set(key, []byte("changed"), time.Minute)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if value, ttl, ok := snapshot.Get(keys[i%len(keys)]); !ok || string(value) != "value" || ttl != NoExpiration {
+					t.Errorf("wrong value for snapshot Get(). Expected (value, 0, true) but got (%s, %v, %v)", value, ttl, ok)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCacheSnapshot_TakenAt(t *testing.T) {
+	// Setup
+	before := time.Now()
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	snapshot := cache.Snapshot()
+
+	// Test
+	if taken := snapshot.TakenAt(); taken.Before(before) || taken.After(time.Now()) {
+		t.Errorf("wrong value for TakenAt(). Expected between %v and now but got %v", before, taken)
+	}
+}
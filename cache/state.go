@@ -0,0 +1,54 @@
+package cache
+
+import "strconv"
+
+// A CacheState represents the lifecycle state of an ActiveCache, see ActiveCache.State
+type CacheState int32
+
+const (
+	// Running is the state of a usable cache with its cleaner started
+	Running CacheState = iota
+
+	// CleanerStopped is the state of a usable cache after StopCleaner.
+	//
+	// Reads hide expired entries but never remove them, so they keep their
+	// memory until overwritten, deleted or removed by CleanNow or a restarted
+	// cleaner
+	CleanerStopped
+
+	// Closed is the final state after Close. Get misses every key and
+	//
+	// writes are dropped, SetE returns ErrClosed
+	Closed
+)
+
+// String returns the state name
+func (s CacheState) String() string {
+	switch s {
+	case Running:
+		return "Running"
+	case CleanerStopped:
+		return "CleanerStopped"
+	case Closed:
+		return "Closed"
+	default:
+		return "CacheState(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// An EntryState represents the outcome of looking a key up, see ActiveCache.GetWithState
+type EntryState int
+
+const (
+	// Missing reports that no live entry is stored for the key
+	Missing EntryState = iota
+
+	// Present reports that a value is stored for the key
+	Present
+
+	// NegativeCached reports that the key is cached as not found, see ActiveCache.SetNotFound
+	NegativeCached
+
+	// Deleted reports that the key was deleted and is kept as a tombstone, see Config.TombstoneTTL
+	Deleted
+)
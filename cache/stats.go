@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"sort"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
+)
+
+// A Stats represents a point-in-time view of cache metrics
+type Stats struct {
+	// Approximate memory used by entries in bytes
+	MemoryUsage int64
+
+	// Amount of writes refused by Config.DetectCollisions
+	Collisions int64
+
+	// Amount of Get calls that found a live value
+	Hits int64
+
+	// Amount of Get calls that found no live value, including expired keys,
+	// keys cached by SetNotFound and tombstones
+	Misses int64
+
+	// Amount of SetAsync writes dropped on a full queue, see Config.AsyncDropWhenFull
+	AsyncDropped int64
+
+	// Amount of writes skipped by WithSkipIfEqual as they changed nothing
+	SkippedWrites int64
+
+	// Amount of entries removed by Config.VerifyChecksums as their value was modified
+	Corruptions int64
+
+	// Amount of Config.ExpiryWarning warnings dropped on a full ExpiringSoon buffer
+	ExpiryWarningsDropped int64
+
+	// Amount of writes refused by Config.MaxCostBytes
+	CostRejections int64
+}
+
+// add returns the sum of every metric of `s` and `other`,
+//
+// aggregating the caches of a wrapper, see adminGroup
+func (s Stats) add(other Stats) Stats {
+	return Stats{
+		MemoryUsage:           s.MemoryUsage + other.MemoryUsage,
+		Collisions:            s.Collisions + other.Collisions,
+		Hits:                  s.Hits + other.Hits,
+		Misses:                s.Misses + other.Misses,
+		AsyncDropped:          s.AsyncDropped + other.AsyncDropped,
+		SkippedWrites:         s.SkippedWrites + other.SkippedWrites,
+		Corruptions:           s.Corruptions + other.Corruptions,
+		ExpiryWarningsDropped: s.ExpiryWarningsDropped + other.ExpiryWarningsDropped,
+		CostRejections:        s.CostRejections + other.CostRejections,
+	}
+}
+
+// Stats returns current cache metrics
+func (c *ActiveCache) Stats() Stats {
+	return Stats{
+		MemoryUsage:           c.MemoryUsage(),
+		Collisions:            c.collisionsCount.Load(),
+		Hits:                  c.hits.Load(),
+		Misses:                c.misses.Load(),
+		AsyncDropped:          c.asyncDropped.Load(),
+		SkippedWrites:         c.skippedWrites.Load(),
+		Corruptions:           c.corruptions.Load(),
+		ExpiryWarningsDropped: c.expiryWarningsDropped.Load(),
+		CostRejections:        c.costRejections.Load(),
+	}
+}
+
+// ResetStats zeroes the counters of Stats and the counters of CleanerStats,
+//
+// so callers can measure rates per interval.
+// MemoryUsage and the recorded Collisions are not counters and are kept.
+//
+// Every counter is set to zero on its own without locking: an increment
+// racing with the reset lands either before it, and is dropped, or after it,
+// and is counted in the next interval. Counters never go negative
+func (c *ActiveCache) ResetStats() {
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.collisionsCount.Store(0)
+	c.cleanBudgetExhausted.Store(0)
+	c.asyncDropped.Store(0)
+	c.skippedWrites.Store(0)
+	c.corruptions.Store(0)
+	c.expiryWarningsDropped.Store(0)
+	c.costRejections.Store(0)
+}
+
+// A Collision represents two distinct keys with the same hash
+//
+// detected by Config.DetectCollisions
+type Collision struct {
+	// Key stored first
+	Stored []byte
+
+	// Key whose write was refused
+	Key []byte
+}
+
+// Collisions returns a copy of the first `MaxRecordedCollisions` collisions
+//
+// detected while Config.DetectCollisions is set, see Stats.Collisions for the total
+func (c *ActiveCache) Collisions() []Collision {
+	c.rlock()
+	defer c.runlock()
+
+	return append([]Collision{}, c.collisions...)
+}
+
+// A CleanerStats represents a point-in-time view of cleaner metrics
+type CleanerStats struct {
+	// Amount of clean cycles stopped by Config.MaxCleanDuration
+	BudgetExhausted int64
+}
+
+// CleanerStats returns current cleaner metrics
+func (c *ActiveCache) CleanerStats() CleanerStats {
+	return CleanerStats{
+		BudgetExhausted: c.cleanBudgetExhausted.Load(),
+	}
+}
+
+// StorageStats returns the bucket distribution of the entries storage
+//
+// and the hash collisions it detected, to tune the table size. Writes
+// refused by `Config.DetectCollisions` never reach the storage and are
+// reported by Stats instead
+func (c *ActiveCache) StorageStats() hashmap.Stats {
+	c.rlock()
+	defer c.runlock()
+
+	return c.entries.Stats()
+}
+
+// TTLHistogram counts stored entries by remaining TTL, `bounds` must be
+//
+// ascending. The i-th bucket counts entries expiring after bounds[i-1] and
+// within bounds[i], the next one those expiring after the last bound. The two
+// last buckets count entries with NoExpiration and expired entries not yet
+// removed by the cleaner, so the result has len(bounds)+3 buckets.
+// Tombstones and keys cached by SetNotFound are not counted, like Keys.
+//
+// With `approximate` only TTLHistogramSampleSize random entries are bucketed
+// and counts are scaled up to the amount of stored entries
+func (c *ActiveCache) TTLHistogram(bounds []time.Duration, approximate bool) []int {
+	histogram := make([]int, len(bounds)+3)
+	now := c.now()
+	add := func(entry *cacheEntry) {
+		switch {
+		case entry.Tombstone || entry.NotFound:
+		case entry.IsExpired(now):
+			histogram[len(bounds)+2]++
+		case !entry.HasTTL():
+			histogram[len(bounds)+1]++
+		default:
+			ttl := entry.RemainingTTL(now)
+			histogram[sort.Search(len(bounds), func(i int) bool { return ttl <= bounds[i] })]++
+		}
+	}
+
+	c.rlock()
+	defer c.runlock()
+
+	if !approximate {
+		c.entries.Range(func(_ []byte, entry *cacheEntry) bool {
+			add(entry)
+			return true
+		})
+		return histogram
+	}
+
+	sample := c.entries.Sample(TTLHistogramSampleSize, nil)
+	for _, e := range sample {
+		add(e.Value)
+	}
+
+	if total := int(c.length.Load()); len(sample) > 0 && len(sample) < total {
+		for i := range histogram {
+			histogram[i] = histogram[i] * total / len(sample)
+		}
+	}
+
+	return histogram
+}
@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache/cachetest"
+	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
+)
+
+func TestActiveCache_Stats(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+
+	// Test
+	stats := cache.Stats()
+	if stats.MemoryUsage != 10+EntryOverheadBytes {
+		t.Errorf("wrong value for Stats().MemoryUsage. Expected %v but got %v", 10+EntryOverheadBytes, stats.MemoryUsage)
+	}
+
+	cache.Get([]byte("lorem"))
+	cache.Get([]byte("nonexistent key"))
+	cache.Get([]byte("nonexistent key"))
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("wrong value for Stats() hits and misses. Expected (1, 2) but got (%v, %v)", stats.Hits, stats.Misses)
+	}
+}
+
+func TestActiveCache_ResetStats(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), NoExpiration)
+	for i := 0; i < 5; i++ {
+		cache.Get([]byte("lorem"))
+		cache.Get([]byte("nonexistent key"))
+	}
+	cache.collisionsCount.Add(1)
+	cache.cleanBudgetExhausted.Add(1)
+
+	// Test
+	cache.ResetStats()
+	stats := cache.Stats()
+	if stats.Hits != 0 || stats.Misses != 0 || stats.Collisions != 0 {
+		t.Errorf("wrong value for Stats() after ResetStats(). Expected zero counters but got %+v", stats)
+	}
+
+	if stats.MemoryUsage != 10+EntryOverheadBytes {
+		t.Errorf("ResetStats() should keep MemoryUsage. Expected %v but got %v", 10+EntryOverheadBytes, stats.MemoryUsage)
+	}
+
+	if cleaner := cache.CleanerStats(); cleaner.BudgetExhausted != 0 {
+		t.Errorf("wrong value for CleanerStats().BudgetExhausted after ResetStats(). Expected 0 but got %v", cleaner.BudgetExhausted)
+	}
+
+	cache.Get([]byte("lorem"))
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("counters should start fresh after ResetStats(). Expected (1, 0) but got (%v, %v)", stats.Hits, stats.Misses)
+	}
+}
+
+// steppingClock is a Clock advancing `clock` by `step` on every read
+type steppingClock struct {
+	clock *cachetest.FakeClock
+	step  time.Duration
+}
+
+func (s steppingClock) Now() time.Time {
+	s.clock.Advance(s.step)
+	return s.clock.Now()
+}
+
+func TestActiveCache_CleanerStats(t *testing.T) {
+	// Setup: every clock read takes 1ms, making each inspected key slow
+	clock := cachetest.NewFakeClock(time.Now())
+	cache := NewActiveCacheWithConfig(&Config{
+		Clock:             steppingClock{clock: clock, step: time.Millisecond},
+		KeysAmountByCycle: 100,
+		MaxCleanDuration:  10 * time.Millisecond,
+	})
+	cache.StopCleaner()
+	for i := 0; i < 200; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), time.Millisecond)
+	}
+	clock.Advance(time.Second)
+
+	// Test
+	start := clock.Now()
+	cache.performClean()
+	elapsed := clock.Now().Sub(start)
+	if elapsed > 15*time.Millisecond {
+		t.Errorf("clean cycle should respect MaxCleanDuration. Expected at most 15ms but took %v", elapsed)
+	}
+
+	if removed := 200 - cache.length.Load(); removed == 0 || removed >= 100 {
+		t.Errorf("clean cycle should stop early. Expected (0, 100) removed entries but got %v", removed)
+	}
+
+	if stats := cache.CleanerStats(); stats.BudgetExhausted != 1 {
+		t.Errorf("wrong value for CleanerStats().BudgetExhausted. Expected 1 but got %v", stats.BudgetExhausted)
+	}
+
+	// all inspected keys were expired, the next cycle must start sooner
+	base := time.Millisecond * DefaultCleanerInterval
+	if interval := cache.nextCleanInterval(true); interval != base/2 {
+		t.Errorf("wrong interval after exhausted budget. Expected %v but got %v", base/2, interval)
+	}
+
+	if interval := cache.nextCleanInterval(true); interval != base {
+		t.Errorf("wrong interval after hurried cycle. Expected %v but got %v", base, interval)
+	}
+}
+
+func TestActiveCache_StorageStats(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	defer cache.Close()
+	for i := 0; i < 25; i++ {
+		cache.SetPermanent([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+
+	// Test
+	stats := cache.StorageStats()
+	if stats.Buckets != hashmap.DefaultTableSize || stats.Entries != 25 || stats.MeanBucketLen != 2.5 || stats.Collisions != 0 {
+		t.Errorf("wrong value for StorageStats(). Expected 25 entries in %v buckets but got %+v", hashmap.DefaultTableSize, stats)
+	}
+
+	buckets, entries := 0, 0
+	for length, amount := range stats.BucketHistogram {
+		buckets += amount
+		entries += length * amount
+		if length < stats.MinBucketLen || length > stats.MaxBucketLen {
+			t.Errorf("wrong value for StorageStats() bucket lengths. Expected %v within [%v, %v]", length, stats.MinBucketLen, stats.MaxBucketLen)
+		}
+	}
+
+	if buckets != stats.Buckets || entries != stats.Entries {
+		t.Errorf("wrong value for StorageStats().BucketHistogram. Expected %v buckets with %v entries but got %v with %v", stats.Buckets, stats.Entries, buckets, entries)
+	}
+}
+
+func TestActiveCache_TTLHistogram_removedKeys(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{TombstoneTTL: time.Minute})
+	cache.StopCleaner()
+	cache.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+	cache.SetPermanent([]byte("john"), []byte("doe"))
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	cache.Delete([]byte("jane"))
+	cache.SetNotFound([]byte("missing"), time.Minute)
+	cache.SetNotFound([]byte("unknown"), NoExpiration)
+
+	// Test tombstones and negative cached keys are not counted
+	for _, approximate := range []bool{false, true} {
+		histogram := cache.TTLHistogram([]time.Duration{time.Hour}, approximate)
+		if !reflect.DeepEqual(histogram, []int{1, 0, 1, 0}) {
+			t.Errorf("wrong value for TTLHistogram(1h, %v). Expected [1 0 1 0] but got %v", approximate, histogram)
+		}
+	}
+}
+
+func TestActiveCache_TTLHistogram(t *testing.T) {
+	// Setup
+	clock := cachetest.NewFakeClock(time.Now())
+
+	cache := NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	cache.Set([]byte("expired"), []byte("value"), time.Second)
+	clock.Advance(time.Second * 2)
+
+	population := []struct {
+		amount int
+		ttl    time.Duration
+	}{
+		{amount: 3, ttl: time.Second * 30},
+		{amount: 2, ttl: time.Minute},
+		{amount: 4, ttl: time.Minute * 5},
+		{amount: 1, ttl: time.Hour},
+		{amount: 2, ttl: NoExpiration},
+	}
+	for _, p := range population {
+		for i := 0; i < p.amount; i++ {
+			cache.Set([]byte(fmt.Sprintf("%v-%v", p.ttl, i)), []byte("value"), p.ttl)
+		}
+	}
+
+	// Test
+	bounds := []time.Duration{time.Minute, time.Minute * 10}
+	expected := []int{5, 4, 1, 2, 1}
+	for _, approximate := range []bool{false, true} {
+		histogram := cache.TTLHistogram(bounds, approximate)
+		if !reflect.DeepEqual(histogram, expected) {
+			t.Errorf("wrong value for TTLHistogram(%v, %v). Expected %v but got %v", bounds, approximate, expected, histogram)
+		}
+	}
+
+	if histogram := cache.TTLHistogram(nil, false); !reflect.DeepEqual(histogram, []int{10, 2, 1}) {
+		t.Errorf("wrong value for TTLHistogram(nil, false). Expected [10 2 1] but got %v", histogram)
+	}
+
+	// Test approximation on a cache bigger than the sample
+	cache = NewActiveCacheWithConfig(&Config{Clock: clock})
+	cache.StopCleaner()
+	for i := 0; i < TTLHistogramSampleSize*3; i++ {
+		cache.Set([]byte(fmt.Sprintf("key%v", i)), []byte("value"), []time.Duration{time.Minute, NoExpiration}[i%2])
+	}
+
+	histogram := cache.TTLHistogram(bounds, true)
+	for i, expected := range []int{TTLHistogramSampleSize * 3 / 2, 0, 0, TTLHistogramSampleSize * 3 / 2, 0} {
+		if diff := histogram[i] - expected; diff < -expected/10 || diff > expected/10 {
+			t.Errorf("wrong value for approximate TTLHistogram() bucket %v. Expected about %v but got %v", i, expected, histogram[i])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// GetStream returns a reader over the Value stored for the specified key
+//
+// and whether it was found.
+//
+// Returns (nil, false) if key is nil, does not exist or is expired
+func (c *ActiveCache) GetStream(key []byte) (io.ReadCloser, bool) {
+	value, _, err := c.GetE(key)
+	if err != nil {
+		return nil, false
+	}
+
+	return io.NopCloser(bytes.NewReader(value)), true
+}
+
+// SetStream reads `r` until EOF and stores the content as Value for
+//
+// specified Key with TTL, following the same rules as SetE.
+//
+// Reading stops with ErrValueTooLarge as soon as the stream exceeds
+// `Config.MaxValueBytes`. Nothing is stored when an error is returned,
+// including read errors from `r`
+func (c *ActiveCache) SetStream(key []byte, r io.Reader, ttl time.Duration) error {
+	if err := c.validateEntry(key, nil, ttl); err != nil {
+		return err
+	}
+
+	if c.config.Load().MaxValueBytes > 0 {
+		// Read one extra byte to detect oversized streams
+		r = io.LimitReader(r, int64(c.config.Load().MaxValueBytes)+1)
+	}
+
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return c.SetE(key, value, ttl)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestActiveCache_GetStream(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test
+	r, ok := cache.GetStream([]byte("lorem"))
+	if !ok {
+		t.Fatal("GetStream() should find existing key")
+	}
+	defer r.Close()
+
+	if val, err := io.ReadAll(r); err != nil || string(val) != "ipsum" {
+		t.Errorf("wrong value read from GetStream(). Expected (ipsum, nil) but got (%s, %v)", val, err)
+	}
+
+	if r, ok := cache.GetStream([]byte("nonexistent key")); ok || r != nil {
+		t.Error("GetStream() should not find nonexistent key")
+	}
+}
+
+func TestActiveCache_SetStream(t *testing.T) {
+	// Setup
+	const maxValueBytes = 16
+	cache := NewActiveCacheWithConfig(&Config{MaxValueBytes: maxValueBytes})
+	cache.StopCleaner()
+	readErr := errors.New("connection reset")
+
+	type testCase struct {
+		key         []byte
+		r           io.Reader
+		expectedErr error
+	}
+
+	testsCase := []testCase{
+		{key: []byte("exact"), r: bytes.NewReader(bytes.Repeat([]byte("v"), maxValueBytes))},
+		{key: []byte("oversized"), r: bytes.NewReader(bytes.Repeat([]byte("v"), maxValueBytes+1)), expectedErr: ErrValueTooLarge},
+		{key: []byte("broken"), r: io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(readErr)), expectedErr: readErr},
+		{key: nil, r: strings.NewReader("value"), expectedErr: ErrNilKey},
+	}
+
+	// Test
+	for _, tc := range testsCase {
+		err := cache.SetStream(tc.key, tc.r, time.Minute)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("wrong error for SetStream(%s). Expected %v but got %v", tc.key, tc.expectedErr, err)
+		}
+
+		if _, stored := cache.entries.Get(tc.key); stored != (tc.expectedErr == nil) {
+			t.Errorf("wrong stored state for SetStream(%s). Expected %v but got %v", tc.key, tc.expectedErr == nil, stored)
+		}
+	}
+
+	if val, ttl := cache.Get([]byte("exact")); len(val) != maxValueBytes || ttl != time.Minute {
+		t.Errorf("wrong value after SetStream(). Expected (%v bytes, 1m) but got (%v bytes, %v)", maxValueBytes, len(val), ttl)
+	}
+}
@@ -0,0 +1,154 @@
+package cache
+
+import "time"
+
+// A Loader loads values from a slower backing store (L2)
+type Loader interface {
+	// Load returns the value stored using `key` and whether it was found
+	Load(key []byte) ([]byte, bool, error)
+}
+
+// A Writer stores values into a slower backing store (L2)
+type Writer interface {
+	// Store persists `value` using `key`
+	Store(key, value []byte) error
+}
+
+// A LoaderWriter is a backing store (L2) that can be read and written
+type LoaderWriter interface {
+	Loader
+	Writer
+}
+
+// A TieredCache fronts a slower backing store (L2) with a Cache (L1).
+//
+// On an L1 miss the value is loaded from L2 and stored into L1 with the
+// configured TTL. Writes go to both tiers, L1 first.
+type TieredCache struct {
+	// In-memory cache
+	l1 Cache
+
+	// Slower backing store
+	l2 LoaderWriter
+
+	// TTL used when populating L1 from L2
+	ttl time.Duration
+
+	// OnError is called with the key and error returned by L2, if not nil.
+	//
+	// L2 errors never change the L1 state
+	OnError func(key []byte, err error)
+}
+
+var _ Cache = (*TieredCache)(nil)
+
+var _ Admin = (*TieredCache)(nil)
+
+// NewTieredCache returns a TieredCache pointer instance using `l1` as
+//
+// in-memory tier and `l2` as backing store. Values loaded from L2 are
+//
+// stored in L1 with `ttl`
+func NewTieredCache(l1 Cache, l2 LoaderWriter, ttl time.Duration) *TieredCache {
+	return &TieredCache{
+		l1:  l1,
+		l2:  l2,
+		ttl: ttl,
+	}
+}
+
+// CleanNow runs a clean cycle of L1, found with AsAdmin, implementing Admin
+func (t *TieredCache) CleanNow() {
+	adminGroup{t.l1}.CleanNow()
+}
+
+// Close closes L1, found with AsAdmin, implementing Admin. L2 is left open
+func (t *TieredCache) Close() error {
+	return adminGroup{t.l1}.Close()
+}
+
+// Delete removes `key` from L1 and reports whether it was stored there.
+//
+// The key stays on L2 as it has no delete operation, so the next Get loads it again
+func (t *TieredCache) Delete(key []byte) bool {
+	if key == nil {
+		return false
+	}
+
+	return t.l1.Delete(key)
+}
+
+// Flush removes every entry of L1, found with AsAdmin, implementing Admin.
+//
+// L2 keeps its values, so the next Get of a key loads it again
+func (t *TieredCache) Flush() {
+	adminGroup{t.l1}.Flush()
+}
+
+// Get returns Value and TTL from L1, falling back to L2 on a miss.
+//
+// Values found on L2 populate L1 and are returned with the TieredCache TTL.
+//
+// If key is nil OR does not exist on both tiers returns (nil, 0)
+func (t *TieredCache) Get(key []byte) ([]byte, time.Duration) {
+	if key == nil {
+		return emptyValueTTL()
+	}
+
+	if value, ttl := t.l1.Get(key); value != nil {
+		return value, ttl
+	}
+
+	value, ok, err := t.l2.Load(key)
+	if err != nil {
+		t.reportError(key, err)
+		return emptyValueTTL()
+	}
+
+	if !ok {
+		return emptyValueTTL()
+	}
+
+	t.l1.Set(key, value, t.ttl)
+	return value, t.ttl
+}
+
+// Len returns the amount of entries stored by L1, found with AsAdmin, implementing Admin
+func (t *TieredCache) Len() int {
+	return adminGroup{t.l1}.Len()
+}
+
+// reportError calls OnError if it is set
+func (t *TieredCache) reportError(key []byte, err error) {
+	if t.OnError != nil {
+		t.OnError(key, err)
+	}
+}
+
+// Set sets Value for specified Key with TTL on L1 and stores it on L2.
+//
+// A negative TTL only removes the key from L1 as L2 has no delete operation
+func (t *TieredCache) Set(key, value []byte, ttl time.Duration) {
+	if key == nil {
+		return
+	}
+
+	t.l1.Set(key, value, ttl)
+	if ttl < NoExpiration {
+		return
+	}
+
+	if err := t.l2.Store(key, value); err != nil {
+		t.reportError(key, err)
+	}
+}
+
+// Stats returns the metrics of L1, found with AsAdmin, implementing Admin
+func (t *TieredCache) Stats() Stats {
+	return adminGroup{t.l1}.Stats()
+}
+
+// Unwrap returns the in-memory tier (L1)
+func (t *TieredCache) Unwrap() Cache {
+	return t.l1
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory LoaderWriter counting its calls
+type fakeStore struct {
+	data   map[string][]byte
+	err    error
+	loads  int
+	stores int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: map[string][]byte{}}
+}
+
+func (f *fakeStore) Load(key []byte) ([]byte, bool, error) {
+	f.loads++
+	if f.err != nil {
+		return nil, false, f.err
+	}
+
+	value, ok := f.data[string(key)]
+	return value, ok, nil
+}
+
+func (f *fakeStore) Store(key, value []byte) error {
+	f.stores++
+	if f.err != nil {
+		return f.err
+	}
+
+	f.data[string(key)] = value
+	return nil
+}
+
+func TestTieredCache_Admin(t *testing.T) {
+	// Setup
+	l1 := NewActiveCache()
+	l1.StopCleaner()
+	l2 := newFakeStore()
+	tiered := NewTieredCache(l1, l2, time.Minute)
+	tiered.Set([]byte("lorem"), []byte("ipsum"), time.Minute)
+
+	// Test
+	admin, ok := AsAdmin(AsBatchCache(tiered))
+	if !ok || admin != Admin(tiered) {
+		t.Fatalf("wrong value for AsAdmin() through the adapter. Expected %p but got %v", tiered, admin)
+	}
+
+	if admin.Len() != 1 {
+		t.Errorf("wrong value for Admin.Len(). Expected 1 but got %v", admin.Len())
+	}
+
+	tiered.Get([]byte("lorem"))
+	if stats := admin.Stats(); stats.Hits != 1 {
+		t.Errorf("wrong value for Admin.Stats().Hits. Expected 1 but got %v", stats.Hits)
+	}
+
+	admin.Flush()
+	if l1.Len() != 0 || l2.stores != 1 {
+		t.Errorf("Admin.Flush() should empty L1 only but got %v entries", l1.Len())
+	}
+
+	if value, _ := tiered.Get([]byte("lorem")); string(value) != "ipsum" {
+		t.Errorf("wrong value for Get(lorem) after Admin.Flush(). Expected ipsum from L2 but got %s", value)
+	}
+
+	if err := admin.Close(); err != nil {
+		t.Errorf("wrong value for Admin.Close(). Expected nil but got %v", err)
+	}
+}
+
+func TestTieredCache_Delete(t *testing.T) {
+	// Setup
+	l1 := NewActiveCache()
+	l1.StopCleaner()
+	l2 := newFakeStore()
+	tiered := NewTieredCache(l1, l2, time.Minute)
+	tiered.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+
+	// Test
+	if !tiered.Delete([]byte("lorem")) || l1.Len() != 0 {
+		t.Errorf("Delete(lorem) should remove the key from L1 but got %v entries", l1.Len())
+	}
+
+	if string(l2.data["lorem"]) != "ipsum" {
+		t.Errorf("Delete() should keep the key on L2 but got %s", l2.data["lorem"])
+	}
+
+	if tiered.Delete([]byte("lorem")) || tiered.Delete(nil) {
+		t.Errorf("wrong value for Delete() of a key missing from L1. Expected false but got true")
+	}
+}
+
+func TestTieredCache_Get(t *testing.T) {
+	// Setup
+	l1 := NewActiveCache()
+	l1.StopCleaner()
+	l2 := newFakeStore()
+	l2.data["lorem"] = []byte("ipsum")
+	tiered := NewTieredCache(l1, l2, time.Minute)
+
+	// Test
+	val, ttl := tiered.Get([]byte("lorem")) // L1 miss, L2 hit
+	if string(val) != "ipsum" || ttl != time.Minute {
+		t.Errorf("wrong value for Get(lorem). Expected (ipsum, 1m) but got (%s, %v)", val, ttl)
+	}
+
+	if val, _ := l1.Get([]byte("lorem")); string(val) != "ipsum" {
+		t.Errorf("L1 should be populated after L2 hit but got %s", val)
+	}
+
+	tiered.Get([]byte("lorem")) // L1 hit
+	if l2.loads != 1 {
+		t.Errorf("L2 should be loaded only once but got %v loads", l2.loads)
+	}
+
+	if val, ttl := tiered.Get([]byte("nonexistent key")); val != nil || ttl != 0 {
+		t.Errorf("wrong value for Get(nonexistent key). Expected (nil, 0) but got (%s, %v)", val, ttl)
+	}
+
+	if val, ttl := tiered.Get(nil); val != nil || ttl != 0 || l2.loads != 2 {
+		t.Errorf("Get(nil) should return (nil, 0) without loading L2 but got (%s, %v)", val, ttl)
+	}
+
+	// L2 errors are reported and do not populate L1
+	var reported error
+	tiered.OnError = func(key []byte, err error) { reported = err }
+	l2.err = errors.New("l2 unavailable")
+	if val, _ := tiered.Get([]byte("john")); val != nil || !errors.Is(reported, l2.err) {
+		t.Errorf("Get() should report L2 errors. Got value %s and error %v", val, reported)
+	}
+}
+
+func TestTieredCache_Set(t *testing.T) {
+	// Setup
+	l1 := NewActiveCache()
+	l1.StopCleaner()
+	l2 := newFakeStore()
+	tiered := NewTieredCache(l1, l2, time.Minute)
+
+	// Test
+	tiered.Set([]byte("lorem"), []byte("ipsum"), time.Second)
+	if val, ttl := l1.Get([]byte("lorem")); string(val) != "ipsum" || ttl != time.Second {
+		t.Errorf("wrong L1 value after Set(). Expected (ipsum, 1s) but got (%s, %v)", val, ttl)
+	}
+
+	if string(l2.data["lorem"]) != "ipsum" {
+		t.Errorf("wrong L2 value after Set(). Expected ipsum but got %s", l2.data["lorem"])
+	}
+
+	tiered.Set([]byte("lorem"), nil, ExpireNow)
+	if val, _ := l1.Get([]byte("lorem")); val != nil || l2.stores != 1 {
+		t.Errorf("negative TTL should only remove from L1. Got L1 value %s and %v L2 stores", val, l2.stores)
+	}
+
+	tiered.Set(nil, []byte("doe"), time.Second)
+	if l2.stores != 1 {
+		t.Error("Set() with nil key should not write to L2")
+	}
+}
+
+func TestTieredCache_Unwrap(t *testing.T) {
+	// Setup
+	l1 := NewActiveCache()
+	l1.StopCleaner()
+	tiered := NewTieredCache(l1, newFakeStore(), time.Minute)
+
+	// Test
+	if inner := tiered.Unwrap(); inner != Cache(l1) {
+		t.Errorf("wrong value for Unwrap(). Expected L1 %p but got %v", l1, inner)
+	}
+}
@@ -0,0 +1,224 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/pkg/hashmap"
+)
+
+// A Txn stages the writes of a transaction, see ActiveCache.Tx.
+//
+// It must not be used once the function given to Tx returns
+type Txn struct {
+	// Cache the transaction commits to
+	cache *ActiveCache
+
+	// Staged writes by key, deletes have a negative TTL
+	writes hashmap.HashMap[txWrite]
+
+	// Staged keys in order of their first write, committed in that order
+	keys [][]byte
+}
+
+// A txWrite represents a write staged by a Txn
+type txWrite struct {
+	value []byte
+	ttl   time.Duration
+}
+
+// checkTx returns the error committing `tx` would fail with before any write
+//
+// is applied: ErrClosed, the collision of a staged key, ErrCostTooHigh for an
+// entry alone exceeding `Config.MaxCostBytes`, or ErrCacheFull when the writes
+// do not fit under `Config.MaxEntries` and `Config.MaxCostBytes` even after
+// evicting every entry they may evict. Staged keys are never evicted, see
+// Tx. Caller must hold the write lock
+func (c *ActiveCache) checkTx(tx *Txn) error {
+	if c.State() == Closed {
+		return ErrClosed
+	}
+
+	conf := c.config.Load()
+	var newKeys int
+	var added, peak int64
+	for _, key := range tx.keys {
+		w, _ := tx.writes.Get(key)
+		if w.ttl < NoExpiration {
+			continue
+		}
+
+		if err := c.detectCollision(key); err != nil {
+			return err
+		}
+
+		// Charged uncompressed, an upper bound with Config.Compress
+		charge := int64(len(key) + len(w.value) + EntryOverheadBytes)
+		if conf.MaxCostBytes > 0 && charge > conf.MaxCostBytes {
+			c.costRejections.Add(1)
+			return ErrCostTooHigh
+		}
+
+		// The cost may only shrink once every write landed, room is needed
+		// for the highest cost reached on the way
+		old, ok := c.entries.Get(key)
+		if ok {
+			added -= old.Charge(key)
+		} else {
+			newKeys++
+		}
+		added += charge
+		peak = max(peak, added)
+	}
+
+	neededEntries := c.length.Load() + int64(newKeys) - int64(conf.MaxEntries)
+	if conf.MaxEntries <= 0 || newKeys == 0 {
+		neededEntries = 0
+	}
+
+	neededCost := c.cost.Load() + peak - conf.MaxCostBytes
+	if conf.MaxCostBytes <= 0 {
+		neededCost = 0
+	}
+
+	if neededEntries <= 0 && neededCost <= 0 {
+		return nil
+	}
+
+	// Only entries the writes may evict make room, see ensureCapacity and ensureCost
+	var evictable, evictableCost int64
+	now := c.now()
+	c.entries.Range(func(key []byte, entry *cacheEntry) bool {
+		if !entry.IsEvictable(now) || tx.isStaged(key) {
+			return true
+		}
+
+		if conf.FullBehavior != RejectWrites || (conf.EvictVolatileRandom && entry.HasTTL()) {
+			evictable++
+		}
+		if conf.FullBehavior != RejectWrites {
+			evictableCost += entry.Charge(key)
+		}
+		return evictable < neededEntries || evictableCost < neededCost
+	})
+
+	if evictable < neededEntries {
+		return ErrCacheFull
+	}
+
+	if evictableCost < neededCost {
+		c.costRejections.Add(1)
+		return ErrCacheFull
+	}
+
+	return nil
+}
+
+// Delete stages the removal of `key`. A nil key is ignored
+func (t *Txn) Delete(key []byte) {
+	if key == nil {
+		return
+	}
+
+	t.stage(key, txWrite{ttl: ExpireNow})
+}
+
+// Get returns the Value and TTL of `key` and whether it was found,
+//
+// reading the writes staged by the transaction first and the cache otherwise.
+// A staged write reports the TTL it was staged with
+func (t *Txn) Get(key []byte) ([]byte, time.Duration, bool) {
+	if w, ok := t.writes.Get(key); ok {
+		if w.ttl < NoExpiration {
+			return nil, 0, false
+		}
+		return w.value, w.ttl, true
+	}
+
+	return t.cache.GetOK(key)
+}
+
+// isStaged reports whether the transaction wrote `key`
+func (t *Txn) isStaged(key []byte) bool {
+	_, ok := t.writes.Get(key)
+	return ok
+}
+
+// Set stages Value for specified Key with TTL like SetE, a negative TTL
+//
+// stages its removal. Key and value are copied.
+//
+// Returns the errors of SetE for invalid keys and values, the transaction can
+// still commit the other writes if the function given to Tx returns nil
+func (t *Txn) Set(key, value []byte, ttl time.Duration) error {
+	if err := t.cache.validateEntry(key, value, ttl); err != nil {
+		return err
+	}
+
+	t.stage(key, txWrite{value: bytes.Clone(value), ttl: ttl})
+	return nil
+}
+
+// stage records `w` as the pending write of `key`, replacing earlier ones
+func (t *Txn) stage(key []byte, w txWrite) {
+	if !t.isStaged(key) {
+		key = bytes.Clone(key)
+		t.keys = append(t.keys, key)
+	}
+
+	t.writes.Put(key, w)
+}
+
+// Tx runs `fn` with a Txn staging writes against a private view and commits
+//
+// them all under a single write lock acquisition when `fn` returns nil, so
+// readers observe either none or all of them. Nothing is written when `fn`
+// returns an error, which Tx returns, or panics, which Tx does not recover.
+//
+// `fn` runs without holding the lock: reads of keys not written by the
+// transaction see the live cache, and concurrent writes to them are not
+// detected. Transactions must not be nested.
+//
+// Returns ErrClosed, ErrHashCollision, ErrCostTooHigh or ErrCacheFull and
+// writes nothing if any staged write would be rejected. Once committed, writes go through to
+// `Config.Backing` in order and their errors are returned joined, a failed
+// write removing its key like SetE
+func (c *ActiveCache) Tx(fn func(tx *Txn) error) error {
+	tx := &Txn{cache: c}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if len(tx.keys) == 0 {
+		return nil
+	}
+
+	c.lock("set")
+	if err := c.checkTx(tx); err != nil {
+		c.unlock()
+		return err
+	}
+
+	// Making room for a write never evicts one committed before it
+	c.spared = tx.isStaged
+	entries := make([]*cacheEntry, len(tx.keys))
+	for i, key := range tx.keys {
+		w, _ := tx.writes.Get(key)
+		// Cannot fail once checkTx accepted the transaction
+		_ = c.setEntry(key, w.value, w.ttl, setOptions{})
+		entries[i], _ = c.entries.Get(key)
+	}
+	c.spared = nil
+	c.unlock()
+
+	var errs []error
+	for i, key := range tx.keys {
+		w, _ := tx.writes.Get(key)
+		if err := c.writeThrough(key, w.value, w.ttl, entries[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
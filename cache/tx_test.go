@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestActiveCache_Tx(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test staged writes are seen inside the transaction only
+	err := cache.Tx(func(tx *Txn) error {
+		if err := tx.Set([]byte("john"), []byte("doe"), time.Minute); err != nil {
+			return err
+		}
+		tx.Delete([]byte("lorem"))
+
+		if value, ttl, ok := tx.Get([]byte("john")); !ok || string(value) != "doe" || ttl != time.Minute {
+			t.Errorf("wrong value for Txn.Get(john). Expected (doe, 1m, true) but got (%s, %v, %v)", value, ttl, ok)
+		}
+
+		if _, _, ok := tx.Get([]byte("lorem")); ok {
+			t.Errorf("wrong value for Txn.Get(lorem) after Txn.Delete(). Expected not found but got found")
+		}
+
+		if _, _, ok := cache.GetOK([]byte("john")); ok {
+			t.Errorf("staged writes should not be visible before commit")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Errorf("wrong value for Tx(). Expected nil but got %v", err)
+	}
+
+	if value, _ := cache.Get([]byte("john")); string(value) != "doe" || cache.Has([]byte("lorem")) {
+		t.Errorf("Tx() should commit every staged write but got john=%s and lorem found=%v", value, cache.Has([]byte("lorem")))
+	}
+
+	// Test an error discards every staged write
+	errAbort := errors.New("abort")
+	err = cache.Tx(func(tx *Txn) error {
+		tx.Set([]byte("jane"), []byte("foster"), NoExpiration)
+		tx.Delete([]byte("john"))
+		return errAbort
+	})
+
+	if err != errAbort || cache.Has([]byte("jane")) || !cache.Has([]byte("john")) {
+		t.Errorf("Tx() returning an error should write nothing but got %v, jane found=%v, john found=%v", err, cache.Has([]byte("jane")), cache.Has([]byte("john")))
+	}
+
+	if err := cache.Tx(func(tx *Txn) error { return tx.Set(nil, []byte("value"), NoExpiration) }); err != ErrNilKey {
+		t.Errorf("wrong value for Tx() with a nil key. Expected %v but got %v", ErrNilKey, err)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Tx_panic(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("Tx() should not recover panics of fn. Expected boom but got %v", r)
+			}
+		}()
+
+		cache.Tx(func(tx *Txn) error {
+			tx.Set([]byte("lorem"), []byte("dolor"), NoExpiration)
+			tx.Set([]byte("john"), []byte("doe"), NoExpiration)
+			panic("boom")
+		})
+	}()
+
+	if value, _ := cache.Get([]byte("lorem")); string(value) != "ipsum" || cache.Has([]byte("john")) {
+		t.Errorf("a panicking Tx() should write nothing but got lorem=%s and john found=%v", value, cache.Has([]byte("john")))
+	}
+
+	// The lock must have been left unlocked
+	cache.SetPermanent([]byte("jane"), []byte("foster"))
+	if !cache.Has([]byte("jane")) {
+		t.Errorf("cache should keep working after a panicking Tx()")
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Tx_rejected(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: 2, FullBehavior: RejectWrites})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test a transaction not fitting is not partially applied
+	err := cache.Tx(func(tx *Txn) error {
+		tx.Set([]byte("lorem"), []byte("dolor"), NoExpiration)
+		tx.Set([]byte("john"), []byte("doe"), NoExpiration)
+		tx.Set([]byte("jane"), []byte("foster"), NoExpiration)
+		return nil
+	})
+
+	if value, _ := cache.Get([]byte("lorem")); err != ErrCacheFull || string(value) != "ipsum" || cache.Len() != 1 {
+		t.Errorf("wrong value for Tx() on a full cache. Expected %v writing nothing but got %v, lorem=%s and %v entries", ErrCacheFull, err, value, cache.Len())
+	}
+
+	// Test a closed cache
+	cache.Close()
+	if err := cache.Tx(func(tx *Txn) error { return tx.Set([]byte("john"), []byte("doe"), NoExpiration) }); err != ErrClosed {
+		t.Errorf("wrong value for Tx() on a closed cache. Expected %v but got %v", ErrClosed, err)
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Tx_cost(t *testing.T) {
+	// Setup
+	cache := NewActiveCacheWithConfig(&Config{MaxCostBytes: 300, FullBehavior: RejectWrites})
+	cache.StopCleaner()
+	cache.SetPermanent([]byte("lorem"), []byte("ipsum"))
+
+	// Test a transaction beyond MaxCostBytes is not partially applied
+	err := cache.Tx(func(tx *Txn) error {
+		tx.Set([]byte("john"), []byte("doe"), NoExpiration)
+		tx.Set([]byte("jane"), []byte("foster"), NoExpiration)
+		return nil
+	})
+
+	if err != ErrCacheFull || cache.Len() != 1 || cache.Cost() != 5+5+EntryOverheadBytes {
+		t.Errorf("wrong value for Tx() beyond MaxCostBytes. Expected %v writing nothing but got %v, %v entries costing %v",
+			ErrCacheFull, err, cache.Len(), cache.Cost())
+	}
+
+	// Test an entry alone beyond MaxCostBytes
+	err = cache.Tx(func(tx *Txn) error {
+		return tx.Set([]byte("john"), make([]byte, 300), NoExpiration)
+	})
+
+	if err != ErrCostTooHigh || cache.Has([]byte("john")) {
+		t.Errorf("wrong value for Tx() with an entry beyond MaxCostBytes. Expected %v but got %v", ErrCostTooHigh, err)
+	}
+
+	// Test evicting to fit the budget
+	cache.Reconfigure(&Config{MaxCostBytes: 300})
+	err = cache.Tx(func(tx *Txn) error {
+		tx.Set([]byte("john"), []byte("doe"), NoExpiration)
+		return tx.Set([]byte("jane"), []byte("foster"), NoExpiration)
+	})
+
+	if err != nil || cache.Has([]byte("lorem")) || !cache.Has([]byte("john")) || !cache.Has([]byte("jane")) || cache.Cost() > 300 {
+		t.Errorf("Tx() should evict lorem to fit under MaxCostBytes but got %v, lorem found=%v and cost %v", err, cache.Has([]byte("lorem")), cache.Cost())
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Tx_sparesStagedKeys(t *testing.T) {
+	// Setup
+	const keys = 3
+	cache := NewActiveCacheWithConfig(&Config{MaxEntries: keys, Eviction: RandomPolicy{}})
+	cache.StopCleaner()
+
+	// Test random eviction never removes a key written earlier by the same commit
+	for i := 0; i < 20; i++ {
+		err := cache.Tx(func(tx *Txn) error {
+			for k := 0; k < keys; k++ {
+				tx.Set([]byte(strconv.Itoa(i*keys+k)), []byte("value"), NoExpiration)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("wrong value for Tx(). Expected nil but got %v", err)
+		}
+
+		for k := 0; k < keys; k++ {
+			if key := strconv.Itoa(i*keys + k); !cache.Has([]byte(key)) {
+				t.Fatalf("Tx() should keep every key it writes but %s was evicted", key)
+			}
+		}
+	}
+
+	assertInvariants(t, cache)
+}
+
+func TestActiveCache_Tx_concurrent(t *testing.T) {
+	// Setup
+	const commits = 500
+	cache := NewActiveCache()
+	cache.StopCleaner()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				// A snapshot is taken under a single read lock acquisition
+				snapshot := cache.Snapshot()
+				value, _, valueOK := snapshot.Get([]byte("value"))
+				index, _, indexOK := snapshot.Get([]byte("index"))
+				if valueOK != indexOK || string(value) != string(index) {
+					t.Errorf("readers should see both keys of a Tx() or none but got value=%s (%v) and index=%s (%v)", value, valueOK, index, indexOK)
+					return
+				}
+			}
+		}()
+	}
+
+	// Test
+	for i := 0; i < commits; i++ {
+		v := []byte(strconv.Itoa(i))
+		err := cache.Tx(func(tx *Txn) error {
+			if i%3 == 2 {
+				tx.Delete([]byte("value"))
+				tx.Delete([]byte("index"))
+				return nil
+			}
+
+			tx.Set([]byte("value"), v, NoExpiration)
+			return tx.Set([]byte("index"), v, NoExpiration)
+		})
+		if err != nil {
+			t.Errorf("wrong value for Tx(). Expected nil but got %v", err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	assertInvariants(t, cache)
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+// A Codec encodes the values of a TypedCache, e.g. with JSON or protobuf
+type Codec interface {
+	// Marshal returns the encoding of `v`
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes `data` into the value pointed to by `v`
+	Unmarshal(data []byte, v any) error
+}
+
+// A GobCodec is the default Codec of TypedCache, encoding values with encoding/gob.
+//
+// Every value is encoded with its type information, so prefer a more compact
+// codec for small values
+type GobCodec struct{}
+
+var _ Codec = GobCodec{}
+
+// Marshal returns the gob encoding of `v`
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the gob encoded `data` into the value pointed to by `v`
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// A TypedCache stores values of type `T` in a Cache, encoding them with a Codec
+type TypedCache[T any] struct {
+	// Cache storing the encoded values
+	cache CacheV2
+
+	// Codec encoding and decoding values
+	codec Codec
+}
+
+var _ Admin = (*TypedCache[any])(nil)
+
+// NewTypedCache returns a TypedCache pointer instance storing values in `c`,
+//
+// encoded with `codec`, or with GobCodec when `codec` is nil
+func NewTypedCache[T any](c Cache, codec Codec) *TypedCache[T] {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+
+	return &TypedCache[T]{cache: AsCacheV2(c), codec: codec}
+}
+
+// CleanNow runs a clean cycle of the Cache storing the values,
+//
+// found with AsAdmin, implementing Admin
+func (t *TypedCache[T]) CleanNow() {
+	adminGroup{t.cache}.CleanNow()
+}
+
+// Close closes the Cache storing the values, found with AsAdmin, implementing Admin
+func (t *TypedCache[T]) Close() error {
+	return adminGroup{t.cache}.Close()
+}
+
+// Delete removes the value stored using `key` like Cache.Delete
+func (t *TypedCache[T]) Delete(key []byte) bool {
+	return t.cache.Delete(key)
+}
+
+// Flush removes every value of the Cache storing the values,
+//
+// found with AsAdmin, implementing Admin
+func (t *TypedCache[T]) Flush() {
+	adminGroup{t.cache}.Flush()
+}
+
+// Get returns the decoded value stored using `key` and its TTL.
+//
+// Returns ErrKeyNotFound on a miss, or the Codec error when the stored
+// value cannot be decoded into `T`
+func (t *TypedCache[T]) Get(key []byte) (*T, time.Duration, error) {
+	data, ttl, ok := t.cache.GetOK(key)
+	if !ok {
+		return nil, 0, ErrKeyNotFound
+	}
+
+	value := new(T)
+	if err := t.codec.Unmarshal(data, value); err != nil {
+		return nil, 0, fmt.Errorf("cache: decode %q: %w", key, err)
+	}
+
+	return value, ttl, nil
+}
+
+// Len returns the amount of entries of the Cache storing the values,
+//
+// found with AsAdmin, implementing Admin
+func (t *TypedCache[T]) Len() int {
+	return adminGroup{t.cache}.Len()
+}
+
+// Set encodes `value` and stores it using `key` with `ttl` like Cache.Set.
+//
+// Returns the Codec error and stores nothing when `value` cannot be encoded
+func (t *TypedCache[T]) Set(key []byte, value T, ttl time.Duration) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cache: encode %q: %w", key, err)
+	}
+
+	t.cache.Set(key, data, ttl)
+	return nil
+}
+
+// Stats returns the metrics of the Cache storing the values,
+//
+// found with AsAdmin, implementing Admin
+func (t *TypedCache[T]) Stats() Stats {
+	return adminGroup{t.cache}.Stats()
+}
+
+// Unwrap returns the Cache storing the encoded values
+func (t *TypedCache[T]) Unwrap() Cache {
+	return t.cache
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// jsonCodec encodes values with encoding/json
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type typedUser struct {
+	Name string
+	Age  int
+}
+
+func TestTypedCache_Admin(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	tiered := NewTieredCache(cache, newFakeStore(), time.Minute)
+	typed := NewTypedCache[typedUser](tiered, nil)
+	typed.Set([]byte("john"), typedUser{Name: "John", Age: 42}, time.Minute)
+
+	// Test
+	// three layers of wrapping: TypedCache over the CacheV2 adapter over a TieredCache
+	if admin, ok := AsAdmin(typed.Unwrap()); !ok || admin != Admin(tiered) {
+		t.Errorf("wrong value for AsAdmin(Unwrap()). Expected %p but got %v", tiered, admin)
+	}
+
+	var admin Admin = typed
+	if admin.Len() != 1 {
+		t.Errorf("wrong value for Admin.Len(). Expected 1 but got %v", admin.Len())
+	}
+
+	typed.Get([]byte("john"))
+	if stats := admin.Stats(); stats.Hits != 1 {
+		t.Errorf("wrong value for Admin.Stats().Hits. Expected 1 but got %v", stats.Hits)
+	}
+
+	admin.Flush()
+	if cache.Len() != 0 {
+		t.Errorf("Admin.Flush() should empty the unwrapped cache but got %v entries", cache.Len())
+	}
+
+	if err := admin.Close(); err != nil {
+		t.Errorf("wrong value for Admin.Close(). Expected nil but got %v", err)
+	}
+}
+
+func TestTypedCache_Get(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": nil, "json": jsonCodec{}} {
+		// Setup
+		cache := NewActiveCache()
+		cache.StopCleaner()
+		typed := NewTypedCache[typedUser](cache, codec)
+
+		// Test
+		if err := typed.Set([]byte("john"), typedUser{Name: "John", Age: 42}, time.Minute); err != nil {
+			t.Errorf("wrong value for %s Set(). Expected nil but got %v", name, err)
+		}
+
+		user, ttl, err := typed.Get([]byte("john"))
+		if err != nil || *user != (typedUser{Name: "John", Age: 42}) || ttl != time.Minute {
+			t.Errorf("wrong value for %s Get(john). Expected ({John 42}, 1m, nil) but got (%v, %v, %v)", name, user, ttl, err)
+		}
+
+		if user, _, err := typed.Get([]byte("jane")); user != nil || err != ErrKeyNotFound {
+			t.Errorf("wrong value for %s Get(jane). Expected (nil, %v) but got (%v, %v)", name, ErrKeyNotFound, user, err)
+		}
+
+		// Test values not written by the codec are reported
+		cache.SetPermanent([]byte("invalid"), []byte("\xff not encoded"))
+		if user, _, err := typed.Get([]byte("invalid")); user != nil || err == nil {
+			t.Errorf("wrong value for %s Get(invalid). Expected a decode error but got (%v, %v)", name, user, err)
+		}
+	}
+}
+
+func TestTypedCache_Set(t *testing.T) {
+	// Setup
+	cache := NewActiveCache()
+	cache.StopCleaner()
+	typed := NewTypedCache[func()](cache, jsonCodec{})
+
+	// Test encoding errors are returned and nothing is stored
+	var unsupported *json.UnsupportedTypeError
+	if err := typed.Set([]byte("fn"), func() {}, NoExpiration); !errors.As(err, &unsupported) {
+		t.Errorf("wrong value for Set() of an unsupported type. Expected *json.UnsupportedTypeError but got %v", err)
+	}
+
+	if cache.Has([]byte("fn")) {
+		t.Errorf("Set() should store nothing when encoding fails")
+	}
+}
@@ -0,0 +1,107 @@
+// Command cachedump inspects and rewrites cache dumps written by cache.WriteDump.
+//
+// It loads the dump given with -in into an ActiveCache, entries keeping the
+// remaining TTL they had when dumped, then writes them to -out or, without
+// -out, lists them on stdout:
+//
+//	cachedump -in prod.dump -out staging.dump
+//	cachedump -in prod.dump
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yamauthi/active-cache-challenge/cache"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "cachedump:", err)
+		os.Exit(1)
+	}
+}
+
+// run parses `args` and converts the -in dump to -out, or lists it on `stdout`
+func run(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("cachedump", flag.ContinueOnError)
+	in := flags.String("in", "", "dump file to read")
+	out := flags.String("out", "", "dump file to write, entries are listed on stdout if empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return errors.New("missing -in dump file")
+	}
+
+	c, err := load(*in)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if *out == "" {
+		return list(stdout, c)
+	}
+
+	if err := save(*out, c); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "%v entries written to %s\n", c.Len(), *out)
+	return nil
+}
+
+// list writes one line per live entry of `c` with its key, value length and remaining TTL
+func list(w io.Writer, c *cache.ActiveCache) error {
+	for _, item := range c.Entries() {
+		if _, err := fmt.Fprintf(w, "%q\t%v bytes\t%v\n", item.Key, len(item.Value), item.TTL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load returns an ActiveCache warmed with the dump stored in file `path`
+func load(path string) (*cache.ActiveCache, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	items, err := cache.ReadDump(f)
+	if err != nil {
+		return nil, err
+	}
+
+	c := cache.NewActiveCache()
+	for _, result := range c.SetMany(items) {
+		if result.Err != nil {
+			c.Close()
+			return nil, fmt.Errorf("key %q: %w", result.Key, result.Err)
+		}
+	}
+
+	return c, nil
+}
+
+// save writes a dump of `c` to file `path`, replacing it
+func save(path string, c *cache.ActiveCache) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := cache.WriteDump(f, c); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
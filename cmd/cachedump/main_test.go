@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yamauthi/active-cache-challenge/cache"
+)
+
+func TestRun(t *testing.T) {
+	// Setup
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.dump")
+	out := filepath.Join(dir, "out.dump")
+
+	c := cache.NewActiveCache()
+	c.SetPermanent([]byte("lorem"), []byte("ipsum"))
+	c.Set([]byte("john"), []byte("doe"), time.Minute)
+	if err := save(in, c); err != nil {
+		t.Fatalf("wrong value for save(). Expected nil but got %v", err)
+	}
+	c.Close()
+
+	// Test conversion
+	var stdout bytes.Buffer
+	if err := run([]string{"-in", in, "-out", out}, &stdout); err != nil {
+		t.Fatalf("wrong value for run(-in, -out). Expected nil but got %v", err)
+	}
+
+	if !strings.Contains(stdout.String(), "2 entries written") {
+		t.Errorf("wrong output for run(-in, -out). Expected 2 entries written but got %q", stdout.String())
+	}
+
+	converted, err := load(out)
+	if err != nil {
+		t.Fatalf("wrong value for load(). Expected nil but got %v", err)
+	}
+	defer converted.Close()
+
+	if val, ttl := converted.Get([]byte("john")); string(val) != "doe" || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("wrong value for Get(john) after conversion. Expected (doe, <= 1m) but got (%s, %v)", val, ttl)
+	}
+
+	// Test listing
+	stdout.Reset()
+	if err := run([]string{"-in", in}, &stdout); err != nil {
+		t.Fatalf("wrong value for run(-in). Expected nil but got %v", err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 {
+		t.Errorf("wrong output for run(-in). Expected 2 lines but got %q", stdout.String())
+	}
+
+	// Test errors
+	if err := run(nil, &stdout); err == nil {
+		t.Error("run() without -in should fail")
+	}
+
+	if err := run([]string{"-in", filepath.Join(dir, "missing.dump")}, &stdout); !os.IsNotExist(err) {
+		t.Errorf("wrong value for run() with missing -in. Expected not exist error but got %v", err)
+	}
+
+	os.WriteFile(in, []byte("not a dump"), 0o644)
+	if err := run([]string{"-in", in}, &stdout); err == nil {
+		t.Error("run() with an invalid dump should fail")
+	}
+}
@@ -0,0 +1,17 @@
+package hashmap
+
+// Cursor represents the position of a scan started by HashMap.ScanCursor
+//
+// or StripedHashMap.ScanCursor. It holds a stripe and bucket index and the
+// lowest hash left to visit in that bucket, so it stays valid while entries
+// are put or deleted. The zero value starts a scan from the beginning
+type Cursor struct {
+	stripe int
+	bucket int
+	from   uint64
+}
+
+// Done reports whether the scan reached the end of the hashmap
+func (c Cursor) Done() bool {
+	return c.bucket >= DefaultTableSize
+}
@@ -1,15 +1,87 @@
 package hashmap
 
-import "hash/maphash"
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math/rand"
+	"slices"
+	"sync"
+)
 
 const DefaultTableSize = 10
 
+// Map is the storage shared by HashMap and LockFreeHashMap, letting callers
+//
+// and benchmarks switch implementation. Keys with the same hash are treated as
+// the same key. HashMap is not safe for concurrent use, while LockFreeHashMap
+// reads take no lock and may run concurrently with its writes
+type Map[V any] interface {
+	// Delete removes the entry with key `key` if exists
+	Delete(key []byte)
+
+	// DeleteOK removes the entry with key `key` and returns the removed value
+	//
+	// and `true` if it existed, otherwise empty `V` and `false`
+	DeleteOK(key []byte) (V, bool)
+
+	// Get returns the value stored using `key` and `true` if key exists,
+	//
+	// otherwise empty `V` and `false`
+	Get(key []byte) (V, bool)
+
+	// GetString returns the value stored using string key `key` like Get
+	GetString(key string) (V, bool)
+
+	// Len returns the amount of stored entries
+	Len() int
+
+	// Put stores `value` with specified `key` and returns the replaced value
+	//
+	// and `true` if key already existed, otherwise empty `V` and `false`
+	Put(key []byte, value V) (V, bool)
+
+	// Range calls `f` for each stored key and value until `f` returns false
+	Range(f func(key []byte, value V) bool)
+}
+
 // HashMap is a basic hashmap implementation
 //
 // values will be the type of `V` (any)
 type HashMap[V any] struct {
 	data [DefaultTableSize][]*entry[V]
 	hash maphash.Hash
+
+	// Hash function replacing maphash, nil on the zero value
+	hashFunc func([]byte) uint64
+
+	// Storage position the next Scan resumes from
+	cursor int
+
+	// Amount of keys hashed, lets tests count hash computations
+	hashWrites int
+
+	// Amount of writes matching a stored hash with different key bytes
+	collisions int
+
+	// Entries removed by deletes, reused by puts of new keys. Created on first use
+	entryPool *sync.Pool
+}
+
+var _ Map[any] = (*HashMap[any])(nil)
+
+// NewHashMap returns an empty hashmap hashing keys with `hash`,
+//
+// or with hash/maphash like the zero value when `hash` is nil.
+//
+// The hash decides the bucket of every key, so a custom one lets bucket
+// assignment match an external sharding scheme. It must be deterministic
+// and is kept for the whole lifetime of the map, clones included. Keys with
+// the same hash are treated as the same key
+func NewHashMap[V any](hash func([]byte) uint64) *HashMap[V] {
+	return &HashMap[V]{hashFunc: hash}
 }
 
 // entry represents a hashmap key value entry
@@ -19,17 +91,181 @@ type entry[V any] struct {
 	Value   V
 }
 
+// Stats represents the bucket distribution of a hashmap, see HashMap.Stats
+type Stats struct {
+	// Amount of buckets, DefaultTableSize
+	Buckets int
+
+	// Amount of stored entries
+	Entries int
+
+	// Length of the shortest and the longest bucket
+	MinBucketLen int
+	MaxBucketLen int
+
+	// Average bucket length, that is the load factor
+	MeanBucketLen float64
+
+	// Amount of buckets by bucket length, see BucketHistogram
+	BucketHistogram map[int]int
+
+	// Amount of writes that found a stored entry with the same hash but
+	// different key bytes, replacing it since keys are compared by hash
+	Collisions int
+}
+
+// BucketHistogram returns how many buckets have each bucket length.
+//
+// Keys are bucket lengths and values the amount of buckets with that length
+func (h *HashMap[V]) BucketHistogram() map[int]int {
+	histogram := map[int]int{}
+	for _, entries := range h.data {
+		histogram[len(entries)]++
+	}
+
+	return histogram
+}
+
+// CheckInvariants verifies every entry is stored in the bucket of its HashKey,
+//
+// that HashKey is the hash of its Key and that no hash is stored twice.
+// Returns every violation joined, nil if none. It hashes every key, so it is
+// meant for tests and debugging
+func (h *HashMap[V]) CheckInvariants() error {
+	var errs []error
+	seen := make(map[uint64]bool, h.Len())
+	for i, entries := range h.data {
+		for _, e := range entries {
+			if bucket := int(e.HashKey % DefaultTableSize); bucket != i {
+				errs = append(errs, fmt.Errorf("hashmap: key %q stored in bucket %d instead of %d", e.Key, i, bucket))
+			}
+
+			if sum := h.hashKey(e.Key); sum != e.HashKey {
+				errs = append(errs, fmt.Errorf("hashmap: key %q stored with hash %d but hashes to %d", e.Key, e.HashKey, sum))
+			}
+
+			if seen[e.HashKey] {
+				errs = append(errs, fmt.Errorf("hashmap: hash %d of key %q stored twice", e.HashKey, e.Key))
+			}
+			seen[e.HashKey] = true
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Clone returns a deep copy of the hashmap: buckets, entries and keys are copied
+//
+// and values are copied with `copier`, e.g. bytes.Clone for []byte values, or
+// assigned as is if `copier` is nil, which is only deep for values without references.
+//
+// The clone hashes keys like the original and is independent of it, puts and
+// deletes on either one are not seen by the other. It costs a key and a value copy
+// per entry on top of the buckets, see ShallowClone for the cheaper copy
+func (h *HashMap[V]) Clone(copier func(V) V) *HashMap[V] {
+	return h.clone(func(e *entry[V]) {
+		e.Key = bytes.Clone(e.Key)
+		if copier != nil {
+			e.Value = copier(e.Value)
+		}
+	})
+}
+
+// clone copies the bucket structure and entries, then calls `copyEntry`
+//
+// on every copied entry. Entries of a bucket are allocated at once
+func (h *HashMap[V]) clone(copyEntry func(e *entry[V])) *HashMap[V] {
+	clone := &HashMap[V]{cursor: h.cursor, hashFunc: h.hashFunc, collisions: h.collisions}
+	clone.hash.SetSeed(h.hash.Seed())
+	for i, bucket := range h.data {
+		if len(bucket) == 0 {
+			continue
+		}
+
+		entries := make([]entry[V], len(bucket))
+		clone.data[i] = make([]*entry[V], len(bucket))
+		for j, e := range bucket {
+			entries[j] = *e
+			copyEntry(&entries[j])
+			clone.data[i][j] = &entries[j]
+		}
+	}
+
+	return clone
+}
+
+// Compact shrinks every bucket slice to a capacity matching its length,
+//
+// releasing memory retained by bucket slices after deletes
+func (h *HashMap[V]) Compact() {
+	for i, bucket := range h.data {
+		if cap(bucket) == len(bucket) {
+			continue
+		}
+
+		if len(bucket) == 0 {
+			h.data[i] = nil
+			continue
+		}
+
+		compacted := make([]*entry[V], len(bucket))
+		copy(compacted, bucket)
+		h.data[i] = compacted
+	}
+}
+
 // Delete removes the entry with key `key` if exists
 func (h *HashMap[V]) Delete(key []byte) {
-	h.resetAndWriteHash(key)
-	for i, v := range h.data[(h.hash.Sum64() % DefaultTableSize)] {
-		if h.hash.Sum64() == v.HashKey {
-			// Remove element
-			h.data[(h.hash.Sum64() % DefaultTableSize)] = append(
-				h.data[(h.hash.Sum64() % DefaultTableSize)][:i],
-				h.data[(h.hash.Sum64() % DefaultTableSize)][i+1:]...,
-			)
-			return
+	h.DeleteOK(key)
+}
+
+// DeleteOK removes the entry with key `key` if exists
+//
+// returns the removed value and `true` if key existed
+//
+// otherwise return empty `V` and `false`
+func (h *HashMap[V]) DeleteOK(key []byte) (V, bool) {
+	return h.deleteOK(h.hashKey(key))
+}
+
+// deleteOK removes the entry whose hash is `sum` like DeleteOK
+func (h *HashMap[V]) deleteOK(sum uint64) (V, bool) {
+	bucket := sum % DefaultTableSize
+	for i, v := range h.data[bucket] {
+		if sum == v.HashKey {
+			if h.position(bucket, i) < h.cursor {
+				h.cursor--
+			}
+
+			// Remove element, clearing the slot left past the end
+			last := len(h.data[bucket]) - 1
+			h.data[bucket] = append(h.data[bucket][:i], h.data[bucket][i+1:]...)
+			h.data[bucket][:last+1][last] = nil
+
+			value := v.Value
+			h.release(v)
+			return value, true
+		}
+	}
+	return *new(V), false
+}
+
+// DeleteString removes the entry with string key `key` like Delete,
+//
+// hashing it without converting it to []byte
+func (h *HashMap[V]) DeleteString(key string) {
+	h.deleteOK(h.hashString(key))
+}
+
+// ForEach calls `f` for every stored entry with its hash, key and value,
+//
+// the hash deciding its bucket as `hashKey % DefaultTableSize`. Lets tooling
+// outside the package check bucket placement and collisions. The iteration
+// order is unspecified and `f` must not modify the hashmap
+func (h *HashMap[V]) ForEach(f func(hashKey uint64, key []byte, value V)) {
+	for _, entries := range h.data {
+		for _, e := range entries {
+			f(e.HashKey, e.Key, e.Value)
 		}
 	}
 }
@@ -40,55 +276,435 @@ func (h *HashMap[V]) Delete(key []byte) {
 //
 // otherwise return empty `V` and `false`
 func (h *HashMap[V]) Get(key []byte) (V, bool) {
-	h.resetAndWriteHash(key)
-	for _, v := range h.data[(h.hash.Sum64() % DefaultTableSize)] {
-		if h.hash.Sum64() == v.HashKey {
+	return h.get(h.hashKey(key))
+}
+
+// get returns the value of the entry whose hash is `sum` like Get
+func (h *HashMap[V]) get(sum uint64) (V, bool) {
+	for _, v := range h.data[sum%DefaultTableSize] {
+		if sum == v.HashKey {
 			return v.Value, true
 		}
 	}
 	return *new(V), false
 }
 
-// GetAll returns all stored keys as an array of `V`.
+// GetAll returns all stored entries as an array of `entry[V]`.
 //
-// returns nil if no values are found
+// returns an empty slice if no values are found
 func (h *HashMap[V]) GetAll() []entry[V] {
-	var values []entry[V]
+	var size int
+	for _, entries := range h.data {
+		size += len(entries)
+	}
+
+	values := make([]entry[V], 0, size)
 	for _, entries := range h.data {
 		for _, e := range entries {
 			values = append(values, *e)
 		}
 	}
 
-	if len(values) > 0 {
-		return values
+	return values
+}
+
+// GetString returns the value stored using string key `key` like Get,
+//
+// hashing it without converting it to []byte. A string key and a []byte
+// key with the same bytes address the same entry
+func (h *HashMap[V]) GetString(key string) (V, bool) {
+	return h.get(h.hashString(key))
+}
+
+// hashKey returns the hash of key `k` computed by the hash function,
+//
+// resetting and writing the maphash when none was given
+func (h *HashMap[V]) hashKey(k []byte) uint64 {
+	h.hashWrites++
+	if h.hashFunc != nil {
+		return h.hashFunc(k)
+	}
+
+	h.hash.Reset()
+	h.hash.Write(k)
+	return h.hash.Sum64()
+}
+
+// hashString returns the hash of string key `k` like hashKey with the same
+//
+// bytes. Only maphash hashes it without converting it to []byte
+func (h *HashMap[V]) hashString(k string) uint64 {
+	h.hashWrites++
+	if h.hashFunc != nil {
+		return h.hashFunc([]byte(k))
+	}
+
+	h.hash.Reset()
+	h.hash.WriteString(k)
+	return h.hash.Sum64()
+}
+
+// Len returns the amount of stored entries, counting every bucket
+func (h *HashMap[V]) Len() int {
+	var entries int
+	for _, bucket := range h.data {
+		entries += len(bucket)
+	}
+
+	return entries
+}
+
+// LoadFactor returns the amount of stored entries divided by the amount of buckets
+func (h *HashMap[V]) LoadFactor() float64 {
+	var entries int
+	for _, bucket := range h.data {
+		entries += len(bucket)
+	}
+
+	return float64(entries) / float64(len(h.data))
+}
+
+// Lookup returns the key and value stored using `key`.
+//
+// The stored key differs from `key` only when both hash to the same HashKey.
+//
+// returns `false` if key does not exist
+func (h *HashMap[V]) Lookup(key []byte) ([]byte, V, bool) {
+	sum := h.hashKey(key)
+	for _, v := range h.data[sum%DefaultTableSize] {
+		if sum == v.HashKey {
+			return v.Key, v.Value, true
+		}
+	}
+	return nil, *new(V), false
+}
+
+// newEntry returns an entry holding `sum`, `key` and `value`,
+//
+// reusing one released by a delete when available
+func (h *HashMap[V]) newEntry(sum uint64, key []byte, value V) *entry[V] {
+	e, _ := h.pool().Get().(*entry[V])
+	if e == nil {
+		e = new(entry[V])
+	}
+
+	e.HashKey, e.Key, e.Value = sum, key, value
+	return e
+}
+
+// pool returns the pool of released entries, creating it on first use
+func (h *HashMap[V]) pool() *sync.Pool {
+	if h.entryPool == nil {
+		h.entryPool = &sync.Pool{}
+	}
+
+	return h.entryPool
+}
+
+// position returns the storage position of the `i`-th entry of `bucket`
+//
+// as if all buckets were laid out one after the other
+func (h *HashMap[V]) position(bucket uint64, i int) int {
+	for _, entries := range h.data[:bucket] {
+		i += len(entries)
 	}
 
-	return nil
+	return i
 }
 
 // Put stores `value` into hashmap with specified `key`
-func (h *HashMap[V]) Put(key []byte, value V) {
-	h.resetAndWriteHash(key)
-	for _, v := range h.data[(h.hash.Sum64() % DefaultTableSize)] {
-		if h.hash.Sum64() == v.HashKey {
+//
+// returns the replaced value and `true` if key already existed
+//
+// otherwise return empty `V` and `false`
+func (h *HashMap[V]) Put(key []byte, value V) (V, bool) {
+	return h.put(h.hashKey(key), func() []byte { return key }, func(k []byte) bool { return bytes.Equal(k, key) }, value)
+}
+
+// put stores `value` in the entry whose hash is `sum` like Put.
+//
+// `key` is only called when a new entry is added, `equal` reports whether
+// the key of an entry with the same hash is the written one, see Stats
+func (h *HashMap[V]) put(sum uint64, key func() []byte, equal func([]byte) bool, value V) (V, bool) {
+	bucket := sum % DefaultTableSize
+	for _, v := range h.data[bucket] {
+		if sum == v.HashKey {
+			if !equal(v.Key) {
+				h.collisions++
+			}
+			old := v.Value
 			v.Value = value
-			return
+			return old, true
 		}
 	}
 
-	h.data[(h.hash.Sum64() % DefaultTableSize)] = append(
-		h.data[(h.hash.Sum64()%DefaultTableSize)],
-		&entry[V]{
-			HashKey: h.hash.Sum64(),
-			Key:     key,
-			Value:   value,
-		},
-	)
+	if h.position(bucket, len(h.data[bucket])) < h.cursor {
+		h.cursor++
+	}
+
+	h.data[bucket] = append(h.data[bucket], h.newEntry(sum, key(), value))
+	return *new(V), false
 }
 
-// resetAndWriteHash reset the hash bytes and write new ones
-func (h *HashMap[V]) resetAndWriteHash(k []byte) {
-	h.hash.Reset()
-	h.hash.Write(k)
+// PutIfAbsent stores `value` with specified `key` unless the key already exists,
+//
+// hashing the key once for both the lookup and the insert.
+//
+// returns `value` and `true` if it was stored
+//
+// otherwise return the existing value and `false`
+func (h *HashMap[V]) PutIfAbsent(key []byte, value V) (V, bool) {
+	sum := h.hashKey(key)
+	bucket := sum % DefaultTableSize
+	for _, v := range h.data[bucket] {
+		if sum == v.HashKey {
+			if !bytes.Equal(v.Key, key) {
+				h.collisions++
+			}
+			return v.Value, false
+		}
+	}
+
+	if h.position(bucket, len(h.data[bucket])) < h.cursor {
+		h.cursor++
+	}
+
+	h.data[bucket] = append(h.data[bucket], h.newEntry(sum, key, value))
+	return value, true
+}
+
+// PutString stores `value` with string key `key` like Put, hashing it
+//
+// without converting it to []byte. The key is only copied to []byte when
+// a new entry is added
+func (h *HashMap[V]) PutString(key string, value V) (V, bool) {
+	return h.put(h.hashString(key), func() []byte { return []byte(key) }, func(k []byte) bool { return string(k) == key }, value)
+}
+
+// Range calls `f` for each stored key and value until `f` returns false.
+//
+// Iteration order is unspecified and `f` must not modify the hashmap
+func (h *HashMap[V]) Range(f func(key []byte, value V) bool) {
+	for _, entries := range h.data {
+		for _, e := range entries {
+			if !f(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
+
+// release clears `e`, removed from its bucket, and returns it to the pool.
+//
+// Entries are never shared outside the buckets, functions returning entries
+// return copies, so no reference to `e` remains
+func (h *HashMap[V]) release(e *entry[V]) {
+	*e = entry[V]{}
+	h.pool().Put(e)
+}
+
+// Sample returns up to `n` entries chosen uniformly at random
+//
+// among those for which `filter` returns true, or among all entries if
+// `filter` is nil. Order of the returned entries is unspecified.
+//
+// Returns an empty slice if no entries match
+func (h *HashMap[V]) Sample(n int, filter func(key []byte, value V) bool) []entry[V] {
+	sample, _, _ := h.sample(make([]entry[V], 0, max(n, 0)), 0, n, 0, h.Len(), filter)
+	return sample
+}
+
+// sample adds up to `limit` entries of the hashmap, from storage position `start`
+//
+// on, to the reservoir `sample` of up to `n` entries like Sample, `matched`
+// entries having been offered to it already. Returns the reservoir, the amount
+// of offered entries and the amount of visited ones, so the reservoir can be
+// carried over several hashmaps
+func (h *HashMap[V]) sample(sample []entry[V], matched, n, start, limit int, filter func(key []byte, value V) bool) ([]entry[V], int, int) {
+	var visited int
+	skip := start
+	for _, entries := range h.data {
+		if skip >= len(entries) {
+			skip -= len(entries)
+			continue
+		}
+
+		for _, e := range entries[skip:] {
+			if visited >= limit {
+				return sample, matched, visited
+			}
+
+			visited++
+			if filter != nil && !filter(e.Key, e.Value) {
+				continue
+			}
+
+			// reservoir sampling: the i-th match replaces a sampled entry with probability n/i
+			matched++
+			if len(sample) < n {
+				sample = append(sample, *e)
+			} else if i := rand.Intn(matched); i < n {
+				sample[i] = *e
+			}
+		}
+		skip = 0
+	}
+
+	return sample, matched, visited
+}
+
+// SampleWindow returns up to `n` entries chosen uniformly at random among those
+//
+// of `window` consecutive entries in storage order, starting at a random
+// position and wrapping around, for which `filter` returns true, or among all
+// of them if `filter` is nil.
+//
+// Unlike Sample it visits at most `window` entries whatever the amount of
+// stored ones, at the cost of choosing among entries stored close to each
+// other. Returns an empty slice if no entries match
+func (h *HashMap[V]) SampleWindow(n, window int, filter func(key []byte, value V) bool) []entry[V] {
+	sample := make([]entry[V], 0, max(n, 0))
+	total := h.Len()
+	if total == 0 || window <= 0 {
+		return sample
+	}
+
+	window = min(window, total)
+	sample, matched, visited := h.sample(sample, 0, n, rand.Intn(total), window, filter)
+	sample, _, _ = h.sample(sample, matched, n, 0, window-visited, filter)
+	return sample
+}
+
+// Scan returns up to `n` entries for which `filter` returns true, or any entries
+//
+// if `filter` is nil, in storage order resuming where the previous Scan stopped
+// and wrapping around once the last entry was visited.
+//
+// Unlike Sample, repeated calls visit every entry once before revisiting any,
+// even while entries are put or deleted between calls. Order of the returned
+// entries is unspecified. Returns an empty slice if no entries match
+func (h *HashMap[V]) Scan(n int, filter func(key []byte, value V) bool) []entry[V] {
+	scan, _ := h.scan(make([]entry[V], 0, max(n, 0)), n, h.Len(), filter)
+	return scan
+}
+
+// scan appends entries to `scan` like Scan until it holds `n` entries or
+//
+// `limit` entries were visited, and returns it with the amount of visited
+// entries. The cursor wraps to the first entry once the last one is visited
+func (h *HashMap[V]) scan(scan []entry[V], n, limit int, filter func(key []byte, value V) bool) ([]entry[V], int) {
+	total := h.Len()
+	if total == 0 {
+		h.cursor = 0
+		return scan, 0
+	}
+
+	if h.cursor >= total {
+		h.cursor = 0
+	}
+
+	var visited int
+	skip := h.cursor
+walk:
+	for pass := 0; pass < 2; pass++ {
+		for _, entries := range h.data {
+			if skip >= len(entries) {
+				skip -= len(entries)
+				continue
+			}
+
+			for _, e := range entries[skip:] {
+				if visited == min(limit, total) || len(scan) >= n {
+					break walk
+				}
+
+				visited++
+				if filter == nil || filter(e.Key, e.Value) {
+					scan = append(scan, *e)
+				}
+			}
+			skip = 0
+		}
+	}
+
+	h.cursor = (h.cursor + visited) % total
+	return scan, visited
+}
+
+// ScanCursor returns up to `n` entries for which `filter` returns true, or any
+//
+// entries if `filter` is nil, starting at `cursor`, with the cursor the next
+// call resumes from. Entries are visited bucket by bucket in ascending hash
+// order, so the position survives puts and deletes between calls.
+//
+// A scan started with the zero Cursor and run until Cursor.Done visits every
+// entry stored for the whole scan exactly once. Entries put or deleted
+// meanwhile may or may not be visited, but none is visited twice. Unlike
+// Scan no state is kept in the hashmap, so several scans may run at once
+func (h *HashMap[V]) ScanCursor(cursor Cursor, n int, filter func(key []byte, value V) bool) ([]entry[V], Cursor) {
+	return h.scanCursor(make([]entry[V], 0, max(n, 0)), cursor, n, filter)
+}
+
+// scanCursor appends entries to `scan` like ScanCursor until it holds `n`
+//
+// entries or the scan is done, and returns it with the cursor to resume from
+func (h *HashMap[V]) scanCursor(scan []entry[V], cursor Cursor, n int, filter func(key []byte, value V) bool) ([]entry[V], Cursor) {
+	for !cursor.Done() && len(scan) < n {
+		var pending []*entry[V]
+		for _, e := range h.data[cursor.bucket] {
+			if e.HashKey >= cursor.from {
+				pending = append(pending, e)
+			}
+		}
+		slices.SortFunc(pending, func(a, b *entry[V]) int {
+			return cmp.Compare(a.HashKey, b.HashKey)
+		})
+
+		for _, e := range pending {
+			if len(scan) >= n {
+				cursor.from = e.HashKey
+				return scan, cursor
+			}
+
+			if filter == nil || filter(e.Key, e.Value) {
+				scan = append(scan, *e)
+			}
+		}
+
+		cursor = Cursor{bucket: cursor.bucket + 1}
+	}
+
+	return scan, cursor
+}
+
+// ShallowClone returns a copy of the hashmap sharing keys and values with it.
+//
+// Buckets and entries are copied, so puts and deletes on either one are not seen
+// by the other, but changes made inside a shared value, e.g. to the bytes of a
+// []byte value, are seen by both. Cheaper than Clone as nothing is copied per
+// entry beyond the entry itself
+func (h *HashMap[V]) ShallowClone() *HashMap[V] {
+	return h.clone(func(e *entry[V]) {})
+}
+
+// Stats returns the bucket distribution of the hashmap and the amount of
+//
+// hash collisions detected by writes, to tune the table size. It costs one
+// pass over the buckets and does not hash any key
+func (h *HashMap[V]) Stats() Stats {
+	stats := Stats{
+		Buckets:         len(h.data),
+		MinBucketLen:    len(h.data[0]),
+		BucketHistogram: h.BucketHistogram(),
+		Collisions:      h.collisions,
+	}
+
+	for _, bucket := range h.data {
+		stats.Entries += len(bucket)
+		stats.MinBucketLen = min(stats.MinBucketLen, len(bucket))
+		stats.MaxBucketLen = max(stats.MaxBucketLen, len(bucket))
+	}
+	stats.MeanBucketLen = float64(stats.Entries) / float64(stats.Buckets)
+
+	return stats
 }
@@ -2,9 +2,12 @@ package hashmap
 
 import (
 	"bytes"
+	"fmt"
+	"hash/fnv"
 	"hash/maphash"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +15,239 @@ const BenchmarkEntries = 10
 
 var hashmap HashMap[[]byte]
 
+func TestNewHashMap(t *testing.T) {
+	// Setup
+	fnvHash := func(key []byte) uint64 {
+		h := fnv.New64a()
+		h.Write(key)
+		return h.Sum64()
+	}
+	hm := NewHashMap[[]byte](fnvHash)
+
+	// Test keys are placed by the custom hash
+	keys := []string{"lorem", "ipsum", "john", "doe", "jane"}
+	for _, key := range keys {
+		hm.Put([]byte(key), []byte(key))
+		sum := fnvHash([]byte(key))
+		bucket := hm.data[sum%DefaultTableSize]
+		if len(bucket) == 0 || bucket[len(bucket)-1].HashKey != sum {
+			t.Errorf("Wrong bucket on HashMap.Put(%s) with custom hash. Expected bucket %v with HashKey %v", key, sum%DefaultTableSize, sum)
+		}
+	}
+
+	for _, key := range keys {
+		value, ok := hm.GetString(key)
+		if _, okBytes := hm.Get([]byte(key)); !ok || !okBytes || string(value) != key {
+			t.Errorf("Wrong value on HashMap.GetString(%s) with custom hash. Expected %s, but received %s", key, key, value)
+		}
+	}
+
+	// clones keep the hash function
+	clone := hm.ShallowClone()
+	clone.PutString("sit", []byte("amet"))
+	sum := fnvHash([]byte("sit"))
+	if bucket := clone.data[sum%DefaultTableSize]; len(bucket) == 0 || bucket[len(bucket)-1].HashKey != sum {
+		t.Errorf("Wrong bucket on cloned HashMap.PutString with custom hash. Expected bucket %v", sum%DefaultTableSize)
+	}
+
+	hm.DeleteString("lorem")
+	if _, ok := hm.Get([]byte("lorem")); ok {
+		t.Error("key was not deleted with custom hash")
+	}
+
+	// nil hash behaves like the zero value
+	hm = NewHashMap[[]byte](nil)
+	hm.Put([]byte("lorem"), []byte("ipsum"))
+	hashTest := maphash.Hash{}
+	hashTest.SetSeed(hm.hash.Seed())
+	hashTest.Write([]byte("lorem"))
+	if bucket := hm.data[hashTest.Sum64()%DefaultTableSize]; len(bucket) != 1 || bucket[0].HashKey != hashTest.Sum64() {
+		t.Errorf("Wrong bucket on HashMap.Put with nil hash. Expected maphash bucket %v", hashTest.Sum64()%DefaultTableSize)
+	}
+}
+
+func TestHashMap_BucketHistogram(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	for i := 0; i < 3; i++ {
+		hashmap.data[0] = append(hashmap.data[0], &entry[[]byte]{HashKey: uint64(i * DefaultTableSize)})
+	}
+	hashmap.data[1] = append(hashmap.data[1], &entry[[]byte]{HashKey: 1})
+	hashmap.data[2] = append(hashmap.data[2], &entry[[]byte]{HashKey: 2})
+
+	// Test
+	expected := map[int]int{0: DefaultTableSize - 3, 1: 2, 3: 1}
+	if histogram := hashmap.BucketHistogram(); !reflect.DeepEqual(expected, histogram) {
+		t.Errorf("Wrong value on HashMap.BucketHistogram. Expected %v, but received %v", expected, histogram)
+	}
+
+	hashmap = HashMap[[]byte]{}
+	expected = map[int]int{0: DefaultTableSize}
+	if histogram := hashmap.BucketHistogram(); !reflect.DeepEqual(expected, histogram) {
+		t.Errorf("Wrong value on empty HashMap.BucketHistogram. Expected %v, but received %v", expected, histogram)
+	}
+}
+
+func TestHashMap_CheckInvariants(t *testing.T) {
+	// Setup
+	newHashMap := func() *HashMap[int] {
+		h := &HashMap[int]{}
+		for i := 0; i < 20; i++ {
+			h.Put([]byte(fmt.Sprintf("key%v", i)), i)
+		}
+		return h
+	}
+
+	if err := newHashMap().CheckInvariants(); err != nil {
+		t.Errorf("Wrong value on HashMap.CheckInvariants. Expected nil, but received %v", err)
+	}
+
+	// Test every corruption is reported alone
+	tests := []struct {
+		name    string
+		corrupt func(h *HashMap[int])
+		message string
+	}{
+		{
+			name: "changed key",
+			corrupt: func(h *HashMap[int]) {
+				e := h.data[h.hashKey([]byte("key0"))%DefaultTableSize][0]
+				e.Key = []byte("other")
+			},
+			message: "but hashes to",
+		},
+		{
+			name: "wrong bucket",
+			corrupt: func(h *HashMap[int]) {
+				sum := h.hashKey([]byte("key0"))
+				bucket := sum % DefaultTableSize
+				moved := (bucket + 1) % DefaultTableSize
+				for i, e := range h.data[bucket] {
+					if e.HashKey == sum {
+						h.data[moved] = append(h.data[moved], e)
+						h.data[bucket] = append(h.data[bucket][:i], h.data[bucket][i+1:]...)
+						break
+					}
+				}
+			},
+			message: "instead of",
+		},
+		{
+			name: "duplicated hash",
+			corrupt: func(h *HashMap[int]) {
+				bucket := h.hashKey([]byte("key0")) % DefaultTableSize
+				copied := *h.data[bucket][0]
+				h.data[bucket] = append(h.data[bucket], &copied)
+			},
+			message: "stored twice",
+		},
+	}
+
+	for _, tt := range tests {
+		h := newHashMap()
+		tt.corrupt(h)
+		err := h.CheckInvariants()
+		if err == nil || strings.Count(err.Error(), "\n") != 0 || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("Wrong value on HashMap.CheckInvariants after %s. Expected a single violation containing %q, but received %v", tt.name, tt.message, err)
+		}
+	}
+}
+
+func TestHashMap_Clone(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+	hashmap.Put([]byte("john"), []byte("doe"))
+
+	// Test
+	clone := hashmap.Clone(bytes.Clone)
+	hashmap.Put([]byte("lorem"), []byte("dolor"))
+	hashmap.Delete([]byte("john"))
+	hashmap.Put([]byte("jane"), []byte("foster"))
+
+	for key, expected := range map[string]string{"lorem": "ipsum", "john": "doe"} {
+		if value, ok := clone.Get([]byte(key)); !ok || string(value) != expected {
+			t.Errorf("Wrong value on cloned HashMap.Get(%s). Expected %s, but received %s", key, expected, value)
+		}
+	}
+
+	if _, ok := clone.Get([]byte("jane")); ok {
+		t.Error("Keys put on the original HashMap should not be seen by the clone")
+	}
+
+	// Values are copied, in-place changes are not shared
+	value, _ := clone.Get([]byte("lorem"))
+	value[0] = 'L'
+	if value, _ := clone.Get([]byte("lorem")); string(value) != "Lpsum" {
+		t.Errorf("Wrong value on cloned HashMap.Get(lorem). Expected Lpsum, but received %s", value)
+	}
+
+	source := HashMap[[]byte]{}
+	source.Put([]byte("lorem"), []byte("ipsum"))
+	copied := source.Clone(bytes.Clone)
+	stored, _ := source.Get([]byte("lorem"))
+	stored[0] = 'I'
+	if value, _ := copied.Get([]byte("lorem")); string(value) != "ipsum" {
+		t.Errorf("HashMap.Clone should copy values with the copier. Expected ipsum, but received %s", value)
+	}
+
+	// Clones of clones keep the hash seed
+	if value, ok := copied.Clone(nil).Get([]byte("lorem")); !ok || string(value) != "ipsum" {
+		t.Errorf("Wrong value on HashMap.Get(lorem) of a clone without copier. Expected ipsum, but received %s", value)
+	}
+}
+
+func TestHashMap_Compact(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	const entries = 200
+	for i := 0; i < entries; i++ {
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+
+	for i := 0; i < entries; i++ {
+		if i%4 != 0 {
+			hashmap.Delete([]byte(fmt.Sprintf("key%v", i)))
+		}
+	}
+
+	var grown bool
+	for _, bucket := range hashmap.data {
+		if cap(bucket) > len(bucket) {
+			grown = true
+		}
+	}
+
+	if !grown {
+		t.Fatal("expected buckets with capacity greater than length before Compact()")
+	}
+
+	// Test
+	hashmap.Compact()
+	for i, bucket := range hashmap.data {
+		if cap(bucket) != len(bucket) {
+			t.Errorf("bucket %v not compacted. Expected cap %v but got %v", i, len(bucket), cap(bucket))
+		}
+	}
+
+	for i := 0; i < entries; i += 4 {
+		if _, ok := hashmap.Get([]byte(fmt.Sprintf("key%v", i))); !ok {
+			t.Errorf("key%v should remain after Compact()", i)
+		}
+	}
+
+	// Empty buckets are released
+	for i := 0; i < entries; i += 4 {
+		hashmap.Delete([]byte(fmt.Sprintf("key%v", i)))
+	}
+	hashmap.Compact()
+	for i, bucket := range hashmap.data {
+		if bucket != nil {
+			t.Errorf("empty bucket %v should be released after Compact() but has cap %v", i, cap(bucket))
+		}
+	}
+}
+
 func TestHashMap_Delete(t *testing.T) {
 	hashmap = HashMap[[]byte]{}
 	key := []byte("lorem")
@@ -36,6 +272,93 @@ func TestHashMap_Delete(t *testing.T) {
 	}
 }
 
+func TestHashMap_DeleteOK(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+
+	// Test
+	val, ok := hashmap.DeleteOK([]byte("lorem"))
+	if !ok || !bytes.Equal(val, []byte("ipsum")) {
+		t.Errorf("Wrong value on DeleteOK. Expected (ipsum, true), but received (%s, %v)", val, ok)
+	}
+
+	val, ok = hashmap.DeleteOK([]byte("lorem"))
+	if ok || val != nil {
+		t.Errorf("Wrong value on DeleteOK for removed key. Expected (nil, false), but received (%s, %v)", val, ok)
+	}
+
+	if _, ok = hashmap.Get([]byte("lorem")); ok {
+		t.Error("key was not deleted")
+	}
+}
+
+func TestHashMap_DeleteString(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+	hashmap.Put([]byte("john"), []byte("doe"))
+
+	// Test
+	hashmap.DeleteString("lorem")
+	hashmap.DeleteString("nonexistent key")
+	if _, ok := hashmap.Get([]byte("lorem")); ok {
+		t.Error("key was not deleted")
+	}
+
+	if value, ok := hashmap.Get([]byte("john")); !ok || string(value) != "doe" {
+		t.Errorf("Wrong value on HashMap.Get(john) after DeleteString. Expected doe, but received %s", value)
+	}
+}
+
+func TestHashMap_ForEach(t *testing.T) {
+	// Setup
+	hm := HashMap[[]byte]{}
+	hashTest := maphash.Hash{}
+	hashTest.SetSeed(hm.hash.Seed())
+
+	expected := map[string]string{"key": "value2", "lorem": "ipsum", "john": "doe"}
+	hm.Put([]byte("key"), []byte("value"))
+	for key, value := range expected {
+		hm.Put([]byte(key), []byte(value))
+	}
+
+	// Test every entry is visited once with the hash placing it
+	visited := map[string]string{}
+	hm.ForEach(func(hashKey uint64, key, value []byte) {
+		hashTest.Reset()
+		hashTest.Write(key)
+		if hashKey != hashTest.Sum64() {
+			t.Errorf("Wrong hash on HashMap.ForEach for key %s. Expected %v, but received %v", key, hashTest.Sum64(), hashKey)
+		}
+
+		if _, ok := visited[string(key)]; ok {
+			t.Errorf("Wrong iteration on HashMap.ForEach. Key %s visited twice", key)
+		}
+		visited[string(key)] = string(value)
+	})
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Wrong entries on HashMap.ForEach. Expected %v, but received %v", expected, visited)
+	}
+
+	// Test colliding keys share one entry keeping the key stored first
+	colliding := NewHashMap[int](func(key []byte) uint64 { return uint64(len(key)) })
+	colliding.Put([]byte("lorem"), 1)
+	colliding.Put([]byte("ipsum"), 2)
+	colliding.Put([]byte("john"), 3)
+
+	buckets := map[uint64][]string{}
+	colliding.ForEach(func(hashKey uint64, key []byte, value int) {
+		buckets[hashKey%DefaultTableSize] = append(buckets[hashKey%DefaultTableSize], fmt.Sprintf("%s=%v", key, value))
+	})
+
+	expectedBuckets := map[uint64][]string{4: {"john=3"}, 5: {"lorem=2"}}
+	if !reflect.DeepEqual(buckets, expectedBuckets) {
+		t.Errorf("Wrong buckets on colliding HashMap.ForEach. Expected %v, but received %v", expectedBuckets, buckets)
+	}
+}
+
 func TestHashMap_Get(t *testing.T) {
 	hashmap = HashMap[[]byte]{}
 	hashTest := maphash.Hash{}
@@ -145,15 +468,95 @@ func TestHashMap_GetAll(t *testing.T) {
 
 	// Test empty hashmap
 	hashmap = HashMap[[]byte]{}
-	if hashmap.GetAll() != nil {
+	if out := hashmap.GetAll(); out == nil || len(out) != 0 {
 		t.Errorf(
-			"Wrong value on HashMap.GetAll. Expected %v, but received %v",
-			expected,
+			"Wrong value on empty HashMap.GetAll. Expected empty slice, but received %#v",
 			out,
 		)
 	}
 }
 
+func TestHashMap_GetString(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+	hashmap.Put([]byte(""), []byte("empty"))
+
+	// Test
+	for key, expected := range map[string]string{"lorem": "ipsum", "": "empty"} {
+		if value, ok := hashmap.GetString(key); !ok || string(value) != expected {
+			t.Errorf("Wrong value on HashMap.GetString(%q). Expected %s, but received %s", key, expected, value)
+		}
+	}
+
+	if value, ok := hashmap.GetString("nonexistent key"); ok {
+		t.Errorf("Wrong value on HashMap.GetString of a missing key. Expected (nil, false), but received (%s, %v)", value, ok)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { hashmap.GetString("lorem") }); allocs != 0 {
+		t.Errorf("HashMap.GetString should not allocate, but allocated %v times", allocs)
+	}
+}
+
+func TestHashMap_Len(t *testing.T) {
+	// Setup
+	hm := HashMap[string]{}
+	for i := 0; i < 25; i++ {
+		hm.Put([]byte(fmt.Sprint(i)), "value")
+	}
+
+	// Test
+	if length := hm.Len(); length != 25 {
+		t.Errorf("Wrong value on HashMap.Len. Expected 25, but received %v", length)
+	}
+
+	hm.Delete([]byte("0"))
+	if length := hm.Len(); length != 24 {
+		t.Errorf("Wrong value on HashMap.Len after delete. Expected 24, but received %v", length)
+	}
+}
+
+func TestHashMap_LoadFactor(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+
+	// Test
+	if lf := hashmap.LoadFactor(); lf != 0 {
+		t.Errorf("Wrong value on empty HashMap.LoadFactor. Expected 0, but received %v", lf)
+	}
+
+	for i := 0; i < 25; i++ {
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i)), []byte("value"))
+	}
+
+	if lf := hashmap.LoadFactor(); lf != 2.5 {
+		t.Errorf("Wrong value on HashMap.LoadFactor. Expected 2.5, but received %v", lf)
+	}
+}
+
+func TestHashMap_Lookup(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+
+	// Test
+	key, value, ok := hashmap.Lookup([]byte("lorem"))
+	if !ok || string(key) != "lorem" || string(value) != "ipsum" {
+		t.Errorf("Wrong value on HashMap.Lookup. Expected (lorem, ipsum, true), but received (%s, %s, %v)", key, value, ok)
+	}
+
+	if key, value, ok := hashmap.Lookup([]byte("missing")); ok || key != nil || value != nil {
+		t.Errorf("Wrong value on missing HashMap.Lookup. Expected (nil, nil, false), but received (%s, %s, %v)", key, value, ok)
+	}
+
+	// force a collision: another key stored with the HashKey of "lorem"
+	bucket := hashmap.data[hashmap.hashKey([]byte("lorem"))%DefaultTableSize]
+	bucket[0].Key = []byte("collision")
+	if key, _, ok := hashmap.Lookup([]byte("lorem")); !ok || string(key) != "collision" {
+		t.Errorf("Wrong key on colliding HashMap.Lookup. Expected collision, but received %s", key)
+	}
+}
+
 func TestHashMap_Put(t *testing.T) {
 	hashmap = HashMap[[]byte]{}
 	hashTest := maphash.Hash{}
@@ -184,8 +587,21 @@ func TestHashMap_Put(t *testing.T) {
 		return nil
 	}
 
+	putKeys := map[string][]byte{}
 	for _, tc := range testsCase {
-		hashmap.Put(tc.key, tc.value)
+		old, replaced := hashmap.Put(tc.key, tc.value)
+		expectedOld, expectedReplaced := putKeys[string(tc.key)]
+		if replaced != expectedReplaced || !bytes.Equal(old, expectedOld) {
+			t.Errorf(
+				"Wrong replaced value for key %v. Expected (%s, %v), but received (%s, %v)",
+				tc.key,
+				expectedOld,
+				expectedReplaced,
+				old,
+				replaced,
+			)
+		}
+		putKeys[string(tc.key)] = tc.value
 
 		// prepare to calculate key hash
 		hashTest.Reset()
@@ -209,3 +625,503 @@ func TestHashMap_Put(t *testing.T) {
 		t.Errorf("Expected existing pointer to entry with key %v and value %s", tc.key, tc.value)
 	}
 }
+
+func TestHashMap_PutIfAbsent(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+
+	// Test
+	writes := hashmap.hashWrites
+	value, stored := hashmap.PutIfAbsent([]byte("john"), []byte("doe"))
+	if !stored || string(value) != "doe" {
+		t.Errorf("Wrong value on HashMap.PutIfAbsent of a new key. Expected (doe, true), but received (%s, %v)", value, stored)
+	}
+
+	if hashmap.hashWrites-writes != 1 {
+		t.Errorf("HashMap.PutIfAbsent should hash the key once, but hashed it %v times", hashmap.hashWrites-writes)
+	}
+
+	writes = hashmap.hashWrites
+	value, stored = hashmap.PutIfAbsent([]byte("lorem"), []byte("dolor"))
+	if stored || string(value) != "ipsum" {
+		t.Errorf("Wrong value on HashMap.PutIfAbsent of an existing key. Expected (ipsum, false), but received (%s, %v)", value, stored)
+	}
+
+	if hashmap.hashWrites-writes != 1 {
+		t.Errorf("HashMap.PutIfAbsent should hash the key once, but hashed it %v times", hashmap.hashWrites-writes)
+	}
+
+	for key, expected := range map[string]string{"lorem": "ipsum", "john": "doe"} {
+		if value, ok := hashmap.Get([]byte(key)); !ok || string(value) != expected {
+			t.Errorf("Wrong value on HashMap.Get(%s) after PutIfAbsent. Expected %s, but received %s", key, expected, value)
+		}
+	}
+}
+
+func TestHashMap_PutString(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+
+	// Test
+	if old, replaced := hashmap.PutString("lorem", []byte("ipsum")); replaced || old != nil {
+		t.Errorf("Wrong value on HashMap.PutString of a new key. Expected (nil, false), but received (%s, %v)", old, replaced)
+	}
+
+	old, replaced := hashmap.Put([]byte("lorem"), []byte("dolor"))
+	if !replaced || string(old) != "ipsum" {
+		t.Errorf("Wrong value on HashMap.Put of a key stored by PutString. Expected (ipsum, true), but received (%s, %v)", old, replaced)
+	}
+
+	old, replaced = hashmap.PutString("lorem", []byte("sit"))
+	if !replaced || string(old) != "dolor" {
+		t.Errorf("Wrong value on HashMap.PutString of an existing key. Expected (dolor, true), but received (%s, %v)", old, replaced)
+	}
+
+	key, _, _ := hashmap.Lookup([]byte("lorem"))
+	if len(hashmap.GetAll()) != 1 || string(key) != "lorem" {
+		t.Errorf("Wrong value on HashMap.Lookup after PutString. Expected lorem in 1 entry, but received %s in %v", key, len(hashmap.GetAll()))
+	}
+}
+
+func TestHashMap_Range(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	expected := map[string]string{"john": "doe", "key": "value", "lorem": "ipsum"}
+	for k, v := range expected {
+		hashmap.Put([]byte(k), []byte(v))
+	}
+
+	// Test
+	visited := map[string]string{}
+	hashmap.Range(func(key []byte, value []byte) bool {
+		visited[string(key)] = string(value)
+		return true
+	})
+
+	if !reflect.DeepEqual(expected, visited) {
+		t.Errorf("Wrong values on HashMap.Range. Expected %v, but received %v", expected, visited)
+	}
+
+	calls := 0
+	hashmap.Range(func(key []byte, value []byte) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("HashMap.Range should stop when f returns false. Expected 1 call, but received %v", calls)
+	}
+}
+
+func TestHashMap_release(t *testing.T) {
+	// Setup
+	const entries = 200
+	hashMap := &HashMap[int]{}
+	keys := make([][]byte, entries)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%v", i))
+	}
+
+	// Test churn reusing released entries for new keys
+	sample := hashMap.Sample(0, nil)
+	for round := 0; round < 20; round++ {
+		for i, key := range keys {
+			if (i+round)%2 == 0 {
+				hashMap.Put(key, i*round)
+			} else {
+				hashMap.Delete(key)
+			}
+		}
+
+		if round == 10 {
+			sample = hashMap.Sample(entries, nil)
+		}
+	}
+
+	// Every stored entry is held by a single slot and belongs to its key
+	seen := map[*entry[int]]bool{}
+	for _, bucket := range hashMap.data {
+		for _, e := range bucket {
+			if seen[e] {
+				t.Errorf("entry of key %s is stored twice", e.Key)
+			}
+			seen[e] = true
+		}
+
+		for _, stale := range bucket[len(bucket):cap(bucket)] {
+			if stale != nil {
+				t.Errorf("deleted slots should be cleared but key %s is still referenced", stale.Key)
+			}
+		}
+	}
+
+	for i, key := range keys {
+		value, ok := hashMap.Get(key)
+		if expected := (i+19)%2 == 0; ok != expected || (ok && value != i*19) {
+			t.Errorf("wrong value for Get(%s). Expected (%v, %v) but got (%v, %v)", key, i*19, expected, value, ok)
+		}
+	}
+
+	// Entries returned earlier are copies and keep their key and value
+	for _, e := range sample {
+		var i int
+		fmt.Sscanf(string(e.Key), "key%d", &i)
+		if e.Value != i*10 {
+			t.Errorf("sampled entry of key %s changed by later puts. Expected %v but got %v", e.Key, i*10, e.Value)
+		}
+	}
+}
+
+func TestHashMap_Sample(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	for i := 0; i < 50; i++ {
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i%2)))
+	}
+	even := func(key []byte, value []byte) bool {
+		return string(value) == "value0"
+	}
+
+	// Test
+	if out := (&HashMap[[]byte]{}).Sample(5, nil); out == nil || len(out) != 0 {
+		t.Errorf("Wrong value on empty HashMap.Sample. Expected empty slice, but received %#v", out)
+	}
+
+	if out := hashmap.Sample(100, nil); len(out) != 50 {
+		t.Errorf("Wrong length on HashMap.Sample. Expected 50, but received %v", len(out))
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		out := hashmap.Sample(5, even)
+		if len(out) != 5 {
+			t.Fatalf("Wrong length on filtered HashMap.Sample. Expected 5, but received %v", len(out))
+		}
+
+		sampled := map[string]bool{}
+		for _, e := range out {
+			if !even(e.Key, e.Value) {
+				t.Fatalf("HashMap.Sample should only return filtered entries, but received %s", e.Value)
+			}
+
+			if sampled[string(e.Key)] {
+				t.Fatalf("HashMap.Sample should not repeat entries, but received %s twice", e.Key)
+			}
+			sampled[string(e.Key)] = true
+			seen[string(e.Key)] = true
+		}
+	}
+
+	// 25 matching entries sampled 100 times by 5 are all expected to show up
+	if len(seen) != 25 {
+		t.Errorf("HashMap.Sample should be random. Expected all 25 entries sampled, but received %v", len(seen))
+	}
+}
+
+func TestHashMap_SampleWindow(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	for i := 0; i < 50; i++ {
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i%2)))
+	}
+
+	// Test
+	if out := (&HashMap[[]byte]{}).SampleWindow(5, 10, nil); out == nil || len(out) != 0 {
+		t.Errorf("Wrong value on empty HashMap.SampleWindow. Expected empty slice, but received %#v", out)
+	}
+
+	if out := hashmap.SampleWindow(100, 100, nil); len(out) != 50 {
+		t.Errorf("Wrong length on HashMap.SampleWindow larger than the hashmap. Expected 50, but received %v", len(out))
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		var visited int
+		out := hashmap.SampleWindow(100, 10, func(key []byte, value []byte) bool {
+			visited++
+			return true
+		})
+
+		if visited != 10 || len(out) != 10 {
+			t.Fatalf("HashMap.SampleWindow should visit the window only. Expected 10 visited and sampled, but received %v and %v", visited, len(out))
+		}
+
+		for _, e := range out {
+			seen[string(e.Key)] = true
+		}
+	}
+
+	// Windows start at random positions, 100 windows of 10 are all expected to cover the 50 entries
+	if len(seen) != 50 {
+		t.Errorf("HashMap.SampleWindow should be random. Expected all 50 entries sampled, but received %v", len(seen))
+	}
+}
+
+func TestHashMap_Scan(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	for i := 0; i < 23; i++ {
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i)))
+	}
+
+	// Test
+	if out := (&HashMap[[]byte]{}).Scan(5, nil); out == nil || len(out) != 0 {
+		t.Errorf("Wrong value on empty HashMap.Scan. Expected empty slice, but received %#v", out)
+	}
+
+	// Every entry is visited once per pass, despite puts and deletes between calls.
+	// Churned keys may or may not be visited depending on where they hash, so
+	// the pass is walked one entry at a time until every stable key was seen
+	seen := map[string]int{}
+	hashmap.Put([]byte("tmp0"), []byte("tmp"))
+	for i := 1; len(seen) < 23 && i < 100; i++ {
+		for _, e := range hashmap.Scan(1, nil) {
+			if string(e.Value) != "tmp" {
+				seen[string(e.Key)]++
+			}
+		}
+
+		hashmap.Put([]byte(fmt.Sprintf("tmp%v", i)), []byte("tmp"))
+		hashmap.Delete([]byte(fmt.Sprintf("tmp%v", i-1)))
+	}
+
+	for i := 0; i < 23; i++ {
+		if key := fmt.Sprintf("key%v", i); seen[key] != 1 {
+			t.Errorf("Wrong value on HashMap.Scan. Expected %s visited once per pass, but received %v visits", key, seen[key])
+		}
+	}
+
+	notTmp := func(key []byte, value []byte) bool {
+		return string(value) != "tmp"
+	}
+	for i := 0; i < 10; i++ {
+		for _, e := range hashmap.Scan(6, notTmp) {
+			if !notTmp(e.Key, e.Value) {
+				t.Fatalf("HashMap.Scan should only return filtered entries, but received %s", e.Value)
+			}
+		}
+	}
+}
+
+func TestHashMap_ScanCursor(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	for i := 0; i < 23; i++ {
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i)))
+	}
+
+	// Test
+	if out, cursor := (&HashMap[[]byte]{}).ScanCursor(Cursor{}, 5, nil); len(out) != 0 || !cursor.Done() {
+		t.Errorf("Wrong value on empty HashMap.ScanCursor. Expected no entries and a done cursor, but received %#v, %#v", out, cursor)
+	}
+
+	// Stable keys are visited once despite puts, deletes and overwrites between calls
+	seen := map[string]int{}
+	var cursor Cursor
+	for i := 0; !cursor.Done(); i++ {
+		if i > 100 {
+			t.Fatalf("HashMap.ScanCursor should terminate, but did not after %v calls", i)
+		}
+
+		var out []entry[[]byte]
+		out, cursor = hashmap.ScanCursor(cursor, 3, nil)
+		if len(out) > 3 {
+			t.Errorf("Wrong value on HashMap.ScanCursor length. Expected at most 3, but received %v", len(out))
+		}
+		for _, e := range out {
+			seen[string(e.Key)]++
+		}
+
+		hashmap.Put([]byte(fmt.Sprintf("tmp%v", i)), []byte("tmp"))
+		hashmap.Delete([]byte(fmt.Sprintf("tmp%v", i-1)))
+		hashmap.Put([]byte(fmt.Sprintf("key%v", i%23)), []byte("overwritten"))
+	}
+
+	for key, visits := range seen {
+		if visits != 1 {
+			t.Errorf("Wrong value on HashMap.ScanCursor. Expected %s visited once, but received %v visits", key, visits)
+		}
+	}
+	for i := 0; i < 23; i++ {
+		if key := fmt.Sprintf("key%v", i); seen[key] != 1 {
+			t.Errorf("Wrong value on HashMap.ScanCursor. Expected %s visited once, but received %v visits", key, seen[key])
+		}
+	}
+
+	notTmp := func(key []byte, value []byte) bool {
+		return string(value) != "tmp"
+	}
+	for cursor = (Cursor{}); !cursor.Done(); {
+		var out []entry[[]byte]
+		out, cursor = hashmap.ScanCursor(cursor, 4, notTmp)
+		for _, e := range out {
+			if !notTmp(e.Key, e.Value) {
+				t.Fatalf("HashMap.ScanCursor should only return filtered entries, but received %s", e.Value)
+			}
+		}
+	}
+}
+
+func TestHashMap_ShallowClone(t *testing.T) {
+	// Setup
+	hashmap = HashMap[[]byte]{}
+	hashmap.Put([]byte("lorem"), []byte("ipsum"))
+	hashmap.Put([]byte("john"), []byte("doe"))
+
+	// Test
+	clone := hashmap.ShallowClone()
+	hashmap.Put([]byte("lorem"), []byte("dolor"))
+	hashmap.Delete([]byte("john"))
+
+	for key, expected := range map[string]string{"lorem": "ipsum", "john": "doe"} {
+		if value, ok := clone.Get([]byte(key)); !ok || string(value) != expected {
+			t.Errorf("Wrong value on shallow cloned HashMap.Get(%s). Expected %s, but received %s", key, expected, value)
+		}
+	}
+
+	// Values are shared, in-place changes are seen by both
+	value, _ := clone.Get([]byte("john"))
+	value[0] = 'D'
+	clone.Put([]byte("jane"), []byte("foster"))
+	if _, ok := hashmap.Get([]byte("jane")); ok {
+		t.Error("Keys put on the shallow clone should not be seen by the original HashMap")
+	}
+
+	source := HashMap[[]byte]{}
+	source.Put([]byte("lorem"), []byte("ipsum"))
+	shared := source.ShallowClone()
+	stored, _ := source.Get([]byte("lorem"))
+	stored[0] = 'I'
+	if value, _ := shared.Get([]byte("lorem")); string(value) != "Ipsum" {
+		t.Errorf("HashMap.ShallowClone should share values. Expected Ipsum, but received %s", value)
+	}
+}
+
+func TestHashMap_Stats(t *testing.T) {
+	// Setup: keys are hashed by their first digit, "1" and "11" collide,
+	// "b" and "c" share buckets 0 and 1 with "0" and "1" without colliding
+	hm := NewHashMap[int](func(key []byte) uint64 { return uint64(key[0] - '0') })
+	for _, key := range []string{"0", "1", "11", "2", "3", "a"} {
+		hm.Put([]byte(key), 1)
+	}
+	hm.Put([]byte("1"), 2)
+	hm.PutString("11", 3)
+	hm.PutIfAbsent([]byte("2"), 4)
+	hm.Put([]byte("b"), 5)
+	hm.PutIfAbsent([]byte("c"), 6)
+
+	// Test
+	expected := Stats{
+		Buckets:         DefaultTableSize,
+		Entries:         7,
+		MinBucketLen:    0,
+		MaxBucketLen:    2,
+		MeanBucketLen:   0.7,
+		BucketHistogram: map[int]int{0: 5, 1: 3, 2: 2},
+		Collisions:      2,
+	}
+	if got := hm.Stats(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Wrong value on HashMap.Stats. Expected %+v, but received %+v", expected, got)
+	}
+
+	expected.Entries, expected.MaxBucketLen, expected.MeanBucketLen = 0, 0, 0
+	expected.BucketHistogram = map[int]int{0: DefaultTableSize}
+	expected.Collisions = 0
+	if got := (&HashMap[int]{}).Stats(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Wrong value on empty HashMap.Stats. Expected %+v, but received %+v", expected, got)
+	}
+}
+
+func BenchmarkHashMap_Clone(b *testing.B) {
+	// Setup, DefaultTableSize buckets make puts slow on large maps
+	const entries = 100_000
+	source := &HashMap[[]byte]{}
+	for i := 0; i < entries; i++ {
+		source.PutIfAbsent([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i)))
+	}
+
+	benchmarks := []struct {
+		name  string
+		clone func() *HashMap[[]byte]
+	}{
+		{name: "deep", clone: func() *HashMap[[]byte] { return source.Clone(bytes.Clone) }},
+		{name: "shallow", clone: source.ShallowClone},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ResetTimer()
+
+			// Test
+			for n := 0; n < b.N; n++ {
+				bm.clone()
+			}
+
+			b.ReportAllocs()
+		})
+	}
+}
+
+func BenchmarkHashMap_Churn(b *testing.B) {
+	// Setup
+	const entries = 1000
+	keys := make([][]byte, entries)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%v", i))
+	}
+
+	hashMap := &HashMap[int]{}
+	for i := 0; i < entries/2; i++ {
+		hashMap.Put(keys[i], i)
+	}
+	b.ResetTimer()
+
+	// Test sustained puts of new keys and deletes of old ones
+	for n := 0; n < b.N; n++ {
+		hashMap.Put(keys[n%entries], n)
+		hashMap.Delete(keys[(n+entries/2)%entries])
+	}
+
+	b.ReportAllocs()
+}
+
+func TestMap(t *testing.T) {
+	for name, hm := range map[string]Map[string]{
+		"HashMap":         &HashMap[string]{},
+		"LockFreeHashMap": NewLockFreeHashMap[string](nil),
+		"StripedHashMap":  NewStripedHashMap[string](4),
+	} {
+		// Setup
+		hm.Put([]byte("lorem"), "ipsum")
+		hm.Put([]byte("john"), "doe")
+
+		// Test both implementations behave the same through the interface
+		if old, replaced := hm.Put([]byte("lorem"), "dolor"); !replaced || old != "ipsum" {
+			t.Errorf("Wrong value on %s Map.Put overwrite. Expected (ipsum, true), but received (%s, %v)", name, old, replaced)
+		}
+
+		if value, ok := hm.GetString("lorem"); !ok || value != "dolor" {
+			t.Errorf("Wrong value on %s Map.GetString. Expected (dolor, true), but received (%s, %v)", name, value, ok)
+		}
+
+		if value, ok := hm.DeleteOK([]byte("john")); !ok || value != "doe" {
+			t.Errorf("Wrong value on %s Map.DeleteOK. Expected (doe, true), but received (%s, %v)", name, value, ok)
+		}
+
+		hm.Delete([]byte("missing"))
+		ranged := map[string]string{}
+		hm.Range(func(key []byte, value string) bool {
+			ranged[string(key)] = value
+			return true
+		})
+
+		if expected := map[string]string{"lorem": "dolor"}; !reflect.DeepEqual(ranged, expected) || hm.Len() != 1 {
+			t.Errorf("Wrong entries on %s Map.Range. Expected %v in 1 entry, but received %v in %v", name, expected, ranged, hm.Len())
+		}
+
+		if _, ok := hm.Get([]byte("john")); ok {
+			t.Errorf("Wrong value on %s Map.Get of a deleted key. Expected false, but received true", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package hashmap
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// LockFreeHashMap is a hashmap for read-mostly workloads whose reads take no lock
+//
+// Buckets are immutable slices published through atomic pointers: writers
+// serialize on a mutex, copy the bucket they change and swap it in, so readers
+// always see a complete bucket version. Keys are compared by hash like HashMap.
+//
+// Reads cost a hash and a bucket scan, writes also copy one bucket, so writes get
+// slower as buckets grow with DefaultTableSize buckets. Stored keys and values are
+// shared with readers and must not be modified.
+//
+// Unlike HashMap the zero value is not usable, see NewLockFreeHashMap
+type LockFreeHashMap[V any] struct {
+	buckets [DefaultTableSize]atomic.Pointer[[]*entry[V]]
+
+	// Serializes writers, readers never take it
+	mtx sync.Mutex
+
+	// Seed of the stateless maphash functions, safe for concurrent use
+	seed maphash.Seed
+
+	// Hash function replacing maphash, nil to use maphash
+	hashFunc func([]byte) uint64
+
+	// Amount of stored entries
+	length atomic.Int64
+}
+
+var _ Map[any] = (*LockFreeHashMap[any])(nil)
+
+// NewLockFreeHashMap returns an empty lock-free hashmap hashing keys with `hash`,
+//
+// or with hash/maphash when `hash` is nil. A custom hash must be deterministic
+// and safe for concurrent use
+func NewLockFreeHashMap[V any](hash func([]byte) uint64) *LockFreeHashMap[V] {
+	return &LockFreeHashMap[V]{seed: maphash.MakeSeed(), hashFunc: hash}
+}
+
+// Delete removes the entry with key `key` if exists
+func (h *LockFreeHashMap[V]) Delete(key []byte) {
+	h.DeleteOK(key)
+}
+
+// DeleteOK removes the entry with key `key` and returns the removed value
+//
+// and `true` if it existed, otherwise empty `V` and `false`
+func (h *LockFreeHashMap[V]) DeleteOK(key []byte) (V, bool) {
+	sum := h.hashKey(key)
+	bucket := &h.buckets[sum%DefaultTableSize]
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	entries := h.load(bucket)
+	for i, v := range entries {
+		if sum == v.HashKey {
+			updated := make([]*entry[V], 0, len(entries)-1)
+			updated = append(append(updated, entries[:i]...), entries[i+1:]...)
+			bucket.Store(&updated)
+			h.length.Add(-1)
+			return v.Value, true
+		}
+	}
+
+	return *new(V), false
+}
+
+// Get returns the value stored using `key` and `true` if key exists,
+//
+// otherwise empty `V` and `false`. It takes no lock and may run concurrently
+// with writes, seeing each one either fully applied or not at all
+func (h *LockFreeHashMap[V]) Get(key []byte) (V, bool) {
+	return h.get(h.hashKey(key))
+}
+
+// get returns the value of the entry whose hash is `sum` like Get
+func (h *LockFreeHashMap[V]) get(sum uint64) (V, bool) {
+	for _, v := range h.load(&h.buckets[sum%DefaultTableSize]) {
+		if sum == v.HashKey {
+			return v.Value, true
+		}
+	}
+
+	return *new(V), false
+}
+
+// GetString returns the value stored using string key `key` like Get,
+//
+// hashing it without converting it to []byte unless a custom hash is set
+func (h *LockFreeHashMap[V]) GetString(key string) (V, bool) {
+	if h.hashFunc != nil {
+		return h.get(h.hashFunc([]byte(key)))
+	}
+
+	return h.get(maphash.String(h.seed, key))
+}
+
+// hashKey returns the hash of key `k`, computed by the hash function if set
+func (h *LockFreeHashMap[V]) hashKey(k []byte) uint64 {
+	if h.hashFunc != nil {
+		return h.hashFunc(k)
+	}
+
+	return maphash.Bytes(h.seed, k)
+}
+
+// Len returns the amount of stored entries without locking
+func (h *LockFreeHashMap[V]) Len() int {
+	return int(h.length.Load())
+}
+
+// load returns the current version of `bucket`, nil while it was never written
+func (h *LockFreeHashMap[V]) load(bucket *atomic.Pointer[[]*entry[V]]) []*entry[V] {
+	if entries := bucket.Load(); entries != nil {
+		return *entries
+	}
+
+	return nil
+}
+
+// Put stores `value` with specified `key`, publishing a new version of its bucket.
+//
+// returns the replaced value and `true` if key already existed
+//
+// otherwise return empty `V` and `false`
+func (h *LockFreeHashMap[V]) Put(key []byte, value V) (V, bool) {
+	sum := h.hashKey(key)
+	bucket := &h.buckets[sum%DefaultTableSize]
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	entries := h.load(bucket)
+	updated := make([]*entry[V], len(entries), len(entries)+1)
+	copy(updated, entries)
+
+	for i, v := range updated {
+		if sum == v.HashKey {
+			// Entries are immutable once published, replace it with a new one
+			updated[i] = &entry[V]{HashKey: sum, Key: v.Key, Value: value}
+			bucket.Store(&updated)
+			return v.Value, true
+		}
+	}
+
+	updated = append(updated, &entry[V]{HashKey: sum, Key: key, Value: value})
+	bucket.Store(&updated)
+	h.length.Add(1)
+	return *new(V), false
+}
+
+// Range calls `f` for each stored key and value until `f` returns false.
+//
+// It takes no lock: every bucket is read at its current version, so writes
+// made while ranging may or may not be seen. `f` may write to the hashmap
+func (h *LockFreeHashMap[V]) Range(f func(key []byte, value V) bool) {
+	for i := range h.buckets {
+		for _, e := range h.load(&h.buckets[i]) {
+			if !f(e.Key, e.Value) {
+				return
+			}
+		}
+	}
+}
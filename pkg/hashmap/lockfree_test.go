@@ -0,0 +1,229 @@
+package hashmap
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLockFreeHashMap_DeleteOK(t *testing.T) {
+	// Setup
+	hm := NewLockFreeHashMap[string](nil)
+	hm.Put([]byte("lorem"), "ipsum")
+	hm.Put([]byte("john"), "doe")
+
+	// Test
+	if value, ok := hm.DeleteOK([]byte("lorem")); !ok || value != "ipsum" {
+		t.Errorf("Wrong value on LockFreeHashMap.DeleteOK. Expected (ipsum, true), but received (%s, %v)", value, ok)
+	}
+
+	if value, ok := hm.DeleteOK([]byte("lorem")); ok || value != "" {
+		t.Errorf("Wrong value on deleted LockFreeHashMap.DeleteOK. Expected (, false), but received (%s, %v)", value, ok)
+	}
+
+	hm.Delete([]byte("john"))
+	if _, ok := hm.Get([]byte("john")); ok || hm.Len() != 0 {
+		t.Errorf("Wrong value on LockFreeHashMap.Len after deletes. Expected 0, but received %v", hm.Len())
+	}
+}
+
+func TestLockFreeHashMap_Get(t *testing.T) {
+	// Setup
+	hm := NewLockFreeHashMap[string](nil)
+	hm.Put([]byte("lorem"), "ipsum")
+
+	// Test
+	if value, ok := hm.Get([]byte("lorem")); !ok || value != "ipsum" {
+		t.Errorf("Wrong value on LockFreeHashMap.Get. Expected (ipsum, true), but received (%s, %v)", value, ok)
+	}
+
+	if value, ok := hm.GetString("lorem"); !ok || value != "ipsum" {
+		t.Errorf("Wrong value on LockFreeHashMap.GetString. Expected (ipsum, true), but received (%s, %v)", value, ok)
+	}
+
+	if value, ok := hm.Get([]byte("missing")); ok || value != "" {
+		t.Errorf("Wrong value on missing LockFreeHashMap.Get. Expected (, false), but received (%s, %v)", value, ok)
+	}
+
+	// Test custom hash, colliding keys share one entry like HashMap
+	custom := NewLockFreeHashMap[int](func(key []byte) uint64 { return uint64(len(key)) })
+	custom.Put([]byte("lorem"), 1)
+	custom.Put([]byte("ipsum"), 2)
+	if value, ok := custom.GetString("dolor"); !ok || value != 2 || custom.Len() != 1 {
+		t.Errorf("Wrong value on colliding LockFreeHashMap.GetString. Expected (2, true) in 1 entry, but received (%v, %v) in %v", value, ok, custom.Len())
+	}
+}
+
+func TestLockFreeHashMap_Put(t *testing.T) {
+	// Setup
+	hm := NewLockFreeHashMap[string](nil)
+
+	// Test
+	if old, replaced := hm.Put([]byte("lorem"), "ipsum"); replaced || old != "" {
+		t.Errorf("Wrong value on new LockFreeHashMap.Put. Expected (, false), but received (%s, %v)", old, replaced)
+	}
+
+	// Test readers holding an old bucket version keep seeing it
+	before := hm.load(&hm.buckets[hm.hashKey([]byte("lorem"))%DefaultTableSize])
+	if old, replaced := hm.Put([]byte("lorem"), "dolor"); !replaced || old != "ipsum" {
+		t.Errorf("Wrong value on LockFreeHashMap.Put overwrite. Expected (ipsum, true), but received (%s, %v)", old, replaced)
+	}
+
+	if before[0].Value != "ipsum" {
+		t.Errorf("LockFreeHashMap.Put should not modify published entries but got %s", before[0].Value)
+	}
+
+	if value, _ := hm.Get([]byte("lorem")); value != "dolor" || hm.Len() != 1 {
+		t.Errorf("Wrong value on LockFreeHashMap.Get after overwrite. Expected dolor in 1 entry, but received %s in %v", value, hm.Len())
+	}
+}
+
+func TestLockFreeHashMap_Range(t *testing.T) {
+	// Setup
+	hm := NewLockFreeHashMap[string](nil)
+	expected := map[string]string{"lorem": "ipsum", "john": "doe", "jane": "foster"}
+	for key, value := range expected {
+		hm.Put([]byte(key), value)
+	}
+
+	// Test
+	ranged := map[string]string{}
+	hm.Range(func(key []byte, value string) bool {
+		ranged[string(key)] = value
+		return true
+	})
+
+	if !reflect.DeepEqual(ranged, expected) {
+		t.Errorf("Wrong entries on LockFreeHashMap.Range. Expected %v, but received %v", expected, ranged)
+	}
+
+	calls := 0
+	hm.Range(func(key []byte, value string) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("LockFreeHashMap.Range should stop once f returns false but called it %v times", calls)
+	}
+}
+
+func TestLockFreeHashMap_concurrent(t *testing.T) {
+	// Setup: every value is its key, so torn reads are detected
+	const keys = 200
+	hm := NewLockFreeHashMap[string](nil)
+	for i := 0; i < keys; i += 2 {
+		hm.Put([]byte(fmt.Sprint(i)), fmt.Sprint(i))
+	}
+
+	var stop atomic.Bool
+	var readers sync.WaitGroup
+	for r := 0; r < runtime.GOMAXPROCS(0); r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; !stop.Load(); i = (i + 1) % keys {
+				key := fmt.Sprint(i)
+				if value, ok := hm.Get([]byte(key)); ok && value != key {
+					t.Errorf("Wrong value on concurrent LockFreeHashMap.Get(%s). Expected %s, but received %s", key, key, value)
+					return
+				}
+			}
+		}()
+	}
+
+	// Test readers during heavy writes
+	var writers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for n := 0; n < 2000; n++ {
+				key := fmt.Sprint((n*4 + w) % keys)
+				if n%3 == 0 {
+					hm.Delete([]byte(key))
+				} else {
+					hm.Put([]byte(key), key)
+				}
+			}
+		}(w)
+	}
+	writers.Wait()
+	stop.Store(true)
+	readers.Wait()
+
+	stored := 0
+	hm.Range(func(key []byte, value string) bool {
+		stored++
+		return true
+	})
+
+	if stored != hm.Len() {
+		t.Errorf("Wrong value on LockFreeHashMap.Len after concurrent writes. Expected %v, but received %v", stored, hm.Len())
+	}
+}
+
+// benchmarkReadMostly runs a 95% read workload on every goroutine,
+//
+// reading with `get` and writing with `put`
+func benchmarkReadMostly(b *testing.B, keys [][]byte, get func(key []byte), put func(key []byte)) {
+	var goroutines atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		id := int(goroutines.Add(1))
+		for i := id; pb.Next(); i++ {
+			key := keys[i%len(keys)]
+			if i%20 == 0 {
+				put(key)
+			} else {
+				get(key)
+			}
+		}
+	})
+}
+
+func BenchmarkLockFreeHashMap_GetParallel(b *testing.B) {
+	// Setup
+	keys := make([][]byte, BenchmarkEntries*100)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%v", i))
+	}
+
+	b.Run("mutex", func(b *testing.B) {
+		// HashMap reads write the shared hash state, so they need the write lock
+		var mtx sync.Mutex
+		hm := &HashMap[[]byte]{}
+		for _, key := range keys {
+			hm.Put(key, key)
+		}
+		b.ResetTimer()
+
+		// Test
+		benchmarkReadMostly(b, keys, func(key []byte) {
+			mtx.Lock()
+			hm.Get(key)
+			mtx.Unlock()
+		}, func(key []byte) {
+			mtx.Lock()
+			hm.Put(key, key)
+			mtx.Unlock()
+		})
+	})
+
+	b.Run("lockfree", func(b *testing.B) {
+		hm := NewLockFreeHashMap[[]byte](nil)
+		for _, key := range keys {
+			hm.Put(key, key)
+		}
+		b.ResetTimer()
+
+		// Test
+		benchmarkReadMostly(b, keys, func(key []byte) {
+			hm.Get(key)
+		}, func(key []byte) {
+			hm.Put(key, key)
+		})
+	})
+}
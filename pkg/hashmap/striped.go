@@ -0,0 +1,365 @@
+package hashmap
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math/rand"
+)
+
+// StripedHashMap is a hashmap split into stripes, each one a HashMap holding
+//
+// the keys whose hash selects it. Keys are routed with stateless maphash
+// functions, so Stripe may be called concurrently and operations on keys of
+// different stripes touch disjoint state.
+//
+// Like HashMap it is not safe for concurrent use by itself: callers guard each
+// stripe with its own lock, see Stripe, and hold every stripe lock for methods
+// visiting the whole hashmap such as Range, Scan or Stats.
+//
+// The zero value is usable and holds a single stripe, see NewStripedHashMap
+type StripedHashMap[V any] struct {
+	// First stripe, the only one of the zero value
+	first HashMap[V]
+
+	// Stripes past the first, nil with a single stripe
+	rest []HashMap[V]
+
+	// Seed of the stateless maphash routing keys to stripes
+	seed maphash.Seed
+
+	// Stripe the next Scan resumes from
+	next int
+}
+
+var _ Map[any] = (*StripedHashMap[any])(nil)
+
+// NewStripedHashMap returns an empty hashmap split into `stripes` stripes,
+//
+// or a single one when `stripes` is less than 2
+func NewStripedHashMap[V any](stripes int) *StripedHashMap[V] {
+	h := &StripedHashMap[V]{}
+	if stripes > 1 {
+		h.rest = make([]HashMap[V], stripes-1)
+		h.seed = maphash.MakeSeed()
+	}
+
+	return h
+}
+
+// at returns stripe `i`
+func (h *StripedHashMap[V]) at(i int) *HashMap[V] {
+	if i == 0 {
+		return &h.first
+	}
+
+	return &h.rest[i-1]
+}
+
+// BucketHistogram returns how many buckets of all stripes have each bucket length
+//
+// like HashMap.BucketHistogram
+func (h *StripedHashMap[V]) BucketHistogram() map[int]int {
+	histogram := map[int]int{}
+	for i := 0; i < h.Stripes(); i++ {
+		for length, buckets := range h.at(i).BucketHistogram() {
+			histogram[length] += buckets
+		}
+	}
+
+	return histogram
+}
+
+// CheckInvariants verifies the invariants of every stripe like
+//
+// HashMap.CheckInvariants and that every key is stored in its stripe.
+// Returns every violation joined, nil if none
+func (h *StripedHashMap[V]) CheckInvariants() error {
+	var errs []error
+	for i := 0; i < h.Stripes(); i++ {
+		stripe := h.at(i)
+		if err := stripe.CheckInvariants(); err != nil {
+			errs = append(errs, err)
+		}
+
+		stripe.Range(func(key []byte, _ V) bool {
+			if expected := h.Stripe(key); expected != i {
+				errs = append(errs, fmt.Errorf("hashmap: key %q stored in stripe %d instead of %d", key, i, expected))
+			}
+			return true
+		})
+	}
+
+	return errors.Join(errs...)
+}
+
+// Clear removes every entry of every stripe, keeping the stripes and the
+//
+// routing of keys to them, so Stripe may run concurrently with it
+func (h *StripedHashMap[V]) Clear() {
+	for i := 0; i < h.Stripes(); i++ {
+		*h.at(i) = HashMap[V]{}
+	}
+	h.next = 0
+}
+
+// Clone returns a copy of the hashmap copying keys, and values with `copier`,
+//
+// stripe by stripe like HashMap.Clone. The clone routes keys to stripes like
+// the original and is independent of it
+func (h *StripedHashMap[V]) Clone(copier func(V) V) *StripedHashMap[V] {
+	clone := &StripedHashMap[V]{first: *h.first.Clone(copier), seed: h.seed, next: h.next}
+	if h.rest != nil {
+		clone.rest = make([]HashMap[V], len(h.rest))
+		for i := range h.rest {
+			clone.rest[i] = *h.rest[i].Clone(copier)
+		}
+	}
+
+	return clone
+}
+
+// Compact shrinks the buckets of every stripe like HashMap.Compact
+func (h *StripedHashMap[V]) Compact() {
+	for i := 0; i < h.Stripes(); i++ {
+		h.at(i).Compact()
+	}
+}
+
+// Delete removes the entry with key `key` if exists
+func (h *StripedHashMap[V]) Delete(key []byte) {
+	h.DeleteOK(key)
+}
+
+// DeleteOK removes the entry with key `key` from its stripe if exists
+//
+// returns the removed value and `true` if key existed
+//
+// otherwise return empty `V` and `false`
+func (h *StripedHashMap[V]) DeleteOK(key []byte) (V, bool) {
+	return h.at(h.Stripe(key)).DeleteOK(key)
+}
+
+// Get returns the value stored using `key` in its stripe.
+//
+// returns value of type `V` and `true` if key exists
+//
+// otherwise return empty `V` and `false`
+func (h *StripedHashMap[V]) Get(key []byte) (V, bool) {
+	return h.at(h.Stripe(key)).Get(key)
+}
+
+// GetAll returns all stored entries of every stripe as an array of `entry[V]`.
+//
+// returns an empty slice if no values are found
+func (h *StripedHashMap[V]) GetAll() []entry[V] {
+	values := make([]entry[V], 0, h.Len())
+	for i := 0; i < h.Stripes(); i++ {
+		values = append(values, h.at(i).GetAll()...)
+	}
+
+	return values
+}
+
+// GetString returns the value stored using string key `key` like Get,
+//
+// hashing it without converting it to []byte
+func (h *StripedHashMap[V]) GetString(key string) (V, bool) {
+	return h.at(h.StripeString(key)).GetString(key)
+}
+
+// Len returns the amount of stored entries, counting every stripe
+func (h *StripedHashMap[V]) Len() int {
+	var entries int
+	for i := 0; i < h.Stripes(); i++ {
+		entries += h.at(i).Len()
+	}
+
+	return entries
+}
+
+// LoadFactor returns the amount of stored entries divided by the amount
+//
+// of buckets of all stripes
+func (h *StripedHashMap[V]) LoadFactor() float64 {
+	return float64(h.Len()) / float64(h.Stripes()*DefaultTableSize)
+}
+
+// Lookup returns the key and value stored using `key` like HashMap.Lookup.
+//
+// returns `false` if key does not exist
+func (h *StripedHashMap[V]) Lookup(key []byte) ([]byte, V, bool) {
+	return h.at(h.Stripe(key)).Lookup(key)
+}
+
+// Put stores `value` into the stripe of `key`
+//
+// returns the replaced value and `true` if key already existed
+//
+// otherwise return empty `V` and `false`
+func (h *StripedHashMap[V]) Put(key []byte, value V) (V, bool) {
+	return h.at(h.Stripe(key)).Put(key, value)
+}
+
+// Range calls `f` for each stored key and value, stripe by stripe,
+//
+// until `f` returns false. Iteration order is unspecified and `f` must not
+// modify the hashmap
+func (h *StripedHashMap[V]) Range(f func(key []byte, value V) bool) {
+	for i := 0; i < h.Stripes(); i++ {
+		keepGoing := true
+		h.at(i).Range(func(key []byte, value V) bool {
+			keepGoing = f(key, value)
+			return keepGoing
+		})
+
+		if !keepGoing {
+			return
+		}
+	}
+}
+
+// Sample returns up to `n` entries chosen uniformly at random among those
+//
+// of all stripes for which `filter` returns true, or among all entries if
+// `filter` is nil, like HashMap.Sample
+func (h *StripedHashMap[V]) Sample(n int, filter func(key []byte, value V) bool) []entry[V] {
+	sample := make([]entry[V], 0, max(n, 0))
+	var matched int
+	for i := 0; i < h.Stripes(); i++ {
+		stripe := h.at(i)
+		sample, matched, _ = stripe.sample(sample, matched, n, 0, stripe.Len(), filter)
+	}
+
+	return sample
+}
+
+// SampleWindow returns up to `n` entries chosen uniformly at random among those
+//
+// of `window` consecutive entries of all stripes, starting at a random position
+// and wrapping from the last stripe to the first, for which `filter` returns
+// true, or among all of them if `filter` is nil, like HashMap.SampleWindow
+func (h *StripedHashMap[V]) SampleWindow(n, window int, filter func(key []byte, value V) bool) []entry[V] {
+	sample := make([]entry[V], 0, max(n, 0))
+	total := h.Len()
+	if total == 0 || window <= 0 {
+		return sample
+	}
+
+	var matched, visited int
+	skip, left := rand.Intn(total), min(window, total)
+	for i := 0; left > 0; i = (i + 1) % h.Stripes() {
+		stripe := h.at(i)
+		if length := stripe.Len(); skip >= length {
+			skip -= length
+			continue
+		}
+
+		sample, matched, visited = stripe.sample(sample, matched, n, skip, left, filter)
+		skip, left = 0, left-visited
+	}
+
+	return sample
+}
+
+// Scan returns up to `n` entries for which `filter` returns true, or any entries
+//
+// if `filter` is nil, like HashMap.Scan. Stripes are scanned one after the
+// other from their own position, so repeated calls visit every entry of every
+// stripe once before revisiting any
+func (h *StripedHashMap[V]) Scan(n int, filter func(key []byte, value V) bool) []entry[V] {
+	scan := make([]entry[V], 0, max(n, 0))
+	left := h.Len()
+	for left > 0 && len(scan) < n {
+		stripe := h.at(h.next)
+		tail := stripe.Len() - stripe.cursor
+		if tail <= 0 {
+			stripe.cursor = 0
+			h.next = (h.next + 1) % h.Stripes()
+			continue
+		}
+
+		var visited int
+		scan, visited = stripe.scan(scan, n, min(tail, left), filter)
+		left -= visited
+
+		// The stripe cursor wrapped, the next Scan resumes from the next stripe
+		if stripe.cursor == 0 {
+			h.next = (h.next + 1) % h.Stripes()
+		}
+	}
+
+	return scan
+}
+
+// ScanCursor returns up to `n` entries for which `filter` returns true, or any
+//
+// entries if `filter` is nil, starting at `cursor`, with the cursor the next
+// call resumes from, like HashMap.ScanCursor. Stripes are visited one after
+// the other, so a cursor is only valid for the hashmap that returned it
+func (h *StripedHashMap[V]) ScanCursor(cursor Cursor, n int, filter func(key []byte, value V) bool) ([]entry[V], Cursor) {
+	scan := make([]entry[V], 0, max(n, 0))
+	for {
+		stripe := cursor.stripe
+		scan, cursor = h.at(stripe).scanCursor(scan, cursor, n, filter)
+		cursor.stripe = stripe
+		if !cursor.Done() || stripe == h.Stripes()-1 {
+			return scan, cursor
+		}
+
+		cursor = Cursor{stripe: stripe + 1}
+		if len(scan) >= n {
+			return scan, cursor
+		}
+	}
+}
+
+// Stats returns the bucket distribution of all stripes and the amount of hash
+//
+// collisions detected by writes like HashMap.Stats, Buckets counting the
+// buckets of every stripe
+func (h *StripedHashMap[V]) Stats() Stats {
+	stats := h.first.Stats()
+	for i := 1; i < h.Stripes(); i++ {
+		stripe := h.at(i).Stats()
+		stats.Buckets += stripe.Buckets
+		stats.Entries += stripe.Entries
+		stats.MinBucketLen = min(stats.MinBucketLen, stripe.MinBucketLen)
+		stats.MaxBucketLen = max(stats.MaxBucketLen, stripe.MaxBucketLen)
+		stats.Collisions += stripe.Collisions
+		for length, buckets := range stripe.BucketHistogram {
+			stats.BucketHistogram[length] += buckets
+		}
+	}
+	stats.MeanBucketLen = float64(stats.Entries) / float64(stats.Buckets)
+
+	return stats
+}
+
+// Stripe returns the index of the stripe storing `key`, from 0 to Stripes() - 1.
+//
+// It keeps no state and is safe for concurrent use, so callers can pick the
+// lock guarding `key` before touching the hashmap
+func (h *StripedHashMap[V]) Stripe(key []byte) int {
+	if h.rest == nil {
+		return 0
+	}
+
+	return int(maphash.Bytes(h.seed, key) % uint64(h.Stripes()))
+}
+
+// Stripes returns the amount of stripes
+func (h *StripedHashMap[V]) Stripes() int {
+	return len(h.rest) + 1
+}
+
+// StripeString returns the index of the stripe storing string key `key`
+//
+// like Stripe, hashing it without converting it to []byte
+func (h *StripedHashMap[V]) StripeString(key string) int {
+	if h.rest == nil {
+		return 0
+	}
+
+	return int(maphash.String(h.seed, key) % uint64(h.Stripes()))
+}
@@ -0,0 +1,361 @@
+package hashmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// newStripedHashMap returns a hashmap split into `stripes` stripes
+//
+// holding keys key0 to key<n-1> with values value0 to value<n-1>
+func newStripedHashMap(stripes, n int) *StripedHashMap[[]byte] {
+	hm := NewStripedHashMap[[]byte](stripes)
+	for i := 0; i < n; i++ {
+		hm.Put([]byte(fmt.Sprintf("key%v", i)), []byte(fmt.Sprintf("value%v", i)))
+	}
+
+	return hm
+}
+
+func TestNewStripedHashMap(t *testing.T) {
+	for stripes, expected := range map[int]int{-1: 1, 0: 1, 1: 1, 2: 2, 256: 256} {
+		if hm := NewStripedHashMap[string](stripes); hm.Stripes() != expected {
+			t.Errorf("Wrong value on NewStripedHashMap(%v).Stripes. Expected %v, but received %v", stripes, expected, hm.Stripes())
+		}
+	}
+
+	// The zero value holds a single stripe
+	var hm StripedHashMap[string]
+	hm.Put([]byte("lorem"), "ipsum")
+	if value, ok := hm.Get([]byte("lorem")); !ok || value != "ipsum" || hm.Stripes() != 1 || hm.Stripe([]byte("lorem")) != 0 {
+		t.Errorf("Wrong value on zero StripedHashMap. Expected (ipsum, true) in 1 stripe, but received (%s, %v) in %v", value, ok, hm.Stripes())
+	}
+}
+
+func TestStripedHashMap_CheckInvariants(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+
+	// Test
+	if err := hm.CheckInvariants(); err != nil {
+		t.Errorf("Wrong value on StripedHashMap.CheckInvariants. Expected nil, but received %v", err)
+	}
+
+	// Store a key in a stripe that does not own it
+	key := []byte("key0")
+	wrong := (hm.Stripe(key) + 1) % hm.Stripes()
+	hm.at(wrong).Put(key, []byte("misplaced"))
+	if err := hm.CheckInvariants(); err == nil {
+		t.Error("Wrong value on StripedHashMap.CheckInvariants of a misplaced key. Expected an error, but received nil")
+	}
+}
+
+func TestStripedHashMap_Clear(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+	stripe := hm.Stripe([]byte("key0"))
+
+	// Test
+	hm.Clear()
+	if hm.Len() != 0 || hm.Stripes() != 8 {
+		t.Errorf("Wrong value on StripedHashMap.Clear. Expected 0 entries in 8 stripes, but received %v in %v", hm.Len(), hm.Stripes())
+	}
+
+	if hm.Stripe([]byte("key0")) != stripe {
+		t.Errorf("Wrong value on StripedHashMap.Stripe after Clear. Expected %v, but received %v", stripe, hm.Stripe([]byte("key0")))
+	}
+}
+
+func TestStripedHashMap_Clone(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+
+	// Test
+	clone := hm.Clone(func(value []byte) []byte { return append([]byte("copy of "), value...) })
+	hm.Put([]byte("key0"), []byte("changed"))
+	hm.Delete([]byte("key1"))
+	hm.Put([]byte("other"), []byte("value"))
+
+	if clone.Len() != 100 || clone.Stripes() != 8 {
+		t.Errorf("Wrong value on StripedHashMap.Clone. Expected 100 entries in 8 stripes, but received %v in %v", clone.Len(), clone.Stripes())
+	}
+
+	for _, key := range []string{"key0", "key1", "key99"} {
+		if value, ok := clone.Get([]byte(key)); !ok || string(value) != "copy of value"+key[3:] {
+			t.Errorf("Wrong value on cloned StripedHashMap.Get(%s). Expected copy of value%s, but received %s", key, key[3:], value)
+		}
+	}
+
+	if _, ok := clone.Get([]byte("other")); ok {
+		t.Error("Keys put on the original StripedHashMap should not be seen by the clone")
+	}
+
+	if err := clone.CheckInvariants(); err != nil {
+		t.Errorf("Clone should keep routing keys like the original but got %v", err)
+	}
+}
+
+func TestStripedHashMap_Put(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+
+	// Test every key is stored in its stripe only
+	used := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%v", i))
+		stripe := hm.Stripe(key)
+		if hm.StripeString(string(key)) != stripe {
+			t.Errorf("Wrong value on StripedHashMap.StripeString(%s). Expected %v, but received %v", key, stripe, hm.StripeString(string(key)))
+		}
+
+		used[stripe] = true
+		if _, ok := hm.at(stripe).Get(key); !ok {
+			t.Errorf("Wrong value on StripedHashMap.Put. Expected %s in stripe %v, but it was not", key, stripe)
+		}
+
+		if value, ok := hm.GetString(string(key)); !ok || string(value) != fmt.Sprintf("value%v", i) {
+			t.Errorf("Wrong value on StripedHashMap.GetString(%s). Expected (value%v, true), but received (%s, %v)", key, i, value, ok)
+		}
+	}
+
+	if len(used) < 2 {
+		t.Errorf("Wrong value on StripedHashMap.Stripe. Expected keys spread over several stripes, but received %v", len(used))
+	}
+
+	if hm.Len() != 100 || len(hm.GetAll()) != 100 {
+		t.Errorf("Wrong value on StripedHashMap.Len. Expected 100, but received %v with %v entries", hm.Len(), len(hm.GetAll()))
+	}
+
+	if old, replaced := hm.Put([]byte("key7"), []byte("overwritten")); !replaced || string(old) != "value7" || hm.Len() != 100 {
+		t.Errorf("Wrong value on StripedHashMap.Put overwrite. Expected (value7, true), but received (%s, %v)", old, replaced)
+	}
+
+	if value, ok := hm.DeleteOK([]byte("key7")); !ok || string(value) != "overwritten" || hm.Len() != 99 {
+		t.Errorf("Wrong value on StripedHashMap.DeleteOK. Expected (overwritten, true), but received (%s, %v)", value, ok)
+	}
+}
+
+func TestStripedHashMap_Range(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+
+	// Test
+	seen := map[string]bool{}
+	hm.Range(func(key []byte, _ []byte) bool {
+		seen[string(key)] = true
+		return true
+	})
+
+	if len(seen) != 100 {
+		t.Errorf("Wrong value on StripedHashMap.Range. Expected 100 keys, but received %v", len(seen))
+	}
+
+	calls := 0
+	hm.Range(func(key []byte, _ []byte) bool {
+		calls++
+		return calls < 3
+	})
+
+	if calls != 3 {
+		t.Errorf("StripedHashMap.Range should stop once f returns false but called it %v times", calls)
+	}
+}
+
+func TestStripedHashMap_Sample(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+
+	// Test
+	sample := hm.Sample(10, nil)
+	seen := map[string]bool{}
+	for _, e := range sample {
+		seen[string(e.Key)] = true
+	}
+
+	if len(sample) != 10 || len(seen) != 10 {
+		t.Errorf("Wrong value on StripedHashMap.Sample. Expected 10 distinct entries, but received %v with %v distinct", len(sample), len(seen))
+	}
+
+	odd := func(key []byte, _ []byte) bool {
+		return key[len(key)-1]%2 == 1
+	}
+	for _, e := range hm.Sample(100, odd) {
+		if !odd(e.Key, e.Value) {
+			t.Fatalf("StripedHashMap.Sample should only return filtered entries, but received %s", e.Key)
+		}
+	}
+
+	if out := hm.Sample(100, odd); len(out) != 50 {
+		t.Errorf("Wrong value on StripedHashMap.Sample of every match. Expected 50, but received %v", len(out))
+	}
+}
+
+func TestStripedHashMap_SampleWindow(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 100)
+
+	// Test
+	if out := NewStripedHashMap[[]byte](8).SampleWindow(5, 10, nil); out == nil || len(out) != 0 {
+		t.Errorf("Wrong value on empty StripedHashMap.SampleWindow. Expected empty slice, but received %#v", out)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		visited := map[string]bool{}
+		out := hm.SampleWindow(5, 20, func(key []byte, _ []byte) bool {
+			visited[string(key)] = true
+			return true
+		})
+
+		if len(visited) != 20 || len(out) != 5 {
+			t.Fatalf("StripedHashMap.SampleWindow should visit 20 distinct entries and sample 5, but received %v and %v", len(visited), len(out))
+		}
+
+		for _, e := range out {
+			if !visited[string(e.Key)] {
+				t.Fatalf("StripedHashMap.SampleWindow should only return visited entries, but received %s", e.Key)
+			}
+			seen[string(e.Key)] = true
+		}
+	}
+
+	// Windows wrap across stripes from random positions, 200 samples of 5 cover most of the 100 entries
+	if len(seen) < 90 {
+		t.Errorf("StripedHashMap.SampleWindow should be random. Expected at least 90 entries sampled, but received %v", len(seen))
+	}
+}
+
+func TestStripedHashMap_Scan(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 23)
+
+	// Test
+	if out := NewStripedHashMap[[]byte](8).Scan(5, nil); out == nil || len(out) != 0 {
+		t.Errorf("Wrong value on empty StripedHashMap.Scan. Expected empty slice, but received %#v", out)
+	}
+
+	// Every entry is visited once per pass across stripes, so 23 calls of 3
+	// entries visit every entry 3 times
+	seen := map[string]int{}
+	for i := 0; i < 23; i++ {
+		out := hm.Scan(3, nil)
+		if len(out) != 3 {
+			t.Fatalf("Wrong value on StripedHashMap.Scan length. Expected 3, but received %v", len(out))
+		}
+		for _, e := range out {
+			seen[string(e.Key)]++
+		}
+	}
+
+	for i := 0; i < 23; i++ {
+		if key := fmt.Sprintf("key%v", i); seen[key] != 3 {
+			t.Errorf("Wrong value on StripedHashMap.Scan. Expected %s visited 3 times, but received %v visits", key, seen[key])
+		}
+	}
+
+	if out := hm.Scan(100, nil); len(out) != 23 {
+		t.Errorf("Wrong value on StripedHashMap.Scan of more than stored. Expected 23, but received %v", len(out))
+	}
+}
+
+func TestStripedHashMap_ScanCursor(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(8, 23)
+
+	// Test
+	if out, cursor := NewStripedHashMap[[]byte](8).ScanCursor(Cursor{}, 5, nil); len(out) != 0 || !cursor.Done() {
+		t.Errorf("Wrong value on empty StripedHashMap.ScanCursor. Expected no entries and a done cursor, but received %#v, %#v", out, cursor)
+	}
+
+	// Stable keys are visited once despite puts and deletes between calls
+	seen := map[string]int{}
+	var cursor Cursor
+	for i := 0; !cursor.Done(); i++ {
+		if i > 200 {
+			t.Fatalf("StripedHashMap.ScanCursor should terminate, but did not after %v calls", i)
+		}
+
+		var out []entry[[]byte]
+		out, cursor = hm.ScanCursor(cursor, 3, nil)
+		if len(out) > 3 {
+			t.Errorf("Wrong value on StripedHashMap.ScanCursor length. Expected at most 3, but received %v", len(out))
+		}
+		for _, e := range out {
+			seen[string(e.Key)]++
+		}
+
+		hm.Put([]byte(fmt.Sprintf("tmp%v", i)), []byte("tmp"))
+		hm.Delete([]byte(fmt.Sprintf("tmp%v", i-1)))
+	}
+
+	for i := 0; i < 23; i++ {
+		if key := fmt.Sprintf("key%v", i); seen[key] != 1 {
+			t.Errorf("Wrong value on StripedHashMap.ScanCursor. Expected %s visited once, but received %v visits", key, seen[key])
+		}
+	}
+}
+
+func TestStripedHashMap_Stats(t *testing.T) {
+	// Setup
+	hm := newStripedHashMap(4, 100)
+
+	// Test
+	stats := hm.Stats()
+	if stats.Buckets != 4*DefaultTableSize || stats.Entries != 100 {
+		t.Errorf("Wrong value on StripedHashMap.Stats. Expected %v buckets and 100 entries, but received %v and %v", 4*DefaultTableSize, stats.Buckets, stats.Entries)
+	}
+
+	var buckets int
+	for _, amount := range hm.BucketHistogram() {
+		buckets += amount
+	}
+
+	if buckets != stats.Buckets || hm.LoadFactor() != 100.0/float64(stats.Buckets) {
+		t.Errorf("Wrong value on StripedHashMap.LoadFactor. Expected %v, but received %v over %v buckets", 100.0/float64(stats.Buckets), hm.LoadFactor(), buckets)
+	}
+}
+
+func TestStripedHashMap_concurrent(t *testing.T) {
+	// Setup: one lock per stripe, like a cache with striped locking
+	hm := NewStripedHashMap[string](16)
+	locks := make([]sync.Mutex, hm.Stripes())
+
+	// Test writers of disjoint keys only share the locks of their stripes
+	var writers sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for n := 0; n < 500; n++ {
+				key := []byte(fmt.Sprintf("w%v-%v", w, n%50))
+				stripe := hm.Stripe(key)
+				locks[stripe].Lock()
+				if n%3 == 0 {
+					hm.Delete(key)
+				} else {
+					hm.Put(key, string(key))
+				}
+				locks[stripe].Unlock()
+			}
+		}(w)
+	}
+	writers.Wait()
+
+	if err := hm.CheckInvariants(); err != nil {
+		t.Errorf("Wrong value on StripedHashMap.CheckInvariants after concurrent writes. Expected nil, but received %v", err)
+	}
+
+	stored := 0
+	hm.Range(func(key []byte, value string) bool {
+		if string(key) != value {
+			t.Errorf("Wrong value on StripedHashMap.Get(%s) after concurrent writes. Expected %s, but received %s", key, key, value)
+		}
+		stored++
+		return true
+	})
+
+	if stored != hm.Len() {
+		t.Errorf("Wrong value on StripedHashMap.Len after concurrent writes. Expected %v, but received %v", stored, hm.Len())
+	}
+}